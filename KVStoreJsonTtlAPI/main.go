@@ -1,12 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang-learning/pkg/kvconfig"
+	"golang-learning/pkg/kvserver"
+	"golang-learning/pkg/kvstore"
 )
 
 func main() {
-	store := NewKVStore()
-	s := NewServer(store)
-	log.Fatal(http.ListenAndServe(":8080", s.mux))
+	cfg, err := kvconfig.Load(os.Args[0], os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then drains requests in flight and
+// stops the reaper.
+func run(cfg kvconfig.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store := kvstore.NewTTLStore().WithCleanupInterval(cfg.CleanupInterval)
+	defer store.Stop()
+
+	api := kvserver.NewServer(store).WithLimits(kvserver.Limits{
+		MaxBodyBytes:  cfg.MaxBodyBytes,
+		MaxKeyBytes:   int(cfg.MaxKeyBytes),
+		MaxValueBytes: int(cfg.MaxValueBytes),
+		Rate:          cfg.RateLimit,
+		Burst:         int(cfg.RateBurst),
+	})
+	if cfg.AuthFile != "" {
+		auth, err := kvserver.LoadAuthConfig(cfg.AuthFile)
+		if err != nil {
+			return err
+		}
+		api.WithAuth(auth.Authenticator(), auth.ACL)
+	}
+
+	srv, err := cfg.HTTPServer(api)
+	if err != nil {
+		return err
+	}
+	log.Printf("listening on %s", cfg.Addr)
+	return cfg.ListenAndServe(ctx, srv)
 }
@@ -1,12 +1,172 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang-learning/pkg/kvconfig"
+	"golang-learning/pkg/kvserver"
+	"golang-learning/pkg/kvstore"
+	"golang-learning/pkg/raft"
+	"golang-learning/pkg/respserver"
 )
 
 func main() {
-	store := NewKVStore()
-	s := NewServer(store)
-	log.Fatal(http.ListenAndServe(":8080", s.mux))
+	cfg, err := kvconfig.Load(os.Args[0], os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then drains requests in flight and
+// stops the store, which writes a final snapshot. With -raft-id, the store
+// is instead replicated to the other members of a Raft cluster, whose log
+// and snapshots are kept in -raft-dir.
+func run(cfg kvconfig.Config) error {
+	if cfg.AuthFile != "" && cfg.RESPAddr != "" {
+		return errors.New("the Redis protocol server has no authentication; disable it with -resp-addr= to use -auth-file")
+	}
+	if cfg.RaftID != 0 && cfg.RESPAddr != "" {
+		return errors.New("the Redis protocol server cannot serve linearizable reads; disable it with -resp-addr= to use -raft-id")
+	}
+	if cfg.RaftID != 0 && cfg.Follow != "" {
+		return errors.New("a member of a Raft cluster cannot also follow a primary; use either -raft-id or -follow")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var store kvstore.Store
+	if cfg.RaftID != 0 {
+		cluster, leave, err := joinCluster(ctx, stop, cfg)
+		if err != nil {
+			return err
+		}
+		defer leave()
+		store = cluster
+	} else {
+		persistent, err := kvstore.NewPersistentStore().
+			WithSnapshotFile(cfg.SnapshotFile).
+			WithWALFile(cfg.WALFile).
+			WithSaveInterval(cfg.SaveInterval).
+			WithCleanupInterval(cfg.CleanupInterval).
+			Initialize()
+		if err != nil {
+			return err
+		}
+		// Deferred first so it runs last, once nothing can write any more.
+		defer persistent.Stop()
+		store = persistent
+	}
+
+	limits := kvserver.Limits{
+		MaxBodyBytes:  cfg.MaxBodyBytes,
+		MaxKeyBytes:   int(cfg.MaxKeyBytes),
+		MaxValueBytes: int(cfg.MaxValueBytes),
+		Rate:          cfg.RateLimit,
+		Burst:         int(cfg.RateBurst),
+	}
+
+	// Serve the Redis protocol alongside the HTTP API on the same store,
+	// with the same limits.
+	if cfg.RESPAddr != "" {
+		resp := respserver.NewServer(store).WithLimits(limits)
+		defer resp.Close()
+		go func() {
+			if err := resp.ListenAndServe(cfg.RESPAddr); !errors.Is(err, respserver.ErrServerClosed) {
+				log.Printf("resp server: %v", err)
+				stop()
+			}
+		}()
+	}
+
+	api := kvserver.NewServer(store).WithLimits(limits)
+	if cfg.AuthFile != "" {
+		auth, err := kvserver.LoadAuthConfig(cfg.AuthFile)
+		if err != nil {
+			return err
+		}
+		api.WithAuth(auth.Authenticator(), auth.ACL)
+	}
+
+	// A follower takes its contents from the primary and refuses writes
+	// until it is promoted.
+	if cfg.Follow != "" {
+		follower := kvserver.NewFollower(store.(*kvstore.PersistentStore), cfg.Follow).WithToken(cfg.FollowToken)
+		api.WithFollower(follower)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := follower.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("follower: %v", err)
+			}
+		}()
+		// Stop following before the store stops.
+		defer func() {
+			stop()
+			<-done
+		}()
+		log.Printf("following %s", cfg.Follow)
+	}
+
+	srv, err := cfg.HTTPServer(api)
+	if err != nil {
+		return err
+	}
+	log.Printf("listening on %s", cfg.Addr)
+	return cfg.ListenAndServe(ctx, srv)
+}
+
+// joinCluster starts the member cfg.RaftID of a Raft cluster, which runs
+// until ctx is done or it fails, when it calls stop. Call leave once the
+// server has shut down.
+func joinCluster(ctx context.Context, stop func(), cfg kvconfig.Config) (*kvstore.RaftStore, func(), error) {
+	peers, err := cfg.Peers()
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := raft.OpenFileStorage(cfg.RaftDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := kvserver.NewRaftTransport().WithToken(cfg.RaftToken)
+
+	store, err := kvstore.NewRaftStore(raft.Config{ID: cfg.RaftID, Peers: peers, Join: cfg.RaftJoin, Storage: storage}, transport)
+	if err != nil {
+		transport.Close()
+		storage.Close()
+		return nil, nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := store.Run(runCtx); err != nil && runCtx.Err() == nil {
+			log.Printf("raft: %v", err)
+			stop()
+		}
+	}()
+	log.Printf("raft member %d in %s", cfg.RaftID, cfg.RaftDir)
+
+	leave := func() {
+		cancel()
+		<-done
+		transport.Close()
+		store.Stop()
+		storage.Close()
+	}
+	return store, leave, nil
 }
@@ -0,0 +1,374 @@
+// Package kvconfig configures and runs the KV server binaries. Settings
+// come from, in increasing order of precedence, built-in defaults, a JSON
+// config file, KV_* environment variables and command-line flags.
+package kvconfig
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+// Config holds the settings of a KV server binary.
+type Config struct {
+	Addr     string // HTTP listen address
+	RESPAddr string // Redis protocol listen address, empty to disable
+
+	SnapshotFile    string
+	WALFile         string // Empty disables the write-ahead log
+	SaveInterval    time.Duration
+	CleanupInterval time.Duration // How often the reaper runs
+
+	AuthFile string // Credentials and ACLs of the HTTP API, empty to allow anyone
+
+	Follow      string // Base URL of the primary to replicate from, empty to be a primary
+	FollowToken string // Bearer token to authenticate to the primary with
+
+	RaftID    uint64 // ID of this server in a Raft cluster, zero to not be in one
+	RaftPeers string // Members of the cluster, as id=URL,...
+	RaftDir   string // Where the Raft log and snapshots are kept
+	RaftJoin  bool   // Join the running cluster of RaftPeers rather than start one
+	RaftToken string // Bearer token to authenticate to the other members with
+
+	TLSCertFile  string // Serve HTTPS with this certificate and TLSKeyFile
+	TLSKeyFile   string
+	ClientCAFile string             // CAs that client certificates are verified against
+	ClientAuth   tls.ClientAuthType // Whether clients must present a certificate
+	H2C          bool               // Accept HTTP/2 without TLS, with prior knowledge
+
+	MaxBodyBytes  int64 // Zero for no limit, as for the other limits
+	MaxKeyBytes   int64
+	MaxValueBytes int64
+	RateLimit     float64 // Requests per second per client
+	RateBurst     int64
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration // Zero by default, as it would end streams too; ReadHeaderTimeout bounds slow clients
+	WriteTimeout      time.Duration // Zero by default so /watch can stream
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // How long to drain requests on exit
+}
+
+// Default returns the settings used for anything not configured.
+func Default() Config {
+	return Config{
+		Addr:              ":8080",
+		RESPAddr:          ":6379",
+		SnapshotFile:      "store.snapshot.json",
+		SaveInterval:      5 * time.Second,
+		CleanupInterval:   100 * time.Millisecond,
+		RaftDir:           "raft",
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   30 * time.Second,
+		MaxBodyBytes:      16 << 20,
+		RateBurst:         1,
+	}
+}
+
+// Peers returns the members of the cluster in RaftPeers.
+func (c Config) Peers() ([]raft.Peer, error) {
+	return parsePeers(c.RaftPeers)
+}
+
+func parsePeers(s string) ([]raft.Peer, error) {
+	var peers []raft.Peer
+	for _, member := range strings.Split(s, ",") {
+		if member = strings.TrimSpace(member); member == "" {
+			continue
+		}
+		id, addr, ok := strings.Cut(member, "=")
+		n, err := strconv.ParseUint(id, 10, 64)
+		if !ok || err != nil || n == 0 || addr == "" {
+			return nil, fmt.Errorf("invalid member %q, want id=URL", member)
+		}
+		for _, p := range peers {
+			if p.ID == n {
+				return nil, fmt.Errorf("member %d given twice", n)
+			}
+		}
+		peers = append(peers, raft.Peer{ID: n, Addr: addr})
+	}
+	return peers, nil
+}
+
+// option is a setting that can be given as a flag, an environment
+// variable or a key of the config file. The flag and the file key share
+// a name.
+type option struct {
+	name  string
+	env   string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+var options = []option{
+	{"addr", "KV_ADDR", "HTTP listen `address`", func(c *Config) flag.Value { return (*stringValue)(&c.Addr) }},
+	{"resp-addr", "KV_RESP_ADDR", "Redis protocol listen `address`, empty to disable", func(c *Config) flag.Value { return (*stringValue)(&c.RESPAddr) }},
+	{"snapshot-file", "KV_SNAPSHOT_FILE", "snapshot `file` of the persistent store", func(c *Config) flag.Value { return (*stringValue)(&c.SnapshotFile) }},
+	{"wal-file", "KV_WAL_FILE", "write-ahead log `file` of the persistent store, empty to disable", func(c *Config) flag.Value { return (*stringValue)(&c.WALFile) }},
+	{"save-interval", "KV_SAVE_INTERVAL", "`interval` between snapshots", func(c *Config) flag.Value { return (*durationValue)(&c.SaveInterval) }},
+	{"cleanup-interval", "KV_CLEANUP_INTERVAL", "`interval` between runs of the expired key reaper", func(c *Config) flag.Value { return (*intervalValue)(&c.CleanupInterval) }},
+	{"auth-file", "KV_AUTH_FILE", "JSON `file` of credentials and ACLs, empty to allow anyone", func(c *Config) flag.Value { return (*stringValue)(&c.AuthFile) }},
+	{"follow", "KV_FOLLOW", "base `URL` of a primary to follow as a read-only replica", func(c *Config) flag.Value { return (*stringValue)(&c.Follow) }},
+	{"follow-token", "KV_FOLLOW_TOKEN", "bearer `token` to authenticate to the primary with", func(c *Config) flag.Value { return (*stringValue)(&c.FollowToken) }},
+	{"raft-id", "KV_RAFT_ID", "`ID` of this server in a Raft cluster, 0 to not be in one", func(c *Config) flag.Value { return (*uint64Value)(&c.RaftID) }},
+	{"raft-peers", "KV_RAFT_PEERS", "members of the Raft cluster, as `id=URL,...`", func(c *Config) flag.Value { return (*peersValue)(&c.RaftPeers) }},
+	{"raft-dir", "KV_RAFT_DIR", "`directory` of the Raft log and snapshots", func(c *Config) flag.Value { return (*stringValue)(&c.RaftDir) }},
+	{"raft-join", "KV_RAFT_JOIN", "join the running cluster of -raft-peers rather than start one", func(c *Config) flag.Value { return (*boolValue)(&c.RaftJoin) }},
+	{"raft-token", "KV_RAFT_TOKEN", "bearer `token` to authenticate to the other members with", func(c *Config) flag.Value { return (*stringValue)(&c.RaftToken) }},
+	{"tls-cert", "KV_TLS_CERT", "PEM certificate `file`, to serve HTTPS", func(c *Config) flag.Value { return (*stringValue)(&c.TLSCertFile) }},
+	{"tls-key", "KV_TLS_KEY", "PEM private key `file` of the certificate", func(c *Config) flag.Value { return (*stringValue)(&c.TLSKeyFile) }},
+	{"tls-client-ca", "KV_TLS_CLIENT_CA", "PEM `file` of the CAs that verify client certificates", func(c *Config) flag.Value { return (*stringValue)(&c.ClientCAFile) }},
+	{"tls-client-auth", "KV_TLS_CLIENT_AUTH", "client certificate `mode`: none, verify-if-given or require", func(c *Config) flag.Value { return (*clientAuthValue)(&c.ClientAuth) }},
+	{"h2c", "KV_H2C", "accept HTTP/2 without TLS", func(c *Config) flag.Value { return (*boolValue)(&c.H2C) }},
+	{"max-body-bytes", "KV_MAX_BODY_BYTES", "largest request body in `bytes`, 0 for none", func(c *Config) flag.Value { return (*int64Value)(&c.MaxBodyBytes) }},
+	{"max-key-bytes", "KV_MAX_KEY_BYTES", "longest key in `bytes`, 0 for none", func(c *Config) flag.Value { return (*int64Value)(&c.MaxKeyBytes) }},
+	{"max-value-bytes", "KV_MAX_VALUE_BYTES", "longest value in `bytes`, 0 for none", func(c *Config) flag.Value { return (*int64Value)(&c.MaxValueBytes) }},
+	{"rate-limit", "KV_RATE_LIMIT", "`requests` per second per client IP or principal, 0 for none", func(c *Config) flag.Value { return (*floatValue)(&c.RateLimit) }},
+	{"rate-burst", "KV_RATE_BURST", "`requests` a client may send at once above the rate", func(c *Config) flag.Value { return (*int64Value)(&c.RateBurst) }},
+	{"read-header-timeout", "KV_READ_HEADER_TIMEOUT", "`time` allowed to read request headers", func(c *Config) flag.Value { return (*durationValue)(&c.ReadHeaderTimeout) }},
+	{"read-timeout", "KV_READ_TIMEOUT", "`time` allowed to read a whole request, 0 for none", func(c *Config) flag.Value { return (*durationValue)(&c.ReadTimeout) }},
+	{"write-timeout", "KV_WRITE_TIMEOUT", "`time` allowed to write a response, 0 for none", func(c *Config) flag.Value { return (*durationValue)(&c.WriteTimeout) }},
+	{"idle-timeout", "KV_IDLE_TIMEOUT", "`time` an idle keep-alive connection is kept open", func(c *Config) flag.Value { return (*durationValue)(&c.IdleTimeout) }},
+	{"shutdown-timeout", "KV_SHUTDOWN_TIMEOUT", "`time` allowed to drain requests on shutdown", func(c *Config) flag.Value { return (*durationValue)(&c.ShutdownTimeout) }},
+}
+
+// Load builds the configuration of the program name from its arguments
+// and environment. The config file is named by -config or KV_CONFIG. It
+// returns flag.ErrHelp if the arguments ask for usage, which has then
+// been written to output.
+func Load(name string, args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	flagged := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", getenv("KV_CONFIG"), "JSON config `file`, keyed by flag name (env KV_CONFIG)")
+	for _, opt := range options {
+		fs.Var(opt.value(&flagged), opt.name, opt.usage+" (env "+opt.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, opt := range options {
+		if v := getenv(opt.env); v != "" {
+			if err := opt.value(&cfg).Set(v); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", opt.env, err)
+			}
+		}
+	}
+
+	// Only flags given on the command line override the file and the
+	// environment, not the defaults the others were parsed into.
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, opt := range options {
+			if opt.name == f.Name && err == nil {
+				err = opt.value(&cfg).Set(f.Value.String())
+			}
+		}
+	})
+	return cfg, err
+}
+
+// loadFile applies the settings in the JSON object in filename to cfg.
+// Values are strings, as they would be written on the command line.
+func loadFile(cfg *Config, filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]string
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("config %s: %w", filename, err)
+	}
+
+	for key, v := range settings {
+		found := false
+		for _, opt := range options {
+			if opt.name == key {
+				if err := opt.value(cfg).Set(v); err != nil {
+					return fmt.Errorf("config %s: %s: %w", filename, key, err)
+				}
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("config %s: unknown setting %q", filename, key)
+		}
+	}
+	return nil
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (v *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+type clientAuthValue tls.ClientAuthType
+
+func (v *clientAuthValue) Set(s string) error {
+	mode, ok := clientAuthModes[s]
+	if !ok {
+		return fmt.Errorf("unknown client auth mode %q", s)
+	}
+	*v = clientAuthValue(mode)
+	return nil
+}
+
+func (v *clientAuthValue) String() string {
+	for name, mode := range clientAuthModes {
+		if mode == tls.ClientAuthType(*v) {
+			return name
+		}
+	}
+	return tls.ClientAuthType(*v).String()
+}
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("negative number %s", s)
+	}
+	*v = int64Value(n)
+	return nil
+}
+
+func (v *int64Value) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+type uint64Value uint64
+
+func (v *uint64Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = uint64Value(n)
+	return nil
+}
+
+func (v *uint64Value) String() string {
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+// peersValue is a list of cluster members, checked as it is set and kept
+// as given so that Config stays comparable.
+type peersValue string
+
+func (v *peersValue) Set(s string) error {
+	if _, err := parsePeers(s); err != nil {
+		return err
+	}
+	*v = peersValue(s)
+	return nil
+}
+
+func (v *peersValue) String() string {
+	return string(*v)
+}
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	if f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("invalid rate %s", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+
+func (v *floatValue) String() string {
+	return strconv.FormatFloat(float64(*v), 'g', -1, 64)
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("negative duration %s", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+// intervalValue is a duration that must be positive, such as how often
+// something runs.
+type intervalValue time.Duration
+
+func (v *intervalValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("interval %s is not positive", s)
+	}
+	*v = intervalValue(d)
+	return nil
+}
+
+func (v *intervalValue) String() string {
+	return time.Duration(*v).String()
+}
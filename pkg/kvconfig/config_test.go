@@ -0,0 +1,191 @@
+package kvconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("kv", nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != Default() {
+		t.Errorf("got %+v want %+v", cfg, Default())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kv.json")
+	err := os.WriteFile(file, []byte(`{
+		"addr": ":9000",
+		"snapshot-file": "/data/file.json",
+		"save-interval": "1m",
+		"cleanup-interval": "1s"
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load("kv",
+		[]string{"-config", file, "-save-interval", "10s", "-addr", ":8080"},
+		env(map[string]string{
+			"KV_SAVE_INTERVAL":    "30s",
+			"KV_CLEANUP_INTERVAL": "2s",
+			"KV_WAL_FILE":         "/data/env.wal",
+		}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Addr = ":8080"                   // Flag, although it is the default
+	want.SnapshotFile = "/data/file.json" // File
+	want.SaveInterval = 10 * time.Second  // Flag over env over file
+	want.CleanupInterval = 2 * time.Second
+	want.WALFile = "/data/env.wal"
+	if cfg != want {
+		t.Errorf("got %+v want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kv.json")
+	if err := os.WriteFile(file, []byte(`{"resp-addr": ""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load("kv", nil, env(map[string]string{"KV_CONFIG": file}), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RESPAddr != "" {
+		t.Errorf("got resp addr %q, want it disabled by the file", cfg.RESPAddr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.json")
+	os.WriteFile(unknown, []byte(`{"port": "80"}`), 0644)
+	badFile := filepath.Join(dir, "bad.json")
+	os.WriteFile(badFile, []byte(`{"save-interval": "soon"}`), 0644)
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"Bad flag", []string{"-save-interval", "soon"}, nil},
+		{"Negative duration", []string{"-idle-timeout", "-1s"}, nil},
+		{"Unknown flag", []string{"-port", "80"}, nil},
+		{"Bad env", nil, map[string]string{"KV_READ_TIMEOUT": "soon"}},
+		{"Missing file", []string{"-config", filepath.Join(dir, "missing.json")}, nil},
+		{"Unknown setting", []string{"-config", unknown}, nil},
+		{"Bad setting", []string{"-config", badFile}, nil},
+		{"Bad client auth", []string{"-tls-client-auth", "maybe"}, nil},
+		{"Bad bool env", nil, map[string]string{"KV_H2C": "sometimes"}},
+		{"Negative size", []string{"-max-body-bytes", "-1"}, nil},
+		{"Bad rate", []string{"-rate-limit", "NaN"}, nil},
+		{"Zero interval", []string{"-cleanup-interval", "0"}, nil},
+		{"Negative interval", nil, map[string]string{"KV_CLEANUP_INTERVAL": "-1s"}},
+		{"Bad member", []string{"-raft-peers", "1=http://a,b"}, nil},
+		{"Duplicate member", []string{"-raft-peers", "1=http://a,1=http://b"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load("kv", tt.args, env(tt.env), io.Discard); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadTLSOptions(t *testing.T) {
+	cfg, err := Load("kv",
+		[]string{"-h2c", "-tls-cert", "c.pem", "-tls-key", "k.pem"},
+		env(map[string]string{"KV_TLS_CLIENT_AUTH": "require", "KV_TLS_CLIENT_CA": "ca.pem"}),
+		io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.H2C || cfg.TLSCertFile != "c.pem" || cfg.TLSKeyFile != "k.pem" || cfg.ClientCAFile != "ca.pem" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("got client auth %v want %v", cfg.ClientAuth, tls.RequireAndVerifyClientCert)
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	cfg, err := Load("kv",
+		[]string{"-max-key-bytes", "512", "-rate-limit", "2.5"},
+		env(map[string]string{"KV_MAX_BODY_BYTES": "1024", "KV_RATE_BURST": "10"}),
+		io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MaxBodyBytes != 1024 || cfg.MaxKeyBytes != 512 || cfg.MaxValueBytes != 0 || cfg.RateLimit != 2.5 || cfg.RateBurst != 10 {
+		t.Errorf("unexpected limits %+v", cfg)
+	}
+}
+
+func TestLoadFollow(t *testing.T) {
+	cfg, err := Load("kv",
+		[]string{"-follow", "http://primary:8080"},
+		env(map[string]string{"KV_FOLLOW_TOKEN": "s3cret"}),
+		io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Follow != "http://primary:8080" || cfg.FollowToken != "s3cret" {
+		t.Errorf("got follow %q with token %q", cfg.Follow, cfg.FollowToken)
+	}
+}
+
+func TestLoadRaft(t *testing.T) {
+	cfg, err := Load("kv",
+		[]string{"-raft-id", "2", "-raft-join"},
+		env(map[string]string{"KV_RAFT_PEERS": "1=http://kv-1:8080, 2=http://kv-2:8080", "KV_RAFT_DIR": "/var/lib/kv"}),
+		io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RaftID != 2 || !cfg.RaftJoin || cfg.RaftDir != "/var/lib/kv" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	peers, err := cfg.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []raft.Peer{{ID: 1, Addr: "http://kv-1:8080"}, {ID: 2, Addr: "http://kv-2:8080"}}
+	if !slices.Equal(peers, want) {
+		t.Errorf("got peers %v want %v", peers, want)
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	if _, err := Load("kv", []string{"-h"}, env(nil), io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("got error %v want %v", err, flag.ErrHelp)
+	}
+}
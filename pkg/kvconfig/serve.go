@@ -0,0 +1,80 @@
+package kvconfig
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// HTTPServer returns a server for h with the configured address,
+// timeouts, TLS and protocols. HTTP/2 is served over TLS, and without it
+// only if H2C is set.
+func (c Config) HTTPServer(h http.Handler) (*http.Server, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(c.H2C)
+
+	return &http.Server{
+		Addr:              c.Addr,
+		Handler:           h,
+		TLSConfig:         tlsConfig,
+		Protocols:         protocols,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+	}, nil
+}
+
+// Serve serves HTTP, or HTTPS if srv has a TLS config, on l until ctx is done, then shuts srv down: it stops
+// accepting connections and waits up to the shutdown timeout for requests
+// in flight to finish. Requests that never finish on their own, such as
+// /watch streams, see their context cancelled when the shutdown starts.
+//
+// Serve returns nil after a clean shutdown.
+func (c Config) Serve(ctx context.Context, srv *http.Server, l net.Listener) error {
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+	srv.RegisterOnShutdown(cancel)
+
+	errc := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errc <- srv.ServeTLS(l, "", "")
+		} else {
+			errc <- srv.Serve(l)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancelShutdown()
+
+	err := srv.Shutdown(shutdownCtx)
+	if serveErr := <-errc; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+	return err
+}
+
+// ListenAndServe is Serve on a listener for srv.Addr.
+func (c Config) ListenAndServe(ctx context.Context, srv *http.Server) error {
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return c.Serve(ctx, srv, l)
+}
@@ -0,0 +1,142 @@
+package kvconfig
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvserver"
+	"golang-learning/pkg/kvstore"
+)
+
+func TestServeDrainsRequestsOnShutdown(t *testing.T) {
+	started := make(chan struct{}, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done() // Like a /watch stream, only ends when cancelled
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	cfg.ShutdownTimeout = 5 * time.Second
+	srv, err := cfg.HTTPServer(mux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- cfg.Serve(ctx, srv, l)
+	}()
+
+	base := "http://" + l.Addr().String()
+	go http.Get(base + "/stream")
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	<-started
+	cancel()
+
+	if got := <-body; got != "done" {
+		t.Errorf("got %q, want the request in flight to finish", got)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("got error %v want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Serve to return once the stream was cancelled")
+	}
+
+	if _, err := http.Get(base + "/slow"); err == nil {
+		t.Errorf("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServeStreamsOutliveReadTimeout(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	cfg.ReadTimeout = 100 * time.Millisecond
+	srv, err := cfg.HTTPServer(kvserver.NewServer(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cfg.Serve(ctx, srv, l)
+	base := "http://" + l.Addr().String()
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/watch?key=foo", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	poll := make(chan map[string]any, 1)
+	go func() {
+		resp, err := http.Get(base + "/watch?key=bar&timeout=300ms")
+		if err != nil {
+			poll <- nil
+			return
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		poll <- body
+	}()
+
+	time.Sleep(3 * cfg.ReadTimeout)
+	store.Set("foo", "1")
+
+	r := bufio.NewReader(stream.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended after the read timeout: %v", err)
+		}
+		if strings.HasPrefix(line, "event: ") {
+			break
+		}
+	}
+
+	if body := <-poll; body == nil || body["revision"] == nil {
+		t.Errorf("got %v from a poll longer than the read timeout", body)
+	}
+}
@@ -0,0 +1,133 @@
+package kvconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// clientAuthModes are the values of -tls-client-auth.
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"verify-if-given": tls.VerifyClientCertIfGiven,
+	"require":         tls.RequireAndVerifyClientCert,
+}
+
+// TLSConfig returns the TLS settings of the HTTP server, or nil if TLS is
+// not configured. The certificate is reloaded when its files change, so
+// it can be rotated without a restart.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		if c.ClientCAFile != "" || c.ClientAuth != tls.NoClientCert {
+			return nil, errors.New("client certificates need tls-cert and tls-key")
+		}
+		return nil, nil
+	}
+	if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+		return nil, errors.New("tls-cert and tls-key must be set together")
+	}
+
+	certs, err := newCertReloader(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+		ClientAuth:     c.ClientAuth,
+	}
+
+	if c.ClientAuth != tls.NoClientCert && c.ClientCAFile == "" {
+		return nil, errors.New("tls-client-auth needs tls-client-ca")
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.ClientCAFile)
+		}
+		if cfg.ClientAuth == tls.NoClientCert {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most.
+var certCheckInterval = time.Second
+
+// certReloader serves a certificate from a pair of files, loading them
+// again when they change. If the new files cannot be loaded, perhaps
+// because they are half written, it keeps the old certificate and tries
+// again later.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   [2]fileStamp // Of the files cert was loaded from
+	checked time.Time
+}
+
+// fileStamp tells whether a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is for tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= certCheckInterval {
+		r.checked = time.Now()
+		if err := r.load(); err != nil {
+			log.Printf("reload certificate %s: %v", r.certFile, err)
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the certificate files if they changed since the last load.
+func (r *certReloader) load() error {
+	var stamp [2]fileStamp
+	for i, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		stamp[i] = fileStamp{fi.ModTime(), fi.Size()}
+	}
+	if r.cert != nil && stamp == r.stamp {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil {
+		log.Printf("reloaded certificate %s", r.certFile)
+	}
+	r.cert = &cert
+	r.stamp = stamp
+	return nil
+}
@@ -0,0 +1,319 @@
+package kvconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the tests, generated afresh each run.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{cert: cert, key: key, pool: x509.NewCertPool(), dir: t.TempDir()}
+	ca.pool.AddCert(cert)
+	writePEM(t, filepath.Join(ca.dir, "ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate for cn, signed by the CA, and its key to
+// name.pem and name-key.pem in the CA directory.
+func (ca *testCA) issue(t *testing.T, name, cn string, serial int64, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(ca.dir, name+".pem")
+	keyFile = filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, filename, typ string, der []byte) {
+	t.Helper()
+	// Write then rename, as a certificate manager would, so a reload
+	// never sees half a file.
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves h with cfg until the test ends and returns its address.
+func serveTLS(t *testing.T, cfg Config, h http.Handler) string {
+	t.Helper()
+	srv, err := cfg.HTTPServer(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cfg.Serve(ctx, srv, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return l.Addr().String()
+}
+
+// protoHandler answers with the protocol of the request and the common
+// name of the client certificate, if any.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Proto)
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		io.WriteString(w, " "+r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}
+})
+
+func get(t *testing.T, client *http.Client, url string) (string, error) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestServeTLSWithHTTP2(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := Default()
+	cfg.TLSCertFile, cfg.TLSKeyFile = ca.issue(t, "server", "localhost", 2, x509.ExtKeyUsageServerAuth)
+	addr := serveTLS(t, cfg, protoHandler)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+
+	body, err := get(t, client, "https://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "HTTP/2.0" {
+		t.Errorf("got %q want HTTP/2.0", body)
+	}
+
+	// Plain HTTP/1.1 clients still work.
+	client = &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ca.pool},
+		TLSNextProto:    map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}}
+	defer client.CloseIdleConnections()
+	if body, err := get(t, client, "https://"+addr+"/"); err != nil || body != "HTTP/1.1" {
+		t.Errorf("got %q, %v want HTTP/1.1", body, err)
+	}
+}
+
+func TestServeH2C(t *testing.T) {
+	cfg := Default()
+	cfg.H2C = true
+	addr := serveTLS(t, cfg, protoHandler)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	defer client.CloseIdleConnections()
+
+	body, err := get(t, client, "http://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "HTTP/2.0" {
+		t.Errorf("got %q want HTTP/2.0", body)
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	defer func(interval time.Duration) { certCheckInterval = interval }(certCheckInterval)
+	certCheckInterval = 0
+
+	ca := newTestCA(t)
+	cfg := Default()
+	cfg.TLSCertFile, cfg.TLSKeyFile = ca.issue(t, "server", "localhost", 10, x509.ExtKeyUsageServerAuth)
+	addr := serveTLS(t, cfg, protoHandler)
+
+	serial := func() int64 {
+		t.Helper()
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.pool})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if got := serial(); got != 10 {
+		t.Fatalf("got serial %d want 10", got)
+	}
+
+	ca.issue(t, "server", "localhost", 11, x509.ExtKeyUsageServerAuth)
+	if got := serial(); got != 11 {
+		t.Errorf("got serial %d after rotation, want 11", got)
+	}
+
+	// A broken certificate is not picked up; the last good one is served.
+	os.WriteFile(cfg.TLSCertFile, []byte("garbage"), 0o600)
+	if got := serial(); got != 11 {
+		t.Errorf("got serial %d after a bad rotation, want 11", got)
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	clientCert, clientKey := ca.issue(t, "client", "svc-a", 3, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		withCert   bool
+		wantBody   string
+		wantFailed bool
+	}{
+		{"RequireWithCert", "require", true, "HTTP/2.0 svc-a", false},
+		{"RequireWithout", "require", false, "", true},
+		{"IfGivenWithCert", "verify-if-given", true, "HTTP/2.0 svc-a", false},
+		{"IfGivenWithout", "verify-if-given", false, "HTTP/2.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.TLSCertFile, cfg.TLSKeyFile = ca.issue(t, "server", "localhost", 2, x509.ExtKeyUsageServerAuth)
+			cfg.ClientCAFile = filepath.Join(ca.dir, "ca.pem")
+			if err := (*clientAuthValue)(&cfg.ClientAuth).Set(tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			addr := serveTLS(t, cfg, protoHandler)
+
+			tlsConfig := &tls.Config{RootCAs: ca.pool}
+			if tt.withCert {
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+			defer client.CloseIdleConnections()
+
+			body, err := get(t, client, "https://"+addr+"/")
+			if tt.wantFailed {
+				if err == nil {
+					t.Errorf("got %q, want the handshake to fail", body)
+				}
+				return
+			}
+			if err != nil || body != tt.wantBody {
+				t.Errorf("got %q, %v want %q", body, err, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", "localhost", 2, x509.ExtKeyUsageServerAuth)
+
+	tests := []struct {
+		name   string
+		config func(c *Config)
+	}{
+		{"CertWithoutKey", func(c *Config) { c.TLSCertFile = certFile }},
+		{"MissingFile", func(c *Config) { c.TLSCertFile, c.TLSKeyFile = certFile, filepath.Join(ca.dir, "nope.pem") }},
+		{"ClientCAWithoutTLS", func(c *Config) { c.ClientCAFile = filepath.Join(ca.dir, "ca.pem") }},
+		{"ClientAuthWithoutCA", func(c *Config) {
+			c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}},
+		{"ClientCANotPEM", func(c *Config) {
+			c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+			c.ClientCAFile = keyFile
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.config(&cfg)
+			if _, err := cfg.TLSConfig(); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	cfg := Default()
+	if tlsConfig, err := cfg.TLSConfig(); tlsConfig != nil || err != nil {
+		t.Errorf("got %v, %v without TLS settings, want nil", tlsConfig, err)
+	}
+}
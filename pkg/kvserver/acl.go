@@ -0,0 +1,150 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Permission is what a principal may do with the keys under a prefix.
+// Each permission includes the ones before it.
+type Permission int
+
+const (
+	PermRead  Permission = iota + 1 // Read values, list keys and watch
+	PermWrite                       // Set, change and delete values
+	PermAdmin                       // Snapshots and metrics, given on the "" prefix
+)
+
+var permissionNames = map[Permission]string{
+	PermRead:  "read",
+	PermWrite: "write",
+	PermAdmin: "admin",
+}
+
+func (p Permission) String() string {
+	if name, ok := permissionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+func (p Permission) MarshalText() ([]byte, error) {
+	if _, ok := permissionNames[p]; !ok {
+		return nil, fmt.Errorf("invalid permission %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Permission) UnmarshalText(text []byte) error {
+	for perm, name := range permissionNames {
+		if name == string(text) {
+			*p = perm
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid permission %q", text)
+}
+
+// Grant gives a permission on every key that starts with Prefix. The
+// empty prefix covers the whole store.
+type Grant struct {
+	Prefix     string     `json:"prefix"`
+	Permission Permission `json:"permission"`
+}
+
+// Anyone is the ACL entry whose grants apply to every request,
+// authenticated or not.
+const Anyone = "*"
+
+// ACL maps principals to their grants.
+type ACL map[string][]Grant
+
+// Allows reports whether principal may access every key starting with
+// prefix with perm. A single key is checked as the prefix of itself.
+// The anonymous principal is "", which only has the grants of Anyone.
+func (a ACL) Allows(principal, prefix string, perm Permission) bool {
+	for _, name := range []string{principal, Anyone} {
+		if name == "" {
+			continue
+		}
+		for _, g := range a[name] {
+			if g.Permission >= perm && strings.HasPrefix(prefix, g.Prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuthConfig is the contents of an auth file: the credentials the server
+// accepts and what their principals may do.
+//
+//	{
+//	  "tokens": {"s3cr3t": "alice"},
+//	  "hmac_keys": {"build": {"principal": "ci", "secret": "..."}},
+//	  "client_certs": true,
+//	  "acl": {
+//	    "alice": [{"prefix": "app:", "permission": "write"}],
+//	    "ci": [{"prefix": "", "permission": "admin"}],
+//	    "*": [{"prefix": "public:", "permission": "read"}]
+//	  }
+//	}
+type AuthConfig struct {
+	Tokens      BearerTokens `json:"tokens"`
+	HMACKeys    HMACKeys     `json:"hmac_keys"`
+	ClientCerts bool         `json:"client_certs"` // Accept verified TLS client certificates
+	ACL         ACL          `json:"acl"`
+}
+
+// LoadAuthConfig reads an AuthConfig from the JSON file filename.
+func LoadAuthConfig(filename string) (AuthConfig, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	defer f.Close()
+
+	var cfg AuthConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return AuthConfig{}, fmt.Errorf("auth file %s: %w", filename, err)
+	}
+
+	for id, key := range cfg.HMACKeys {
+		if key.Principal == "" || key.Secret == "" {
+			return AuthConfig{}, fmt.Errorf("auth file %s: hmac key %q needs a principal and a secret", filename, id)
+		}
+	}
+	for token, principal := range cfg.Tokens {
+		if token == "" || principal == "" {
+			return AuthConfig{}, fmt.Errorf("auth file %s: tokens need a principal", filename)
+		}
+	}
+	for principal, grants := range cfg.ACL {
+		for _, g := range grants {
+			if g.Permission == 0 {
+				return AuthConfig{}, fmt.Errorf("auth file %s: grant on %q to %s has no permission", filename, g.Prefix, principal)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Authenticator returns the authenticators for the credentials in c, in
+// the order mTLS, bearer token, HMAC signature.
+func (c AuthConfig) Authenticator() Authenticator {
+	var authns Authenticators
+	if c.ClientCerts {
+		authns = append(authns, ClientCerts{})
+	}
+	if len(c.Tokens) > 0 {
+		authns = append(authns, c.Tokens)
+	}
+	if len(c.HMACKeys) > 0 {
+		authns = append(authns, c.HMACKeys)
+	}
+	return authns
+}
@@ -0,0 +1,97 @@
+package kvserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACLAllows(t *testing.T) {
+	acl := ACL{
+		"alice": {{Prefix: "app:", Permission: PermWrite}},
+		"ops":   {{Prefix: "", Permission: PermAdmin}},
+		Anyone:  {{Prefix: "public:", Permission: PermRead}},
+	}
+
+	tests := []struct {
+		principal string
+		prefix    string
+		perm      Permission
+		want      bool
+	}{
+		{"alice", "app:x", PermRead, true},
+		{"alice", "app:x", PermWrite, true},
+		{"alice", "app:x", PermAdmin, false},
+		{"alice", "other", PermRead, false},
+		{"alice", "app", PermRead, false}, // Covers keys outside app:
+		{"alice", "", PermRead, false},
+		{"alice", "public:x", PermRead, true},
+		{"alice", "public:x", PermWrite, false},
+		{"ops", "", PermAdmin, true},
+		{"ops", "anything", PermWrite, true},
+		{"", "public:x", PermRead, true},
+		{"", "app:x", PermRead, false},
+		{"mallory", "app:x", PermRead, false},
+	}
+
+	for _, tt := range tests {
+		if got := acl.Allows(tt.principal, tt.prefix, tt.perm); got != tt.want {
+			t.Errorf("Allows(%q, %q, %v) = %v, want %v", tt.principal, tt.prefix, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "auth.json")
+	os.WriteFile(filename, []byte(`{
+		"tokens": {"t0k3n": "alice"},
+		"hmac_keys": {"k1": {"principal": "ci", "secret": "shh"}},
+		"client_certs": true,
+		"acl": {
+			"alice": [{"prefix": "app:", "permission": "write"}],
+			"*": [{"prefix": "public:", "permission": "read"}]
+		}
+	}`), 0o600)
+
+	cfg, err := LoadAuthConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Tokens["t0k3n"] != "alice" || cfg.HMACKeys["k1"].Secret != "shh" || !cfg.ClientCerts {
+		t.Errorf("unexpected credentials %+v", cfg)
+	}
+	if g := cfg.ACL["alice"]; len(g) != 1 || g[0] != (Grant{"app:", PermWrite}) {
+		t.Errorf("unexpected grants %+v", g)
+	}
+	if authns := cfg.Authenticator().(Authenticators); len(authns) != 3 {
+		t.Errorf("got %d authenticators, want 3", len(authns))
+	}
+}
+
+func TestLoadAuthConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"UnknownField", `{"users": {}}`, "unknown field"},
+		{"BadPermission", `{"acl": {"a": [{"prefix": "", "permission": "root"}]}}`, "invalid permission"},
+		{"NoPermission", `{"acl": {"a": [{"prefix": "x"}]}}`, "no permission"},
+		{"NoSecret", `{"hmac_keys": {"k": {"principal": "a"}}}`, "needs a principal and a secret"},
+		{"NoPrincipal", `{"tokens": {"t": ""}}`, "need a principal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "auth.json")
+			os.WriteFile(filename, []byte(tt.file), 0o600)
+
+			_, err := LoadAuthConfig(filename)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
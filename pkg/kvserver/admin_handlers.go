@@ -0,0 +1,178 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// snapshotStatsResponse is the JSON form of SnapshotStats.
+type snapshotStatsResponse struct {
+	LastSnapshot *time.Time `json:"last_snapshot"`
+	SizeBytes    int        `json:"size_bytes"`
+	Entries      int        `json:"entries"`
+	DurationMs   float64    `json:"duration_ms"`
+}
+
+func newSnapshotStatsResponse(stats kvstore.SnapshotStats) snapshotStatsResponse {
+	resp := snapshotStatsResponse{
+		SizeBytes:  stats.Size,
+		Entries:    stats.Entries,
+		DurationMs: float64(stats.Duration) / float64(time.Millisecond),
+	}
+	if !stats.Time.IsZero() {
+		resp.LastSnapshot = &stats.Time
+	}
+	return resp
+}
+
+func (s *Server) SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	snapshotter, ok := s.store.(kvstore.Snapshotter)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are not supported by this store",
+		})
+		return
+	}
+
+	stats, err := snapshotter.Snapshot()
+	if errors.Is(err, kvstore.ErrSnapshotDisabled) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are disabled",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newSnapshotStatsResponse(stats))
+}
+
+func (s *Server) SnapshotStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	snapshotter, ok := s.store.(kvstore.Snapshotter)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are not supported by this store",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newSnapshotStatsResponse(snapshotter.SnapshotStats()))
+}
+
+func (s *Server) SnapshotDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	snapshotter, ok := s.store.(kvstore.Snapshotter)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are not supported by this store",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="store.snapshot.json"`)
+	w.WriteHeader(http.StatusOK)
+	snapshotter.WriteSnapshot(w)
+}
+
+func (s *Server) SnapshotRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	snapshotter, ok := s.store.(kvstore.Snapshotter)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are not supported by this store",
+		})
+		return
+	}
+
+	defer r.Body.Close()
+	err := snapshotter.RestoreSnapshot(r.Body)
+	if errors.Is(err, kvstore.ErrReadOnly) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if errors.Is(err, kvstore.ErrSnapshotDisabled) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Snapshots are disabled, so a restore would not survive a restart",
+		})
+		return
+	}
+	if errors.Is(err, kvstore.ErrSnapshotCorrupt) || errors.Is(err, kvstore.ErrSnapshotVersion) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
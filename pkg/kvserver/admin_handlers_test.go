@@ -0,0 +1,204 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	t.Run("Wrong HTTP Method (GET)", func(t *testing.T) {
+		server := NewServer(kvstore.NewMemoryStore())
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil)
+		rr := httptest.NewRecorder()
+		server.SnapshotHandler(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("got status %d want %d", rr.Code, http.StatusMethodNotAllowed)
+		}
+	})
+
+	t.Run("Store without snapshots", func(t *testing.T) {
+		server := NewServer(kvstore.NewMemoryStore())
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+		rr := httptest.NewRecorder()
+		server.SnapshotHandler(rr, req)
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("got status %d want %d", rr.Code, http.StatusNotImplemented)
+		}
+	})
+
+	t.Run("Snapshots disabled", func(t *testing.T) {
+		store := kvstore.NewPersistentStore()
+		defer store.Stop()
+		server := NewServer(store)
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+		rr := httptest.NewRecorder()
+		server.SnapshotHandler(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("got status %d want %d", rr.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("Valid Request", func(t *testing.T) {
+		store, err := kvstore.NewPersistentStore().
+			WithSnapshotFile(filepath.Join(t.TempDir(), "store.snapshot.json")).
+			Initialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Stop()
+		server := NewServer(store)
+
+		store.Set("foo", "bar")
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+		rr := httptest.NewRecorder()
+		server.SnapshotHandler(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+		}
+
+		var got snapshotStatsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.LastSnapshot == nil || got.Entries != 1 || got.SizeBytes == 0 {
+			t.Errorf("unexpected stats %+v", got)
+		}
+	})
+}
+
+func TestSnapshotStatsHandler(t *testing.T) {
+	store, err := kvstore.NewPersistentStore().
+		WithSnapshotFile(filepath.Join(t.TempDir(), "store.snapshot.json")).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+	server := NewServer(store)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/snapshot/stats", nil)
+	rr := httptest.NewRecorder()
+	server.SnapshotStatsHandler(rr, req)
+
+	var got snapshotStatsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.LastSnapshot != nil {
+		t.Errorf("expected no snapshot yet, got %v", got.LastSnapshot)
+	}
+
+	before := time.Now()
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	server.SnapshotStatsHandler(rr, req)
+
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.LastSnapshot == nil || got.LastSnapshot.Before(before) {
+		t.Errorf("expected last snapshot after %v, got %v", before, got.LastSnapshot)
+	}
+}
+
+func TestSnapshotDownloadAndRestore(t *testing.T) {
+	source := kvstore.NewPersistentStore()
+	defer source.Stop()
+	source.Set("foo", "bar")
+	source.Set("key", "value")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/snapshot/download", nil)
+	rr := httptest.NewRecorder()
+	NewServer(source).SnapshotDownloadHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+	target, err := kvstore.NewPersistentStore().WithSnapshotFile(snapshotFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Stop()
+	target.Set("stale", "value")
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/snapshot/restore", bytes.NewReader(rr.Body.Bytes()))
+	rr = httptest.NewRecorder()
+	NewServer(target).SnapshotRestoreHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+
+	if val, _ := target.Get("foo"); val != "bar" {
+		t.Errorf("expected foo to be restored")
+	}
+	if _, exists := target.Get("stale"); exists {
+		t.Errorf("expected stale key to be replaced by the restore")
+	}
+
+	reloaded, err := kvstore.NewPersistentStore().WithSnapshotFile(snapshotFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if len(reloaded.Keys()) != 2 {
+		t.Errorf("expected restore to be written to the snapshot file, got %d keys", len(reloaded.Keys()))
+	}
+}
+
+func TestSnapshotRestoreHandler_Disabled(t *testing.T) {
+	store, err := kvstore.NewPersistentStore().WithWALFile(filepath.Join(t.TempDir(), "store.wal")).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/snapshot/restore", bytes.NewBufferString("{}"))
+	rr := httptest.NewRecorder()
+	NewServer(store).SnapshotRestoreHandler(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestSnapshotRestoreHandler_Corrupt(t *testing.T) {
+	store := kvstore.NewPersistentStore()
+	defer store.Stop()
+	store.Set("foo", "bar")
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/snapshot/restore", bytes.NewBufferString("{corrupt"))
+	rr := httptest.NewRecorder()
+	NewServer(store).SnapshotRestoreHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusBadRequest)
+	}
+	if val, _ := store.Get("foo"); val != "bar" {
+		t.Errorf("expected store to be untouched by a failed restore")
+	}
+}
@@ -0,0 +1,199 @@
+package kvserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request
+	// carries none of the credentials it checks.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrBadCredentials is returned by an Authenticator when the request
+	// carries credentials it checks, but they are not valid.
+	ErrBadCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator finds out which principal sent a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal string, err error)
+}
+
+// Authenticators tries each authenticator in turn, until one finds
+// credentials in the request.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(r *http.Request) (string, error) {
+	for _, authn := range a {
+		principal, err := authn.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return principal, err
+		}
+	}
+	return "", ErrNoCredentials
+}
+
+// BearerTokens maps static tokens, sent as "Authorization: Bearer
+// <token>", to their principals.
+type BearerTokens map[string]string
+
+func (t BearerTokens) Authenticate(r *http.Request) (string, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrNoCredentials
+	}
+
+	// Compare digests, which are all the same length, so that the time
+	// taken says nothing about how much of a token was right.
+	sum := sha256.Sum256([]byte(token))
+	principal := ""
+	for known, p := range t {
+		knownSum := sha256.Sum256([]byte(known))
+		if subtle.ConstantTimeCompare(sum[:], knownSum[:]) == 1 {
+			principal = p
+		}
+	}
+	if principal == "" {
+		return "", ErrBadCredentials
+	}
+	return principal, nil
+}
+
+const (
+	// HMACScheme is the Authorization scheme of signed requests.
+	HMACScheme = "KV-HMAC-SHA256"
+	// HMACDateHeader carries the time a request was signed, in RFC 3339.
+	HMACDateHeader = "X-KV-Date"
+	// MaxClockSkew is how far the signing time of a request may be from
+	// the server's clock.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// HMACKey is a shared secret for signing requests.
+type HMACKey struct {
+	Principal string `json:"principal"`
+	Secret    string `json:"secret"`
+}
+
+// HMACKeys maps key IDs to the keys that sign requests with
+//
+//	Authorization: KV-HMAC-SHA256 key=<id>, signature=<hex>
+//	X-KV-Date: 2024-05-01T12:00:00Z
+//
+// The signature is the HMAC-SHA256 of the method, path, query, date and
+// body digest; see SignRequest. A signature can be replayed until the
+// date is MaxClockSkew old, so use TLS as well.
+type HMACKeys map[string]HMACKey
+
+func (k HMACKeys) Authenticate(r *http.Request) (string, error) {
+	scheme, params, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if scheme != HMACScheme {
+		return "", ErrNoCredentials
+	}
+
+	var id, sig string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "key":
+			id = value
+		case "signature":
+			sig = value
+		}
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", ErrBadCredentials
+	}
+
+	key, ok := k[id]
+	if !ok {
+		return "", ErrBadCredentials
+	}
+
+	date, err := time.Parse(time.RFC3339, r.Header.Get(HMACDateHeader))
+	if err != nil {
+		return "", ErrBadCredentials
+	}
+	if skew := time.Since(date); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return "", ErrBadCredentials
+	}
+
+	want, err := signature(r, key.Secret)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal(got, want) {
+		return "", ErrBadCredentials
+	}
+	return key.Principal, nil
+}
+
+// SignRequest signs r for HMACKeys with the key id and its secret, as of
+// now. The body, if any, is read and replaced so it can still be sent.
+func SignRequest(r *http.Request, id, secret string, now time.Time) error {
+	r.Header.Set(HMACDateHeader, now.UTC().Format(time.RFC3339))
+	sig, err := signature(r, secret)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", HMACScheme+" key="+id+", signature="+hex.EncodeToString(sig))
+	return nil
+}
+
+// signature computes the HMAC of r under secret.
+func signature(r *http.Request, secret string) ([]byte, error) {
+	body, err := peekBody(r)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		r.Header.Get(HMACDateHeader),
+		hex.EncodeToString(digest[:]),
+	}, "\n"))
+	return mac.Sum(nil), nil
+}
+
+// peekBody reads the body of r and puts back a copy, so that handlers can
+// read it again.
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// ClientCerts authenticates requests by their TLS client certificate.
+// The principal is the common name of a certificate that the server
+// verified; an unverified certificate is not a credential.
+type ClientCerts struct{}
+
+func (ClientCerts) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", ErrNoCredentials
+	}
+
+	principal := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if principal == "" {
+		return "", ErrBadCredentials
+	}
+	return principal, nil
+}
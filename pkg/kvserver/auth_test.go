@@ -0,0 +1,159 @@
+package kvserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBearerTokens(t *testing.T) {
+	authn := BearerTokens{"t0k3n": "alice"}
+
+	tests := []struct {
+		name          string
+		header        string
+		wantPrincipal string
+		wantErr       error
+	}{
+		{"Valid", "Bearer t0k3n", "alice", nil},
+		{"SchemeCase", "bearer t0k3n", "alice", nil},
+		{"Wrong", "Bearer nope", "", ErrBadCredentials},
+		{"Missing", "", "", ErrNoCredentials},
+		{"OtherScheme", "Basic YTpi", "", ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			principal, err := authn.Authenticate(req)
+			if principal != tt.wantPrincipal || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %q, %v want %q, %v", principal, err, tt.wantPrincipal, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHMACKeys(t *testing.T) {
+	authn := HMACKeys{"k1": {Principal: "ci", Secret: "shh"}}
+	signed := func(id, secret string, at time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/set?x=1", strings.NewReader(`{"key":"a","value":"1"}`))
+		if err := SignRequest(req, id, secret, at); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		req := signed("k1", "shh", time.Now())
+		principal, err := authn.Authenticate(req)
+		if principal != "ci" || err != nil {
+			t.Fatalf("got %q, %v", principal, err)
+		}
+
+		// The handler still gets the body.
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != `{"key":"a","value":"1"}` {
+			t.Errorf("body after authentication is %q", body)
+		}
+	})
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{"WrongSecret", func() *http.Request { return signed("k1", "guess", time.Now()) }},
+		{"UnknownKey", func() *http.Request { return signed("k2", "shh", time.Now()) }},
+		{"Stale", func() *http.Request { return signed("k1", "shh", time.Now().Add(-2*MaxClockSkew)) }},
+		{"TamperedBody", func() *http.Request {
+			req := signed("k1", "shh", time.Now())
+			req.Body = io.NopCloser(strings.NewReader(`{"key":"b","value":"1"}`))
+			return req
+		}},
+		{"TamperedQuery", func() *http.Request {
+			req := signed("k1", "shh", time.Now())
+			req.URL.RawQuery = "x=2"
+			return req
+		}},
+		{"BadSignature", func() *http.Request {
+			req := signed("k1", "shh", time.Now())
+			req.Header.Set("Authorization", HMACScheme+" key=k1, signature=zz")
+			return req
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authn.Authenticate(tt.req()); !errors.Is(err, ErrBadCredentials) {
+				t.Errorf("got %v want %v", err, ErrBadCredentials)
+			}
+		})
+	}
+
+	t.Run("Unsigned", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+		if _, err := authn.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("got %v want %v", err, ErrNoCredentials)
+		}
+	})
+}
+
+func TestClientCerts(t *testing.T) {
+	cert := func(cn string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	}
+
+	tests := []struct {
+		name          string
+		state         *tls.ConnectionState
+		wantPrincipal string
+		wantErr       error
+	}{
+		{"Verified", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert("svc")}}}, "svc", nil},
+		{"Unverified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert("svc")}}, "", ErrNoCredentials},
+		{"NoCommonName", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert("")}}}, "", ErrBadCredentials},
+		{"PlainHTTP", nil, "", ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+			req.TLS = tt.state
+
+			principal, err := ClientCerts{}.Authenticate(req)
+			if principal != tt.wantPrincipal || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %q, %v want %q, %v", principal, err, tt.wantPrincipal, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorsFirstWithCredentials(t *testing.T) {
+	authn := Authenticators{BearerTokens{"t0k3n": "alice"}, HMACKeys{"k1": {Principal: "ci", Secret: "shh"}}}
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+	SignRequest(req, "k1", "shh", time.Now())
+	if principal, err := authn.Authenticate(req); principal != "ci" || err != nil {
+		t.Errorf("got %q, %v want ci", principal, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, err := authn.Authenticate(req); !errors.Is(err, ErrBadCredentials) {
+		t.Errorf("got %v want %v", err, ErrBadCredentials)
+	}
+
+	req.Header.Del("Authorization")
+	if _, err := authn.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("got %v want %v", err, ErrNoCredentials)
+	}
+}
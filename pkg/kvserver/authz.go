@@ -0,0 +1,250 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// scope is a key prefix a request touches and what it does with it.
+type scope struct {
+	prefix string
+	perm   Permission
+}
+
+// access returns the scopes a request to a route touches. Routes
+// without one need admin on the whole store.
+type access func(r *http.Request) []scope
+
+// routeAccess is what each route of the server needs, by path.
+var routeAccess = map[string]access{
+	"/set":      bodyKey(PermWrite),
+	"/get":      queryKeyAccess(PermRead),
+	"/delete":   queryKeyAccess(PermWrite),
+	"/keys":     keysAccess,
+	"/mset":     msetAccess,
+	"/mget":     bodyKeys(PermRead),
+	"/mdelete":  bodyKeys(PermWrite),
+	"/ttl":      queryKeyAccess(PermRead),
+	"/expire":   bodyKey(PermWrite),
+	"/persist":  queryKeyAccess(PermWrite),
+	"/txn":      txnAccess,
+	"/type":     queryKeyAccess(PermRead),
+	"/incr":     bodyKey(PermWrite),
+	"/decr":     bodyKey(PermWrite),
+	"/lpush":    bodyKey(PermWrite),
+	"/rpush":    bodyKey(PermWrite),
+	"/lpop":     bodyKey(PermWrite),
+	"/rpop":     bodyKey(PermWrite),
+	"/lrange":   queryKeyAccess(PermRead),
+	"/hset":     bodyKey(PermWrite),
+	"/hget":     queryKeyAccess(PermRead),
+	"/hdel":     bodyKey(PermWrite),
+	"/sadd":     bodyKey(PermWrite),
+	"/srem":     bodyKey(PermWrite),
+	"/smembers": queryKeyAccess(PermRead),
+	// A watch on a prefix is checked on the prefix, which is the key.
+	"/watch": queryKeyAccess(PermRead),
+}
+
+// WithAuth makes every request authenticate with authn and checks it
+// against acl before the handler runs. Requests without credentials act
+// as the anonymous principal, so they only get the grants of Anyone.
+func (s *Server) WithAuth(authn Authenticator, acl ACL) *Server {
+	s.authn = authn
+	s.acl = acl
+	return s
+}
+
+// errorWriter writes an error response in the format of a route.
+type errorWriter func(w http.ResponseWriter, r *http.Request, status int, msg string)
+
+// guard wraps the handler of a route so that it only runs for requests
+// within the limits and allowed access to what they touch, that a
+// follower does not take writes, and that a cluster only serves them on
+// its leader. values returns the values the request stores, if any.
+func (s *Server) guard(route access, values func(*http.Request) []string, fail errorWriter, h http.HandlerFunc) http.HandlerFunc {
+	if route == nil {
+		route = func(*http.Request) []scope { return []scope{{"", PermAdmin}} }
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Cap the body first, since a signed request is read whole to
+		// check its signature, and so are those whose keys are in it.
+		if !s.limitBody(w, r, fail) {
+			return
+		}
+
+		var principal string
+		var authErr error
+		if s.authn != nil {
+			principal, authErr = s.authn.Authenticate(r)
+			if errors.Is(authErr, ErrNoCredentials) {
+				authErr = nil
+			}
+		}
+
+		// Limit before rejecting bad credentials, so that guessing
+		// them is slowed down too.
+		if !s.rateLimit(w, r, principal, fail) {
+			return
+		}
+		if authErr != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kv"`)
+			fail(w, r, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+
+		scopes := route(r)
+		if !s.checkSizes(w, r, scopes, values, fail) {
+			return
+		}
+
+		if s.authn != nil {
+			for _, sc := range scopes {
+				if s.acl.Allows(principal, sc.prefix, sc.perm) {
+					continue
+				}
+				if principal == "" {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="kv"`)
+					fail(w, r, http.StatusUnauthorized, "Authentication required")
+					return
+				}
+				fail(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+		}
+
+		if s.readOnly() {
+			for _, sc := range scopes {
+				if sc.perm == PermWrite {
+					s.misdirected(w, r, fail)
+					return
+				}
+			}
+		}
+		if c, ok := s.store.(kvstore.Consensus); ok && !s.linearize(w, r, c, scopes, fail) {
+			return
+		}
+		h(w, r)
+	}
+}
+
+// writeError writes a legacy JSON error response.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": msg,
+	})
+}
+
+// queryKeyAccess needs perm on the ?key= of a request.
+func queryKeyAccess(perm Permission) access {
+	return func(r *http.Request) []scope {
+		return []scope{{r.URL.Query().Get("key"), perm}}
+	}
+}
+
+// pathKeyAccess needs perm on the {key} of a request path.
+func pathKeyAccess(perm Permission) access {
+	return func(r *http.Request) []scope {
+		return []scope{{r.PathValue("key"), perm}}
+	}
+}
+
+// bodyKey needs perm on the "key" of a JSON request body.
+func bodyKey(perm Permission) access {
+	return func(r *http.Request) []scope {
+		var req struct {
+			Key string `json:"key"`
+		}
+		if !peekJSON(r, &req) {
+			return []scope{{"", perm}}
+		}
+		return []scope{{req.Key, perm}}
+	}
+}
+
+// bodyKeys needs perm on each of the "keys" of a JSON request body.
+func bodyKeys(perm Permission) access {
+	return func(r *http.Request) []scope {
+		var req struct {
+			Keys []string `json:"keys"`
+		}
+		if !peekJSON(r, &req) {
+			return []scope{{"", perm}}
+		}
+
+		scopes := make([]scope, len(req.Keys))
+		for i, key := range req.Keys {
+			scopes[i] = scope{key, perm}
+		}
+		return scopes
+	}
+}
+
+func msetAccess(r *http.Request) []scope {
+	var req struct {
+		Entries []struct {
+			Key string `json:"key"`
+		} `json:"entries"`
+	}
+	if !peekJSON(r, &req) {
+		return []scope{{"", PermWrite}}
+	}
+
+	scopes := make([]scope, len(req.Entries))
+	for i, e := range req.Entries {
+		scopes[i] = scope{e.Key, PermWrite}
+	}
+	return scopes
+}
+
+// txnAccess needs read on the keys a transaction gets and write on the
+// ones it changes.
+func txnAccess(r *http.Request) []scope {
+	var req struct {
+		Ops []struct {
+			Op  string `json:"op"`
+			Key string `json:"key"`
+		} `json:"ops"`
+	}
+	if !peekJSON(r, &req) {
+		return []scope{{"", PermWrite}}
+	}
+
+	scopes := make([]scope, len(req.Ops))
+	for i, op := range req.Ops {
+		perm := PermWrite
+		if op.Op == "get" {
+			perm = PermRead
+		}
+		scopes[i] = scope{op.Key, perm}
+	}
+	return scopes
+}
+
+// keysAccess needs read on the ?prefix= of a listing. Listing
+// expirations covers every key.
+func keysAccess(r *http.Request) []scope {
+	query := r.URL.Query()
+	if query.Get("expirations") == "true" {
+		return []scope{{"", PermRead}}
+	}
+	return []scope{{query.Get("prefix"), PermRead}}
+}
+
+// peekJSON decodes the JSON body of r into v, leaving the body for the
+// handler to read again. If it fails the keys are unknown, so callers
+// check the request against the whole store instead.
+func peekJSON(r *http.Request, v any) bool {
+	body, err := peekBody(r)
+	if err != nil {
+		return false
+	}
+	return json.NewDecoder(bytes.NewReader(body)).Decode(v) == nil
+}
@@ -0,0 +1,152 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func newAuthServer(t *testing.T) *Server {
+	t.Helper()
+	store := kvstore.NewPersistentStore()
+	if _, err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Stop)
+
+	store.Set("app:a", "1")
+	store.Set("secret", "2")
+	store.Set("public:a", "3")
+
+	return NewServer(store).WithAuth(
+		BearerTokens{"alice-token": "alice", "ops-token": "ops"},
+		ACL{
+			"alice": {{Prefix: "app:", Permission: PermWrite}},
+			"ops":   {{Prefix: "", Permission: PermAdmin}},
+			Anyone:  {{Prefix: "public:", Permission: PermRead}},
+		},
+	)
+}
+
+func TestAuthorization(t *testing.T) {
+	s := newAuthServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		token  string
+		want   int
+	}{
+		{"ReadOwnPrefix", http.MethodGet, "/get?key=app:a", "", "alice-token", http.StatusOK},
+		{"ReadOtherKey", http.MethodGet, "/get?key=secret", "", "alice-token", http.StatusForbidden},
+		{"WriteOwnPrefix", http.MethodPost, "/set", `{"key":"app:b","value":"x"}`, "alice-token", http.StatusCreated},
+		{"WriteOtherKey", http.MethodPost, "/set", `{"key":"secret","value":"x"}`, "alice-token", http.StatusForbidden},
+		{"DeleteOtherKey", http.MethodDelete, "/delete?key=secret", "", "alice-token", http.StatusForbidden},
+		{"MSetOneOtherKey", http.MethodPost, "/mset", `{"entries":[{"key":"app:c","value":"x"},{"key":"secret","value":"x"}]}`, "alice-token", http.StatusForbidden},
+		{"MGetOwnKeys", http.MethodPost, "/mget", `{"keys":["app:a","app:b"]}`, "alice-token", http.StatusOK},
+		{"TxnWritesOtherKey", http.MethodPost, "/txn", `{"ops":[{"op":"get","key":"app:a"},{"op":"delete","key":"secret"}]}`, "alice-token", http.StatusForbidden},
+		{"UndecodableBody", http.MethodPost, "/set", `{"key":`, "alice-token", http.StatusForbidden},
+		{"ListOwnPrefix", http.MethodGet, "/keys?prefix=app:", "", "alice-token", http.StatusOK},
+		{"ListEverything", http.MethodGet, "/keys", "", "alice-token", http.StatusForbidden},
+		{"AdminAsUser", http.MethodGet, "/admin/snapshot/stats", "", "alice-token", http.StatusForbidden},
+		{"AdminAsAdmin", http.MethodGet, "/admin/snapshot/stats", "", "ops-token", http.StatusOK},
+		{"MetricsAsAdmin", http.MethodGet, "/metrics", "", "ops-token", http.StatusOK},
+		{"AnonymousPublic", http.MethodGet, "/get?key=public:a", "", "", http.StatusOK},
+		{"AnonymousPrivate", http.MethodGet, "/get?key=app:a", "", "", http.StatusUnauthorized},
+		{"AnonymousWrite", http.MethodPost, "/set", `{"key":"public:a","value":"x"}`, "", http.StatusUnauthorized},
+		{"BadToken", http.MethodGet, "/get?key=public:a", "", "nope", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("got status %d want %d: %s", rr.Code, tt.want, rr.Body)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			if rr.Code == http.StatusUnauthorized || rr.Code == http.StatusForbidden {
+				var body map[string]string
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+					t.Errorf("got body %v, %v want a JSON error", body, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizationKeyResource(t *testing.T) {
+	s := newAuthServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"Get", http.MethodGet, "/v1/keys/app:a", http.StatusOK},
+		{"PutOtherKey", http.MethodPut, "/v1/keys/secret", http.StatusForbidden},
+		{"AliasOtherKey", http.MethodGet, "/kv/secret", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("x"))
+			req.Header.Set("Authorization", "Bearer alice-token")
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("got status %d want %d: %s", rr.Code, tt.want, rr.Body)
+			}
+			if rr.Code == http.StatusForbidden {
+				if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Errorf("got Content-Type %q want application/problem+json", ct)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizationHMAC(t *testing.T) {
+	s := newAuthServer(t)
+	s.WithAuth(Authenticators{s.authn, HMACKeys{"k1": {Principal: "alice", Secret: "shh"}}}, s.acl)
+
+	req := httptest.NewRequest(http.MethodPost, "/set", strings.NewReader(`{"key":"app:signed","value":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	SignRequest(req, "k1", "shh", time.Now())
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	if v, _ := s.store.Get("app:signed"); v != "x" {
+		t.Errorf("got value %q want x", v)
+	}
+}
+
+func TestNoAuthByDefault(t *testing.T) {
+	s := NewServer(kvstore.NewMemoryStore())
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+}
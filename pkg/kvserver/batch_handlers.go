@@ -0,0 +1,240 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// batchResult is the outcome for one key of a batch request. Status is
+// what the single-key endpoint would have answered for it.
+type batchResult struct {
+	Key     string  `json:"key"`
+	Value   *string `json:"value,omitempty"`
+	Version uint64  `json:"version,omitempty"`
+	Status  int     `json:"status"`
+}
+
+// MSetHandler sets many keys with one lock acquisition:
+//
+//	{"entries": [{"key": "a", "value": "1"}, {"key": "b", "value": "2", "ttl": "1m"}]}
+//
+// Either every entry is set or, if the store cannot make room for them
+// all, none is.
+func (s *Server) MSetHandler(w http.ResponseWriter, r *http.Request) {
+	batcher, ok := s.batcher(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Entries []struct {
+			Key   string          `json:"key"`
+			Value string          `json:"value"`
+			TTL   json.RawMessage `json:"ttl"`
+		} `json:"entries"`
+	}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Entries) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return
+	}
+
+	entries := make([]kvstore.Entry, len(req.Entries))
+	for i, e := range req.Entries {
+		if e.Key == "" || e.Value == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "Key and Value are required",
+				"index": i,
+			})
+			return
+		}
+
+		ttl, err := parseTTL(e.TTL)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "Invalid ttl",
+				"index": i,
+			})
+			return
+		}
+
+		entries[i] = kvstore.Entry{Key: e.Key, Value: e.Value, TTL: ttl}
+	}
+
+	versions, err := batcher.MSet(entries)
+	if errors.Is(err, kvstore.ErrStoreFull) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInsufficientStorage)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Store is full",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	results := make([]batchResult, len(entries))
+	for i, e := range entries {
+		results[i] = batchResult{Key: e.Key, Version: versions[i], Status: http.StatusCreated}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"results": results,
+	})
+}
+
+// MGetHandler reads many keys with one lock acquisition:
+//
+//	{"keys": ["a", "b"]}
+func (s *Server) MGetHandler(w http.ResponseWriter, r *http.Request) {
+	batcher, ok := s.batcher(w, r)
+	if !ok {
+		return
+	}
+
+	keys, ok := decodeKeys(w, r)
+	if !ok {
+		return
+	}
+
+	values := batcher.MGet(keys)
+
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		results[i] = batchResult{Key: key, Status: http.StatusNotFound}
+		if val, exists := values[key]; exists {
+			results[i].Value = &val
+			results[i].Status = http.StatusOK
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"results": results,
+	})
+}
+
+// MDeleteHandler deletes many keys with one lock acquisition:
+//
+//	{"keys": ["a", "b"]}
+func (s *Server) MDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	batcher, ok := s.batcher(w, r)
+	if !ok {
+		return
+	}
+
+	keys, ok := decodeKeys(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := batcher.MDelete(keys)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		results[i] = batchResult{Key: key, Status: http.StatusNotFound}
+		if found[i] {
+			results[i].Status = http.StatusOK
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"results": results,
+	})
+}
+
+// batcher checks the method and content type shared by the batch
+// endpoints and returns the store as a Batcher. It writes the error
+// response itself if the request cannot proceed.
+func (s *Server) batcher(w http.ResponseWriter, r *http.Request) (kvstore.Batcher, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return nil, false
+	}
+
+	batcher, ok := s.store.(kvstore.Batcher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Batches are not supported by this store",
+		})
+		return nil, false
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Content-Type must be application/json",
+		})
+		return nil, false
+	}
+
+	return batcher, true
+}
+
+// decodeKeys reads the {"keys": [...]} body of /mget and /mdelete.
+func decodeKeys(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req struct {
+		Keys []string `json:"keys"`
+	}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Keys) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return nil, false
+	}
+
+	for i, key := range req.Keys {
+		if key == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "Key is required",
+				"index": i,
+			})
+			return nil, false
+		}
+	}
+	return req.Keys, true
+}
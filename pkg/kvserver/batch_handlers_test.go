@@ -0,0 +1,111 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func postBatch(t *testing.T, server *Server, path, body string) (int, []batchResult) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var resp struct {
+		Results []batchResult `json:"results"`
+	}
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, resp.Results
+}
+
+func TestBatchHandlers(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	code, results := postBatch(t, server, "/mset", `{"entries":[{"key":"a","value":"1"},{"key":"b","value":"2","ttl":"1m"}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d want %d", code, http.StatusOK)
+	}
+	for _, res := range results {
+		if res.Status != http.StatusCreated || res.Version == 0 {
+			t.Errorf("got %+v, want a created key with a version", res)
+		}
+	}
+	if ttl, _ := store.TTL("b"); ttl <= 0 {
+		t.Errorf("expected b to have a ttl")
+	}
+
+	_, results = postBatch(t, server, "/mget", `{"keys":["a","missing","b"]}`)
+	wantStatus := []int{http.StatusOK, http.StatusNotFound, http.StatusOK}
+	for i, res := range results {
+		if res.Status != wantStatus[i] {
+			t.Errorf("%s: got status %d want %d", res.Key, res.Status, wantStatus[i])
+		}
+	}
+	if results[0].Value == nil || *results[0].Value != "1" {
+		t.Errorf("got %v want value 1", results[0].Value)
+	}
+	if results[1].Value != nil {
+		t.Errorf("expected no value for a missing key")
+	}
+
+	_, results = postBatch(t, server, "/mdelete", `{"keys":["a","missing"]}`)
+	if results[0].Status != http.StatusOK || results[1].Status != http.StatusNotFound {
+		t.Errorf("got %+v, want a deleted and a missing key", results)
+	}
+	if _, exists := store.Get("a"); exists {
+		t.Errorf("expected a to be deleted")
+	}
+}
+
+func TestBatchHandlersBadRequests(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Invalid body", "/mget", `{invalid}`, http.StatusBadRequest},
+		{"No keys", "/mdelete", `{"keys":[]}`, http.StatusBadRequest},
+		{"Empty key", "/mget", `{"keys":["a",""]}`, http.StatusBadRequest},
+		{"Missing value", "/mset", `{"entries":[{"key":"a"}]}`, http.StatusBadRequest},
+		{"Invalid ttl", "/mset", `{"entries":[{"key":"a","value":"1","ttl":"soon"}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := postBatch(t, server, tt.path, tt.body); code != tt.wantStatus {
+				t.Errorf("got status %d want %d", code, tt.wantStatus)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/mget", nil)
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestMSetHandlerStoreFull(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore().WithMaxEntries(1))
+
+	code, _ := postBatch(t, server, "/mset", `{"entries":[{"key":"a","value":"1"},{"key":"b","value":"2"}]}`)
+	if code != http.StatusInsufficientStorage {
+		t.Errorf("got status %d want %d", code, http.StatusInsufficientStorage)
+	}
+}
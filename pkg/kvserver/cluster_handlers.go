@@ -0,0 +1,213 @@
+package kvserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+	"golang-learning/pkg/raft"
+)
+
+// LeaderHeader tells a client that a member of a cluster refused its
+// request which server leads the cluster.
+const LeaderHeader = "X-KV-Leader"
+
+// clusterTimeout bounds how long a request waits on the cluster: a read
+// for the leader to confirm it still leads, which it cannot while cut off
+// from a quorum, or a membership change to commit.
+var clusterTimeout = 5 * time.Second
+
+// linearize lets a request on a cluster go ahead only on the leader: a
+// write is refused elsewhere, and a read waits until the leader has
+// confirmed with a quorum that nothing newer was committed. Requests that
+// only need admin, such as Raft messages, go ahead on any member.
+func (s *Server) linearize(w http.ResponseWriter, r *http.Request, c kvstore.Consensus, scopes []scope, fail errorWriter) bool {
+	var reads, writes bool
+	for _, sc := range scopes {
+		reads = reads || sc.perm == PermRead
+		writes = writes || sc.perm == PermWrite
+	}
+
+	switch {
+	case writes:
+		if !c.IsLeader() {
+			s.misdirected(w, r, fail)
+			return false
+		}
+	case reads:
+		ctx, cancel := context.WithTimeout(r.Context(), clusterTimeout)
+		defer cancel()
+		err := c.ReadBarrier(ctx)
+		if errors.Is(err, kvstore.ErrNotLeader) {
+			s.misdirected(w, r, fail)
+			return false
+		}
+		if err != nil {
+			fail(w, r, http.StatusServiceUnavailable, "Cluster unavailable")
+			return false
+		}
+	}
+	return true
+}
+
+// RaftMessageHandler takes a batch of Raft messages from another member
+// of the cluster. MaxBodyBytes does not apply, as the batch may hold a
+// snapshot of the whole store.
+func (s *Server) RaftMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	c, ok := s.store.(kvstore.Consensus)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Clustering is not supported by this store",
+		})
+		return
+	}
+
+	var msgs []raft.Message
+	if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid JSON",
+		})
+		return
+	}
+
+	for _, m := range msgs {
+		if err := c.Step(m); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Cluster unavailable",
+			})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClusterStatusHandler serves the role and term of this member, the
+// leader it knows of and the members of the cluster.
+func (s *Server) ClusterStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	c, ok := s.store.(kvstore.Consensus)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Clustering is not supported by this store",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c.ClusterStatus())
+}
+
+type memberRequest struct {
+	ID   uint64 `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// AddMemberHandler adds a server to the cluster:
+//
+//	POST /admin/cluster/add {"id": 4, "addr": "http://kv-4:8080"}
+//
+// Start the server to join the cluster first. It must be sent to the
+// leader, and one change is made at a time.
+func (s *Server) AddMemberHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeMembers(w, r, true, func(ctx context.Context, c kvstore.Consensus, req memberRequest) error {
+		return c.AddMember(ctx, req.ID, req.Addr)
+	})
+}
+
+// RemoveMemberHandler removes a server from the cluster:
+//
+//	POST /admin/cluster/remove {"id": 4}
+func (s *Server) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeMembers(w, r, false, func(ctx context.Context, c kvstore.Consensus, req memberRequest) error {
+		return c.RemoveMember(ctx, req.ID)
+	})
+}
+
+// changeMembers proposes the membership change in the body of r, which
+// needs an address if needAddr is set.
+func (s *Server) changeMembers(w http.ResponseWriter, r *http.Request, needAddr bool, change func(context.Context, kvstore.Consensus, memberRequest) error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	c, ok := s.store.(kvstore.Consensus)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Clustering is not supported by this store",
+		})
+		return
+	}
+
+	var req memberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 || (needAddr && req.Addr == "") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid member",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), clusterTimeout)
+	defer cancel()
+	err := change(ctx, c, req)
+	switch {
+	case errors.Is(err, kvstore.ErrNotLeader):
+		s.misdirected(w, r, writeError)
+		return
+	case errors.Is(err, raft.ErrConfChangePending):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Another membership change is in progress",
+		})
+		return
+	case err != nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Cluster unavailable",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c.ClusterStatus())
+}
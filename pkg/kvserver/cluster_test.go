@@ -0,0 +1,322 @@
+package kvserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+	"golang-learning/pkg/raft"
+)
+
+type clusterNode struct {
+	id        uint64
+	store     *kvstore.RaftStore
+	server    *Server
+	http      *httptest.Server
+	transport *RaftTransport
+	limits    Limits
+	stop      func()
+}
+
+// newClusterNodes reserves a loopback address for each of n servers, so
+// that every node can be told where the others are before it starts.
+func newClusterNodes(t *testing.T, n int) ([]*clusterNode, []raft.Peer) {
+	t.Helper()
+
+	var nodes []*clusterNode
+	var peers []raft.Peer
+	for i := range n {
+		node := &clusterNode{id: uint64(i + 1)}
+		node.http = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node.server.ServeHTTP(w, r)
+		}))
+		nodes = append(nodes, node)
+		peers = append(peers, raft.Peer{ID: node.id, Addr: "http://" + node.http.Listener.Addr().String()})
+	}
+	return nodes, peers
+}
+
+// start runs node in the cluster of peers until the test ends or stop
+// is called.
+func (node *clusterNode) start(t *testing.T, peers []raft.Peer, join bool) {
+	t.Helper()
+
+	node.transport = NewRaftTransport()
+	store, err := kvstore.NewRaftStore(raft.Config{ID: node.id, Peers: peers, Join: join}, node.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.store = store.WithTickInterval(5 * time.Millisecond)
+	node.server = NewServer(store).WithLimits(node.limits)
+	node.http.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Run(ctx)
+		close(done)
+	}()
+
+	stopped := false
+	node.stop = func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		cancel()
+		<-done
+		node.transport.Close()
+		node.http.CloseClientConnections()
+		node.http.Close()
+		store.Stop()
+	}
+	t.Cleanup(node.stop)
+}
+
+func newCluster(t *testing.T, n int) []*clusterNode {
+	t.Helper()
+
+	nodes, peers := newClusterNodes(t, n)
+	for _, node := range nodes {
+		node.start(t, peers, false)
+	}
+	return nodes
+}
+
+func clusterLeader(t *testing.T, nodes []*clusterNode) *clusterNode {
+	t.Helper()
+
+	var lead *clusterNode
+	waitFor(t, "a leader", func() bool {
+		for _, node := range nodes {
+			if node.store.IsLeader() {
+				lead = node
+				return true
+			}
+		}
+		return false
+	})
+	return lead
+}
+
+func TestClusterOverHTTP(t *testing.T) {
+	nodes := newCluster(t, 3)
+	lead := clusterLeader(t, nodes)
+
+	resp, err := http.Post(lead.http.URL+"/set", "application/json", strings.NewReader(`{"key":"k","value":"v"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d for a write to the leader", resp.StatusCode)
+	}
+
+	resp, err = http.Get(lead.http.URL + "/get?key=k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || body["value"] != "v" {
+		t.Errorf("got %d %v from the leader", resp.StatusCode, body)
+	}
+
+	for _, node := range nodes {
+		waitFor(t, "replication", func() bool {
+			v, _ := node.store.Get("k")
+			return v == "v"
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	lead.server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/cluster", nil))
+	var st raft.Status
+	json.NewDecoder(rr.Body).Decode(&st)
+	if rr.Code != http.StatusOK || st.Role != raft.Leader || len(st.Members) != 3 {
+		t.Errorf("got status %d %+v", rr.Code, st)
+	}
+}
+
+func TestClusterIgnoresBodyLimit(t *testing.T) {
+	nodes, peers := newClusterNodes(t, 3)
+	for _, node := range nodes {
+		node.limits = Limits{MaxBodyBytes: 256}
+		node.start(t, peers, false)
+	}
+	lead := clusterLeader(t, nodes)
+
+	// The entry is larger than the limit, and is sent to the others in a
+	// Raft message that is larger still.
+	value := strings.Repeat("v", 1024)
+	if err := lead.store.Set("k", value); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range nodes {
+		waitFor(t, "replication", func() bool {
+			v, _ := node.store.Get("k")
+			return v == value
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	body := `{"key":"k2","value":"` + value + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/set", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	lead.server.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for a client write over the limit", rr.Code)
+	}
+}
+
+func TestClusterFollowerRedirects(t *testing.T) {
+	nodes := newCluster(t, 3)
+	lead := clusterLeader(t, nodes)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"Set", http.MethodPost, "/set", `{"key":"k","value":"v"}`},
+		{"Delete", http.MethodDelete, "/delete?key=k", ""},
+		{"Expire", http.MethodPost, "/expire", `{"key":"k","ttl":"1m"}`},
+		// Reads are only linearizable on the leader.
+		{"Get", http.MethodGet, "/get?key=k", ""},
+		{"Keys", http.MethodGet, "/keys", ""},
+		{"AddMember", http.MethodPost, "/admin/cluster/add", `{"id":9,"addr":"http://x"}`},
+	}
+
+	for _, node := range nodes {
+		if node == lead {
+			continue
+		}
+		waitFor(t, "the leader to be known", func() bool { return node.store.Leader() == lead.http.URL })
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+				rr := httptest.NewRecorder()
+				node.server.ServeHTTP(rr, req)
+
+				if rr.Code != http.StatusMisdirectedRequest {
+					t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusMisdirectedRequest, rr.Body)
+				}
+				if got := rr.Header().Get(LeaderHeader); got != lead.http.URL {
+					t.Errorf("got %s %q want %q", LeaderHeader, got, lead.http.URL)
+				}
+			})
+		}
+	}
+}
+
+func TestClusterKeyResource(t *testing.T) {
+	nodes := newCluster(t, 3)
+	lead := clusterLeader(t, nodes)
+
+	do := func(node *clusterNode, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		node.server.ServeHTTP(rr, req)
+		return rr
+	}
+	png := http.Header{"Content-Type": {"image/png"}}
+
+	if rr := do(lead, http.MethodPut, "/v1/keys/logo", "\x89PNG", png); rr.Code != http.StatusCreated || rr.Header().Get("ETag") == "" {
+		t.Fatalf("got status %d, ETag %q for a PUT to the leader", rr.Code, rr.Header().Get("ETag"))
+	}
+	rr := do(lead, http.MethodGet, "/kv/logo", "", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "\x89PNG" || rr.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("got %d %q %q from the leader", rr.Code, rr.Header().Get("Content-Type"), rr.Body)
+	}
+	for _, node := range nodes {
+		waitFor(t, "replication", func() bool {
+			c, _ := node.store.GetContent("logo")
+			return c.ContentType == "image/png"
+		})
+	}
+
+	if rr := do(lead, http.MethodPut, "/v1/keys/logo", "x", http.Header{"If-None-Match": {"*"}}); rr.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d for a conditional PUT", rr.Code)
+	}
+	if rr := do(lead, http.MethodDelete, "/v1/keys/logo", "", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("got status %d for a DELETE on the leader", rr.Code)
+	}
+
+	for _, node := range nodes {
+		if node == lead {
+			continue
+		}
+		waitFor(t, "the leader to be known", func() bool { return node.store.Leader() == lead.http.URL })
+		for _, method := range []string{http.MethodPut, http.MethodGet} {
+			rr := do(node, method, "/v1/keys/logo", "x", png)
+			if rr.Code != http.StatusMisdirectedRequest || rr.Header().Get(LeaderHeader) != lead.http.URL {
+				t.Errorf("%s on a follower: got status %d, leader %q", method, rr.Code, rr.Header().Get(LeaderHeader))
+			}
+		}
+	}
+}
+
+func TestClusterReadsNeedQuorum(t *testing.T) {
+	defer func(d time.Duration) { clusterTimeout = d }(clusterTimeout)
+	clusterTimeout = 200 * time.Millisecond
+
+	nodes := newCluster(t, 3)
+	lead := clusterLeader(t, nodes)
+	for _, node := range nodes {
+		if node != lead {
+			node.stop()
+		}
+	}
+
+	// Cut off from the others, the leader cannot confirm that it still
+	// leads, so it must not answer from what may be stale.
+	rr := httptest.NewRecorder()
+	lead.server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?key=k", nil))
+	if rr.Code != http.StatusServiceUnavailable && rr.Code != http.StatusMisdirectedRequest {
+		t.Errorf("got status %d for a read without a quorum", rr.Code)
+	}
+}
+
+func TestClusterAddMember(t *testing.T) {
+	nodes, peers := newClusterNodes(t, 4)
+	for _, node := range nodes[:3] {
+		node.start(t, peers[:3], false)
+	}
+	lead := clusterLeader(t, nodes[:3])
+	lead.store.Set("before", "1")
+
+	joining := nodes[3]
+	joining.start(t, peers[:3], true)
+	body := `{"id":4,"addr":"` + peers[3].Addr + `"}`
+	resp, err := http.Post(lead.http.URL+"/admin/cluster/add", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d adding a member", resp.StatusCode)
+	}
+
+	lead.store.Set("after", "2")
+	waitFor(t, "the new member to catch up", func() bool {
+		v, _ := joining.store.Get("after")
+		return v == "2"
+	})
+	if v, _ := joining.store.Get("before"); v != "1" {
+		t.Errorf("new member got before=%q", v)
+	}
+	if got := len(joining.store.ClusterStatus().Members); got != 4 {
+		t.Errorf("new member sees %d members want 4", got)
+	}
+}
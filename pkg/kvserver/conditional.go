@@ -0,0 +1,84 @@
+package kvserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang-learning/pkg/kvstore"
+)
+
+var errInvalidPrecondition = errors.New("invalid If-Match or If-None-Match header")
+
+// precondition is the condition a write request puts on the current
+// version of a key, taken from its If-Match or If-None-Match header.
+type precondition struct {
+	ifMatch     bool   // If-Match: the key must exist...
+	version     uint64 // ...at this version, or at any if zero
+	ifNoneMatch bool   // If-None-Match: *, the key must not exist
+}
+
+// parsePrecondition reads the conditional headers of r. If-Match takes
+// "*" or a single strong ETag; If-None-Match only "*", since a write that
+// must not match one particular version is not something clients need.
+func parsePrecondition(r *http.Request) (precondition, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+
+	switch {
+	case ifMatch != "" && ifNoneMatch != "":
+		return precondition{}, errInvalidPrecondition
+	case ifNoneMatch == "*":
+		return precondition{ifNoneMatch: true}, nil
+	case ifNoneMatch != "":
+		return precondition{}, errInvalidPrecondition
+	case ifMatch == "*":
+		return precondition{ifMatch: true}, nil
+	case ifMatch != "":
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			return precondition{}, err
+		}
+		return precondition{ifMatch: true, version: version}, nil
+	}
+	return precondition{}, nil
+}
+
+// conditional reports whether the request carried a precondition at all.
+func (p precondition) conditional() bool {
+	return p.ifMatch || p.ifNoneMatch
+}
+
+// etag formats a key version as a strong entity tag.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETag is the inverse of etag. Weak tags are rejected because
+// If-Match uses strong comparison.
+func parseETag(tag string) (uint64, error) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidPrecondition
+	}
+
+	version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version == 0 {
+		return 0, errInvalidPrecondition
+	}
+	return version, nil
+}
+
+// preconditionFailed maps the errors of conditional writes to the message
+// sent with a 412, and reports whether err was one of them.
+func preconditionFailed(err error) (string, bool) {
+	switch {
+	case errors.Is(err, kvstore.ErrKeyExists):
+		return "Key already exists", true
+	case errors.Is(err, kvstore.ErrKeyNotFound):
+		return "Key not found", true
+	case errors.Is(err, kvstore.ErrVersionMismatch):
+		return "Version mismatch", true
+	}
+	return "", false
+}
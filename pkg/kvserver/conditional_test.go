@@ -0,0 +1,142 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	set := func(value string, header, tag string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"key": "foo", "value": value})
+		req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, tag)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	del := func(tag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/delete?key=foo", nil)
+		req.Header.Set("If-Match", tag)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	wantError := func(t *testing.T, rr *httptest.ResponseRecorder, status int, msg string) {
+		t.Helper()
+
+		if rr.Code != status {
+			t.Fatalf("got status %d want %d", rr.Code, status)
+		}
+
+		var got map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got["error"] != msg {
+			t.Errorf("got %q want %q", got["error"], msg)
+		}
+	}
+
+	rr := set("1", "If-Match", "*")
+	wantError(t, rr, http.StatusPreconditionFailed, "Key not found")
+
+	rr = set("1", "If-None-Match", "*")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+	}
+	first := rr.Header().Get("ETag")
+	if first == "" {
+		t.Fatal("expected an ETag on a conditional set")
+	}
+
+	rr = set("2", "If-None-Match", "*")
+	wantError(t, rr, http.StatusPreconditionFailed, "Key already exists")
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=foo", nil)
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	if got := rr.Header().Get("ETag"); got != first {
+		t.Errorf("got ETag %q from /get want %q", got, first)
+	}
+
+	rr = set("2", "If-Match", first)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+	}
+	second := rr.Header().Get("ETag")
+	if second == first {
+		t.Errorf("expected a new ETag after a write, got %q again", second)
+	}
+
+	rr = set("3", "If-Match", first)
+	wantError(t, rr, http.StatusPreconditionFailed, "Version mismatch")
+
+	rr = del(first)
+	wantError(t, rr, http.StatusPreconditionFailed, "Version mismatch")
+
+	rr = del(second)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+
+	rr = del(second)
+	wantError(t, rr, http.StatusPreconditionFailed, "Key not found")
+}
+
+func TestInvalidPreconditions(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{name: "Weak ETag", headers: map[string]string{"If-Match": `W/"1"`}},
+		{name: "Unquoted ETag", headers: map[string]string{"If-Match": "1"}},
+		{name: "ETag list", headers: map[string]string{"If-Match": `"1", "2"`}},
+		{name: "If-None-Match ETag", headers: map[string]string{"If-None-Match": `"1"`}},
+		{name: "Both headers", headers: map[string]string{"If-Match": "*", "If-None-Match": "*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBufferString(`{"key":"foo","value":"bar"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("got status %d want %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestConditionalRequestsUnsupported(t *testing.T) {
+	// Embedding only the Store interface hides the Versioner methods.
+	server := NewServer(struct{ kvstore.Store }{kvstore.NewMemoryStore()})
+
+	req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBufferString(`{"key":"foo","value":"bar"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-None-Match", "*")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusNotImplemented)
+	}
+}
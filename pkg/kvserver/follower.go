@@ -0,0 +1,287 @@
+package kvserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// PrimaryHeader tells a client that a follower refused its write which
+// server to send it to instead.
+const PrimaryHeader = "X-KV-Primary"
+
+const (
+	minFollowRetry = 100 * time.Millisecond
+	maxFollowRetry = 10 * time.Second
+)
+
+// errGone is returned when the primary no longer has the entries after
+// the follower's position, so it must bootstrap again.
+var errGone = errors.New("primary log does not continue from this position")
+
+// FollowerStatus describes how a follower is keeping up with its primary.
+type FollowerStatus struct {
+	Primary     string                      `json:"primary"`
+	Connected   bool                        `json:"connected"`
+	Position    kvstore.ReplicationPosition `json:"position"`
+	PrimarySeq  uint64                      `json:"primary_seq"`  // As of LastContact
+	Lag         uint64                      `json:"lag_entries"`  // Entries behind PrimarySeq
+	LastContact *time.Time                  `json:"last_contact"` // Last message from the primary
+	Bootstraps  int                         `json:"bootstraps"`
+	Error       string                      `json:"error,omitempty"` // Of the last attempt, if it failed
+}
+
+// Follower keeps a store in step with a primary server: it loads a
+// snapshot of the primary, then applies the primary's log as it is
+// streamed, bootstrapping again whenever the log no longer continues from
+// where the store is.
+type Follower struct {
+	store   kvstore.Replicator
+	primary string
+	client  *http.Client
+	token   string
+
+	mu       sync.Mutex
+	status   FollowerStatus
+	promoted bool
+	cancel   context.CancelFunc // Of the running Run, if any
+}
+
+// NewFollower returns a follower of the server at the base URL primary,
+// and makes store a read-only follower. Call Run to start following.
+func NewFollower(store kvstore.Replicator, primary string) *Follower {
+	store.Follow()
+	return &Follower{
+		store:   store,
+		primary: strings.TrimSuffix(primary, "/"),
+		client:  http.DefaultClient,
+		status:  FollowerStatus{Primary: primary},
+	}
+}
+
+// WithClient sets the client used to reach the primary, which is
+// http.DefaultClient otherwise. It must not time out whole requests,
+// since the stream does not end.
+func (f *Follower) WithClient(client *http.Client) *Follower {
+	f.client = client
+	return f
+}
+
+// WithToken authenticates to the primary with a bearer token, which needs
+// admin on the whole store.
+func (f *Follower) WithToken(token string) *Follower {
+	f.token = token
+	return f
+}
+
+// Primary returns the base URL of the primary.
+func (f *Follower) Primary() string {
+	return f.primary
+}
+
+// Promoted reports whether Promote was called.
+func (f *Follower) Promoted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.promoted
+}
+
+// Status returns the position of the store and how far it is behind the
+// primary.
+func (f *Follower) Status() FollowerStatus {
+	pos := f.store.ReplicationStatus().Position
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.status
+	st.Position = pos
+	if st.PrimarySeq > pos.Seq {
+		st.Lag = st.PrimarySeq - pos.Seq
+	}
+	return st
+}
+
+// Promote stops following and makes the store a primary.
+func (f *Follower) Promote() {
+	f.mu.Lock()
+	f.promoted = true
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.status.Connected = false
+	f.mu.Unlock()
+
+	f.store.Promote()
+}
+
+// Run follows the primary until ctx is done or the follower is promoted,
+// retrying with backoff when the primary cannot be reached.
+func (f *Follower) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f.mu.Lock()
+	if f.promoted {
+		f.mu.Unlock()
+		return nil
+	}
+	f.cancel = cancel
+	f.mu.Unlock()
+
+	retry := minFollowRetry
+	bootstrapped := false
+	for {
+		var err error
+		if !bootstrapped {
+			err = f.bootstrap(ctx)
+			bootstrapped = err == nil
+		}
+		if err == nil {
+			err = f.tail(ctx)
+			if errors.Is(err, errGone) || errors.Is(err, kvstore.ErrReplicationGap) {
+				bootstrapped = false
+			}
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if f.Promoted() {
+			return nil
+		}
+
+		f.mu.Lock()
+		f.status.Connected = false
+		if err != nil {
+			f.status.Error = err.Error()
+		}
+		f.mu.Unlock()
+
+		// A dropped stream that made progress is resumed at once.
+		if err == nil {
+			retry = minFollowRetry
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		retry = min(2*retry, maxFollowRetry)
+	}
+}
+
+// bootstrap replaces the contents of the store with a snapshot of the
+// primary.
+func (f *Follower) bootstrap(ctx context.Context) error {
+	resp, err := f.get(ctx, "/replication/snapshot")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	seq, err := strconv.ParseUint(resp.Header.Get(LogSeqHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("snapshot without a valid %s header", LogSeqHeader)
+	}
+	pos := kvstore.ReplicationPosition{LogID: resp.Header.Get(LogIDHeader), Seq: seq}
+	if err := f.store.LoadReplica(resp.Body, pos); err != nil {
+		return fmt.Errorf("load snapshot: %w", err)
+	}
+
+	f.mu.Lock()
+	f.status.Bootstraps++
+	f.contact(seq)
+	f.mu.Unlock()
+	return nil
+}
+
+// tail applies the stream of the primary's log from the position of the
+// store until it ends. It returns nil if the stream ended after making
+// progress, so that it can be resumed straight away.
+func (f *Follower) tail(ctx context.Context) error {
+	pos := f.store.ReplicationStatus().Position
+	query := url.Values{"log": {pos.LogID}, "seq": {strconv.FormatUint(pos.Seq, 10)}}
+	resp, err := f.get(ctx, "/replication/stream?"+query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	f.mu.Lock()
+	f.status.Connected = true
+	f.status.Error = ""
+	f.mu.Unlock()
+
+	applied := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var msg replicationMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("decode stream: %w", err)
+		}
+		if msg.Entry != nil {
+			if err := f.store.ApplyReplicated(*msg.Entry); err != nil {
+				return fmt.Errorf("apply entry %d: %w", msg.Entry.Seq, err)
+			}
+			applied = true
+		}
+
+		f.mu.Lock()
+		f.contact(msg.Head)
+		f.mu.Unlock()
+	}
+	if err := scanner.Err(); err != nil && !applied {
+		return err
+	}
+	if !applied {
+		return errors.New("stream ended")
+	}
+	return nil
+}
+
+// contact records a message from the primary, which was at head. The
+// caller must hold f.mu.
+func (f *Follower) contact(head uint64) {
+	now := time.Now()
+	f.status.LastContact = &now
+	f.status.PrimarySeq = head
+}
+
+// get requests path from the primary, failing unless it answers 200 OK.
+func (f *Follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.primary+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return nil, errGone
+	}
+	return nil, fmt.Errorf("%s: %s", path, resp.Status)
+}
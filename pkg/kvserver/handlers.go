@@ -0,0 +1,348 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func (s *Server) SetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Content-Type must be application/json",
+		})
+		return
+	}
+
+	var req struct {
+		Key   string          `json:"key"`
+		Value string          `json:"value"`
+		TTL   json.RawMessage `json:"ttl"`
+	}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return
+	}
+
+	if req.Key == "" || req.Value == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key and Value are required",
+		})
+		return
+	}
+
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid ttl",
+		})
+		return
+	}
+
+	cond, err := parsePrecondition(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid If-Match or If-None-Match header",
+		})
+		return
+	}
+
+	var version uint64
+	if cond.conditional() {
+		versioner, ok := s.store.(kvstore.Versioner)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotImplemented)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Conditional writes are not supported by this store",
+			})
+			return
+		}
+
+		if cond.ifNoneMatch {
+			version, err = versioner.SetIfAbsent(req.Key, req.Value, ttl)
+		} else {
+			version, err = versioner.CompareAndSwap(req.Key, cond.version, req.Value, ttl)
+		}
+	} else {
+		err = s.store.SetWithTTL(req.Key, req.Value, ttl)
+	}
+
+	if msg, ok := preconditionFailed(err); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": msg,
+		})
+		return
+	}
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if errors.Is(err, kvstore.ErrStoreFull) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInsufficientStorage)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Store is full",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	if version != 0 {
+		w.Header().Set("ETag", etag(version))
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) GetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return
+	}
+
+	var val string
+	var version uint64
+	var exists bool
+	if versioner, ok := s.store.(kvstore.Versioner); ok {
+		val, version, exists = versioner.GetWithVersion(key)
+	} else {
+		val, exists = s.store.Get(key)
+	}
+	if !exists {
+		if typed, ok := s.store.(kvstore.TypedStore); ok && typed.Type(key) != "" {
+			typedError(w, kvstore.ErrWrongType)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	resp := map[string]any{
+		"key":   key,
+		"value": val,
+	}
+	if expirer, ok := s.store.(kvstore.Expirer); ok {
+		if ttl, _ := expirer.TTL(key); ttl > 0 {
+			resp["ttl"] = ttl.Seconds()
+		}
+	}
+
+	if version != 0 {
+		w.Header().Set("ETag", etag(version))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return
+	}
+
+	cond, err := parsePrecondition(r)
+	if err != nil || cond.ifNoneMatch {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid If-Match header",
+		})
+		return
+	}
+
+	if cond.ifMatch {
+		versioner, ok := s.store.(kvstore.Versioner)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotImplemented)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Conditional writes are not supported by this store",
+			})
+			return
+		}
+
+		err = versioner.CompareAndDelete(key, cond.version)
+		if msg, ok := preconditionFailed(err); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": msg,
+			})
+			return
+		}
+	} else {
+		if !s.exists(key) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Key not found",
+			})
+			return
+		}
+		err = s.store.Delete(key)
+	}
+
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// exists reports whether key holds a value of any type: Get sees only
+// strings, not the lists, hashes and sets of a kvstore.TypedStore.
+func (s *Server) exists(key string) bool {
+	if typed, ok := s.store.(kvstore.TypedStore); ok {
+		return typed.Type(key) != ""
+	}
+	_, exists := s.store.Get(key)
+	return exists
+}
+
+func (s *Server) KeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	if r.URL.Query().Get("expirations") == "true" {
+		s.expirations(w)
+		return
+	}
+
+	if scanner, ok := s.store.(kvstore.Scanner); ok {
+		s.scanKeys(w, r, scanner)
+		return
+	}
+
+	if len(r.URL.Query()) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Listing options are not supported by this store",
+		})
+		return
+	}
+
+	keys := s.store.Keys()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]string{
+		"keys": keys,
+	})
+}
+
+// expirations lists every key with the time it expires.
+func (s *Server) expirations(w http.ResponseWriter) {
+	expirer, ok := s.store.(kvstore.Expirer)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Expirations are not supported by this store",
+		})
+		return
+	}
+
+	// Keys and expirations come from a single read of the store
+	// so that they are consistent with each other.
+	all := expirer.Expirations()
+	keys := make([]string, 0, len(all))
+	expirations := make(map[string]time.Time)
+	for k, exp := range all {
+		keys = append(keys, k)
+		if !exp.IsZero() {
+			expirations[k] = exp
+		}
+	}
+	slices.Sort(keys)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys":        keys,
+		"expirations": expirations,
+	})
+}
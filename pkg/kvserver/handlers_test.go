@@ -1,4 +1,4 @@
-package main
+package kvserver
 
 import (
 	"bytes"
@@ -8,10 +8,12 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+
+	"golang-learning/pkg/kvstore"
 )
 
 func TestSetHandler(t *testing.T) {
-	store := NewKVStore()
+	store := kvstore.NewMemoryStore()
 	server := NewServer(store)
 
 	tests := []struct {
@@ -126,7 +128,7 @@ func TestSetHandler(t *testing.T) {
 }
 
 func TestGetHandler(t *testing.T) {
-	store := NewKVStore()
+	store := kvstore.NewMemoryStore()
 	server := NewServer(store)
 
 	store.Set("foo", "bar")
@@ -201,7 +203,7 @@ func TestGetHandler(t *testing.T) {
 }
 
 func TestDeleteEndpoint(t *testing.T) {
-	store := NewKVStore()
+	store := kvstore.NewMemoryStore()
 	server := NewServer(store)
 
 	store.Set("foo", "bar")
@@ -289,7 +291,7 @@ func TestDeleteEndpoint(t *testing.T) {
 }
 
 func TestKeysEndpoint(t *testing.T) {
-	store := NewKVStore()
+	store := kvstore.NewMemoryStore()
 	server := NewServer(store)
 
 	tests := []struct {
@@ -371,3 +373,53 @@ func TestKeysEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestServerWithAnyStore(t *testing.T) {
+	stores := map[string]kvstore.Store{
+		"MemoryStore":  kvstore.NewMemoryStore(),
+		"TTLStore":     kvstore.NewTTLStore(),
+		"ShardedStore": kvstore.NewShardedStore(4),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if stopper, ok := store.(interface{ Stop() }); ok {
+				defer stopper.Stop()
+			}
+			server := NewServer(store)
+
+			req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBufferString(`{"key":"foo","value":"bar"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/get?key=foo", nil)
+			rr = httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("got status %d want %d", rr.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestSetHandlerStoreFull(t *testing.T) {
+	store := kvstore.NewMemoryStore().WithMaxEntries(1)
+	server := NewServer(store)
+
+	store.Set("foo", "bar")
+
+	req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBufferString(`{"key":"key","value":"value"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	server.SetHandler(rr, req)
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusInsufficientStorage)
+	}
+}
@@ -0,0 +1,83 @@
+package kvserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"golang-learning/pkg/kvstore"
+)
+
+const (
+	defaultKeysLimit = 1000
+	maxKeysLimit     = 10000
+)
+
+// scanKeys lists a page of keys in sorted order:
+//
+//	GET /keys?prefix=user:&match=user:*:name&start=a&end=m&limit=100&values=true
+//
+// When there are more keys the response carries a cursor; pass it back as
+// ?cursor= with the same filters to get the next page.
+func (s *Server) scanKeys(w http.ResponseWriter, r *http.Request, scanner kvstore.Scanner) {
+	query := r.URL.Query()
+	opts := kvstore.ScanOptions{
+		Prefix: query.Get("prefix"),
+		Match:  query.Get("match"),
+		Start:  query.Get("start"),
+		End:    query.Get("end"),
+		Limit:  defaultKeysLimit,
+		Values: query.Get("values") == "true",
+	}
+
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > maxKeysLimit {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid limit",
+			})
+			return
+		}
+		opts.Limit = limit
+	}
+
+	if c := query.Get("cursor"); c != "" {
+		after, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil || len(after) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid cursor",
+			})
+			return
+		}
+		opts.After = string(after)
+	}
+
+	page, more := scanner.Scan(opts)
+
+	keys := make([]string, len(page))
+	for i, kv := range page {
+		keys[i] = kv.Key
+	}
+	resp := map[string]any{
+		"keys": keys,
+	}
+	if opts.Values {
+		values := make(map[string]string, len(page))
+		for _, kv := range page {
+			values[kv.Key] = kv.Value
+		}
+		resp["values"] = values
+	}
+	if more {
+		resp["cursor"] = base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
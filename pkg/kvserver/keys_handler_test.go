@@ -0,0 +1,116 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+type keysResponse struct {
+	Keys   []string          `json:"keys"`
+	Values map[string]string `json:"values"`
+	Cursor string            `json:"cursor"`
+}
+
+func listKeys(t *testing.T, server *Server, query url.Values) (int, keysResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/keys?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var resp keysResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestKeysPagination(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+	for _, k := range []string{"user:4", "user:2", "session:1", "user:1", "user:3", "user:5"} {
+		store.Set(k, "v:"+k)
+	}
+
+	var got []string
+	query := url.Values{"prefix": {"user:"}, "limit": {"2"}}
+	for pages := 1; ; pages++ {
+		code, resp := listKeys(t, server, query)
+		if code != http.StatusOK {
+			t.Fatalf("got status %d want %d", code, http.StatusOK)
+		}
+		got = append(got, resp.Keys...)
+
+		if resp.Cursor == "" {
+			if pages != 3 {
+				t.Errorf("got %d pages want 3", pages)
+			}
+			break
+		}
+		query.Set("cursor", resp.Cursor)
+	}
+
+	if want := []string{"user:1", "user:2", "user:3", "user:4", "user:5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestKeysFilters(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+	for _, k := range []string{"a:1", "a:22", "b:1", "c:1"} {
+		store.Set(k, "v:"+k)
+	}
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantKeys   []string
+	}{
+		{"Glob", url.Values{"match": {"?:1"}}, http.StatusOK, []string{"a:1", "b:1", "c:1"}},
+		{"Range", url.Values{"start": {"a:2"}, "end": {"c"}}, http.StatusOK, []string{"a:22", "b:1"}},
+		{"Zero limit", url.Values{"limit": {"0"}}, http.StatusBadRequest, nil},
+		{"Limit too large", url.Values{"limit": {"100000"}}, http.StatusBadRequest, nil},
+		{"Bad cursor", url.Values{"cursor": {"!!"}}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := listKeys(t, server, tt.query)
+			if code != tt.wantStatus {
+				t.Fatalf("got status %d want %d", code, tt.wantStatus)
+			}
+			if tt.wantKeys != nil && !reflect.DeepEqual(resp.Keys, tt.wantKeys) {
+				t.Errorf("got %q want %q", resp.Keys, tt.wantKeys)
+			}
+		})
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		_, resp := listKeys(t, server, url.Values{"prefix": {"b:"}, "values": {"true"}})
+		if want := map[string]string{"b:1": "v:b:1"}; !reflect.DeepEqual(resp.Values, want) {
+			t.Errorf("got %v want %v", resp.Values, want)
+		}
+	})
+}
+
+func TestKeysOptionsUnsupported(t *testing.T) {
+	// Embedding only the Store interface hides the Scanner methods.
+	server := NewServer(struct{ kvstore.Store }{kvstore.NewMemoryStore()})
+
+	if code, _ := listKeys(t, server, url.Values{"prefix": {"a"}}); code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", code, http.StatusNotImplemented)
+	}
+	if code, _ := listKeys(t, server, nil); code != http.StatusOK {
+		t.Errorf("got status %d want %d", code, http.StatusOK)
+	}
+}
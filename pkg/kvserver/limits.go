@@ -0,0 +1,253 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Limits bounds what a single request may send, and how often each client
+// may send one. Zero fields are unlimited.
+//
+// MaxBodyBytes applies to every route but RaftMessagePath, so it also
+// bounds the size of a snapshot that can be restored over HTTP. Raft
+// messages carry the snapshots a cluster sends to members that fall
+// behind, which grow with the store, and only admins may send them.
+type Limits struct {
+	MaxBodyBytes  int64
+	MaxKeyBytes   int
+	MaxValueBytes int
+	Rate          float64 // Requests per second per client
+	Burst         int     // Requests a client may send at once, at least 1
+}
+
+// limitStats counts the requests refused by the limits.
+type limitStats struct {
+	body, key, value, rate atomic.Uint64
+}
+
+// WithLimits applies l to every request. Clients are told apart by their
+// principal if they authenticated, and by their IP address otherwise.
+func (s *Server) WithLimits(l Limits) *Server {
+	s.limits = l
+	s.limiter = nil
+	if l.Rate > 0 {
+		s.limiter = NewRateLimiter(l.Rate, l.Burst)
+	}
+	return s
+}
+
+// routeValues returns the values that a write to each route stores, by
+// path, to check against MaxValueBytes.
+var routeValues = map[string]func(r *http.Request) []string{
+	"/set":   setValues,
+	"/mset":  msetValues,
+	"/txn":   txnValues,
+	"/lpush": pushValues,
+	"/rpush": pushValues,
+	"/hset":  hsetValues,
+	"/sadd":  saddValues,
+}
+
+func setValues(r *http.Request) []string {
+	var req struct {
+		Value string `json:"value"`
+	}
+	peekJSON(r, &req)
+	return []string{req.Value}
+}
+
+func msetValues(r *http.Request) []string {
+	var req struct {
+		Entries []struct {
+			Value string `json:"value"`
+		} `json:"entries"`
+	}
+	peekJSON(r, &req)
+
+	values := make([]string, len(req.Entries))
+	for i, e := range req.Entries {
+		values[i] = e.Value
+	}
+	return values
+}
+
+func txnValues(r *http.Request) []string {
+	var req struct {
+		Ops []struct {
+			Value string `json:"value"`
+		} `json:"ops"`
+	}
+	peekJSON(r, &req)
+
+	values := make([]string, len(req.Ops))
+	for i, op := range req.Ops {
+		values[i] = op.Value
+	}
+	return values
+}
+
+func pushValues(r *http.Request) []string {
+	var req struct {
+		Values []string `json:"values"`
+	}
+	peekJSON(r, &req)
+	return req.Values
+}
+
+func hsetValues(r *http.Request) []string {
+	var req struct {
+		Fields map[string]string `json:"fields"`
+	}
+	peekJSON(r, &req)
+
+	values := make([]string, 0, len(req.Fields))
+	for _, v := range req.Fields {
+		values = append(values, v)
+	}
+	return values
+}
+
+func saddValues(r *http.Request) []string {
+	var req struct {
+		Members []string `json:"members"`
+	}
+	peekJSON(r, &req)
+	return req.Members
+}
+
+// bodyValue is the value of a raw key resource: the whole body.
+func bodyValue(r *http.Request) []string {
+	body, _ := peekBody(r)
+	return []string{string(body)}
+}
+
+// rateLimit reports whether the client may send r, and otherwise writes
+// a 429 telling it when to retry.
+func (s *Server) rateLimit(w http.ResponseWriter, r *http.Request, principal string, fail errorWriter) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	client := "principal:" + principal
+	if principal == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		client = "ip:" + host
+	}
+
+	ok, wait := s.limiter.Allow(client)
+	if ok {
+		return true
+	}
+
+	s.limitStats.rate.Add(1)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	fail(w, r, http.StatusTooManyRequests, "Too many requests")
+	return false
+}
+
+// limitBody reads the body of r up front, refusing it with a 413 if it is
+// larger than MaxBodyBytes, so that nothing after it can read more.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request, fail errorWriter) bool {
+	if s.limits.MaxBodyBytes <= 0 || r.URL.Path == RaftMessagePath {
+		return true
+	}
+
+	if r.ContentLength <= s.limits.MaxBodyBytes {
+		r.Body = http.MaxBytesReader(w, r.Body, s.limits.MaxBodyBytes)
+		_, err := peekBody(r)
+		var tooLarge *http.MaxBytesError
+		if err == nil {
+			return true
+		}
+		if !errors.As(err, &tooLarge) {
+			fail(w, r, http.StatusBadRequest, "Bad Request")
+			return false
+		}
+	}
+
+	s.limitStats.body.Add(1)
+	fail(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+	return false
+}
+
+// checkSizes reports whether the keys and values r sends are within the
+// limits, and otherwise writes a 413.
+func (s *Server) checkSizes(w http.ResponseWriter, r *http.Request, scopes []scope, values func(*http.Request) []string, fail errorWriter) bool {
+	if s.limits.MaxKeyBytes > 0 {
+		for _, sc := range scopes {
+			if len(sc.prefix) > s.limits.MaxKeyBytes {
+				s.limitStats.key.Add(1)
+				fail(w, r, http.StatusRequestEntityTooLarge, "Key too large")
+				return false
+			}
+		}
+	}
+
+	if s.limits.MaxValueBytes > 0 && values != nil {
+		for _, v := range values(r) {
+			if len(v) > s.limits.MaxValueBytes {
+				s.limitStats.value.Add(1)
+				fail(w, r, http.StatusRequestEntityTooLarge, "Value too large")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type limitsResponse struct {
+	MaxBodyBytes  int64             `json:"max_body_bytes"`
+	MaxKeyBytes   int               `json:"max_key_bytes"`
+	MaxValueBytes int               `json:"max_value_bytes"`
+	Rate          float64           `json:"rate"`
+	Burst         int               `json:"burst"`
+	Clients       int               `json:"clients"`
+	Rejected      map[string]uint64 `json:"rejected"`
+}
+
+// LimitsHandler serves the configured limits and how many requests each
+// has refused.
+func (s *Server) LimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	resp := limitsResponse{
+		MaxBodyBytes:  s.limits.MaxBodyBytes,
+		MaxKeyBytes:   s.limits.MaxKeyBytes,
+		MaxValueBytes: s.limits.MaxValueBytes,
+		Rate:          s.limits.Rate,
+		Burst:         s.limits.Burst,
+		Rejected:      s.limitStats.counts(),
+	}
+	if s.limiter != nil {
+		resp.Clients = s.limiter.Clients()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// counts returns the refusals by the reason label used in the metrics.
+func (st *limitStats) counts() map[string]uint64 {
+	return map[string]uint64{
+		"body_too_large":  st.body.Load(),
+		"key_too_large":   st.key.Load(),
+		"value_too_large": st.value.Load(),
+		"rate_limited":    st.rate.Load(),
+	}
+}
@@ -0,0 +1,152 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestSizeLimits(t *testing.T) {
+	s := NewServer(kvstore.NewMemoryStore()).WithLimits(Limits{
+		MaxBodyBytes:  200,
+		MaxKeyBytes:   8,
+		MaxValueBytes: 16,
+	})
+
+	long := strings.Repeat("x", 17)
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+		reason string
+	}{
+		{"Within", http.MethodPost, "/set", `{"key":"a","value":"1"}`, http.StatusCreated, ""},
+		{"Body", http.MethodPost, "/set", `{"key":"a","value":"` + strings.Repeat("x", 300) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"Key", http.MethodPost, "/set", `{"key":"abcdefghi","value":"1"}`, http.StatusRequestEntityTooLarge, "key_too_large"},
+		{"QueryKey", http.MethodGet, "/get?key=abcdefghi", "", http.StatusRequestEntityTooLarge, "key_too_large"},
+		{"Value", http.MethodPost, "/set", `{"key":"a","value":"` + long + `"}`, http.StatusRequestEntityTooLarge, "value_too_large"},
+		{"MSetValue", http.MethodPost, "/mset", `{"entries":[{"key":"a","value":"1"},{"key":"b","value":"` + long + `"}]}`, http.StatusRequestEntityTooLarge, "value_too_large"},
+		{"PushValue", http.MethodPost, "/rpush", `{"key":"l","values":["1","` + long + `"]}`, http.StatusRequestEntityTooLarge, "value_too_large"},
+		{"HSetValue", http.MethodPost, "/hset", `{"key":"h","fields":{"f":"` + long + `"}}`, http.StatusRequestEntityTooLarge, "value_too_large"},
+		{"KeyResource", http.MethodPut, "/v1/keys/a", long, http.StatusRequestEntityTooLarge, "value_too_large"},
+		{"KeyResourceWithin", http.MethodPut, "/v1/keys/a", "small", http.StatusCreated, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := s.limitStats.counts()
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("got status %d want %d: %s", rr.Code, tt.want, rr.Body)
+			}
+			if tt.reason != "" {
+				if got := s.limitStats.counts()[tt.reason]; got != before[tt.reason]+1 {
+					t.Errorf("%s count went from %d to %d", tt.reason, before[tt.reason], got)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyLimitWithoutContentLength(t *testing.T) {
+	s := NewServer(kvstore.NewMemoryStore()).WithLimits(Limits{MaxBodyBytes: 64})
+
+	// A chunked body is only found to be too large while reading it.
+	body := `{"key":"a","value":"` + strings.Repeat("x", 100) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/set", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if _, ok := s.store.Get("a"); ok {
+		t.Error("oversized value was stored")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := NewServer(kvstore.NewMemoryStore()).WithLimits(Limits{Rate: 1, Burst: 2})
+	s.WithAuth(BearerTokens{"t0k3n": "alice"}, ACL{Anyone: {{Prefix: "", Permission: PermAdmin}}})
+
+	get := func(remoteAddr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for range 2 {
+		if rr := get("10.0.0.1:1234", ""); rr.Code == http.StatusTooManyRequests {
+			t.Fatal("request within the burst was limited")
+		}
+	}
+
+	rr := get("10.0.0.1:5678", "") // Same IP, another port
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("got Retry-After %q want 1", got)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Errorf("got body %v, %v want a JSON error", body, err)
+	}
+
+	// A principal is limited on its own, wherever it comes from.
+	if rr := get("10.0.0.1:1234", "t0k3n"); rr.Code == http.StatusTooManyRequests {
+		t.Error("authenticated request limited by its IP's bucket")
+	}
+	if rr := get("10.0.0.2:1234", ""); rr.Code == http.StatusTooManyRequests {
+		t.Error("request from another IP was limited")
+	}
+}
+
+func TestLimitsHandler(t *testing.T) {
+	s := NewServer(kvstore.NewMemoryStore()).WithLimits(Limits{MaxKeyBytes: 4, Rate: 5, Burst: 10})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=toolong", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/limits", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+
+	var got limitsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MaxKeyBytes != 4 || got.Rate != 5 || got.Burst != 10 {
+		t.Errorf("unexpected limits %+v", got)
+	}
+	if got.Rejected["key_too_large"] != 1 || got.Clients != 1 {
+		t.Errorf("got rejected %v and %d clients, want 1 key_too_large and 1 client", got.Rejected, got.Clients)
+	}
+
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `http_rejected_requests_total{reason="key_too_large"} 1`; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+}
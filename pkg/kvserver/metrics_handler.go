@@ -0,0 +1,164 @@
+package kvserver
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"golang-learning/pkg/kvstore"
+	"golang-learning/pkg/metrics"
+	"golang-learning/pkg/raft"
+)
+
+// MetricsHandler serves the store and HTTP metrics in the Prometheus text
+// exposition format. Families are only written for what the store
+// supports; the HTTP families are always there.
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	mw := metrics.NewWriter(w)
+	s.writeStoreMetrics(mw)
+	s.writeReplicationMetrics(mw)
+	s.writeClusterMetrics(mw)
+	s.writeHTTPMetrics(mw)
+}
+
+func (s *Server) writeStoreMetrics(mw *metrics.Writer) {
+	if usage, ok := s.store.(interface{ Usage() kvstore.Usage }); ok {
+		u := usage.Usage()
+		mw.Gauge("kvstore_keys", "Keys in the store, including expired keys not yet reaped.", value(u.Entries))
+		mw.Gauge("kvstore_bytes", "Bytes held by keys and values.", value(u.Bytes))
+		mw.Gauge("kvstore_watch_history_bytes", "Bytes held by the recent events kept for watches.", value(u.HistoryBytes))
+		mw.Counter("kvstore_rejected_writes_total", "Writes refused because the store was full.", value(u.Rejections))
+	} else {
+		mw.Gauge("kvstore_keys", "Keys in the store, including expired keys not yet reaped.", value(len(s.store.Keys())))
+	}
+
+	if reporter, ok := s.store.(kvstore.StatsReporter); ok {
+		st := reporter.Stats()
+		mw.Counter("kvstore_gets_total", "Reads of a string key.", value(st.Gets))
+		mw.Counter("kvstore_hits_total", "Reads that found the key.", value(st.Hits))
+		mw.Counter("kvstore_misses_total", "Reads that did not find the key.", value(st.Misses))
+		mw.Counter("kvstore_sets_total", "Writes of a key.", value(st.Sets))
+		mw.Counter("kvstore_deletes_total", "Deletes of a key, including evictions.", value(st.Deletes))
+		mw.Counter("kvstore_expired_keys_total", "Keys removed because their TTL ran out.", value(st.Expired))
+		mw.Counter("kvstore_evictions_total", "Keys evicted to make room.", value(st.Evictions))
+	}
+
+	if reaper, ok := s.store.(kvstore.Reaper); ok {
+		st := reaper.ReaperStats()
+		mw.Counter("kvstore_reaper_runs_total", "Runs of the expired key reaper.", value(st.Runs))
+		mw.Counter("kvstore_reaper_reaped_keys_total", "Expired keys deleted by the reaper.", value(st.Reaped))
+		mw.Histogram("kvstore_reaper_duration_seconds", "Time taken by each run of the reaper.", metrics.HistogramSample{Histogram: st.Duration})
+	}
+
+	if snapshotter, ok := s.store.(kvstore.Snapshotter); ok {
+		st := snapshotter.SaveStats()
+		mw.Counter("kvstore_snapshot_saves_total", "Snapshots written to disk.", value(st.Saves))
+		mw.Counter("kvstore_snapshot_save_failures_total", "Snapshots that failed to be written.", value(st.Failures))
+		mw.Histogram("kvstore_snapshot_save_duration_seconds", "Time taken to write a snapshot.", metrics.HistogramSample{Histogram: st.Duration})
+
+		if last := snapshotter.SnapshotStats(); !last.Time.IsZero() {
+			mw.Gauge("kvstore_snapshot_last_save_timestamp_seconds", "When the last snapshot was written.", metrics.Sample{Value: float64(last.Time.UnixNano()) / 1e9})
+			mw.Gauge("kvstore_snapshot_last_size_bytes", "Size of the last snapshot.", value(last.Size))
+		}
+	}
+}
+
+func (s *Server) writeReplicationMetrics(mw *metrics.Writer) {
+	replicator, ok := s.store.(kvstore.Replicator)
+	if !ok {
+		return
+	}
+
+	st := replicator.ReplicationStatus()
+	mw.Gauge("kvstore_replication_seq", "Sequence number of the last entry in the replication log.", value(st.Position.Seq))
+	mw.Gauge("kvstore_replication_followers", "Replication streams open to followers.", value(st.Followers))
+
+	if s.follower != nil && st.Role == kvstore.RoleFollower {
+		fs := s.follower.Status()
+		mw.Gauge("kvstore_replication_lag_entries", "Entries the follower is behind its primary.", value(fs.Lag))
+		if fs.LastContact != nil {
+			mw.Gauge("kvstore_replication_last_contact_timestamp_seconds", "When the follower last heard from its primary.", metrics.Sample{Value: float64(fs.LastContact.UnixNano()) / 1e9})
+		}
+	}
+}
+
+func (s *Server) writeClusterMetrics(mw *metrics.Writer) {
+	c, ok := s.store.(kvstore.Consensus)
+	if !ok {
+		return
+	}
+
+	st := c.ClusterStatus()
+	leader := 0
+	if st.Role == raft.Leader {
+		leader = 1
+	}
+	mw.Gauge("kvstore_raft_term", "Current Raft term of this member.", value(st.Term))
+	mw.Gauge("kvstore_raft_leader", "Whether this member leads the cluster.", value(leader))
+	mw.Gauge("kvstore_raft_members", "Members of the cluster.", value(len(st.Members)))
+	mw.Gauge("kvstore_raft_commit_index", "Index of the last entry known to be committed.", value(st.Commit))
+	mw.Gauge("kvstore_raft_applied_index", "Index of the last entry applied to the store.", value(st.Applied))
+}
+
+func (s *Server) writeHTTPMetrics(mw *metrics.Writer) {
+	stats := s.metrics.Stats()
+
+	var requests []metrics.Sample
+	latencies := make([]metrics.HistogramSample, 0, len(stats))
+	bounds := make([]float64, len(latencyBuckets))
+	for i, b := range latencyBuckets {
+		bounds[i] = b.Seconds()
+	}
+
+	for _, st := range stats {
+		codes := make([]int, 0, len(st.Statuses))
+		for code := range st.Statuses {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+
+		for _, code := range codes {
+			requests = append(requests, metrics.Sample{
+				Labels: []metrics.Label{{Name: "route", Value: st.Route}, {Name: "code", Value: strconv.Itoa(code)}},
+				Value:  float64(st.Statuses[code]),
+			})
+		}
+
+		latencies = append(latencies, metrics.HistogramSample{
+			Labels: []metrics.Label{{Name: "route", Value: st.Route}},
+			Histogram: metrics.HistogramSnapshot{
+				Bounds: bounds,
+				Counts: st.Buckets,
+				Sum:    st.Total.Seconds(),
+				Count:  st.Requests,
+			},
+		})
+	}
+
+	mw.Counter("http_requests_total", "HTTP requests by route and status code.", requests...)
+	mw.Histogram("http_request_duration_seconds", "Time taken to serve HTTP requests by route.", latencies...)
+
+	counts := s.limitStats.counts()
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	slices.Sort(reasons)
+
+	rejected := make([]metrics.Sample, len(reasons))
+	for i, reason := range reasons {
+		rejected[i] = metrics.Sample{
+			Labels: []metrics.Label{{Name: "reason", Value: reason}},
+			Value:  float64(counts[reason]),
+		}
+	}
+	mw.Counter("http_rejected_requests_total", "HTTP requests refused by the size and rate limits.", rejected...)
+}
+
+// value is a sample without labels.
+func value[T int | int64 | uint64](v T) metrics.Sample {
+	return metrics.Sample{Value: float64(v)}
+}
@@ -0,0 +1,85 @@
+package kvserver
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+	"golang-learning/pkg/metrics"
+)
+
+func scrape(t *testing.T, server *Server) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("got Content-Type %q want %q", got, metrics.ContentType)
+	}
+	return rr.Body.String()
+}
+
+func TestMetricsHandler(t *testing.T) {
+	store := kvstore.NewTTLStore()
+	defer store.Stop()
+	server := NewServer(store).WithLogger(slog.New(slog.DiscardHandler))
+
+	store.Set("foo", "bar")
+	for _, path := range []string{"/get?key=foo", "/get?key=missing"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, server)
+	for _, want := range []string{
+		"kvstore_keys 1\n",
+		"kvstore_gets_total 2\n",
+		"kvstore_hits_total 1\n",
+		"kvstore_misses_total 1\n",
+		"kvstore_sets_total 1\n",
+		"# TYPE kvstore_reaper_duration_seconds histogram\n",
+		`http_requests_total{route="GET /get",code="200"} 1` + "\n",
+		`http_requests_total{route="GET /get",code="404"} 1` + "\n",
+		`http_request_duration_seconds_count{route="GET /get"} 2` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "kvstore_snapshot") {
+		t.Errorf("expected no snapshot metrics for a TTLStore")
+	}
+}
+
+func TestMetricsHandlerSnapshots(t *testing.T) {
+	store, err := kvstore.NewPersistentStore().
+		WithSnapshotFile(filepath.Join(t.TempDir(), "store.snapshot.json")).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+	server := NewServer(store).WithLogger(slog.New(slog.DiscardHandler))
+
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := scrape(t, server)
+	for _, want := range []string{
+		"kvstore_snapshot_saves_total 1\n",
+		"kvstore_snapshot_save_duration_seconds_count 1\n",
+		"# TYPE kvstore_snapshot_last_save_timestamp_seconds gauge\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+}
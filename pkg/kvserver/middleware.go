@@ -0,0 +1,179 @@
+package kvserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps a handler with behaviour shared by every request.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in mws. The first middleware is the outermost, so it sees
+// the request first and the response last.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request carrying ctx, as set by the
+// RequestIDs middleware, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDs propagates the X-Request-ID header of a request, making up
+// an ID if there is none. The ID is echoed on the response and available
+// to handlers through RequestID.
+func RequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Recover turns a panicking handler into a 500 JSON error, instead of the
+// connection being dropped, and logs the panic with its stack.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := recordResponse(w)
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				logger.ErrorContext(r.Context(), "panic serving request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"request_id", RequestID(r.Context()),
+					"panic", err,
+					"stack", string(debug.Stack()),
+				)
+
+				if rec.status != 0 {
+					// Too late for an error response; the client sees
+					// a truncated body instead.
+					return
+				}
+				rec.Header().Set("Content-Type", "application/json")
+				rec.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(rec).Encode(map[string]string{
+					"error": "Internal Server Error",
+				})
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// AccessLog logs one line per request once it has been served.
+//
+// The route is the ServeMux pattern that matched, so AccessLog must sit
+// inside any middleware that replaces the request, such as RequestIDs.
+func AccessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := recordResponse(w)
+			start := time.Now()
+
+			next.ServeHTTP(rec, r)
+
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route(r)),
+				slog.Int("status", rec.code()),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("request_id", RequestID(r.Context())),
+			)
+		})
+	}
+}
+
+// route names the ServeMux pattern that served r, once it has been served.
+func route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	return r.Pattern
+}
+
+// responseRecorder remembers the status and size of a response on its way
+// to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int // Zero until the header is written
+	bytes  int64
+}
+
+// recordResponse wraps w in a responseRecorder, unless it already is one, so
+// several middleware share one.
+func recordResponse(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers such as /watch flush through the recorder.
+func (r *responseRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// code is the status sent, which is 200 if the handler wrote nothing.
+func (r *responseRecorder) code() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
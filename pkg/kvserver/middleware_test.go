@@ -0,0 +1,177 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("outer"), mark("inner"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if want := []string{"outer", "inner", "handler"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v want %v", order, want)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	var seen string
+	h := RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"Propagated", "abc-123"},
+		{"Generated", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			got := rr.Header().Get("X-Request-ID")
+			if got == "" || got != seen {
+				t.Errorf("got response ID %q and context ID %q, want the same non-empty ID", got, seen)
+			}
+			if tt.header != "" && got != tt.header {
+				t.Errorf("got %q want %q", got, tt.header)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RequestIDs, Recover(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if got := strings.TrimSpace(rr.Body.String()); got != `{"error":"Internal Server Error"}` {
+		t.Errorf("got body %q", got)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["panic"] != "boom" || entry["request_id"] != "req-1" {
+		t.Errorf("got log entry %v", entry)
+	}
+}
+
+func TestRecoverAfterHeaderWritten(t *testing.T) {
+	h := Recover(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusAccepted || rr.Body.Len() != 0 {
+		t.Errorf("got status %d and body %q, want the response left as it was", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServerAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store).WithLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	store.Set("foo", "bar")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/keys/foo", nil)
+	req.Header.Set("X-Request-ID", "req-2")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"msg":        "request",
+		"method":     "GET",
+		"path":       "/v1/keys/foo",
+		"route":      "GET /v1/keys/{key...}",
+		"status":     200.0,
+		"bytes":      3.0,
+		"request_id": "req-2",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s: got %v want %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestServerRouteMetrics(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store).WithLogger(slog.New(slog.DiscardHandler))
+
+	store.Set("foo", "bar")
+
+	for _, path := range []string{"/get?key=foo", "/get?key=missing", "/get?key=foo", "/nope"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := make(map[string]RouteStats)
+	for _, st := range server.Metrics().Stats() {
+		got[st.Route] = st
+	}
+
+	get := got["GET /get"]
+	if want := map[int]uint64{200: 2, 404: 1}; get.Requests != 3 || !reflect.DeepEqual(get.Statuses, want) {
+		t.Errorf("got %+v, want 3 requests with statuses %v", get, want)
+	}
+	if n := len(get.Buckets); n != len(LatencyBuckets())+1 || get.Buckets[n-1] != 3 {
+		t.Errorf("got buckets %v, want every request in the last bucket", get.Buckets)
+	}
+	if got["unmatched"].Statuses[404] != 1 {
+		t.Errorf("expected the unmatched request to be counted, got %+v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,47 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// problem is an RFC 9457 problem details object, the error body of every
+// /v1 endpoint.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// writeProblem writes a problem+json response for status. The problem
+// type is about:blank, so the title is the status text and detail says
+// what went wrong with this request.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// methodNotAllowed returns a handler that rejects every request with a
+// 405 listing the allowed methods. It is registered without a method
+// under the same pattern as the handlers for those methods, so the mux
+// only sends it what they do not match.
+func methodNotAllowed(allow string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed on this resource")
+	}
+}
+
+// notFound answers requests for paths under /v1 that match no resource.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, "No such resource")
+}
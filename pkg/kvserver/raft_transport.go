@@ -0,0 +1,184 @@
+package kvserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+// RaftMessagePath is where a server in a cluster takes messages from the
+// other members.
+const RaftMessagePath = "/raft/message"
+
+const (
+	// raftQueueSize is how many messages may wait for a peer before more
+	// are dropped. Raft sends them again.
+	raftQueueSize = 4096
+	// raftBatchSize is how many messages are sent in one request.
+	raftBatchSize = 64
+	// raftSendTimeout bounds a request, so that a member that hangs does
+	// not stop the messages after it for long.
+	raftSendTimeout = 5 * time.Second
+)
+
+// RaftTransport sends Raft messages to the other members of a cluster
+// over HTTP. The address of a member is the base URL of its server. Each
+// member has a queue, sent in order by its own goroutine, so that a slow
+// or unreachable member does not hold up the others.
+type RaftTransport struct {
+	client *http.Client
+	token  string
+
+	mu    sync.Mutex
+	peers map[uint64]*raftPeer
+}
+
+type raftPeer struct {
+	addr   string
+	queue  chan raft.Message
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRaftTransport() *RaftTransport {
+	return &RaftTransport{
+		client: http.DefaultClient,
+		peers:  make(map[uint64]*raftPeer),
+	}
+}
+
+// WithClient sets the client used to reach the other members, which is
+// http.DefaultClient otherwise.
+func (t *RaftTransport) WithClient(client *http.Client) *RaftTransport {
+	t.client = client
+	return t
+}
+
+// WithToken authenticates to the other members with a bearer token, which
+// needs admin on the whole store.
+func (t *RaftTransport) WithToken(token string) *RaftTransport {
+	t.token = token
+	return t
+}
+
+// Send queues msgs for their members, dropping those for unknown members
+// and those that do not fit.
+func (t *RaftTransport) Send(msgs []raft.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range msgs {
+		p := t.peers[m.To]
+		if p == nil {
+			continue
+		}
+		select {
+		case p.queue <- m:
+		default:
+		}
+	}
+}
+
+// AddPeer starts sending to the member id at addr.
+func (t *RaftTransport) AddPeer(id uint64, addr string) {
+	t.RemovePeer(id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &raftPeer{
+		addr:   strings.TrimSuffix(addr, "/"),
+		queue:  make(chan raft.Message, raftQueueSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	t.mu.Lock()
+	t.peers[id] = p
+	t.mu.Unlock()
+
+	go t.run(ctx, p)
+}
+
+// RemovePeer stops sending to the member id, dropping what is queued.
+func (t *RaftTransport) RemovePeer(id uint64) {
+	t.mu.Lock()
+	p := t.peers[id]
+	delete(t.peers, id)
+	t.mu.Unlock()
+
+	if p != nil {
+		p.cancel()
+		<-p.done
+	}
+}
+
+// Close stops sending to every member.
+func (t *RaftTransport) Close() {
+	t.mu.Lock()
+	ids := make([]uint64, 0, len(t.peers))
+	for id := range t.peers {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	for _, id := range ids {
+		t.RemovePeer(id)
+	}
+}
+
+// run sends the queue of p, batching what has built up while the last
+// request was in flight.
+func (t *RaftTransport) run(ctx context.Context, p *raftPeer) {
+	defer close(p.done)
+
+	for {
+		var batch []raft.Message
+		select {
+		case m := <-p.queue:
+			batch = append(batch, m)
+		case <-ctx.Done():
+			return
+		}
+	drain:
+		for len(batch) < raftBatchSize {
+			select {
+			case m := <-p.queue:
+				batch = append(batch, m)
+			default:
+				break drain
+			}
+		}
+
+		// A failed send is dropped, like a lost message.
+		t.post(ctx, p.addr, batch)
+	}
+}
+
+func (t *RaftTransport) post(ctx context.Context, addr string, msgs []raft.Message) error {
+	body, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, raftSendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+RaftMessagePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
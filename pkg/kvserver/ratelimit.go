@@ -0,0 +1,85 @@
+package kvserver
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket per client. Each bucket holds up to burst
+// tokens and refills at rate tokens per second; a request takes one.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last brought up to date
+}
+
+// NewRateLimiter returns a limiter allowing each client rate requests per
+// second on average, and bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of client. If there is none, it
+// reports how long until there will be.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Clients returns the number of clients the limiter is keeping a bucket
+// for, which are those seen within about one refill time.
+func (l *RateLimiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(l.now())
+	return len(l.buckets)
+}
+
+// sweep drops the buckets that have had time to refill, since a new
+// bucket would be the same, at most once per refill time. The caller must
+// hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < refill {
+		return
+	}
+
+	l.swept = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package kvserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(2, 3) // 2/s, bursts of 3
+	l.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst refused", i)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request past the burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("got wait %v want 500ms", wait)
+	}
+
+	// Other clients have their own bucket.
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client was refused")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request after the wait refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request after one token refilled allowed")
+	}
+}
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(10, 5)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	l.Allow("b")
+	if got := l.Clients(); got != 2 {
+		t.Fatalf("got %d clients want 2", got)
+	}
+
+	// Half a second refills a bucket of 5 at 10/s.
+	now = now.Add(500 * time.Millisecond)
+	l.Allow("b")
+	if got := l.Clients(); got != 1 {
+		t.Errorf("got %d clients after a refill, want 1", got)
+	}
+}
@@ -0,0 +1,303 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// Headers carrying the position a replication snapshot is current to.
+const (
+	LogIDHeader  = "X-KV-Log-ID"
+	LogSeqHeader = "X-KV-Log-Seq"
+)
+
+// replicationHeartbeat is how often an idle replication stream tells the
+// follower where the primary is, so that it can report its lag.
+var replicationHeartbeat = time.Second
+
+// replicationMessage is a line of a replication stream: an entry, or a
+// heartbeat if Entry is nil. Head is the sequence number of the last
+// entry on the primary when the message was written.
+type replicationMessage struct {
+	Entry *kvstore.ReplicationEntry `json:"entry,omitempty"`
+	Head  uint64                    `json:"head"`
+}
+
+// ReplicationSnapshotHandler serves a snapshot of the store for a follower
+// to bootstrap from, with the position of the log it is current to in
+// the X-KV-Log-ID and X-KV-Log-Seq headers.
+func (s *Server) ReplicationSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	replicator, ok := s.store.(kvstore.Replicator)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Replication is not supported by this store",
+		})
+		return
+	}
+
+	data, pos, err := replicator.ReplicationSnapshot()
+	if errors.Is(err, kvstore.ErrReadOnly) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(LogIDHeader, pos.LogID)
+	w.Header().Set(LogSeqHeader, strconv.FormatUint(pos.Seq, 10))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ReplicationStreamHandler streams the entries of the log after a
+// position as newline-delimited JSON:
+//
+//	GET /replication/stream?log=5f2c...&seq=42
+//
+// A position the log no longer continues from gets 410 Gone, and the
+// follower should bootstrap again. The stream ends if the follower falls
+// too far behind; it may then resume from the last entry it applied.
+func (s *Server) ReplicationStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	replicator, ok := s.store.(kvstore.Replicator)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Replication is not supported by this store",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	seq, err := strconv.ParseUint(query.Get("seq"), 10, 64)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid seq",
+		})
+		return
+	}
+
+	feed, err := replicator.Replicate(kvstore.ReplicationPosition{LogID: query.Get("log"), Seq: seq})
+	if errors.Is(err, kvstore.ErrReadOnly) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if errors.Is(err, kvstore.ErrReplicationGap) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Log does not continue from this position",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+	defer feed.Close()
+
+	keepOpen(w)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Streaming unsupported",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	enc.Encode(replicationMessage{Head: replicator.ReplicationStatus().Position.Seq})
+	flusher.Flush()
+
+	ticker := time.NewTicker(replicationHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if enc.Encode(replicationMessage{Head: replicator.ReplicationStatus().Position.Seq}) != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-feed.Entries():
+			if !ok {
+				return
+			}
+
+			// Send what is already queued before flushing, which
+			// is what a follower catching up mostly receives.
+			head := replicator.ReplicationStatus().Position.Seq
+			for ok {
+				if enc.Encode(replicationMessage{Entry: &e, Head: head}) != nil {
+					return
+				}
+				select {
+				case e, ok = <-feed.Entries():
+				default:
+					ok = false
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+type replicationStatusResponse struct {
+	Role      string                      `json:"role"`
+	Position  kvstore.ReplicationPosition `json:"position"`
+	Followers int                         `json:"followers"`
+	Following *FollowerStatus             `json:"following,omitempty"`
+}
+
+// ReplicationStatusHandler serves the role and log position of the store
+// and, on a follower, how far behind its primary it is.
+func (s *Server) ReplicationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	replicator, ok := s.store.(kvstore.Replicator)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Replication is not supported by this store",
+		})
+		return
+	}
+
+	st := replicator.ReplicationStatus()
+	resp := replicationStatusResponse{
+		Role:      st.Role,
+		Position:  st.Position,
+		Followers: st.Followers,
+	}
+	if s.follower != nil && st.Role == kvstore.RoleFollower {
+		fs := s.follower.Status()
+		resp.Following = &fs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// PromoteHandler makes a follower stop following its primary and accept
+// writes. Promoting a primary does nothing.
+func (s *Server) PromoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	replicator, ok := s.store.(kvstore.Replicator)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Replication is not supported by this store",
+		})
+		return
+	}
+
+	if s.follower != nil {
+		s.follower.Promote()
+	} else {
+		replicator.Promote()
+	}
+
+	st := replicator.ReplicationStatus()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(replicationStatusResponse{
+		Role:      st.Role,
+		Position:  st.Position,
+		Followers: st.Followers,
+	})
+}
+
+// WithFollower makes the server the front of a follower, refusing writes
+// with 421 Misdirected Request and the address of the primary until f is
+// promoted. Run f separately.
+func (s *Server) WithFollower(f *Follower) *Server {
+	s.follower = f
+	return s
+}
+
+// readOnly reports whether the server refuses writes because it is an
+// unpromoted follower.
+func (s *Server) readOnly() bool {
+	return s.follower != nil && !s.follower.Promoted()
+}
+
+// misdirected refuses a request that only the primary can serve,
+// pointing at it with the X-KV-Primary header if known. In a cluster it
+// points at the leader with X-KV-Leader instead.
+func (s *Server) misdirected(w http.ResponseWriter, r *http.Request, fail errorWriter) {
+	if c, ok := s.store.(kvstore.Consensus); ok {
+		if leader := c.Leader(); leader != "" {
+			w.Header().Set(LeaderHeader, leader)
+		}
+		fail(w, r, http.StatusMisdirectedRequest, "Not the cluster leader; send requests to the leader")
+		return
+	}
+	if s.follower != nil {
+		w.Header().Set(PrimaryHeader, s.follower.Primary())
+	}
+	fail(w, r, http.StatusMisdirectedRequest, "Read-only follower; send writes to the primary")
+}
@@ -0,0 +1,251 @@
+package kvserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+type replicaNode struct {
+	store    *kvstore.PersistentStore
+	server   *Server
+	http     *httptest.Server
+	follower *Follower
+}
+
+func newPrimaryNode(t *testing.T) *replicaNode {
+	t.Helper()
+
+	store, err := kvstore.NewPersistentStore().Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Stop)
+
+	n := &replicaNode{store: store, server: NewServer(store)}
+	n.http = httptest.NewServer(n.server)
+	t.Cleanup(n.http.Close)
+	return n
+}
+
+// newFollowerNode starts a follower of primary, serving on loopback, that
+// follows until the test ends.
+func newFollowerNode(t *testing.T, primary string) *replicaNode {
+	t.Helper()
+
+	store, err := kvstore.NewPersistentStore().Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Stop)
+
+	f := NewFollower(store, primary)
+	n := &replicaNode{store: store, server: NewServer(store).WithFollower(f), follower: f}
+	n.http = httptest.NewServer(n.server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		n.http.CloseClientConnections()
+		n.http.Close()
+		<-done
+	})
+	return n
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func caughtUp(primary, follower *replicaNode) func() bool {
+	return func() bool {
+		return follower.store.ReplicationStatus().Position == primary.store.ReplicationStatus().Position
+	}
+}
+
+func TestReplicationOverHTTP(t *testing.T) {
+	primary := newPrimaryNode(t)
+	primary.store.Set("before", "1")
+
+	followers := []*replicaNode{
+		newFollowerNode(t, primary.http.URL),
+		newFollowerNode(t, primary.http.URL),
+	}
+	for _, f := range followers {
+		waitFor(t, "bootstrap", caughtUp(primary, f))
+	}
+
+	primary.store.Set("after", "2")
+	primary.store.RPush("list", "a", "b")
+	for _, f := range followers {
+		waitFor(t, "stream", caughtUp(primary, f))
+	}
+	waitFor(t, "followers", func() bool { return primary.store.ReplicationStatus().Followers == 2 })
+
+	for _, f := range followers {
+		resp, err := http.Get(f.http.URL + "/get?key=after")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || body["value"] != "2" {
+			t.Errorf("got %d %v from a follower", resp.StatusCode, body)
+		}
+
+		if got, _ := f.store.LRange("list", 0, -1); len(got) != 2 {
+			t.Errorf("got list %v", got)
+		}
+	}
+}
+
+func TestFollowerRefusesWrites(t *testing.T) {
+	primary := newPrimaryNode(t)
+	follower := newFollowerNode(t, primary.http.URL)
+	waitFor(t, "bootstrap", caughtUp(primary, follower))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"Set", http.MethodPost, "/set", `{"key":"k","value":"v"}`},
+		{"Delete", http.MethodDelete, "/delete?key=k", ""},
+		{"KeyResource", http.MethodPut, "/v1/keys/k", "v"},
+		{"Restore", http.MethodPost, "/admin/snapshot/restore", `{}`},
+		{"Snapshot", http.MethodGet, "/replication/snapshot", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			follower.server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusMisdirectedRequest {
+				t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusMisdirectedRequest, rr.Body)
+			}
+			if got := rr.Header().Get(PrimaryHeader); got != primary.http.URL {
+				t.Errorf("got %s %q want %q", PrimaryHeader, got, primary.http.URL)
+			}
+		})
+	}
+
+	// Reads still work.
+	rr := httptest.NewRecorder()
+	follower.server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?key=missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d for a read want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestFollowerReportsLag(t *testing.T) {
+	primary := newPrimaryNode(t)
+	primary.store.Set("a", "1")
+	follower := newFollowerNode(t, primary.http.URL)
+	waitFor(t, "bootstrap", caughtUp(primary, follower))
+
+	rr := httptest.NewRecorder()
+	follower.server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/replication", nil))
+	var got replicationStatusResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Role != kvstore.RoleFollower || got.Following == nil {
+		t.Fatalf("got status %+v want a follower", got)
+	}
+	if got.Following.Primary != primary.http.URL || got.Following.Bootstraps != 1 || got.Following.LastContact == nil {
+		t.Errorf("unexpected follower status %+v", got.Following)
+	}
+
+	// Entries the primary has but the follower has not applied are lag.
+	follower.follower.mu.Lock()
+	follower.follower.contact(got.Position.Seq + 3)
+	follower.follower.mu.Unlock()
+	if lag := follower.follower.Status().Lag; lag != 3 {
+		t.Errorf("got lag %d want 3", lag)
+	}
+
+	rr = httptest.NewRecorder()
+	follower.server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := "kvstore_replication_lag_entries 3"; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+}
+
+func TestFollowerBootstrapsAgainAfterGap(t *testing.T) {
+	primary := newPrimaryNode(t)
+	follower := newFollowerNode(t, primary.http.URL)
+	waitFor(t, "bootstrap", caughtUp(primary, follower))
+
+	// Promoting the primary starts a new log, as a restart would, which
+	// the follower cannot resume in.
+	primary.store.Follow()
+	primary.store.Promote()
+	primary.http.CloseClientConnections()
+	primary.store.Set("new", "log")
+
+	waitFor(t, "second bootstrap", func() bool { return follower.follower.Status().Bootstraps == 2 })
+	waitFor(t, "catch up", caughtUp(primary, follower))
+	if got, _ := follower.store.Get("new"); got != "log" {
+		t.Errorf("got %q want log", got)
+	}
+}
+
+func TestPromoteFollower(t *testing.T) {
+	primary := newPrimaryNode(t)
+	primary.store.Set("a", "1")
+	follower := newFollowerNode(t, primary.http.URL)
+	waitFor(t, "bootstrap", caughtUp(primary, follower))
+
+	rr := httptest.NewRecorder()
+	follower.server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/replication/promote", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+
+	// The old primary's writes no longer reach it.
+	primary.store.Set("a", "2")
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/set", strings.NewReader(`{"key":"b","value":"3"}`))
+	req.Header.Set("Content-Type", "application/json")
+	follower.server.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d for a write after promotion: %s", rr.Code, rr.Body)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := follower.store.Get("a"); got != "1" {
+		t.Errorf("promoted follower got %q from the old primary", got)
+	}
+
+	// It can be followed in turn.
+	next := newFollowerNode(t, follower.http.URL)
+	waitFor(t, "bootstrap from the promoted follower", caughtUp(follower, next))
+	if got, _ := next.store.Get("b"); got != "3" {
+		t.Errorf("got %q want 3", got)
+	}
+}
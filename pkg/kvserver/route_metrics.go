@@ -0,0 +1,138 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the request latency histogram.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// RouteMetrics counts requests per route and status, and the time they
+// took. Routes are ServeMux patterns, so the number of series is bounded
+// by the routes registered rather than the paths requested.
+type RouteMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*routeMetrics
+}
+
+type routeMetrics struct {
+	statuses map[int]uint64
+	buckets  []uint64 // Requests per latency bucket, the last one unbounded
+	total    time.Duration
+}
+
+// RouteStats is a snapshot of the metrics of one route.
+type RouteStats struct {
+	Route    string         `json:"route"`
+	Requests uint64         `json:"requests"`
+	Statuses map[int]uint64 `json:"statuses"`
+	// Buckets holds the number of requests that took at most each of
+	// LatencyBuckets, cumulatively, with every request in the last one.
+	Buckets []uint64      `json:"buckets"`
+	Total   time.Duration `json:"total_ns"`
+}
+
+func NewRouteMetrics() *RouteMetrics {
+	return &RouteMetrics{routes: make(map[string]*routeMetrics)}
+}
+
+// LatencyBuckets returns the upper bounds of RouteStats.Buckets. The
+// final bucket, which has no bound, is not included.
+func LatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), latencyBuckets...)
+}
+
+// Middleware records the route, status and latency of every request.
+// Like AccessLog, it must sit inside any middleware that replaces the
+// request.
+func (m *RouteMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordResponse(w)
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		m.observe(route(r), rec.code(), time.Since(start))
+	})
+}
+
+func (m *RouteMetrics) observe(route string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rm, ok := m.routes[route]
+	if !ok {
+		rm = &routeMetrics{
+			statuses: make(map[int]uint64),
+			buckets:  make([]uint64, len(latencyBuckets)+1),
+		}
+		m.routes[route] = rm
+	}
+
+	rm.statuses[status]++
+	rm.total += d
+
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	rm.buckets[i]++
+}
+
+// Stats returns the metrics of every route seen so far, sorted by route.
+func (m *RouteMetrics) Stats() []RouteStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]RouteStats, 0, len(m.routes))
+	for route, rm := range m.routes {
+		st := RouteStats{
+			Route:    route,
+			Statuses: make(map[int]uint64, len(rm.statuses)),
+			Buckets:  make([]uint64, len(rm.buckets)),
+			Total:    rm.total,
+		}
+		for status, n := range rm.statuses {
+			st.Statuses[status] = n
+			st.Requests += n
+		}
+
+		var cumulative uint64
+		for i, n := range rm.buckets {
+			cumulative += n
+			st.Buckets[i] = cumulative
+		}
+		stats = append(stats, st)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// RouteStatsHandler serves the route metrics as JSON.
+func (s *Server) RouteStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"routes": s.metrics.Stats(),
+	})
+}
@@ -0,0 +1,131 @@
+// Package kvserver exposes any kvstore.Store over a JSON HTTP API.
+package kvserver
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"golang-learning/pkg/kvstore"
+)
+
+type Server struct {
+	store   kvstore.Store
+	mux     *http.ServeMux
+	handler http.Handler // mux wrapped in middleware
+	logger  *slog.Logger
+	metrics *RouteMetrics
+	authn   Authenticator // Nil unless WithAuth was called
+	acl     ACL
+
+	limits     Limits
+	limiter    *RateLimiter // Nil unless Limits.Rate is set
+	limitStats limitStats
+
+	follower *Follower // Nil unless WithFollower was called
+}
+
+func NewServer(store kvstore.Store) *Server {
+	s := &Server{
+		store:   store,
+		mux:     http.NewServeMux(),
+		logger:  slog.Default(),
+		metrics: NewRouteMetrics(),
+	}
+	s.routes()
+	s.handler = s.middleware()
+	return s
+}
+
+// WithLogger sets the logger for access logs and panics, which is
+// slog.Default() otherwise.
+func (s *Server) WithLogger(logger *slog.Logger) *Server {
+	s.logger = logger
+	s.handler = s.middleware()
+	return s
+}
+
+// Metrics returns the per-route request metrics of the server.
+func (s *Server) Metrics() *RouteMetrics {
+	return s.metrics
+}
+
+// middleware wraps the mux in the middleware every request goes through.
+// RequestIDs comes first so that the others can log the ID.
+func (s *Server) middleware() http.Handler {
+	return Chain(s.mux,
+		RequestIDs,
+		AccessLog(s.logger),
+		s.metrics.Middleware,
+		Recover(s.logger),
+	)
+}
+
+func (s *Server) routes() {
+	s.v1Routes()
+
+	// Legacy routes, kept as they were before /v1. Their handlers still
+	// check the method themselves, since they are also called directly.
+	s.legacy(http.MethodPost, "/set", s.SetHandler)
+	s.legacy(http.MethodGet, "/get", s.GetHandler)
+	s.legacy(http.MethodDelete, "/delete", s.DeleteHandler)
+	s.legacy(http.MethodGet, "/keys", s.KeysHandler)
+	s.legacy(http.MethodPost, "/mset", s.MSetHandler)
+	s.legacy(http.MethodPost, "/mget", s.MGetHandler)
+	s.legacy(http.MethodPost, "/mdelete", s.MDeleteHandler)
+	s.legacy(http.MethodGet, "/ttl", s.TTLHandler)
+	s.legacy(http.MethodPost, "/expire", s.ExpireHandler)
+	s.legacy(http.MethodPost, "/persist", s.PersistHandler)
+	s.legacy(http.MethodPost, "/txn", s.TxnHandler)
+	s.legacy(http.MethodGet, "/type", s.TypeHandler)
+	s.legacy(http.MethodPost, "/incr", s.IncrHandler)
+	s.legacy(http.MethodPost, "/decr", s.DecrHandler)
+	s.legacy(http.MethodPost, "/lpush", s.LPushHandler)
+	s.legacy(http.MethodPost, "/rpush", s.RPushHandler)
+	s.legacy(http.MethodPost, "/lpop", s.LPopHandler)
+	s.legacy(http.MethodPost, "/rpop", s.RPopHandler)
+	s.legacy(http.MethodGet, "/lrange", s.LRangeHandler)
+	s.legacy(http.MethodPost, "/hset", s.HSetHandler)
+	s.legacy(http.MethodGet, "/hget", s.HGetHandler)
+	s.legacy(http.MethodPost, "/hdel", s.HDelHandler)
+	s.legacy(http.MethodPost, "/sadd", s.SAddHandler)
+	s.legacy(http.MethodPost, "/srem", s.SRemHandler)
+	s.legacy(http.MethodGet, "/smembers", s.SMembersHandler)
+	s.legacy(http.MethodGet, "/watch", s.WatchHandler)
+
+	s.legacy(http.MethodPost, "/admin/snapshot", s.SnapshotHandler)
+	s.legacy(http.MethodGet, "/admin/snapshot/stats", s.SnapshotStatsHandler)
+	s.legacy(http.MethodGet, "/admin/snapshot/download", s.SnapshotDownloadHandler)
+	s.legacy(http.MethodPost, "/admin/snapshot/restore", s.SnapshotRestoreHandler)
+	s.legacy(http.MethodGet, "/admin/routes", s.RouteStatsHandler)
+	s.legacy(http.MethodGet, "/admin/limits", s.LimitsHandler)
+	s.legacy(http.MethodGet, "/admin/replication", s.ReplicationStatusHandler)
+	s.legacy(http.MethodPost, "/admin/replication/promote", s.PromoteHandler)
+	s.legacy(http.MethodGet, "/replication/snapshot", s.ReplicationSnapshotHandler)
+	s.legacy(http.MethodGet, "/replication/stream", s.ReplicationStreamHandler)
+	s.legacy(http.MethodGet, "/admin/cluster", s.ClusterStatusHandler)
+	s.legacy(http.MethodPost, "/admin/cluster/add", s.AddMemberHandler)
+	s.legacy(http.MethodPost, "/admin/cluster/remove", s.RemoveMemberHandler)
+	s.legacy(http.MethodPost, RaftMessagePath, s.RaftMessageHandler)
+
+	s.mux.HandleFunc("GET /metrics", s.guard(nil, nil, writeError, s.MetricsHandler))
+}
+
+// legacy registers a pre-/v1 route for method, guarded with the access
+// in routeAccess and the values in routeValues. Other methods get the
+// route's original 405 body, now with an Allow header.
+func (s *Server) legacy(method, path string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(method+" "+path, s.guard(routeAccess[path], routeValues[path], writeError, handler))
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", method)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,240 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+var errInvalidTTL = errors.New("ttl must be a positive duration or number of seconds")
+
+// parseTTL accepts either a Go duration string ("1m30s") or a number of
+// seconds (90, 1.5). A missing ttl means no expiration.
+func parseTTL(raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var ttl time.Duration
+	var str string
+	var seconds float64
+	if err := json.Unmarshal(raw, &str); err == nil {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return 0, errInvalidTTL
+		}
+		ttl = d
+	} else if err := json.Unmarshal(raw, &seconds); err == nil {
+		ttl = time.Duration(seconds * float64(time.Second))
+	} else {
+		return 0, errInvalidTTL
+	}
+
+	if ttl < 0 {
+		return 0, errInvalidTTL
+	}
+	return ttl, nil
+}
+
+// TTLHandler reports the remaining lifetime of a key in seconds.
+// A ttl of -1 means the key does not expire.
+func (s *Server) TTLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	expirer, ok := s.store.(kvstore.Expirer)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "TTLs are not supported by this store",
+		})
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return
+	}
+
+	ttl, exists := expirer.TTL(key)
+	if !exists {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	seconds := float64(-1)
+	if ttl > 0 {
+		seconds = ttl.Seconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key": key,
+		"ttl": seconds,
+	})
+}
+
+// ExpireHandler sets a new TTL on an existing key.
+func (s *Server) ExpireHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	expirer, ok := s.store.(kvstore.Expirer)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "TTLs are not supported by this store",
+		})
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Content-Type must be application/json",
+		})
+		return
+	}
+
+	var req struct {
+		Key string          `json:"key"`
+		TTL json.RawMessage `json:"ttl"`
+	}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return
+	}
+
+	if req.Key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return
+	}
+
+	ttl, err := parseTTL(req.TTL)
+	if err != nil || ttl == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid ttl",
+		})
+		return
+	}
+
+	found, err := expirer.Expire(req.Key, ttl)
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PersistHandler clears the TTL of a key so that it never expires.
+func (s *Server) PersistHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	expirer, ok := s.store.(kvstore.Expirer)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "TTLs are not supported by this store",
+		})
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return
+	}
+
+	found, err := expirer.Persist(key)
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeError)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,312 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "Missing", raw: "", want: 0},
+		{name: "Null", raw: "null", want: 0},
+		{name: "Duration string", raw: `"1m30s"`, want: 90 * time.Second},
+		{name: "Whole seconds", raw: "90", want: 90 * time.Second},
+		{name: "Fractional seconds", raw: "1.5", want: 1500 * time.Millisecond},
+		{name: "Invalid string", raw: `"soon"`, wantErr: true},
+		{name: "Negative", raw: "-5", wantErr: true},
+		{name: "Wrong type", raw: "true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTTL(json.RawMessage(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetHandlerWithTTL(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		wantStatus int
+		wantTTL    bool
+	}{
+		{
+			name:       "Duration string",
+			key:        "a",
+			body:       `{"key":"a","value":"1","ttl":"1m"}`,
+			wantStatus: http.StatusCreated,
+			wantTTL:    true,
+		},
+		{
+			name:       "Seconds",
+			key:        "b",
+			body:       `{"key":"b","value":"1","ttl":60}`,
+			wantStatus: http.StatusCreated,
+			wantTTL:    true,
+		},
+		{
+			name:       "No ttl",
+			key:        "c",
+			body:       `{"key":"c","value":"1"}`,
+			wantStatus: http.StatusCreated,
+			wantTTL:    false,
+		},
+		{
+			name:       "Invalid ttl",
+			key:        "d",
+			body:       `{"key":"d","value":"1","ttl":"forever"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/set", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			server.SetHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			ttl, _ := store.TTL(tt.key)
+			if (ttl > 0) != tt.wantTTL {
+				t.Errorf("got ttl %v, want ttl set %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestGetHandlerReportsTTL(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.SetWithTTL("foo", "bar", time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=foo", nil)
+	rr := httptest.NewRecorder()
+	server.GetHandler(rr, req)
+
+	var got struct {
+		Key   string  `json:"key"`
+		Value string  `json:"value"`
+		TTL   float64 `json:"ttl"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TTL <= 0 || got.TTL > 60 {
+		t.Errorf("got ttl %v, want within (0, 60]", got.TTL)
+	}
+}
+
+func TestTTLHandler(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.SetWithTTL("expiring", "value", time.Minute)
+	store.Set("forever", "value")
+
+	tests := []struct {
+		name       string
+		method     string
+		keyParam   string
+		wantStatus int
+		wantTTL    func(float64) bool
+	}{
+		{
+			name:       "Wrong HTTP Method (POST)",
+			method:     http.MethodPost,
+			keyParam:   "expiring",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Missing key",
+			method:     http.MethodGet,
+			keyParam:   "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Non-existent key",
+			method:     http.MethodGet,
+			keyParam:   "missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Key with ttl",
+			method:     http.MethodGet,
+			keyParam:   "expiring",
+			wantStatus: http.StatusOK,
+			wantTTL:    func(ttl float64) bool { return ttl > 0 && ttl <= 60 },
+		},
+		{
+			name:       "Key without ttl",
+			method:     http.MethodGet,
+			keyParam:   "forever",
+			wantStatus: http.StatusOK,
+			wantTTL:    func(ttl float64) bool { return ttl == -1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/ttl?key="+tt.keyParam, nil)
+			rr := httptest.NewRecorder()
+
+			server.TTLHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantTTL == nil {
+				return
+			}
+
+			var got struct {
+				TTL float64 `json:"ttl"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantTTL(got.TTL) {
+				t.Errorf("unexpected ttl %v", got.TTL)
+			}
+		})
+	}
+}
+
+func TestExpireHandler(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.SetWithTTL("foo", "bar", time.Second)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "Missing key",
+			body:       `{"ttl":"1h"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing ttl",
+			body:       `{"key":"foo"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Non-existent key",
+			body:       `{"key":"missing","ttl":"1h"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Valid Request",
+			body:       `{"key":"foo","ttl":"1h"}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/expire", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			server.ExpireHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if ttl, _ := store.TTL("foo"); ttl < 59*time.Minute {
+		t.Errorf("expected ttl to be extended to an hour, got %v", ttl)
+	}
+}
+
+func TestPersistHandler(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.SetWithTTL("foo", "bar", 200*time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPost, "/persist?key=missing", nil)
+	rr := httptest.NewRecorder()
+	server.PersistHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusNotFound)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/persist?key=foo", nil)
+	rr = httptest.NewRecorder()
+	server.PersistHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if _, exists := store.Get("foo"); !exists {
+		t.Errorf("expected persisted key to outlive its original ttl")
+	}
+}
+
+func TestKeysHandlerWithExpirations(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.SetWithTTL("expiring", "value", time.Minute)
+	store.Set("forever", "value")
+
+	req := httptest.NewRequest(http.MethodGet, "/keys?expirations=true", nil)
+	rr := httptest.NewRecorder()
+	server.KeysHandler(rr, req)
+
+	var got struct {
+		Keys        []string             `json:"keys"`
+		Expirations map[string]time.Time `json:"expirations"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Keys) != 2 {
+		t.Errorf("got keys %v, want 2 keys", got.Keys)
+	}
+	if _, ok := got.Expirations["forever"]; ok {
+		t.Errorf("expected no expiration for a key without ttl")
+	}
+	if exp := got.Expirations["expiring"]; time.Until(exp) <= 0 {
+		t.Errorf("expected expiration in the future, got %v", exp)
+	}
+}
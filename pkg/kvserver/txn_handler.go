@@ -0,0 +1,147 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"golang-learning/pkg/kvstore"
+)
+
+type txnOp struct {
+	Op        string          `json:"op"`
+	Key       string          `json:"key"`
+	Value     string          `json:"value"`
+	TTL       json.RawMessage `json:"ttl"`
+	IfExists  bool            `json:"if_exists"`
+	IfAbsent  bool            `json:"if_absent"`
+	IfVersion uint64          `json:"if_version"`
+}
+
+type txnResult struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	Found   bool   `json:"found"`
+}
+
+// TxnHandler applies a batch of ops atomically:
+//
+//	{"ops": [{"op": "get", "key": "a", "if_version": 3},
+//	         {"op": "delete", "key": "a"},
+//	         {"op": "set", "key": "b", "value": "x", "if_absent": true}]}
+//
+// If a condition fails nothing is applied and the response is a 409
+// naming the index of the op that failed.
+func (s *Server) TxnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	transactor, ok := s.store.(kvstore.Transactor)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Transactions are not supported by this store",
+		})
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Content-Type must be application/json",
+		})
+		return
+	}
+
+	var req struct {
+		Ops []txnOp `json:"ops"`
+	}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Ops) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return
+	}
+
+	ops := make([]kvstore.TxnOp, len(req.Ops))
+	for i, op := range req.Ops {
+		ttl, err := parseTTL(op.TTL)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "Invalid ttl",
+				"index": i,
+			})
+			return
+		}
+
+		ops[i] = kvstore.TxnOp{
+			Op:        op.Op,
+			Key:       op.Key,
+			Value:     op.Value,
+			TTL:       ttl,
+			IfExists:  op.IfExists,
+			IfAbsent:  op.IfAbsent,
+			IfVersion: op.IfVersion,
+		}
+	}
+
+	results, err := transactor.Txn(ops)
+
+	var txnErr *kvstore.TxnError
+	if errors.As(err, &txnErr) {
+		status, msg := http.StatusBadRequest, "Invalid op"
+		if m, ok := preconditionFailed(err); ok {
+			status, msg = http.StatusConflict, m
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": msg,
+			"index": txnErr.Index,
+		})
+		return
+	}
+	if errors.Is(err, kvstore.ErrStoreFull) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInsufficientStorage)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Store is full",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+
+	resp := make([]txnResult, len(results))
+	for i, res := range results {
+		resp[i] = txnResult(res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"results": resp,
+	})
+}
@@ -0,0 +1,145 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestTxnHandler(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+	store.Set("from", "gopher")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+		wantIndex  int
+	}{
+		{
+			name:       "Invalid body",
+			body:       `{invalid}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Bad Request",
+		},
+		{
+			name:       "No ops",
+			body:       `{"ops":[]}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Bad Request",
+		},
+		{
+			name:       "Unknown op",
+			body:       `{"ops":[{"op":"get","key":"from"},{"op":"rename","key":"from"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Invalid op",
+			wantIndex:  1,
+		},
+		{
+			name:       "Invalid ttl",
+			body:       `{"ops":[{"op":"set","key":"a","value":"1","ttl":"soon"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Invalid ttl",
+		},
+		{
+			name:       "Failed condition",
+			body:       `{"ops":[{"op":"delete","key":"from"},{"op":"set","key":"from","value":"x","if_exists":true}]}`,
+			wantStatus: http.StatusConflict,
+			wantError:  "Key not found",
+			wantIndex:  1,
+		},
+		{
+			name:       "Move",
+			body:       `{"ops":[{"op":"get","key":"from"},{"op":"delete","key":"from"},{"op":"set","key":"to","value":"gopher","if_absent":true}]}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/txn", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var got struct {
+				Error string `json:"error"`
+				Index int    `json:"index"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Error != tt.wantError || got.Index != tt.wantIndex {
+				t.Errorf("got %+v want error %q at index %d", got, tt.wantError, tt.wantIndex)
+			}
+		})
+	}
+
+	if _, exists := store.Get("from"); exists {
+		t.Errorf("expected from to be moved")
+	}
+	if val, _ := store.Get("to"); val != "gopher" {
+		t.Errorf("got %q want %q", val, "gopher")
+	}
+}
+
+func TestTxnHandlerResults(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+	store.Set("a", "1")
+
+	body := `{"ops":[{"op":"get","key":"a"},{"op":"get","key":"missing"},{"op":"set","key":"b","value":"2"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/txn", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var got struct {
+		Results []txnResult `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 3 {
+		t.Fatalf("got %d results want 3", len(got.Results))
+	}
+
+	_, version, _ := store.GetWithVersion("a")
+	if want := (txnResult{Key: "a", Value: "1", Version: version, Found: true}); got.Results[0] != want {
+		t.Errorf("got %+v want %+v", got.Results[0], want)
+	}
+	if got.Results[1].Found {
+		t.Errorf("expected missing key not to be found")
+	}
+	if _, version, _ := store.GetWithVersion("b"); got.Results[2].Version != version {
+		t.Errorf("got version %d want %d", got.Results[2].Version, version)
+	}
+}
+
+func TestTxnHandlerUnsupported(t *testing.T) {
+	store := kvstore.NewShardedStore(2)
+	defer store.Stop()
+	server := NewServer(store)
+
+	req := httptest.NewRequest(http.MethodPost, "/txn", bytes.NewBufferString(`{"ops":[{"op":"get","key":"a"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,533 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// The endpoints in this file work on counters, lists, hashes and sets.
+// Writes take a JSON body naming the key; reads take ?key=.
+
+func (s *Server) IncrHandler(w http.ResponseWriter, r *http.Request) {
+	s.incr(w, r, 1)
+}
+
+func (s *Server) DecrHandler(w http.ResponseWriter, r *http.Request) {
+	s.incr(w, r, -1)
+}
+
+// incr adds sign times the optional "by" (default 1) to a counter:
+//
+//	{"key": "hits", "by": 5}
+func (s *Server) incr(w http.ResponseWriter, r *http.Request, sign int64) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key string `json:"key"`
+		By  *int64 `json:"by"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+
+	by := int64(1)
+	if req.By != nil {
+		by = *req.By
+	}
+
+	n, err := typed.IncrBy(req.Key, sign*by)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":   req.Key,
+		"value": n,
+	})
+}
+
+func (s *Server) LPushHandler(w http.ResponseWriter, r *http.Request) {
+	s.push(w, r, true)
+}
+
+func (s *Server) RPushHandler(w http.ResponseWriter, r *http.Request) {
+	s.push(w, r, false)
+}
+
+// push adds values to the head or tail of a list:
+//
+//	{"key": "queue", "values": ["a", "b"]}
+func (s *Server) push(w http.ResponseWriter, r *http.Request, head bool) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key    string   `json:"key"`
+		Values []string `json:"values"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+	if len(req.Values) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Values are required",
+		})
+		return
+	}
+
+	push := typed.RPush
+	if head {
+		push = typed.LPush
+	}
+	n, err := push(req.Key, req.Values...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":    req.Key,
+		"length": n,
+	})
+}
+
+func (s *Server) LPopHandler(w http.ResponseWriter, r *http.Request) {
+	s.pop(w, r, true)
+}
+
+func (s *Server) RPopHandler(w http.ResponseWriter, r *http.Request) {
+	s.pop(w, r, false)
+}
+
+// pop removes up to count (default 1) values from the head or tail of a list:
+//
+//	{"key": "queue", "count": 10}
+func (s *Server) pop(w http.ResponseWriter, r *http.Request, head bool) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Count *int   `json:"count"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+
+	count := 1
+	if req.Count != nil {
+		count = *req.Count
+	}
+	if count <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid count",
+		})
+		return
+	}
+
+	pop := typed.RPop
+	if head {
+		pop = typed.LPop
+	}
+	values, err := pop(req.Key, count)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	if len(values) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":    req.Key,
+		"values": values,
+	})
+}
+
+// LRangeHandler returns a range of a list, the whole of it by default:
+//
+//	GET /lrange?key=queue&start=0&stop=-1
+func (s *Server) LRangeHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	key, ok := queryKey(w, r)
+	if !ok {
+		return
+	}
+
+	bounds := []int{0, -1}
+	for i, name := range []string{"start", "stop"} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid " + name,
+			})
+			return
+		}
+		bounds[i] = n
+	}
+
+	values, err := typed.LRange(key, bounds[0], bounds[1])
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":    key,
+		"values": values,
+	})
+}
+
+// HSetHandler sets fields of a hash:
+//
+//	{"key": "user:1", "fields": {"name": "gopher"}}
+func (s *Server) HSetHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key    string            `json:"key"`
+		Fields map[string]string `json:"fields"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+	if len(req.Fields) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Fields are required",
+		})
+		return
+	}
+
+	n, err := typed.HSet(req.Key, req.Fields)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":   req.Key,
+		"added": n,
+	})
+}
+
+// HGetHandler returns one field of a hash, or all of them without ?field=:
+//
+//	GET /hget?key=user:1&field=name
+func (s *Server) HGetHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	key, ok := queryKey(w, r)
+	if !ok {
+		return
+	}
+
+	resp := map[string]any{
+		"key": key,
+	}
+	found := false
+
+	if field := r.URL.Query().Get("field"); field != "" {
+		v, exists, err := typed.HGet(key, field)
+		if err != nil {
+			typedError(w, err)
+			return
+		}
+		resp["field"], resp["value"], found = field, v, exists
+	} else {
+		fields, err := typed.HGetAll(key)
+		if err != nil {
+			typedError(w, err)
+			return
+		}
+		resp["fields"], found = fields, len(fields) > 0
+	}
+
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HDelHandler removes fields from a hash:
+//
+//	{"key": "user:1", "fields": ["name"]}
+func (s *Server) HDelHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key    string   `json:"key"`
+		Fields []string `json:"fields"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+
+	n, err := typed.HDel(req.Key, req.Fields...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":     req.Key,
+		"removed": n,
+	})
+}
+
+func (s *Server) SAddHandler(w http.ResponseWriter, r *http.Request) {
+	s.members(w, r, true)
+}
+
+func (s *Server) SRemHandler(w http.ResponseWriter, r *http.Request) {
+	s.members(w, r, false)
+}
+
+// members adds members to or removes them from a set:
+//
+//	{"key": "tags", "members": ["go", "kv"]}
+func (s *Server) members(w http.ResponseWriter, r *http.Request, add bool) {
+	typed, ok := s.typedStore(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Key     string   `json:"key"`
+		Members []string `json:"members"`
+	}
+	if !decodeTypedRequest(w, r, &req, &req.Key) {
+		return
+	}
+
+	op, field := typed.SRem, "removed"
+	if add {
+		op, field = typed.SAdd, "added"
+	}
+	n, err := op(req.Key, req.Members...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key": req.Key,
+		field: n,
+	})
+}
+
+// SMembersHandler returns the members of a set, sorted:
+//
+//	GET /smembers?key=tags
+func (s *Server) SMembersHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	key, ok := queryKey(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := typed.SMembers(key)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":     key,
+		"members": members,
+	})
+}
+
+// TypeHandler reports the type of value a key holds:
+//
+//	GET /type?key=queue
+func (s *Server) TypeHandler(w http.ResponseWriter, r *http.Request) {
+	typed, ok := s.typedStore(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	key, ok := queryKey(w, r)
+	if !ok {
+		return
+	}
+
+	typ := typed.Type(key)
+	if typ == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key not found",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"key":  key,
+		"type": typ,
+	})
+}
+
+// typedStore checks the method of a typed value request and returns the
+// store as a TypedStore. It writes the error response itself if the
+// request cannot proceed.
+func (s *Server) typedStore(w http.ResponseWriter, r *http.Request, method string) (kvstore.TypedStore, bool) {
+	if r.Method != method {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return nil, false
+	}
+
+	typed, ok := s.store.(kvstore.TypedStore)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Typed values are not supported by this store",
+		})
+		return nil, false
+	}
+
+	if method == http.MethodPost && r.Header.Get("Content-Type") != "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Content-Type must be application/json",
+		})
+		return nil, false
+	}
+
+	return typed, true
+}
+
+// decodeTypedRequest decodes the JSON body of r into req and checks that
+// *key was set.
+func decodeTypedRequest(w http.ResponseWriter, r *http.Request, req any, key *string) bool {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Bad Request",
+		})
+		return false
+	}
+
+	if *key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return false
+	}
+	return true
+}
+
+// queryKey returns the ?key= of r.
+func queryKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Key is required",
+		})
+		return "", false
+	}
+	return key, true
+}
+
+// typedError writes the response for an error from a TypedStore.
+func typedError(w http.ResponseWriter, err error) {
+	status, msg := http.StatusInternalServerError, "Internal Server Error"
+	switch {
+	case errors.Is(err, kvstore.ErrWrongType):
+		status, msg = http.StatusConflict, "WRONGTYPE Operation against a key holding the wrong kind of value"
+	case errors.Is(err, kvstore.ErrNotInteger):
+		status, msg = http.StatusConflict, "Value is not an integer or out of range"
+	case errors.Is(err, kvstore.ErrStoreFull):
+		status, msg = http.StatusInsufficientStorage, "Store is full"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": msg,
+	})
+}
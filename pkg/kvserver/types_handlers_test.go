@@ -0,0 +1,151 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func doTyped(t *testing.T, server http.Handler, method, path, body string) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var resp map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, resp
+}
+
+func TestTypedHandlers(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       map[string]any
+	}{
+		{http.MethodPost, "/incr", `{"key":"hits"}`, http.StatusOK, map[string]any{"key": "hits", "value": 1.0}},
+		{http.MethodPost, "/incr", `{"key":"hits","by":9}`, http.StatusOK, map[string]any{"key": "hits", "value": 10.0}},
+		{http.MethodPost, "/decr", `{"key":"hits","by":4}`, http.StatusOK, map[string]any{"key": "hits", "value": 6.0}},
+		{http.MethodGet, "/get?key=hits", "", http.StatusOK, map[string]any{"key": "hits", "value": "6"}},
+		{http.MethodPost, "/rpush", `{"key":"queue","values":["a","b","c"]}`, http.StatusOK, map[string]any{"key": "queue", "length": 3.0}},
+		{http.MethodPost, "/lpush", `{"key":"queue","values":["z"]}`, http.StatusOK, map[string]any{"key": "queue", "length": 4.0}},
+		{http.MethodGet, "/lrange?key=queue&start=1", "", http.StatusOK, map[string]any{"key": "queue", "values": []any{"a", "b", "c"}}},
+		{http.MethodPost, "/lpop", `{"key":"queue"}`, http.StatusOK, map[string]any{"key": "queue", "values": []any{"z"}}},
+		{http.MethodPost, "/rpop", `{"key":"queue","count":2}`, http.StatusOK, map[string]any{"key": "queue", "values": []any{"c", "b"}}},
+		{http.MethodPost, "/lpop", `{"key":"missing"}`, http.StatusNotFound, map[string]any{"error": "Key not found"}},
+		{http.MethodPost, "/hset", `{"key":"user","fields":{"name":"gopher","lang":"go"}}`, http.StatusOK, map[string]any{"key": "user", "added": 2.0}},
+		{http.MethodGet, "/hget?key=user&field=name", "", http.StatusOK, map[string]any{"key": "user", "field": "name", "value": "gopher"}},
+		{http.MethodGet, "/hget?key=user", "", http.StatusOK, map[string]any{"key": "user", "fields": map[string]any{"name": "gopher", "lang": "go"}}},
+		{http.MethodGet, "/hget?key=user&field=missing", "", http.StatusNotFound, map[string]any{"error": "Key not found"}},
+		{http.MethodPost, "/hdel", `{"key":"user","fields":["lang"]}`, http.StatusOK, map[string]any{"key": "user", "removed": 1.0}},
+		{http.MethodPost, "/sadd", `{"key":"tags","members":["go","kv","go"]}`, http.StatusOK, map[string]any{"key": "tags", "added": 2.0}},
+		{http.MethodPost, "/srem", `{"key":"tags","members":["kv"]}`, http.StatusOK, map[string]any{"key": "tags", "removed": 1.0}},
+		{http.MethodGet, "/smembers?key=tags", "", http.StatusOK, map[string]any{"key": "tags", "members": []any{"go"}}},
+		{http.MethodGet, "/type?key=queue", "", http.StatusOK, map[string]any{"key": "queue", "type": "list"}},
+		{http.MethodGet, "/type?key=missing", "", http.StatusNotFound, map[string]any{"error": "Key not found"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			code, got := doTyped(t, server, tt.method, tt.path, tt.body)
+			if code != tt.wantStatus {
+				t.Errorf("got status %d want %d", code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypedHandlersErrors(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.Set("name", "gopher")
+	store.SAdd("tags", "go")
+
+	wrongType := map[string]any{"error": "WRONGTYPE Operation against a key holding the wrong kind of value"}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       map[string]any
+	}{
+		{"Get typed key", http.MethodGet, "/get?key=tags", "", http.StatusConflict, wrongType},
+		{"Push to set", http.MethodPost, "/rpush", `{"key":"tags","values":["x"]}`, http.StatusConflict, wrongType},
+		{"Hash read of string", http.MethodGet, "/hget?key=name", "", http.StatusConflict, wrongType},
+		{"Incr non-integer", http.MethodPost, "/incr", `{"key":"name"}`, http.StatusConflict, map[string]any{"error": "Value is not an integer or out of range"}},
+		{"Missing key", http.MethodPost, "/sadd", `{"members":["x"]}`, http.StatusBadRequest, map[string]any{"error": "Key is required"}},
+		{"Missing values", http.MethodPost, "/lpush", `{"key":"queue"}`, http.StatusBadRequest, map[string]any{"error": "Values are required"}},
+		{"Bad count", http.MethodPost, "/lpop", `{"key":"queue","count":0}`, http.StatusBadRequest, map[string]any{"error": "Invalid count"}},
+		{"Bad range", http.MethodGet, "/lrange?key=queue&stop=x", "", http.StatusBadRequest, map[string]any{"error": "Invalid stop"}},
+		{"Wrong method", http.MethodGet, "/incr", "", http.StatusMethodNotAllowed, map[string]any{"error": "Method not allowed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, got := doTyped(t, server, tt.method, tt.path, tt.body)
+			if code != tt.wantStatus {
+				t.Errorf("got status %d want %d", code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteTypedKeys(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.RPush("queue", "a", "b")
+	store.HSet("user", map[string]string{"name": "gopher"})
+
+	for _, path := range []string{"/delete?key=queue", "/v1/keys/user"} {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Errorf("DELETE %s: got status %d: %s", path, rr.Code, rr.Body)
+		}
+	}
+	if typ := store.Type("queue"); typ != "" {
+		t.Errorf("list still there as %q", typ)
+	}
+	if typ := store.Type("user"); typ != "" {
+		t.Errorf("hash still there as %q", typ)
+	}
+}
+
+func TestTypedHandlersUnsupported(t *testing.T) {
+	server := NewServer(struct{ kvstore.Store }{kvstore.NewMemoryStore()})
+
+	code, got := doTyped(t, server, http.MethodPost, "/incr", `{"key":"hits"}`)
+	if code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", code, http.StatusNotImplemented)
+	}
+	if got["error"] != "Typed values are not supported by this store" {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// defaultContentType is served for values stored without a content type,
+// such as those written through /set.
+const defaultContentType = "text/plain; charset=utf-8"
+
+// v1Routes registers the /v1 API. Routes use method patterns, so the
+// handlers never check r.Method, and errors are problem+json.
+//
+// /v1/keys/{key} is a resource holding raw bytes. PUT stores the request
+// body verbatim with its Content-Type, and GET and HEAD serve it back with
+// the same Content-Type. Keys may contain slashes. /kv/{key} is an alias.
+func (s *Server) v1Routes() {
+	for _, prefix := range []string{"/v1/keys/", "/kv/"} {
+		pattern := prefix + "{key...}"
+		read, write := pathKeyAccess(PermRead), pathKeyAccess(PermWrite)
+		s.mux.HandleFunc("GET "+pattern, s.guard(read, nil, writeProblem, s.getKey))
+		s.mux.HandleFunc("HEAD "+pattern, s.guard(read, nil, writeProblem, s.getKey))
+		s.mux.HandleFunc("PUT "+pattern, s.guard(write, bodyValue, writeProblem, s.putKey))
+		s.mux.HandleFunc("DELETE "+pattern, s.guard(write, nil, writeProblem, s.deleteKey))
+		s.mux.HandleFunc(pattern, methodNotAllowed("GET, HEAD, PUT, DELETE"))
+	}
+	s.mux.HandleFunc("/v1/", notFound)
+}
+
+// getKey serves a value with its content type and ETag.
+func (s *Server) getKey(w http.ResponseWriter, r *http.Request) {
+	content, key, ok := s.keyResource(w, r)
+	if !ok {
+		return
+	}
+
+	c, exists := content.GetContent(key)
+	if !exists {
+		if typed, ok := s.store.(kvstore.TypedStore); ok && typed.Type(key) != "" {
+			writeProblem(w, r, http.StatusConflict, "WRONGTYPE Operation against a key holding the wrong kind of value")
+			return
+		}
+		writeProblem(w, r, http.StatusNotFound, "Key not found")
+		return
+	}
+
+	contentType := c.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(c.Value)))
+	w.Header().Set("ETag", etag(c.Version))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		io.WriteString(w, c.Value)
+	}
+}
+
+// putKey stores the request body under the key. An optional ?ttl= takes
+// a duration such as 90s or a number of seconds. If-Match and
+// If-None-Match: * make the write conditional as on /set.
+func (s *Server) putKey(w http.ResponseWriter, r *http.Request) {
+	content, key, ok := s.keyResource(w, r)
+	if !ok {
+		return
+	}
+
+	cond, err := parsePrecondition(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid If-Match or If-None-Match header")
+		return
+	}
+
+	var raw json.RawMessage
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		raw = json.RawMessage(strconv.Quote(v))
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			raw = json.RawMessage(v)
+		}
+	}
+	ttl, err := parseTTL(raw)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid ttl")
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Could not read the request body")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var version uint64
+	switch {
+	case cond.ifNoneMatch:
+		version, err = content.SetContentIfAbsent(key, string(body), contentType, ttl)
+	case cond.ifMatch:
+		version, err = content.CompareAndSwapContent(key, cond.version, string(body), contentType, ttl)
+	default:
+		version, err = content.SetContent(key, string(body), contentType, ttl)
+	}
+
+	if msg, ok := preconditionFailed(err); ok {
+		writeProblem(w, r, http.StatusPreconditionFailed, msg)
+		return
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		writeProblem(w, r, http.StatusNotImplemented, "Conditional writes are not supported by this store")
+		return
+	}
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeProblem)
+		return
+	}
+	if errors.Is(err, kvstore.ErrStoreFull) {
+		writeProblem(w, r, http.StatusInsufficientStorage, "Store is full")
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// deleteKey deletes the key, honouring an If-Match precondition.
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	_, key, ok := s.keyResource(w, r)
+	if !ok {
+		return
+	}
+
+	cond, err := parsePrecondition(r)
+	if err != nil || cond.ifNoneMatch {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	if cond.ifMatch {
+		versioner, ok := s.store.(kvstore.Versioner)
+		if !ok {
+			writeProblem(w, r, http.StatusNotImplemented, "Conditional writes are not supported by this store")
+			return
+		}
+
+		err = versioner.CompareAndDelete(key, cond.version)
+		if msg, ok := preconditionFailed(err); ok {
+			writeProblem(w, r, http.StatusPreconditionFailed, msg)
+			return
+		}
+	} else {
+		if !s.exists(key) {
+			writeProblem(w, r, http.StatusNotFound, "Key not found")
+			return
+		}
+		err = s.store.Delete(key)
+	}
+
+	if errors.Is(err, kvstore.ErrNotLeader) {
+		s.misdirected(w, r, writeProblem)
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keyResource returns the store as a kvstore.ContentStore and the key
+// named by the path. It writes the problem itself if there is none.
+func (s *Server) keyResource(w http.ResponseWriter, r *http.Request) (kvstore.ContentStore, string, bool) {
+	content, ok := s.store.(kvstore.ContentStore)
+	if !ok {
+		writeProblem(w, r, http.StatusNotImplemented, "Raw values are not supported by this store")
+		return nil, "", false
+	}
+
+	key := r.PathValue("key")
+	if key == "" {
+		writeProblem(w, r, http.StatusBadRequest, "Key is required")
+		return nil, "", false
+	}
+	return content, key, true
+}
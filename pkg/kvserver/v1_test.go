@@ -0,0 +1,223 @@
+package kvserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang-learning/pkg/kvstore"
+)
+
+func TestKeyResourceRoundTrip(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+	png := []byte("\x89PNG\r\n\x1a\n\x00\xff\xfe")
+
+	tests := []struct {
+		name        string
+		path        string
+		body        []byte
+		contentType string
+		wantType    string
+	}{
+		{"Binary", "/v1/keys/logo.png", png, "image/png", "image/png"},
+		{"JSON object", "/v1/keys/config", []byte(`{"debug":true}`), "application/json", "application/json"},
+		{"No content type", "/v1/keys/blob", []byte("abc"), "", "application/octet-stream"},
+		{"Key with slashes", "/v1/keys/users/1/avatar", png, "image/png", "image/png"},
+		{"Legacy alias", "/kv/empty", nil, "text/plain", "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+			}
+			putETag := rr.Header().Get("ETag")
+
+			req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr = httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+			}
+			if !bytes.Equal(rr.Body.Bytes(), tt.body) {
+				t.Errorf("got body %q want %q", rr.Body.Bytes(), tt.body)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q want %q", got, tt.wantType)
+			}
+			if got, want := rr.Header().Get("Content-Length"), strconv.Itoa(len(tt.body)); got != want {
+				t.Errorf("got Content-Length %s want %s", got, want)
+			}
+			if got := rr.Header().Get("ETag"); got != putETag {
+				t.Errorf("got ETag %s want %s", got, putETag)
+			}
+		})
+	}
+}
+
+func TestKeyResource(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	store.Set("plain", "hello")
+	store.SAdd("tags", "go")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		wantStatus int
+		wantBody   string
+		wantDetail string
+	}{
+		{name: "Value set through /set", method: http.MethodGet, path: "/v1/keys/plain", wantStatus: http.StatusOK, wantBody: "hello"},
+		{name: "Head", method: http.MethodHead, path: "/v1/keys/plain", wantStatus: http.StatusOK},
+		{name: "Missing key", method: http.MethodGet, path: "/v1/keys/missing", wantStatus: http.StatusNotFound, wantDetail: "Key not found"},
+		{name: "Typed key", method: http.MethodGet, path: "/v1/keys/tags", wantStatus: http.StatusConflict, wantDetail: "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{name: "No key", method: http.MethodGet, path: "/v1/keys/", wantStatus: http.StatusBadRequest, wantDetail: "Key is required"},
+		{name: "Bad ttl", method: http.MethodPut, path: "/v1/keys/a?ttl=soon", wantStatus: http.StatusBadRequest, wantDetail: "Invalid ttl"},
+		{name: "Create only", method: http.MethodPut, path: "/v1/keys/plain", header: map[string]string{"If-None-Match": "*"}, wantStatus: http.StatusPreconditionFailed, wantDetail: "Key already exists"},
+		{name: "Stale If-Match", method: http.MethodPut, path: "/v1/keys/plain", header: map[string]string{"If-Match": `"99"`}, wantStatus: http.StatusPreconditionFailed, wantDetail: "Version mismatch"},
+		{name: "Bad If-Match", method: http.MethodDelete, path: "/v1/keys/plain", header: map[string]string{"If-Match": "W/\"1\""}, wantStatus: http.StatusBadRequest, wantDetail: "Invalid If-Match header"},
+		{name: "Wrong method", method: http.MethodPost, path: "/v1/keys/a", wantStatus: http.StatusMethodNotAllowed, wantDetail: "Method POST is not allowed on this resource"},
+		{name: "Unknown resource", method: http.MethodGet, path: "/v1/nope", wantStatus: http.StatusNotFound, wantDetail: "No such resource"},
+		{name: "Delete", method: http.MethodDelete, path: "/v1/keys/plain", wantStatus: http.StatusNoContent},
+		{name: "Delete missing", method: http.MethodDelete, path: "/v1/keys/plain", wantStatus: http.StatusNotFound, wantDetail: "Key not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d want %d", rr.Code, tt.wantStatus)
+			}
+
+			if tt.wantDetail == "" {
+				if got := rr.Body.String(); got != tt.wantBody {
+					t.Errorf("got body %q want %q", got, tt.wantBody)
+				}
+				return
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("got Content-Type %q want application/problem+json", got)
+			}
+			var got problem
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.wantStatus),
+				Status:   tt.wantStatus,
+				Detail:   tt.wantDetail,
+				Instance: req.URL.Path,
+			}
+			if got != want {
+				t.Errorf("got %+v want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestKeyResourceConditionalPut(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	put := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/v1/keys/doc", strings.NewReader("x"))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := put("If-None-Match", "*")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+	}
+
+	rr = put("If-Match", rr.Header().Get("ETag"))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusCreated)
+	}
+}
+
+func TestMethodNotAllowedSetsAllow(t *testing.T) {
+	server := NewServer(kvstore.NewMemoryStore())
+
+	tests := []struct {
+		method    string
+		path      string
+		wantAllow string
+	}{
+		{http.MethodPost, "/v1/keys/a", "GET, HEAD, PUT, DELETE"},
+		{http.MethodPatch, "/kv/a", "GET, HEAD, PUT, DELETE"},
+		{http.MethodGet, "/set", http.MethodPost},
+		{http.MethodPost, "/get", http.MethodGet},
+		{http.MethodGet, "/admin/snapshot", http.MethodPost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Errorf("got status %d want %d", rr.Code, http.StatusMethodNotAllowed)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("got Allow %q want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestKeyResourceTTL(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/keys/session?ttl=60", strings.NewReader("x"))
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusCreated)
+	}
+	if ttl, _ := store.TTL("session"); ttl <= 0 {
+		t.Errorf("expected session to have a ttl")
+	}
+}
+
+func TestKeyResourceUnsupported(t *testing.T) {
+	server := NewServer(struct{ kvstore.Store }{kvstore.NewMemoryStore()})
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/keys/a", strings.NewReader("x"))
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusNotImplemented)
+	}
+}
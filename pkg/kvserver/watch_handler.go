@@ -0,0 +1,198 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+)
+
+type watchEvent struct {
+	Type     string `json:"type"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Revision uint64 `json:"revision"`
+}
+
+// WatchHandler streams changes to a key, or to every key under a prefix:
+//
+//	GET /watch?key=user:1
+//	GET /watch?key=user:&prefix=true&since=42
+//
+// Clients that accept text/event-stream get Server-Sent Events, with the
+// revision as the event id so that a reconnecting EventSource resumes
+// where it left off. Other clients long-poll: the response holds the events
+// after since, waiting up to timeout for the first one, and a revision to
+// pass as since on the next poll.
+func (s *Server) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	watcher, ok := s.store.(kvstore.Watcher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Watches are not supported by this store",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	opts := kvstore.WatchOptions{
+		Key:    query.Get("key"),
+		Prefix: query.Get("prefix") == "true",
+	}
+
+	since := query.Get("since")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		since = id
+	}
+	if since != "" {
+		rev, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid since",
+			})
+			return
+		}
+		opts.Since = rev
+	}
+
+	timeout := defaultPollTimeout
+	if t := query.Get("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d < 0 || d > maxPollTimeout {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid timeout",
+			})
+			return
+		}
+		timeout = d
+	}
+
+	sub, err := watcher.Watch(opts)
+	if errors.Is(err, kvstore.ErrCompacted) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Revision compacted",
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Internal Server Error",
+		})
+		return
+	}
+	defer sub.Close()
+
+	keepOpen(w)
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamEvents(w, r, sub)
+		return
+	}
+	s.pollEvents(w, r, sub, max(opts.Since, sub.Revision()), timeout)
+}
+
+// keepOpen lifts the server's read and write deadlines from a request
+// that waits on the store, such as a stream, for longer than a request
+// normally takes. Once the read deadline passes, net/http would otherwise
+// cancel the request.
+func keepOpen(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// streamEvents writes events as Server-Sent Events until the client goes
+// away or the subscription falls behind, in which case the client is
+// expected to reconnect with Last-Event-ID.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, sub *kvstore.Subscription) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Streaming unsupported",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			data, _ := json.Marshal(watchEvent(ev))
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Revision, ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// pollEvents waits up to timeout for an event, then responds with it and
+// any others already queued. revision is where the poll started, returned
+// as is if nothing happened.
+func (s *Server) pollEvents(w http.ResponseWriter, r *http.Request, sub *kvstore.Subscription, revision uint64, timeout time.Duration) {
+	events := []watchEvent{}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+	case ev, ok := <-sub.Events():
+		for ok {
+			events = append(events, watchEvent(ev))
+			revision = ev.Revision
+
+			select {
+			case ev, ok = <-sub.Events():
+			default:
+				ok = false
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"events":   events,
+		"revision": revision,
+	})
+}
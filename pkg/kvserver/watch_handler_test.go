@@ -0,0 +1,153 @@
+package kvserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+type pollResponse struct {
+	Events   []watchEvent `json:"events"`
+	Revision uint64       `json:"revision"`
+}
+
+func poll(t *testing.T, server *Server, query string) (int, pollResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/watch?"+query, nil)
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var resp pollResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestWatchHandlerLongPoll(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	server := NewServer(store)
+
+	t.Run("times out with the current revision", func(t *testing.T) {
+		store.Set("foo", "1")
+
+		code, resp := poll(t, server, "key=foo&timeout=10ms")
+		if code != http.StatusOK {
+			t.Fatalf("got status %d want %d", code, http.StatusOK)
+		}
+		if len(resp.Events) != 0 {
+			t.Errorf("got %d events want none", len(resp.Events))
+		}
+
+		_, version, _ := store.GetWithVersion("foo")
+		if resp.Revision != version {
+			t.Errorf("got revision %d want %d", resp.Revision, version)
+		}
+	})
+
+	t.Run("returns events after since", func(t *testing.T) {
+		_, since, _ := store.GetWithVersion("foo")
+		store.Set("foo", "2")
+		store.Set("bar", "2")
+		store.Delete("foo")
+
+		_, resp := poll(t, server, "key=foo&since="+strconv.FormatUint(since, 10))
+		if len(resp.Events) != 2 {
+			t.Fatalf("got %d events want 2", len(resp.Events))
+		}
+		if resp.Events[0].Value != "2" || resp.Events[1].Type != kvstore.EventDelete {
+			t.Errorf("got %+v, want a set then a delete", resp.Events)
+		}
+		if resp.Revision != resp.Events[1].Revision {
+			t.Errorf("got revision %d want %d", resp.Revision, resp.Events[1].Revision)
+		}
+	})
+
+	t.Run("waits for the next event", func(t *testing.T) {
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			store.Set("user:1", "gopher")
+		}()
+
+		_, resp := poll(t, server, "key=user:&prefix=true&timeout=5s")
+		if len(resp.Events) != 1 || resp.Events[0].Key != "user:1" {
+			t.Errorf("got %+v, want the set of user:1", resp.Events)
+		}
+	})
+
+	t.Run("rejects bad parameters", func(t *testing.T) {
+		for _, query := range []string{"since=abc", "timeout=forever", "timeout=1h"} {
+			if code, _ := poll(t, server, query); code != http.StatusBadRequest {
+				t.Errorf("%s: got status %d want %d", query, code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("reports compacted revisions", func(t *testing.T) {
+		if code, _ := poll(t, server, "since=1000000"); code != http.StatusGone {
+			t.Errorf("got status %d want %d", code, http.StatusGone)
+		}
+	})
+}
+
+func TestWatchHandlerSSE(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	store.Set("foo", "0")
+	_, since, _ := store.GetWithVersion("foo")
+	store.Set("foo", "1")
+
+	ts := httptest.NewServer(NewServer(store))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/watch?key=foo", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(since, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q want text/event-stream", ct)
+	}
+
+	store.Delete("foo")
+
+	// Read the missed set, then the live delete.
+	r := bufio.NewReader(resp.Body)
+	var types []string
+	for len(types) < 2 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ, ok := strings.CutPrefix(strings.TrimSpace(line), "event: "); ok {
+			types = append(types, typ)
+		}
+	}
+
+	if types[0] != kvstore.EventSet || types[1] != kvstore.EventDelete {
+		t.Errorf("got events %q want [set delete]", types)
+	}
+}
+
+func TestWatchHandlerUnsupported(t *testing.T) {
+	store := kvstore.NewShardedStore(2)
+	defer store.Stop()
+	server := NewServer(store)
+
+	if code, _ := poll(t, server, "key=foo"); code != http.StatusNotImplemented {
+		t.Errorf("got status %d want %d", code, http.StatusNotImplemented)
+	}
+}
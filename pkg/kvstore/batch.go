@@ -0,0 +1,72 @@
+package kvstore
+
+import "time"
+
+// Entry is a key and value to set, with a TTL; zero means no expiration.
+type Entry struct {
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// MGet returns the values of the keys that are set, read under a single lock.
+func (s *MemoryStore) MGet(keys []string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		it, exists := s.lookup(key)
+		if !exists || it.Type != "" {
+			s.read(false)
+			continue
+		}
+		s.read(true)
+
+		values[key] = it.Value
+		if s.policy != nil {
+			s.policy.Accessed(key)
+		}
+	}
+	return values
+}
+
+// MSet sets every entry under a single lock and returns their new versions.
+// Like Txn it journals the batch as one record, and either every entry is
+// set or, if the store cannot make room for all of them, none is.
+func (s *MemoryStore) MSet(entries []Entry) ([]uint64, error) {
+	ops := make([]TxnOp, len(entries))
+	for i, e := range entries {
+		ops[i] = TxnOp{Op: TxnSet, Key: e.Key, Value: e.Value, TTL: e.TTL}
+	}
+
+	results, err := s.Txn(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint64, len(results))
+	for i, res := range results {
+		versions[i] = res.Version
+	}
+	return versions, nil
+}
+
+// MDelete deletes keys under a single lock and reports which of them existed.
+func (s *MemoryStore) MDelete(keys []string) ([]bool, error) {
+	ops := make([]TxnOp, len(keys))
+	for i, key := range keys {
+		ops[i] = TxnOp{Op: TxnDelete, Key: key}
+	}
+
+	results, err := s.Txn(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(results))
+	for i, res := range results {
+		found[i] = res.Found
+	}
+	return found, nil
+}
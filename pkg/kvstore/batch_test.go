@@ -0,0 +1,71 @@
+package kvstore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	sharded := NewShardedStore(4)
+	defer sharded.Stop()
+
+	stores := map[string]interface {
+		Store
+		Batcher
+	}{
+		"MemoryStore":  NewMemoryStore(),
+		"ShardedStore": sharded,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			versions, err := store.MSet([]Entry{
+				{Key: "a", Value: "1"},
+				{Key: "b", Value: "2"},
+				{Key: "c", Value: "3"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range versions {
+				if v == 0 {
+					t.Errorf("entry %d: expected a version", i)
+				}
+			}
+
+			got := store.MGet([]string{"a", "missing", "c"})
+			if want := map[string]string{"a": "1", "c": "3"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v want %v", got, want)
+			}
+
+			found, err := store.MDelete([]string{"a", "missing", "b"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []bool{true, false, true}; !reflect.DeepEqual(found, want) {
+				t.Errorf("got %v want %v", found, want)
+			}
+
+			if keys := store.Keys(); !reflect.DeepEqual(keys, []string{"c"}) {
+				t.Errorf("got %q want %q", keys, []string{"c"})
+			}
+		})
+	}
+}
+
+func TestMSetAllOrNothing(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(2)
+
+	_, err := store.MSet([]Entry{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "c", Value: "3"},
+	})
+	if !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("got %v want %v", err, ErrStoreFull)
+	}
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys to be set, got %q", keys)
+	}
+}
@@ -0,0 +1,89 @@
+package kvstore
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrKeyExists is returned by SetIfAbsent when the key is already set.
+	ErrKeyExists = errors.New("key exists")
+	// ErrKeyNotFound is returned by conditional writes to a missing key.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrVersionMismatch is returned by conditional writes when the key
+	// has been changed since the version the caller read.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// GetWithVersion returns the value stored under key and its version.
+func (s *MemoryStore) GetWithVersion(key string) (string, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.lookup(key)
+	if !exists || item.Type != "" {
+		s.read(false)
+		return "", 0, false
+	}
+	s.read(true)
+
+	if s.policy != nil {
+		s.policy.Accessed(key)
+	}
+	return item.Value, item.Version, true
+}
+
+// SetIfAbsent stores value under key for ttl only if key is not set,
+// and returns the new version. It fails with ErrKeyExists otherwise.
+func (s *MemoryStore) SetIfAbsent(key string, value string, ttl time.Duration) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.lookup(key); exists {
+		return 0, ErrKeyExists
+	}
+	return s.set(key, value, ttl)
+}
+
+// SetIfPresent stores value under key for ttl only if key is already set,
+// and returns the new version. It fails with ErrKeyNotFound otherwise.
+func (s *MemoryStore) SetIfPresent(key string, value string, ttl time.Duration) (uint64, error) {
+	return s.CompareAndSwap(key, 0, value, ttl)
+}
+
+// CompareAndSwap stores value under key for ttl only if the key is still
+// at version, and returns the new version. A zero version matches any.
+func (s *MemoryStore) CompareAndSwap(key string, version uint64, value string, ttl time.Duration) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(key, version); err != nil {
+		return 0, err
+	}
+	return s.set(key, value, ttl)
+}
+
+// CompareAndDelete deletes key only if it is still at version.
+// A zero version matches any.
+func (s *MemoryStore) CompareAndDelete(key string, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(key, version); err != nil {
+		return err
+	}
+	return s.delete(key)
+}
+
+// check reports why key at version may not be written, if at all.
+// The caller must hold s.mu.
+func (s *MemoryStore) check(key string, version uint64) error {
+	it, exists := s.lookup(key)
+	if !exists {
+		return ErrKeyNotFound
+	}
+	if version != 0 && it.Version != version {
+		return ErrVersionMismatch
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package kvstore
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersions(t *testing.T) {
+	t.Run("every write bumps the version", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.Set("key", "1")
+		_, v1, _ := store.GetWithVersion("key")
+		store.Set("key", "2")
+		_, v2, _ := store.GetWithVersion("key")
+
+		if v1 == 0 || v2 <= v1 {
+			t.Errorf("got versions %d then %d, want increasing", v1, v2)
+		}
+	})
+
+	t.Run("ttl changes keep the version", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.Set("key", "1")
+		_, before, _ := store.GetWithVersion("key")
+		store.Expire("key", time.Minute)
+		_, after, _ := store.GetWithVersion("key")
+
+		if before != after {
+			t.Errorf("got %d want %d", after, before)
+		}
+	})
+
+	t.Run("versions are not reused after delete", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.Set("key", "1")
+		_, before, _ := store.GetWithVersion("key")
+		store.Delete("key")
+		store.Set("key", "1")
+		_, after, _ := store.GetWithVersion("key")
+
+		if after == before {
+			t.Errorf("got reused version %d", after)
+		}
+	})
+}
+
+func TestConditionalWrites(t *testing.T) {
+	store := NewMemoryStore()
+
+	v1, err := store.SetIfAbsent("key", "1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetIfAbsent("key", "2", 0); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("got %v want %v", err, ErrKeyExists)
+	}
+
+	if _, err := store.SetIfPresent("missing", "1", 0); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got %v want %v", err, ErrKeyNotFound)
+	}
+
+	v2, err := store.CompareAndSwap("key", v1, "2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CompareAndSwap("key", v1, "3", 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("got %v want %v", err, ErrVersionMismatch)
+	}
+	if val, _ := store.Get("key"); val != "2" {
+		t.Errorf("got %q want %q", val, "2")
+	}
+
+	if err := store.CompareAndDelete("key", v1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("got %v want %v", err, ErrVersionMismatch)
+	}
+	if err := store.CompareAndDelete("key", v2); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := store.Get("key"); exists {
+		t.Errorf("expected key to be deleted")
+	}
+}
+
+func TestSetIfAbsentAfterExpiry(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.SetWithTTL("key", "old", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := store.SetIfAbsent("key", "new", 0); err != nil {
+		t.Errorf("expected expired key to count as absent, got %v", err)
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	store := NewShardedStore(4)
+	defer store.Stop()
+	store.Set("counter", "0")
+
+	const workers, increments = 8, 50
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; {
+				val, version, _ := store.GetWithVersion("counter")
+				n, _ := strconv.Atoi(val)
+				_, err := store.CompareAndSwap("counter", version, strconv.Itoa(n+1), 0)
+				if errors.Is(err, ErrVersionMismatch) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, _ := store.Get("counter"); val != strconv.Itoa(workers*increments) {
+		t.Errorf("got %s want %d", val, workers*increments)
+	}
+}
+
+func TestPersistentStore_KeepsVersions(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		WithSaveInterval(time.Hour).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("snapshotted", "1")
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.Set("logged", "1")
+	_, v1, _ := store.GetWithVersion("snapshotted")
+	_, v2, _ := store.GetWithVersion("logged")
+	// No Stop: the second key only survives in the wal.
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if _, v, _ := reloaded.GetWithVersion("snapshotted"); v != v1 {
+		t.Errorf("got version %d from snapshot want %d", v, v1)
+	}
+	if _, v, _ := reloaded.GetWithVersion("logged"); v != v2 {
+		t.Errorf("got version %d from wal want %d", v, v2)
+	}
+
+	version, err := reloaded.SetIfPresent("logged", "2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version <= v2 {
+		t.Errorf("got version %d after reload, want more than %d", version, v2)
+	}
+}
@@ -0,0 +1,72 @@
+package kvstore
+
+import "time"
+
+// Content is a value stored together with its media type.
+type Content struct {
+	Value       string
+	ContentType string // Empty for values set as plain strings
+	Version     uint64
+}
+
+// SetContent stores value under key for ttl along with its media type and
+// returns its new version. Values are byte strings, so any body can be
+// stored; a zero ttl means no expiration.
+func (s *MemoryStore) SetContent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setContent(key, value, contentType, ttl)
+}
+
+// SetContentIfAbsent is SetContent that fails with ErrKeyExists if key
+// is already set.
+func (s *MemoryStore) SetContentIfAbsent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.lookup(key); exists {
+		return 0, ErrKeyExists
+	}
+	return s.setContent(key, value, contentType, ttl)
+}
+
+// CompareAndSwapContent is SetContent that fails like CompareAndSwap
+// unless key is still at version. A zero version matches any.
+func (s *MemoryStore) CompareAndSwapContent(key string, version uint64, value string, contentType string, ttl time.Duration) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(key, version); err != nil {
+		return 0, err
+	}
+	return s.setContent(key, value, contentType, ttl)
+}
+
+// setContent is SetContent for a caller that holds s.mu.
+func (s *MemoryStore) setContent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	return s.setAt(key, value, contentType, exp)
+}
+
+// GetContent returns the value stored under key with its media type and
+// version. Like Get, it reports keys holding other types as missing.
+func (s *MemoryStore) GetContent(key string) (Content, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.lookup(key)
+	if !exists || item.Type != "" {
+		s.read(false)
+		return Content{}, false
+	}
+	s.read(true)
+
+	if s.policy != nil {
+		s.policy.Accessed(key)
+	}
+	return Content{Value: item.Value, ContentType: item.ContentType, Version: item.Version}, true
+}
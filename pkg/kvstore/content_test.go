@@ -0,0 +1,118 @@
+package kvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// binaryValue is a value that is not valid UTF-8.
+const binaryValue = "\x89PNG\r\n\x1a\n\x00\xff\xfe"
+
+func TestContent(t *testing.T) {
+	store := NewMemoryStore()
+
+	version, err := store.SetContent("img", binaryValue, "image/png", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := store.GetContent("img")
+	if !ok {
+		t.Fatalf("expected img to be set")
+	}
+	want := Content{Value: binaryValue, ContentType: "image/png", Version: version}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+
+	store.Set("img", "text")
+	if got, _ := store.GetContent("img"); got.ContentType != "" {
+		t.Errorf("got content type %q, want it cleared by Set", got.ContentType)
+	}
+
+	store.RPush("list", "a")
+	if _, ok := store.GetContent("list"); ok {
+		t.Errorf("expected a list to be reported as missing")
+	}
+}
+
+func TestContentConditional(t *testing.T) {
+	store := NewMemoryStore()
+
+	v1, err := store.SetContentIfAbsent("doc", "{}", "application/json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetContentIfAbsent("doc", "[]", "application/json", 0); err != ErrKeyExists {
+		t.Errorf("got error %v want %v", err, ErrKeyExists)
+	}
+
+	if _, err := store.CompareAndSwapContent("doc", v1+1, "[]", "application/json", 0); err != ErrVersionMismatch {
+		t.Errorf("got error %v want %v", err, ErrVersionMismatch)
+	}
+	if _, err := store.CompareAndSwapContent("missing", 0, "[]", "application/json", 0); err != ErrKeyNotFound {
+		t.Errorf("got error %v want %v", err, ErrKeyNotFound)
+	}
+
+	v2, err := store.CompareAndSwapContent("doc", v1, "<doc/>", "application/xml", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetContent("doc"); got != (Content{Value: "<doc/>", ContentType: "application/xml", Version: v2}) {
+		t.Errorf("got %+v after compare-and-swap", got)
+	}
+}
+
+func TestContentWithTTL(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.SetContent("doc", "{}", "application/json", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok := store.GetContent("doc"); ok {
+		t.Errorf("expected doc to expire")
+	}
+}
+
+func TestPersistentStore_BinaryValues(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	open := func() *PersistentStore {
+		store, err := NewPersistentStore().
+			WithSnapshotFile(snapshotFile).
+			WithWALFile(walFile).
+			WithSaveInterval(time.Hour).
+			Initialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	check := func(store *PersistentStore, from string) {
+		t.Helper()
+		got, ok := store.GetContent("img")
+		if !ok || got.Value != binaryValue || got.ContentType != "image/png" {
+			t.Errorf("got %+v, want the binary value restored from %s", got, from)
+		}
+		if val, _ := store.Get("raw"); val != binaryValue {
+			t.Errorf("got %q, want the plain binary value restored from %s", val, from)
+		}
+	}
+
+	store := open()
+	store.SetContent("img", binaryValue, "image/png", 0)
+	store.Set("raw", binaryValue)
+	// No Stop: the values are only in the wal.
+
+	reloaded := open()
+	check(reloaded, "the wal")
+	reloaded.Stop()
+
+	reloaded = open()
+	defer reloaded.Stop()
+	check(reloaded, "the snapshot")
+}
@@ -0,0 +1,301 @@
+package kvstore
+
+import (
+	"container/heap"
+	"container/list"
+	"math/rand/v2"
+	"sync"
+)
+
+// EvictionPolicy decides which key a bounded store evicts when it is full.
+// The store reports every insert, read and removal to the policy. Reads
+// happen under the store's read lock, so implementations must be safe for
+// concurrent use.
+type EvictionPolicy interface {
+	// Added is called when key is inserted or overwritten, or its TTL
+	// changes. expiration is in Unix nanoseconds, 0 meaning never.
+	Added(key string, expiration int64)
+	// Accessed is called when key is read.
+	Accessed(key string)
+	// Removed is called when key is deleted, expires or is evicted.
+	Removed(key string)
+	// Victim returns the key to evict next, or false if there is none.
+	Victim() (string, bool)
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	mu    sync.Mutex
+	order *list.List // Front is the most recently used
+	elems map[string]*list.Element
+}
+
+// NewLRUPolicy returns a policy that evicts the least recently used key.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) Added(key string, _ int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elems[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) Accessed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) Removed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Victim() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.order.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+// lfuEntry is a key in an lfuPolicy heap. Ties on count are broken by
+// seq, the logical time of the last access, so older keys go first.
+type lfuEntry struct {
+	key   string
+	count uint64
+	seq   uint64
+	index int
+}
+
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// lfuPolicy evicts the least frequently used key.
+type lfuPolicy struct {
+	mu      sync.Mutex
+	heap    lfuHeap
+	entries map[string]*lfuEntry
+	seq     uint64
+}
+
+// NewLFUPolicy returns a policy that evicts the least frequently used key,
+// the least recently used one among keys with the same count.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{
+		entries: make(map[string]*lfuEntry),
+	}
+}
+
+func (p *lfuPolicy) Added(key string, _ int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.touch(key, true)
+}
+
+func (p *lfuPolicy) Accessed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.touch(key, false)
+}
+
+// touch bumps the count of key, adding it if create is set. The caller must hold p.mu.
+func (p *lfuPolicy) touch(key string, create bool) {
+	p.seq++
+	if e, ok := p.entries[key]; ok {
+		e.count++
+		e.seq = p.seq
+		heap.Fix(&p.heap, e.index)
+		return
+	}
+
+	if create {
+		e := &lfuEntry{key: key, count: 1, seq: p.seq}
+		p.entries[key] = e
+		heap.Push(&p.heap, e)
+	}
+}
+
+func (p *lfuPolicy) Removed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.entries[key]; ok {
+		heap.Remove(&p.heap, e.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy) Victim() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	return p.heap[0].key, true
+}
+
+// randomPolicy evicts a key chosen uniformly at random.
+type randomPolicy struct {
+	mu    sync.Mutex
+	keys  []string
+	index map[string]int
+}
+
+// NewRandomPolicy returns a policy that evicts a random key.
+func NewRandomPolicy() EvictionPolicy {
+	return &randomPolicy{
+		index: make(map[string]int),
+	}
+}
+
+func (p *randomPolicy) Added(key string, _ int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.index[key]; ok {
+		return
+	}
+	p.index[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+func (p *randomPolicy) Accessed(string) {}
+
+func (p *randomPolicy) Removed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	// Move the last key into the hole to keep removal O(1).
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.index[p.keys[i]] = i
+	p.keys = p.keys[:last]
+	delete(p.index, key)
+}
+
+func (p *randomPolicy) Victim() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys) == 0 {
+		return "", false
+	}
+	return p.keys[rand.IntN(len(p.keys))], true
+}
+
+// volatileTTLPolicy evicts the key with a TTL that expires soonest.
+// Keys without a TTL are never evicted.
+type volatileTTLPolicy struct {
+	mu      sync.Mutex
+	expiry  expiryHeap
+	entries map[string]*item
+}
+
+// NewVolatileTTLPolicy returns a policy that evicts the key closest to
+// expiring, like Redis's volatile-ttl. When no key has a TTL there is
+// no victim and the store rejects the write.
+func NewVolatileTTLPolicy() EvictionPolicy {
+	return &volatileTTLPolicy{
+		entries: make(map[string]*item),
+	}
+}
+
+func (p *volatileTTLPolicy) Added(key string, expiration int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	it, ok := p.entries[key]
+	if !ok {
+		if expiration == 0 {
+			return
+		}
+		it = &item{key: key, index: -1}
+		p.entries[key] = it
+	}
+
+	it.Expiration = expiration
+	p.expiry.track(it)
+	if expiration == 0 {
+		delete(p.entries, key)
+	}
+}
+
+func (p *volatileTTLPolicy) Accessed(string) {}
+
+func (p *volatileTTLPolicy) Removed(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if it, ok := p.entries[key]; ok {
+		p.expiry.untrack(it)
+		delete(p.entries, key)
+	}
+}
+
+func (p *volatileTTLPolicy) Victim() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.expiry) == 0 {
+		return "", false
+	}
+	return p.expiry[0].key, true
+}
@@ -0,0 +1,204 @@
+package kvstore
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		// setup runs against a store bounded to 3 entries before a
+		// fourth key is written.
+		setup       func(s *MemoryStore)
+		wantEvicted string
+	}{
+		{
+			name:   "LRU evicts least recently used",
+			policy: NewLRUPolicy(),
+			setup: func(s *MemoryStore) {
+				s.Set("a", "1")
+				s.Set("b", "2")
+				s.Set("c", "3")
+				s.Get("a")
+			},
+			wantEvicted: "b",
+		},
+		{
+			name:   "LFU evicts least frequently used",
+			policy: NewLFUPolicy(),
+			setup: func(s *MemoryStore) {
+				s.Set("a", "1")
+				s.Set("b", "2")
+				s.Set("c", "3")
+				s.Get("a")
+				s.Get("a")
+				s.Get("b")
+				s.Get("c")
+				s.Get("c")
+			},
+			wantEvicted: "b",
+		},
+		{
+			name:   "Volatile TTL evicts soonest expiring",
+			policy: NewVolatileTTLPolicy(),
+			setup: func(s *MemoryStore) {
+				s.SetWithTTL("a", "1", time.Hour)
+				s.SetWithTTL("b", "2", time.Minute)
+				s.Set("c", "3")
+			},
+			wantEvicted: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore().
+				WithMaxEntries(3).
+				WithEvictionPolicy(tt.policy)
+
+			tt.setup(store)
+
+			if err := store.Set("d", "4"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, exists := store.Get(tt.wantEvicted); exists {
+				t.Errorf("expected %q to be evicted", tt.wantEvicted)
+			}
+			if len(store.Keys()) != 3 {
+				t.Errorf("got %d keys want 3", len(store.Keys()))
+			}
+			if usage := store.Usage(); usage.Evictions != 1 {
+				t.Errorf("got %d evictions want 1", usage.Evictions)
+			}
+		})
+	}
+}
+
+func TestRandomPolicyStaysWithinBound(t *testing.T) {
+	store := NewMemoryStore().
+		WithMaxEntries(10).
+		WithEvictionPolicy(NewRandomPolicy())
+
+	for i := 0; i < 100; i++ {
+		if err := store.Set("key"+strconv.Itoa(i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(store.Keys()) != 10 {
+		t.Errorf("got %d keys want 10", len(store.Keys()))
+	}
+	if usage := store.Usage(); usage.Evictions != 90 {
+		t.Errorf("got %d evictions want 90", usage.Evictions)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	store := NewMemoryStore().
+		WithMaxBytes(10).
+		WithEvictionPolicy(NewLRUPolicy())
+
+	store.Set("a", "1234") // 5 bytes
+	store.Set("b", "1234") // 10 bytes
+	store.Set("c", "1234") // Evicts a
+
+	if _, exists := store.Get("a"); exists {
+		t.Errorf("expected a to be evicted")
+	}
+	if usage := store.Usage(); usage.Bytes != 10 {
+		t.Errorf("got %d bytes want 10", usage.Bytes)
+	}
+
+	// Overwriting with a value of the same size needs no room.
+	store.Set("c", "abcd")
+	if _, exists := store.Get("b"); !exists {
+		t.Errorf("expected b to survive an overwrite of c")
+	}
+
+	if err := store.Set("big", "value larger than the bound"); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("got error %v want %v", err, ErrStoreFull)
+	}
+}
+
+func TestRejectWhenFull(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+	}{
+		{name: "No policy", policy: nil},
+		{name: "Volatile TTL without volatile keys", policy: NewVolatileTTLPolicy()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore().WithMaxEntries(2)
+			if tt.policy != nil {
+				store.WithEvictionPolicy(tt.policy)
+			}
+
+			store.Set("a", "1")
+			store.Set("b", "2")
+
+			if err := store.Set("c", "3"); !errors.Is(err, ErrStoreFull) {
+				t.Errorf("got error %v want %v", err, ErrStoreFull)
+			}
+			if err := store.Set("a", "updated"); err != nil {
+				t.Errorf("expected overwrite of an existing key to succeed, got %v", err)
+			}
+
+			usage := store.Usage()
+			if usage.Rejections != 1 || usage.Evictions != 0 {
+				t.Errorf("got %+v, want 1 rejection and no evictions", usage)
+			}
+		})
+	}
+}
+
+func TestFullStoreDropsExpiredKeysFirst(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(2)
+
+	store.SetWithTTL("a", "1", time.Nanosecond)
+	store.Set("b", "2")
+	time.Sleep(time.Millisecond)
+
+	if err := store.Set("c", "3"); err != nil {
+		t.Errorf("expected expired key to make room, got %v", err)
+	}
+}
+
+func TestEvictionsAreJournaled(t *testing.T) {
+	dir := t.TempDir()
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithWALFile(walFile).
+		WithMaxEntries(1).
+		WithEvictionPolicy(NewLRUPolicy()).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Stop()
+
+	reloaded, err := NewPersistentStore().WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if _, exists := reloaded.Get("a"); exists {
+		t.Errorf("expected evicted key to stay evicted after replay")
+	}
+	if val, _ := reloaded.Get("b"); val != "2" {
+		t.Errorf("expected b to be replayed")
+	}
+}
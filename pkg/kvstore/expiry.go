@@ -0,0 +1,54 @@
+package kvstore
+
+import "container/heap"
+
+// expiryHeap is a min-heap of the items that carry a TTL, ordered by
+// Expiration. It lets the reaper find due items without scanning the
+// whole store. Each item records its position in index so it can be
+// removed or re-ordered when its TTL changes.
+type expiryHeap []*item
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].Expiration < h[j].Expiration }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
+
+// track adds, re-orders or removes it in the heap to match its Expiration.
+func (h *expiryHeap) track(it *item) {
+	switch {
+	case it.Expiration > 0 && it.index >= 0:
+		heap.Fix(h, it.index)
+	case it.Expiration > 0:
+		heap.Push(h, it)
+	case it.index >= 0:
+		heap.Remove(h, it.index)
+	}
+}
+
+// untrack removes it from the heap if it is there.
+func (h *expiryHeap) untrack(it *item) {
+	if it.index >= 0 {
+		heap.Remove(h, it.index)
+	}
+}
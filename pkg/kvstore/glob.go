@@ -0,0 +1,95 @@
+package kvstore
+
+// MatchPattern reports whether key matches the Redis-style glob pattern.
+// '*' matches any run of bytes, '?' a single byte, "[abc]" and "[a-z]" a
+// class of bytes ("[^a]" negates it) and '\' escapes the next byte.
+// Unlike path.Match, '/' has no special meaning.
+func MatchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Collapse runs of '*' and try every possible split.
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if MatchPattern(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], key[0])
+			if !ok {
+				// An unterminated class matches a literal '['.
+				if key[0] != '[' {
+					return false
+				}
+				break
+			}
+			if !matched {
+				return false
+			}
+			pattern, key = rest, key[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+// matchClass matches c against the class at the start of pattern, which
+// follows the opening '['. It returns the pattern after the closing ']',
+// and false if the class is not terminated.
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo <= c && c <= hi {
+				matched = true
+			}
+			i += 2
+		default:
+			if pattern[i] == c {
+				matched = true
+			}
+		}
+	}
+	return false, "", false
+}
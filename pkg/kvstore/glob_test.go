@@ -0,0 +1,39 @@
+package kvstore
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*", "anything", true},
+		{"*", "", true},
+		{"user:*", "user:42", true},
+		{"user:*", "session:42", false},
+		{"*:42", "user:42", true},
+		{"a/*", "a/b/c", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"h[llo", "h[llo", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.key, func(t *testing.T) {
+			if got := MatchPattern(tt.pattern, tt.key); got != tt.want {
+				t.Errorf("MatchPattern(%q, %q) = %v want %v", tt.pattern, tt.key, got, tt.want)
+			}
+		})
+	}
+}
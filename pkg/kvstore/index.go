@@ -0,0 +1,89 @@
+package kvstore
+
+import "math/rand/v2"
+
+const (
+	// indexMaxLevel bounds the height of the skip list; with indexP of
+	// 1/4 it comfortably covers billions of keys.
+	indexMaxLevel = 16
+	indexP        = 4
+)
+
+type indexNode struct {
+	key  string
+	next []*indexNode
+}
+
+// keyIndex is a skip list of the keys in a store, kept in sorted order so
+// that ranges of keys can be listed without sorting the whole map.
+// It is not safe for concurrent use; MemoryStore guards it with its lock.
+type keyIndex struct {
+	head  indexNode
+	level int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  indexNode{next: make([]*indexNode, indexMaxLevel)},
+		level: 1,
+	}
+}
+
+// path fills update with the rightmost node before key on every level
+// and returns the first node at or after key.
+func (x *keyIndex) path(key string, update []*indexNode) *indexNode {
+	n := &x.head
+	for i := x.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].key < key {
+			n = n.next[i]
+		}
+		if update != nil {
+			update[i] = n
+		}
+	}
+	return n.next[0]
+}
+
+// insert adds key to the index if it is not already there.
+func (x *keyIndex) insert(key string) {
+	var update [indexMaxLevel]*indexNode
+	if n := x.path(key, update[:]); n != nil && n.key == key {
+		return
+	}
+
+	level := 1
+	for level < indexMaxLevel && rand.IntN(indexP) == 0 {
+		level++
+	}
+	for i := x.level; i < level; i++ {
+		update[i] = &x.head
+	}
+	x.level = max(x.level, level)
+
+	n := &indexNode{key: key, next: make([]*indexNode, level)}
+	for i := range level {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+}
+
+// delete removes key from the index if it is there.
+func (x *keyIndex) delete(key string) {
+	var update [indexMaxLevel]*indexNode
+	n := x.path(key, update[:])
+	if n == nil || n.key != key {
+		return
+	}
+
+	for i := range n.next {
+		update[i].next[i] = n.next[i]
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+}
+
+// seek returns the first node whose key is at or after key.
+func (x *keyIndex) seek(key string) *indexNode {
+	return x.path(key, nil)
+}
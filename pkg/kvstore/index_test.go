@@ -0,0 +1,43 @@
+package kvstore
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	x := newKeyIndex()
+	want := map[string]bool{}
+
+	for i := 0; i < 5000; i++ {
+		key := strconv.Itoa(rand.IntN(1000))
+		if rand.IntN(3) == 0 {
+			x.delete(key)
+			delete(want, key)
+		} else {
+			x.insert(key)
+			want[key] = true
+		}
+	}
+
+	var got []string
+	for n := x.seek(""); n != nil; n = n.next[0] {
+		got = append(got, n.key)
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	if !slices.Equal(got, keys) {
+		t.Errorf("index holds %d keys in order %v, want %d", len(got), slices.IsSorted(got), len(keys))
+	}
+
+	if n := x.seek("5"); n == nil || n.key < "5" {
+		t.Errorf("seek landed before its key")
+	}
+}
@@ -0,0 +1,105 @@
+package kvstore
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Types of value a key can hold.
+const (
+	TypeString = "string"
+	TypeList   = "list"
+	TypeHash   = "hash"
+	TypeSet    = "set"
+)
+
+type item struct {
+	Value      string
+	Expiration int64
+	Version    uint64 // Store-wide revision of the write that set Value
+
+	// ContentType is the media type Value was stored with through
+	// SetContent, or empty for values set as plain strings.
+	ContentType string `json:",omitempty"`
+
+	// Type is empty for strings. Other types keep their value in the
+	// matching field below instead of Value.
+	Type string              `json:",omitempty"`
+	List []string            `json:",omitempty"`
+	Hash map[string]string   `json:",omitempty"`
+	Set  map[string]struct{} `json:",omitempty"`
+
+	key   string
+	index int   // Position in the expiry heap, -1 if not in it
+	extra int64 // Bytes held in List, Hash or Set
+}
+
+// itemJSON is how an item is encoded. Values that are not valid UTF-8
+// would be mangled by encoding/json, so they are written base64 encoded
+// to Binary instead of Value.
+type itemJSON struct {
+	plainItem
+	Binary []byte `json:",omitempty"`
+}
+
+type plainItem item
+
+func (i item) MarshalJSON() ([]byte, error) {
+	if utf8.ValidString(i.Value) {
+		return json.Marshal(plainItem(i))
+	}
+
+	v := itemJSON{plainItem: plainItem(i), Binary: []byte(i.Value)}
+	v.Value = ""
+	return json.Marshal(v)
+}
+
+func (i *item) UnmarshalJSON(data []byte) error {
+	var v itemJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*i = item(v.plainItem)
+	if v.Binary != nil {
+		i.Value = string(v.Binary)
+	}
+	return nil
+}
+
+// expired reports whether the item has a TTL that ended before now.
+func (i *item) expired(now int64) bool {
+	return i.Expiration > 0 && now > i.Expiration
+}
+
+// size is the number of bytes the item counts against a store's byte bound.
+func (i *item) size() int64 {
+	return int64(len(i.key)+len(i.Value)) + i.extra
+}
+
+// typ returns the type of value the item holds.
+func (i *item) typ() string {
+	if i.Type == "" {
+		return TypeString
+	}
+	return i.Type
+}
+
+// measure recomputes extra from the item's collection.
+func (i *item) measure() {
+	i.extra = 0
+	for _, v := range i.List {
+		i.extra += int64(len(v))
+	}
+	for f, v := range i.Hash {
+		i.extra += int64(len(f) + len(v))
+	}
+	for m := range i.Set {
+		i.extra += int64(len(m))
+	}
+}
+
+// empty reports whether the item is a collection with nothing left in it.
+func (i *item) empty() bool {
+	return i.Type != "" && len(i.List) == 0 && len(i.Hash) == 0 && len(i.Set) == 0
+}
@@ -0,0 +1,532 @@
+package kvstore
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrStoreFull is returned by writes to a bounded store that is full and
+// either has no eviction policy or nothing its policy is willing to evict.
+var ErrStoreFull = errors.New("store is full")
+
+// Usage reports how full a store is and how it has made room.
+// A zero MaxEntries or MaxBytes means that dimension is unbounded.
+type Usage struct {
+	Entries    int
+	MaxEntries int
+	Bytes      int64
+	MaxBytes   int64
+	// HistoryBytes is held by the recent events kept for watches. In a
+	// store bounded by MaxBytes, it is at most a quarter of the bound.
+	HistoryBytes int64
+	Evictions    uint64
+	Rejections   uint64
+}
+
+// MemoryStore is an in-memory Store guarded by a single lock.
+//
+// Keys set with a TTL stop being visible once they expire, but MemoryStore
+// never removes them on its own; use a TTLStore to reclaim their memory.
+//
+// A MemoryStore can be bounded by entry count and by bytes (the sum of key
+// and value lengths). When a write would exceed a bound, expired keys are
+// dropped first, then keys chosen by the eviction policy. Without a policy
+// the write fails with ErrStoreFull.
+type MemoryStore struct {
+	dict    map[string]*item
+	index   *keyIndex
+	expiry  expiryHeap
+	mu      sync.RWMutex
+	version uint64 // Highest version handed out so far
+
+	// Change feed, see Watch.
+	watchers     map[*Subscription]struct{}
+	history      []Event
+	historyBytes int64  // Of the keys and values in history
+	compacted    uint64 // Revision of the newest event dropped from history
+
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	policy     EvictionPolicy
+	evictions  uint64
+	rejections uint64
+	stats      storeStats
+
+	// journal, if set, is called with every mutation while s.mu is held
+	// and before the mutation is applied. If it fails the mutation is
+	// abandoned and the error returned to the caller.
+	journal func(rec record) error
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		dict:  make(map[string]*item),
+		index: newKeyIndex(),
+	}
+}
+
+// WithMaxEntries bounds the number of keys in the store.
+func (s *MemoryStore) WithMaxEntries(n int) *MemoryStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxEntries = n
+	return s
+}
+
+// WithMaxBytes bounds the total length of the keys and values in the store.
+// The recent events kept for Watch are bounded to a quarter of n more.
+func (s *MemoryStore) WithMaxBytes(n int64) *MemoryStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxBytes = n
+	return s
+}
+
+// WithEvictionPolicy sets the policy used to make room in a full store.
+// Keys already in the store are handed to the policy.
+func (s *MemoryStore) WithEvictionPolicy(policy EvictionPolicy) *MemoryStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy = policy
+	for k, v := range s.dict {
+		policy.Added(k, v.Expiration)
+	}
+	return s
+}
+
+// Usage returns the current size, bounds and eviction counters of the store.
+func (s *MemoryStore) Usage() Usage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Usage{
+		Entries:      len(s.dict),
+		MaxEntries:   s.maxEntries,
+		Bytes:        s.bytes,
+		MaxBytes:     s.maxBytes,
+		HistoryBytes: s.historyBytes,
+		Evictions:    s.evictions,
+		Rejections:   s.rejections,
+	}
+}
+
+// log passes rec to the journal, if any. The caller must hold s.mu.
+func (s *MemoryStore) log(rec record) error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal(rec)
+}
+
+// load replaces the contents of the store with dict and rebuilds the
+// expiry index. A store that has never been written keeps the versions
+// in dict; otherwise the loaded keys get new ones, so that a version read
+// before the load cannot match a different value after it.
+// The caller must hold s.mu.
+func (s *MemoryStore) load(dict map[string]*item) {
+	s.replace(dict, s.version == 0)
+}
+
+// replace is load, keeping the versions in dict if keepVersions is set.
+// The caller must hold s.mu.
+func (s *MemoryStore) replace(dict map[string]*item, keepVersions bool) {
+	for k := range s.dict {
+		s.remove(k)
+		s.notify(EventDelete, k, "", s.nextVersion())
+	}
+
+	// Load in version order so that events are in revision order.
+	keys := make([]string, 0, len(dict))
+	for k, v := range dict {
+		if !keepVersions {
+			v.Version = 0
+		}
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		va, vb := dict[a].Version, dict[b].Version
+		if va == 0 || vb == 0 {
+			return cmp.Compare(vb, va) // Unversioned last
+		}
+		return cmp.Compare(va, vb)
+	})
+
+	for _, k := range keys {
+		it := dict[k]
+		s.put(k, it)
+		s.notify(EventSet, k, it.Value, it.Version)
+	}
+}
+
+// put stores it under key, replacing any previous item. An item without a
+// version, such as one loaded from an old snapshot, is given the next one.
+// The caller must hold s.mu.
+func (s *MemoryStore) put(key string, it *item) {
+	if it.Version == 0 {
+		it.Version = s.nextVersion()
+	} else if it.Version > s.version {
+		s.version = it.Version
+	}
+
+	if old, exists := s.dict[key]; exists {
+		s.expiry.untrack(old)
+		s.bytes -= old.size()
+	} else {
+		s.index.insert(key)
+	}
+
+	it.key = key
+	it.index = -1
+	it.measure()
+	s.dict[key] = it
+	s.expiry.track(it)
+	s.bytes += it.size()
+	if s.policy != nil {
+		s.policy.Added(key, it.Expiration)
+	}
+}
+
+// nextVersion returns a version newer than any in the store. Versions are
+// never reused, so a key that is deleted and set again gets a new one.
+// Deletes and expirations take a version too, as the revision of their
+// event. The caller must hold s.mu.
+func (s *MemoryStore) nextVersion() uint64 {
+	s.version++
+	return s.version
+}
+
+// expire removes key, which has expired. The caller must hold s.mu.
+func (s *MemoryStore) expire(key string) {
+	s.remove(key)
+	s.notify(EventExpire, key, "", s.nextVersion())
+}
+
+// remove deletes key and its expiry index entry. The caller must hold s.mu.
+func (s *MemoryStore) remove(key string) {
+	if it, exists := s.dict[key]; exists {
+		s.expiry.untrack(it)
+		delete(s.dict, key)
+		s.index.delete(key)
+		s.bytes -= it.size()
+		if s.policy != nil {
+			s.policy.Removed(key)
+		}
+	}
+}
+
+// makeRoom ensures that storing size bytes under key keeps the store within
+// its bounds, evicting keys if needed. Evictions are journaled as deletes so
+// that replay does not bring them back. The caller must hold s.mu.
+func (s *MemoryStore) makeRoom(key string, size int64) error {
+	if s.maxEntries <= 0 && s.maxBytes <= 0 {
+		return nil
+	}
+
+	if s.maxBytes > 0 && size > s.maxBytes {
+		s.rejections++
+		return ErrStoreFull
+	}
+
+	return s.evict(func() bool { return s.full(key, size) }, nil)
+}
+
+// evict drops expired keys, then keys chosen by the eviction policy, until
+// full reports false. Keys in keep are never evicted; the write fails if the
+// policy picks one. The caller must hold s.mu.
+func (s *MemoryStore) evict(full func() bool, keep map[string]*item) error {
+	now := time.Now().UnixNano()
+	for full() {
+		// Expired keys are free to drop and need no journal entry.
+		if len(s.expiry) > 0 && s.expiry[0].expired(now) {
+			s.expire(s.expiry[0].key)
+			continue
+		}
+
+		if s.policy == nil {
+			s.rejections++
+			return ErrStoreFull
+		}
+
+		victim, ok := s.policy.Victim()
+		if _, kept := keep[victim]; !ok || kept {
+			s.rejections++
+			return ErrStoreFull
+		}
+		if _, exists := s.dict[victim]; !exists {
+			s.policy.Removed(victim) // Out of sync, drop it and try again
+			continue
+		}
+
+		if err := s.delete(victim); err != nil {
+			return err
+		}
+		s.evictions++
+	}
+	return nil
+}
+
+// full reports whether storing size bytes under key would exceed a bound.
+// The caller must hold s.mu.
+func (s *MemoryStore) full(key string, size int64) bool {
+	entries, bytes := len(s.dict), s.bytes+size
+	if old, exists := s.dict[key]; exists {
+		bytes -= old.size()
+	} else {
+		entries++
+	}
+
+	return (s.maxEntries > 0 && entries > s.maxEntries) ||
+		(s.maxBytes > 0 && bytes > s.maxBytes)
+}
+
+// lookup returns the live item stored under key. The caller must hold s.mu.
+func (s *MemoryStore) lookup(key string) (*item, bool) {
+	it, exists := s.dict[key]
+	if !exists || it.expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	return it, true
+}
+
+// apply replays a single journal record. It only looks at what the record
+// holds, never at the clock, so replaying a log always gives the same
+// result: a key that has expired since is left for lookups to skip and for
+// the reaper to remove. The caller must hold s.mu.
+func (s *MemoryStore) apply(rec record) {
+	switch rec.Op {
+	case opSet:
+		it := &item{Value: rec.Value, ContentType: rec.ContentType, Expiration: rec.Expiration, Version: rec.Version}
+		s.put(rec.Key, it)
+		s.notify(EventSet, rec.Key, it.Value, it.Version)
+	case opDelete:
+		if _, exists := s.dict[rec.Key]; !exists {
+			return
+		}
+		s.remove(rec.Key)
+		if rec.Version > s.version {
+			s.version = rec.Version
+		} else {
+			rec.Version = s.nextVersion()
+		}
+		s.notify(EventDelete, rec.Key, "", rec.Version)
+	case opExpire:
+		if it, exists := s.dict[rec.Key]; exists {
+			it.Expiration = rec.Expiration
+			s.expiry.track(it)
+			if s.policy != nil {
+				s.policy.Added(rec.Key, it.Expiration)
+			}
+		}
+	case opTxn:
+		for _, op := range rec.Ops {
+			s.apply(op)
+		}
+	default:
+		s.applyCollection(rec)
+	}
+}
+
+func (s *MemoryStore) Set(key string, value string) error {
+	return s.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores value under key for ttl. A zero ttl means no expiration.
+func (s *MemoryStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.set(key, value, ttl)
+	return err
+}
+
+// set stores value under key for ttl and returns its new version.
+// The caller must hold s.mu.
+func (s *MemoryStore) set(key string, value string, ttl time.Duration) (uint64, error) {
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	return s.setAt(key, value, "", exp)
+}
+
+// setAt stores value under key with its content type until exp, a Unix
+// time in nanoseconds or zero for no expiration, and returns its new version.
+// The caller must hold s.mu.
+func (s *MemoryStore) setAt(key string, value string, contentType string, exp int64) (uint64, error) {
+	if err := s.makeRoom(key, int64(len(key)+len(value))); err != nil {
+		return 0, err
+	}
+
+	version := s.version + 1
+	if err := s.log(record{Op: opSet, Key: key, Value: value, ContentType: contentType, Expiration: exp, Version: version}); err != nil {
+		return 0, err
+	}
+
+	s.put(key, &item{
+		Value:       value,
+		ContentType: contentType,
+		Expiration:  exp,
+		Version:     version,
+	})
+	s.notify(EventSet, key, value, version)
+	return version, nil
+}
+
+// Get returns the string stored under key. Keys holding other types of
+// value are reported as missing; see Type.
+func (s *MemoryStore) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.lookup(key)
+	if !exists || item.Type != "" {
+		s.read(false)
+		return "", false
+	}
+	s.read(true)
+
+	if s.policy != nil {
+		s.policy.Accessed(key)
+	}
+	return item.Value, true
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.dict[key]; !exists {
+		return nil
+	}
+	return s.delete(key)
+}
+
+// delete removes key, which must be in the store. The caller must hold s.mu.
+func (s *MemoryStore) delete(key string) error {
+	version := s.version + 1
+	if err := s.log(record{Op: opDelete, Key: key, Version: version}); err != nil {
+		return err
+	}
+
+	s.remove(key)
+	s.version = version
+	s.notify(EventDelete, key, "", version)
+	return nil
+}
+
+// Keys returns a slice of all keys in the store, in sorted order.
+func (s *MemoryStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.dict))
+	now := time.Now().UnixNano()
+	for n := s.index.seek(""); n != nil; n = n.next[0] {
+		if !s.dict[n.key].expired(now) {
+			keys = append(keys, n.key)
+		}
+	}
+	return keys
+}
+
+// TTL returns the remaining lifetime of key.
+// A zero duration means the key does not expire.
+func (s *MemoryStore) TTL(key string) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := s.lookup(key)
+	if !exists {
+		return 0, false
+	}
+
+	if item.Expiration == 0 {
+		return 0, true
+	}
+
+	remaining := time.Duration(item.Expiration - time.Now().UnixNano())
+	if remaining <= 0 {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// Expire sets the remaining lifetime of an existing key to ttl,
+// extending or shortening any TTL it already had.
+// It reports whether the key exists.
+func (s *MemoryStore) Expire(key string, ttl time.Duration) (bool, error) {
+	return s.setExpiration(key, time.Now().Add(ttl).UnixNano())
+}
+
+// Persist removes the TTL from key so that it never expires.
+// It reports whether the key exists.
+func (s *MemoryStore) Persist(key string) (bool, error) {
+	return s.setExpiration(key, 0)
+}
+
+func (s *MemoryStore) setExpiration(key string, exp int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.lookup(key); !exists {
+		return false, nil
+	}
+
+	rec := record{Op: opExpire, Key: key, Expiration: exp}
+	if err := s.log(rec); err != nil {
+		return false, err
+	}
+
+	s.apply(rec)
+	return true, nil
+}
+
+// Expirations returns every key in the store mapped to the time it expires.
+// Keys without a TTL map to the zero time.
+func (s *MemoryStore) Expirations() map[string]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expirations := make(map[string]time.Time, len(s.dict))
+	now := time.Now().UnixNano()
+	for k, v := range s.dict {
+		if v.expired(now) {
+			continue
+		}
+
+		var exp time.Time
+		if v.Expiration > 0 {
+			exp = time.Unix(0, v.Expiration)
+		}
+		expirations[k] = exp
+	}
+	return expirations
+}
+
+// reapExpired deletes up to budget expired keys, earliest first, and
+// returns how many it deleted. Only keys that are due are touched, so the
+// lock is held for time proportional to the work done rather than to the
+// size of the store.
+func (s *MemoryStore) reapExpired(budget int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	n := 0
+	for ; n < budget && len(s.expiry) > 0; n++ {
+		it := s.expiry[0]
+		if !it.expired(now) {
+			break
+		}
+
+		s.expire(it.key)
+	}
+	return n
+}
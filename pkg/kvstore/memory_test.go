@@ -1,4 +1,4 @@
-package main
+package kvstore
 
 import (
 	"strconv"
@@ -9,7 +9,7 @@ import (
 
 func TestSetAndGet(t *testing.T) {
 	t.Run("get returns value after set", func(t *testing.T) {
-		store := NewKVStore()
+		store := NewMemoryStore()
 		k, v := "key1", "value1"
 
 		store.Set(k, v)
@@ -24,7 +24,7 @@ func TestSetAndGet(t *testing.T) {
 	})
 
 	t.Run("check for non-existent key", func(t *testing.T) {
-		store := NewKVStore()
+		store := NewMemoryStore()
 		k := "key1"
 
 		_, ok := store.Get(k)
@@ -34,7 +34,7 @@ func TestSetAndGet(t *testing.T) {
 	})
 
 	t.Run("set overwrites existing key", func(t *testing.T) {
-		store := NewKVStore()
+		store := NewMemoryStore()
 
 		store.Set("dup", "1")
 		store.Set("dup", "2")
@@ -50,7 +50,7 @@ func TestSetAndGet(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	store := NewKVStore()
+	store := NewMemoryStore()
 	k, v := "key1", "value1"
 
 	store.Set(k, v)
@@ -63,7 +63,7 @@ func TestDelete(t *testing.T) {
 }
 
 func TestKeys(t *testing.T) {
-	store := NewKVStore()
+	store := NewMemoryStore()
 
 	store.Set("key1", "value1")
 	store.Set("key2", "value2")
@@ -78,7 +78,7 @@ func TestKeys(t *testing.T) {
 }
 
 func TestConcurrentAccess(t *testing.T) {
-	store := NewKVStore()
+	store := NewMemoryStore()
 	var wg sync.WaitGroup
 
 	for i := 1; i <= 1000; i++ {
@@ -106,8 +106,7 @@ func TestConcurrentAccess(t *testing.T) {
 }
 
 func TestSetWithTTL(t *testing.T) {
-	store := NewKVStore()
-	defer store.Stop()
+	store := NewMemoryStore()
 
 	tests := []struct {
 		name       string
@@ -157,54 +156,94 @@ func TestSetWithTTL(t *testing.T) {
 	}
 }
 
-func TestConcurrentSetWithTTL(t *testing.T) {
-	store := NewKVStore()
-	defer store.Stop()
+func TestTTL(t *testing.T) {
+	store := NewMemoryStore()
 
-	var wg sync.WaitGroup
-	wg.Add(100)
-	for i := 1; i <= 100; i++ {
-		go func() {
-			defer wg.Done()
-			key := "key" + strconv.Itoa(i)
-			store.SetWithTTL(key, "value", 100*time.Millisecond)
-		}()
+	store.SetWithTTL("expiring", "value", time.Minute)
+	store.Set("forever", "value")
+
+	if ttl, ok := store.TTL("expiring"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("got ttl=%v ok=%v, want ttl within (0, 1m]", ttl, ok)
 	}
 
-	wg.Wait()
+	if ttl, ok := store.TTL("forever"); !ok || ttl != 0 {
+		t.Errorf("got ttl=%v ok=%v, want 0 for a key without ttl", ttl, ok)
+	}
 
-	for i := 1; i <= 100; i++ {
-		key := "key" + strconv.Itoa(i)
-		if _, exists := store.Get(key); !exists {
-			t.Errorf("key %s should exist", key)
-		}
+	if _, ok := store.TTL("missing"); ok {
+		t.Errorf("expected missing key to report not found")
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.Set("key1", "value1")
+	if ok, _ := store.Expire("key1", 100*time.Millisecond); !ok {
+		t.Fatalf("expected Expire to find key1")
 	}
 
-	// Wait for expiration
-	time.Sleep(150 * time.Millisecond)
+	store.SetWithTTL("key2", "value2", 100*time.Millisecond)
+	if ok, _ := store.Persist("key2"); !ok {
+		t.Fatalf("expected Persist to find key2")
+	}
 
-	for i := 1; i <= 100; i++ {
-		key := "key" + strconv.Itoa(i)
-		if _, exists := store.Get(key); exists {
-			t.Errorf("key %s should have expired", key)
-		}
+	if ok, _ := store.Expire("missing", time.Second); ok {
+		t.Errorf("expected missing key to report not found")
+	}
+	if ok, _ := store.Persist("missing"); ok {
+		t.Errorf("expected missing key to report not found")
 	}
 
+	time.Sleep(250 * time.Millisecond)
+
+	if _, exists := store.Get("key1"); exists {
+		t.Errorf("expected key1 to expire after Expire")
+	}
+	if _, exists := store.Get("key2"); !exists {
+		t.Errorf("expected key2 to survive after Persist")
+	}
 }
 
-func TestCleanupExpired(t *testing.T) {
-	store := NewKVStore()
-	defer store.Stop()
+func TestExpiryIndexTracksTTLChanges(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.SetWithTTL("key1", "value1", time.Minute)
+	store.SetWithTTL("key2", "value2", time.Minute)
+	store.Set("key3", "value3")
+
+	store.Set("key1", "value1") // Overwrite drops the TTL
+	store.Delete("key2")
+	store.Expire("key3", time.Minute)
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 
-	for i := 1; i <= 10; i++ {
-		key := "key" + strconv.Itoa(i)
-		val := "value" + strconv.Itoa(i)
-		store.SetWithTTL(key, val, 50*time.Millisecond)
+	if len(store.expiry) != 1 || store.expiry[0].key != "key3" {
+		t.Errorf("expected only key3 in the expiry index, got %d items", len(store.expiry))
 	}
+}
+
+func TestExpiryIndexRebuiltOnLoad(t *testing.T) {
+	store := NewMemoryStore()
+
+	exp := time.Now().Add(-time.Second).UnixNano()
+	store.mu.Lock()
+	store.load(map[string]*item{
+		"expired": {Value: "value", Expiration: exp},
+		"forever": {Value: "value"},
+	})
+	store.mu.Unlock()
+
+	store.reapExpired(defaultCleanupBudget)
 
-	time.Sleep(200 * time.Millisecond)
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 
-	if len(store.dict) != 0 {
-		t.Errorf("store should be empty, got %d items", len(store.dict))
+	if _, exists := store.dict["expired"]; exists {
+		t.Errorf("expected loaded expired key to be reaped")
+	}
+	if _, exists := store.dict["forever"]; !exists {
+		t.Errorf("expected key without ttl to survive")
 	}
 }
@@ -0,0 +1,352 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"golang-learning/pkg/metrics"
+)
+
+var ErrSnapshotDisabled = errors.New("snapshot file is not configured")
+
+// SnapshotStats describes the most recent snapshot written to disk.
+type SnapshotStats struct {
+	Time     time.Time
+	Size     int
+	Entries  int
+	Duration time.Duration
+}
+
+// SaveStats counts the snapshots written to disk, periodically or on
+// demand, and how long they took.
+type SaveStats struct {
+	Saves    uint64
+	Failures uint64
+	Duration metrics.HistogramSnapshot
+}
+
+// PersistentStore is a TTLStore that survives restarts. It periodically
+// writes JSON snapshots and, optionally, appends every mutation to a
+// write-ahead log in between.
+//
+// Configure it with the With methods, then call Initialize before use.
+type PersistentStore struct {
+	*TTLStore
+
+	snapshotFile string
+	saveInterval time.Duration
+	walFile      string
+	wal          *wal
+	saveMu       sync.Mutex // Serializes snapshots and guards lastSave
+	lastSave     SnapshotStats
+	saves        uint64 // Guarded by saveMu
+	saveFailures uint64 // Guarded by saveMu
+	saveDuration *metrics.Histogram
+	initialized  bool // Initialize succeeded, so Stop may save
+	repl         replication
+}
+
+func NewPersistentStore() *PersistentStore {
+	return &PersistentStore{
+		TTLStore:     NewTTLStore(),
+		snapshotFile: "", // Disabled by default
+		saveInterval: 0,  // Disabled by default
+		walFile:      "", // Disabled by default
+		saveDuration: metrics.NewHistogram(),
+	}
+}
+
+func (s *PersistentStore) WithSnapshotFile(filename string) *PersistentStore {
+	s.snapshotFile = filename
+	return s
+}
+
+func (s *PersistentStore) WithSaveInterval(interval time.Duration) *PersistentStore {
+	s.saveInterval = interval
+	return s
+}
+
+// WithWALFile enables the write-ahead log. Every mutation is appended
+// and fsynced to filename before it is applied to the store.
+func (s *PersistentStore) WithWALFile(filename string) *PersistentStore {
+	s.walFile = filename
+	return s
+}
+
+// WithCleanupInterval is TTLStore.WithCleanupInterval, returning s for chaining.
+func (s *PersistentStore) WithCleanupInterval(interval time.Duration) *PersistentStore {
+	s.TTLStore.WithCleanupInterval(interval)
+	return s
+}
+
+// WithCleanupBudget is TTLStore.WithCleanupBudget, returning s for chaining.
+func (s *PersistentStore) WithCleanupBudget(budget int) *PersistentStore {
+	s.TTLStore.WithCleanupBudget(budget)
+	return s
+}
+
+// WithMaxEntries is MemoryStore.WithMaxEntries, returning s for chaining.
+func (s *PersistentStore) WithMaxEntries(n int) *PersistentStore {
+	s.MemoryStore.WithMaxEntries(n)
+	return s
+}
+
+// WithMaxBytes is MemoryStore.WithMaxBytes, returning s for chaining.
+func (s *PersistentStore) WithMaxBytes(n int64) *PersistentStore {
+	s.MemoryStore.WithMaxBytes(n)
+	return s
+}
+
+// WithEvictionPolicy is MemoryStore.WithEvictionPolicy, returning s for chaining.
+func (s *PersistentStore) WithEvictionPolicy(policy EvictionPolicy) *PersistentStore {
+	s.MemoryStore.WithEvictionPolicy(policy)
+	return s
+}
+
+// Initialize loads the latest snapshot, replays the write-ahead log on top
+// of it and starts the periodic save.
+func (s *PersistentStore) Initialize() (*PersistentStore, error) {
+	var gen uint64 // Generation of the log that follows the snapshot
+	if s.snapshotFile != "" {
+		var dict map[string]*item
+		var err error
+		dict, gen, err = readSnapshot(s.snapshotFile)
+		if err != nil {
+			return nil, fmt.Errorf("load snapshot %s: %w", s.snapshotFile, err)
+		}
+
+		s.mu.Lock()
+		s.load(dict)
+		s.mu.Unlock()
+	}
+
+	if s.walFile != "" {
+		w, err := openWAL(s.walFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// A log older than the snapshot was left by a crash before it
+		// could be reset, and the snapshot already holds its records.
+		// Replaying them again would repeat pushes and pops.
+		s.mu.Lock()
+		err = w.Replay(func(rec record) {
+			if w.gen >= gen {
+				s.apply(rec)
+			}
+		})
+		if err == nil && w.gen < gen {
+			err = w.Reset(gen)
+		}
+		if err == nil {
+			s.wal = w
+		}
+		s.mu.Unlock()
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+
+	// The events that built up the loaded data are not all known, so
+	// watches can only start from here.
+	// Neither should they count as writes.
+	// The replication log starts here too, under a new ID, so followers
+	// of an earlier run bootstrap again.
+	s.mu.Lock()
+	s.forgetHistory()
+	s.resetStats()
+	s.repl.logID = newLogID()
+	s.journal = s.journalRecord
+	s.mu.Unlock()
+
+	if s.snapshotFile != "" && s.saveInterval > 0 {
+		s.wg.Add(1)
+		go s.periodicSave()
+	}
+	s.initialized = true
+	return s, nil
+}
+
+func (s *PersistentStore) periodicSave() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.saveToDisk(); err != nil {
+				log.Println("failed to save snapshot:", err)
+			}
+		case <-s.stop:
+			if err := s.saveToDisk(); err != nil {
+				log.Println("failed to save snapshot:", err)
+			}
+			return
+		}
+	}
+}
+
+// saveToDisk writes a snapshot of the store and, once it is on disk,
+// discards the write-ahead log records it covers by starting the next
+// generation of the log.
+func (s *PersistentStore) saveToDisk() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.save()
+}
+
+// save is saveToDisk for a caller that holds s.saveMu and s.mu.
+func (s *PersistentStore) save() (err error) {
+	start := time.Now()
+	defer func() {
+		s.saveDuration.ObserveDuration(time.Since(start))
+		if err != nil {
+			s.saveFailures++
+		} else {
+			s.saves++
+		}
+	}()
+
+	var gen uint64
+	if s.wal != nil {
+		gen = s.wal.gen + 1
+	}
+	data, err := encodeSnapshot(s.dict, gen)
+	if err != nil {
+		return fmt.Errorf("marshal store: %w", err)
+	}
+	if err := writeSnapshot(s.snapshotFile, data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	// Writers are excluded by the lock, so no record can be appended
+	// between the snapshot and the reset.
+	if s.wal != nil {
+		if err := s.wal.Reset(gen); err != nil {
+			return fmt.Errorf("reset wal: %w", err)
+		}
+	}
+
+	s.lastSave = SnapshotStats{
+		Time:     start,
+		Size:     len(data),
+		Entries:  len(s.dict),
+		Duration: time.Since(start),
+	}
+	return nil
+}
+
+// Snapshot writes a snapshot to disk immediately, outside the periodic save.
+func (s *PersistentStore) Snapshot() (SnapshotStats, error) {
+	if s.snapshotFile == "" {
+		return SnapshotStats{}, ErrSnapshotDisabled
+	}
+
+	if err := s.saveToDisk(); err != nil {
+		return SnapshotStats{}, err
+	}
+	return s.SnapshotStats(), nil
+}
+
+// SnapshotStats returns the stats of the last snapshot written to disk.
+// The zero value means no snapshot has been written yet.
+func (s *PersistentStore) SnapshotStats() SnapshotStats {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	return s.lastSave
+}
+
+// SaveStats returns the counters of every snapshot written to disk so far.
+func (s *PersistentStore) SaveStats() SaveStats {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	return SaveStats{
+		Saves:    s.saves,
+		Failures: s.saveFailures,
+		Duration: s.saveDuration.Snapshot(),
+	}
+}
+
+// WriteSnapshot streams a snapshot of the current contents of the store to w,
+// in the same format as the snapshot file.
+func (s *PersistentStore) WriteSnapshot(w io.Writer) error {
+	s.mu.RLock()
+	data, err := encodeSnapshot(s.dict, 0)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// RestoreSnapshot replaces the contents of the store with the snapshot read
+// from r. If a snapshot file is configured the restored data is written to
+// it before the store takes another write, so the restore survives a
+// restart. The write-ahead log cannot hold a restore on its own, so a store
+// with a log but no snapshot file fails with ErrSnapshotDisabled; a store
+// with neither only keeps the restore in memory.
+//
+// The restore is not an entry of the replication log, so it starts a new
+// log: followers get ErrReplicationGap and bootstrap again.
+func (s *PersistentStore) RestoreSnapshot(r io.Reader) error {
+	if s.snapshotFile == "" && s.walFile != "" {
+		return ErrSnapshotDisabled
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	dict, _, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.repl.following {
+		return ErrReadOnly
+	}
+	s.load(dict)
+	s.restartLog()
+
+	if s.snapshotFile == "" {
+		return nil
+	}
+	return s.save()
+}
+
+// Stop halts the background goroutines, waits for the final save and
+// closes the write-ahead log. Without a periodic save, Stop writes the
+// final snapshot itself.
+func (s *PersistentStore) Stop() {
+	s.TTLStore.Stop()
+
+	if s.initialized && s.snapshotFile != "" && s.saveInterval <= 0 {
+		if err := s.saveToDisk(); err != nil {
+			log.Println("failed to save snapshot:", err)
+		}
+	}
+
+	if s.wal != nil {
+		s.wal.Close()
+	}
+}
@@ -0,0 +1,406 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPersistentStore_ReloadOnRestart(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithSaveInterval(5 * time.Second).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("key1", "value1")
+	store.Set("key2", "value2")
+	store.Stop()
+
+	time.Sleep(time.Second) // Some breathing space
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if val, _ := reloaded.Get("key1"); val != "value1" {
+		t.Errorf("expected key1 to be restored from snapshot")
+	}
+
+	if val, _ := reloaded.Get("key2"); val != "value2" {
+		t.Errorf("expected key2 to be restored from snapshot")
+	}
+}
+
+func TestPersistentStore_RespectsTTL(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithSaveInterval(5 * time.Second).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetWithTTL("key1", "value1", time.Second)
+	store.SetWithTTL("key2", "value2", time.Minute)
+	time.Sleep(6 * time.Second) // Wait for Auto-Save
+	store.Stop()
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if _, exists := reloaded.Get("key1"); exists {
+		t.Errorf("expected expired key1 to be gone")
+	}
+
+	if val, _ := reloaded.Get("key2"); val != "value2" {
+		t.Errorf("expected key2 to be restored from snapshot")
+	}
+}
+
+func TestPersistentStore_FileWrittenCorrectly(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithSaveInterval(5 * time.Second).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("a", "1")
+	store.Set("b", "2")
+	store.Stop()
+
+	time.Sleep(time.Second) // Some breathing space
+
+	raw, err := os.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatalf("expected file to exist")
+	}
+
+	header, body, ok := bytes.Cut(raw, []byte("\n"))
+	if !ok {
+		t.Fatalf("expected snapshot header")
+	}
+
+	var decodedHeader snapshotHeader
+	if err := json.Unmarshal(header, &decodedHeader); err != nil {
+		t.Errorf("invalid snapshot header")
+	}
+	if decodedHeader.Version != snapshotVersion || decodedHeader.Entries != 2 {
+		t.Errorf("unexpected snapshot header %+v", decodedHeader)
+	}
+
+	var decoded map[string]map[string]interface{}
+	err = json.Unmarshal(body, &decoded)
+	if err != nil {
+		t.Errorf("invalid snapshot format")
+	}
+
+	if len(decoded) != 2 {
+		t.Fatalf("unexpected snapshot content")
+	}
+}
+
+func TestPersistentStore_ReplaysWALAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		WithSaveInterval(time.Hour).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("key1", "value1")
+	store.SetWithTTL("key2", "value2", time.Minute)
+	store.Set("key3", "value3")
+	store.Delete("key3")
+	// No Stop: simulate a crash before the next snapshot.
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if val, _ := reloaded.Get("key1"); val != "value1" {
+		t.Errorf("expected key1 to be replayed from wal")
+	}
+
+	if val, _ := reloaded.Get("key2"); val != "value2" {
+		t.Errorf("expected key2 to be replayed from wal")
+	}
+
+	if _, exists := reloaded.Get("key3"); exists {
+		t.Errorf("expected deleted key3 to stay deleted")
+	}
+}
+
+func TestPersistentStore_ReplaysTTLChanges(t *testing.T) {
+	walFile := filepath.Join(t.TempDir(), "store.wal")
+
+	store, err := NewPersistentStore().WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetWithTTL("persisted", "1", 50*time.Millisecond)
+	store.Persist("persisted")
+	store.SetWithTTL("extended", "2", 50*time.Millisecond)
+	store.Expire("extended", time.Hour)
+	store.RPush("list", "old")
+	store.Expire("list", 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	store.RPush("list", "new")
+	// No Stop: simulate a crash, replaying after the original TTLs passed.
+
+	reloaded, err := NewPersistentStore().WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if val, _ := reloaded.Get("persisted"); val != "1" {
+		t.Errorf("got persisted=%q want 1", val)
+	}
+	if val, _ := reloaded.Get("extended"); val != "2" {
+		t.Errorf("got extended=%q want 2", val)
+	}
+	if got, _ := reloaded.LRange("list", 0, -1); !slices.Equal(got, []string{"new"}) {
+		t.Errorf("got list %q want [new]", got)
+	}
+}
+
+func TestPersistentStore_RestoreSurvivesCrash(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().WithSnapshotFile(snapshotFile).WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("before", "1")
+
+	donor := NewMemoryStore()
+	donor.Set("restored", "2")
+	data, _ := encodeSnapshot(donor.dict, 0)
+	if err := store.RestoreSnapshot(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	store.Set("after", "3")
+	// No Stop: simulate a crash before the next snapshot.
+
+	reloaded, err := NewPersistentStore().WithSnapshotFile(snapshotFile).WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if _, exists := reloaded.Get("before"); exists {
+		t.Error("write from before the restore replayed over it")
+	}
+	if val, _ := reloaded.Get("restored"); val != "2" {
+		t.Errorf("got restored=%q want 2", val)
+	}
+	if val, _ := reloaded.Get("after"); val != "3" {
+		t.Errorf("got after=%q want 3", val)
+	}
+}
+
+func TestPersistentStore_RestoreRefusedWithoutSnapshotFile(t *testing.T) {
+	walFile := filepath.Join(t.TempDir(), "store.wal")
+
+	store, err := NewPersistentStore().WithSnapshotFile("").WithWALFile(walFile).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+	store.Set("before", "1")
+
+	donor := NewMemoryStore()
+	donor.Set("restored", "2")
+	data, _ := encodeSnapshot(donor.dict, 0)
+	if err := store.RestoreSnapshot(bytes.NewReader(data)); !errors.Is(err, ErrSnapshotDisabled) {
+		t.Fatalf("got %v want ErrSnapshotDisabled", err)
+	}
+	if val, _ := store.Get("before"); val != "1" {
+		t.Errorf("got before=%q after a refused restore", val)
+	}
+}
+
+func TestPersistentStore_WALResetAfterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		WithSaveInterval(time.Hour).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("key1", "value1")
+	store.Stop()
+
+	w, err := openWAL(walFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = w.Replay(func(record) { n++ })
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected wal to be empty after snapshot, got %d records", n)
+	}
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if val, _ := reloaded.Get("key1"); val != "value1" {
+		t.Errorf("expected key1 to be restored from snapshot")
+	}
+}
+
+func TestPersistentStore_SkipsWALCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+	open := func() *PersistentStore {
+		t.Helper()
+		store, err := NewPersistentStore().WithSnapshotFile(snapshotFile).WithWALFile(walFile).Initialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	store := open()
+	store.RPush("list", "a", "b")
+	store.HSet("hash", map[string]string{"f": "1"})
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.LPop("list", 1)
+	store.HSet("hash", map[string]string{"g": "2"})
+
+	// Crash after the next snapshot is in place but before the log is reset.
+	stale, err := os.ReadFile(walFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(walFile, stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := open()
+	if got, _ := reloaded.LRange("list", 0, -1); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("got list %q want [b]", got)
+	}
+
+	// Writes after the restart go to a log the next restart replays.
+	reloaded.RPush("list", "c")
+	reloaded = open()
+	defer reloaded.Stop()
+	if got, _ := reloaded.LRange("list", 0, -1); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("got list %q want [b c]", got)
+	}
+	if got, _ := reloaded.HGetAll("hash"); len(got) != 2 {
+		t.Errorf("got hash %v want 2 fields", got)
+	}
+}
+
+func TestPersistentStore_HonorsSaveInterval(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithSaveInterval(100 * time.Millisecond).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Stop()
+
+	store.Set("key1", "value1")
+	time.Sleep(300 * time.Millisecond) // Well short of the old fixed 5s ticker
+
+	dict, _, err := readSnapshot(snapshotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dict["key1"] == nil || dict["key1"].Value != "value1" {
+		t.Errorf("expected key1 to be saved within the configured interval")
+	}
+
+	if stats := store.SnapshotStats(); stats.Time.IsZero() || stats.Entries != 1 {
+		t.Errorf("unexpected snapshot stats %+v", stats)
+	}
+}
+
+func TestPersistentStore_StopSavesWithoutInterval(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("key1", "value1")
+	store.Stop()
+
+	dict, _, err := readSnapshot(snapshotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dict["key1"] == nil || dict["key1"].Value != "value1" {
+		t.Errorf("expected Stop to write a final snapshot")
+	}
+}
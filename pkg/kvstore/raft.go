@@ -0,0 +1,299 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+const defaultRaftTimeout = 5 * time.Second
+
+// ErrNotLeader is returned by writes to a RaftStore that is not the leader
+// of its cluster, and by its ReadBarrier. Leader says where to go instead.
+var ErrNotLeader = raft.ErrNotLeader
+
+// RaftStore is a TTLStore replicated to a cluster with Raft. Writes are
+// proposed to the cluster and return once a quorum has committed them and
+// this node has applied them. Only the leader takes writes.
+//
+// Get and the other reads serve what this node has applied. For a
+// linearizable read, call ReadBarrier first, as kvserver does.
+//
+// The snapshots Raft takes of the store are in the snapshot file format
+// of PersistentStore.
+type RaftStore struct {
+	mem     *TTLStore
+	runner  *raft.Runner
+	timeout time.Duration
+}
+
+// raftMachine is the raft.StateMachine of a RaftStore. Commands are
+// journal records, applied in the order the cluster committed them, so
+// every node holds the same keys and values. Versions are not compared
+// across nodes: each reaper takes one for the keys it expires.
+type raftMachine struct {
+	*TTLStore
+}
+
+// NewRaftStore restores the node in cfg from cfg.Storage, or starts it,
+// sending to the other nodes over transport. Call Run to take part in the
+// cluster.
+func NewRaftStore(cfg raft.Config, transport raft.Transport) (*RaftStore, error) {
+	mem := NewTTLStore()
+	runner, err := raft.NewRunner(cfg, raftMachine{mem}, transport)
+	if err != nil {
+		mem.Stop()
+		return nil, err
+	}
+	return &RaftStore{mem: mem, runner: runner, timeout: defaultRaftTimeout}, nil
+}
+
+// WithTickInterval is raft.Runner.WithTickInterval, returning s for chaining.
+func (s *RaftStore) WithTickInterval(d time.Duration) *RaftStore {
+	s.runner.WithTickInterval(d)
+	return s
+}
+
+// WithSnapshotEntries is raft.Runner.WithSnapshotEntries, returning s for
+// chaining.
+func (s *RaftStore) WithSnapshotEntries(n uint64) *RaftStore {
+	s.runner.WithSnapshotEntries(n)
+	return s
+}
+
+// WithTimeout bounds how long a write waits to be committed. A write that
+// times out may still be committed later.
+func (s *RaftStore) WithTimeout(d time.Duration) *RaftStore {
+	s.timeout = d
+	return s
+}
+
+// Run takes part in the cluster until ctx is done. It returns an error if
+// the Raft state could not be persisted.
+func (s *RaftStore) Run(ctx context.Context) error {
+	return s.runner.Run(ctx)
+}
+
+// Stop halts the reaper. Stop Run first by cancelling its context.
+func (s *RaftStore) Stop() {
+	s.mem.Stop()
+}
+
+func (s *RaftStore) Get(key string) (string, bool) {
+	return s.mem.Get(key)
+}
+
+func (s *RaftStore) Set(key string, value string) error {
+	return s.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores value under key for ttl, once the cluster commits it.
+// The expiration is fixed by the leader, so it is the same on every node.
+func (s *RaftStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	_, err := s.propose(record{Op: opSet, Key: key, Value: value, Expiration: exp})
+	return err
+}
+
+// SetContent is SetWithTTL keeping contentType with the value. It returns
+// the version the leader gave the value, which is not that of the other
+// nodes.
+func (s *RaftStore) SetContent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	var exp int64
+	if ttl > 0 {
+		exp = time.Now().Add(ttl).UnixNano()
+	}
+	res, err := s.propose(record{Op: opSet, Key: key, Value: value, ContentType: contentType, Expiration: exp})
+	if err != nil {
+		return 0, err
+	}
+	version, _ := res.(uint64)
+	return version, nil
+}
+
+// SetContentIfAbsent fails with errors.ErrUnsupported: whether a key is
+// set depends on when each node expires it, so the condition could be
+// decided differently across the cluster.
+func (s *RaftStore) SetContentIfAbsent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// CompareAndSwapContent fails with errors.ErrUnsupported, since versions
+// differ across the cluster.
+func (s *RaftStore) CompareAndSwapContent(key string, version uint64, value string, contentType string, ttl time.Duration) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (s *RaftStore) GetContent(key string) (Content, bool) {
+	return s.mem.GetContent(key)
+}
+
+func (s *RaftStore) Delete(key string) error {
+	_, err := s.propose(record{Op: opDelete, Key: key})
+	return err
+}
+
+func (s *RaftStore) Keys() []string {
+	return s.mem.Keys()
+}
+
+func (s *RaftStore) TTL(key string) (time.Duration, bool) {
+	return s.mem.TTL(key)
+}
+
+func (s *RaftStore) Expire(key string, ttl time.Duration) (bool, error) {
+	return s.setExpiration(key, time.Now().Add(ttl).UnixNano())
+}
+
+func (s *RaftStore) Persist(key string) (bool, error) {
+	return s.setExpiration(key, 0)
+}
+
+// setExpiration reports whether key existed when the change was applied.
+func (s *RaftStore) setExpiration(key string, exp int64) (bool, error) {
+	res, err := s.propose(record{Op: opExpire, Key: key, Expiration: exp})
+	if err != nil {
+		return false, err
+	}
+	exists, _ := res.(bool)
+	return exists, nil
+}
+
+func (s *RaftStore) Expirations() map[string]time.Time {
+	return s.mem.Expirations()
+}
+
+// Usage is MemoryStore.Usage for what this node has applied.
+func (s *RaftStore) Usage() Usage {
+	return s.mem.Usage()
+}
+
+func (s *RaftStore) ReaperStats() ReaperStats {
+	return s.mem.ReaperStats()
+}
+
+// propose commits rec and returns the result of applying it.
+func (s *RaftStore) propose(rec record) (any, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	res, err := s.runner.Propose(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ReadBarrier waits until this node can serve a linearizable read: it is
+// still the leader and has applied every write committed before the call.
+// It fails with ErrNotLeader on other nodes.
+func (s *RaftStore) ReadBarrier(ctx context.Context) error {
+	return s.runner.ReadBarrier(ctx)
+}
+
+// IsLeader reports whether this node leads the cluster, as far as it
+// knows.
+func (s *RaftStore) IsLeader() bool {
+	return s.runner.Status().Role == raft.Leader
+}
+
+// Leader returns the address of the leader, or "" if none is known.
+func (s *RaftStore) Leader() string {
+	st := s.runner.Status()
+	for _, p := range st.Members {
+		if p.ID == st.Lead {
+			return p.Addr
+		}
+	}
+	return ""
+}
+
+// ClusterStatus describes this node and the members of the cluster.
+func (s *RaftStore) ClusterStatus() raft.Status {
+	return s.runner.Status()
+}
+
+// Step hands the node a message from another node of the cluster.
+func (s *RaftStore) Step(m raft.Message) error {
+	return s.runner.Step(m)
+}
+
+// AddMember adds the node id at addr to the cluster. The node should be
+// started with raft.Config.Join first.
+func (s *RaftStore) AddMember(ctx context.Context, id uint64, addr string) error {
+	return s.runner.ProposeConfChange(ctx, raft.ConfChange{Type: raft.AddNode, NodeID: id, Addr: addr})
+}
+
+// RemoveMember removes the node id from the cluster.
+func (s *RaftStore) RemoveMember(ctx context.Context, id uint64) error {
+	return s.runner.ProposeConfChange(ctx, raft.ConfChange{Type: raft.RemoveNode, NodeID: id})
+}
+
+// Apply applies a committed record. Sets report the version of the value
+// and expirations whether the key existed.
+//
+// Nothing but the record decides the result, so that every node, and a
+// node replaying its log after a restart, applies it alike. In particular
+// an expired key counts as existing until the reaper removes it.
+func (m raftMachine) Apply(data []byte) any {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch rec.Op {
+	case opExpire:
+		_, exists := m.dict[rec.Key]
+		m.apply(rec)
+		return exists
+	case opSet:
+		m.apply(rec)
+		if it, exists := m.dict[rec.Key]; exists {
+			return it.Version
+		}
+		return uint64(0)
+	}
+	m.apply(rec)
+	return nil
+}
+
+// Snapshot encodes the store as PersistentStore writes it to disk.
+func (m raftMachine) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return encodeSnapshot(m.dict, 0)
+}
+
+// Restore replaces the store with a snapshot from the leader, or from
+// storage on a restart.
+func (m raftMachine) Restore(data []byte) error {
+	dict, _, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replace(dict, true)
+	m.forgetHistory()
+	return nil
+}
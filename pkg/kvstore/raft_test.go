@@ -0,0 +1,280 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+// raftHub is a raft.Transport between RaftStores in one process.
+type raftHub struct {
+	mu     sync.Mutex
+	queues map[uint64]chan raft.Message
+}
+
+type raftHubTransport struct {
+	hub *raftHub
+}
+
+func (t raftHubTransport) Send(msgs []raft.Message) {
+	t.hub.mu.Lock()
+	defer t.hub.mu.Unlock()
+
+	for _, m := range msgs {
+		select {
+		case t.hub.queues[m.To] <- m:
+		default:
+		}
+	}
+}
+
+func (raftHubTransport) AddPeer(id uint64, addr string) {}
+func (raftHubTransport) RemovePeer(id uint64)           {}
+
+// newRaftCluster starts a cluster of n RaftStores with IDs from 1, each
+// with the storage returned by storage. The cluster runs until stop is
+// called or the test ends.
+func newRaftCluster(t *testing.T, n int, storage func(id uint64) raft.Storage) (stores []*RaftStore, stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	stop = func() {
+		cancel()
+		wg.Wait()
+		for _, s := range stores {
+			s.Stop()
+		}
+		stores = nil
+	}
+	t.Cleanup(func() { stop() })
+
+	hub := &raftHub{queues: make(map[uint64]chan raft.Message)}
+	var peers []raft.Peer
+	for id := uint64(1); id <= uint64(n); id++ {
+		peers = append(peers, raft.Peer{ID: id, Addr: fmt.Sprintf("node-%d", id)})
+	}
+
+	for _, p := range peers {
+		store, err := NewRaftStore(raft.Config{ID: p.ID, Peers: peers, Storage: storage(p.ID)}, raftHubTransport{hub})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.WithTickInterval(2 * time.Millisecond).WithSnapshotEntries(4)
+		stores = append(stores, store)
+
+		queue := make(chan raft.Message, 1024)
+		hub.mu.Lock()
+		hub.queues[p.ID] = queue
+		hub.mu.Unlock()
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.Run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case m := <-queue:
+					store.Step(m)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return stores, stop
+}
+
+func memoryStorage(uint64) raft.Storage {
+	return raft.NewMemoryStorage()
+}
+
+func raftLeader(t *testing.T, stores []*RaftStore) *RaftStore {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range stores {
+			if s.IsLeader() {
+				return s
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("no leader elected")
+	return nil
+}
+
+// waitForKeys waits until store holds exactly want.
+func waitForKeys(t *testing.T, store *RaftStore, want []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(store.Keys(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got keys %v want %v", store.Keys(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRaftStore_WritesReplicate(t *testing.T) {
+	stores, _ := newRaftCluster(t, 3, memoryStorage)
+	lead := raftLeader(t, stores)
+
+	var want []string
+	for i := range 10 {
+		key := fmt.Sprintf("key%d", i)
+		if err := lead.Set(key, "value"+key); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, key)
+	}
+	if err := lead.Delete("key0"); err != nil {
+		t.Fatal(err)
+	}
+	want = want[1:]
+
+	// A committed write is applied on the leader before Set returns.
+	if val, ok := lead.Get("key9"); !ok || val != "valuekey9" {
+		t.Errorf("got %q, %v from the leader", val, ok)
+	}
+	if got := lead.Keys(); !slices.Equal(got, want) {
+		t.Errorf("got keys %v on the leader want %v", got, want)
+	}
+	for _, s := range stores {
+		waitForKeys(t, s, want)
+		if val, _ := s.Get("key5"); val != "valuekey5" {
+			t.Errorf("got key5=%q", val)
+		}
+	}
+}
+
+func TestRaftStore_FollowerRefusesWrites(t *testing.T) {
+	stores, _ := newRaftCluster(t, 3, memoryStorage)
+	lead := raftLeader(t, stores)
+	ctx := context.Background()
+
+	for _, s := range stores {
+		if s == lead {
+			continue
+		}
+		if err := s.Set("k", "v"); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("got %v want ErrNotLeader", err)
+		}
+		if err := s.ReadBarrier(ctx); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("got %v want ErrNotLeader", err)
+		}
+		if got, want := s.Leader(), fmt.Sprintf("node-%d", lead.ClusterStatus().ID); got != want {
+			t.Errorf("follower points at leader %q", got)
+		}
+	}
+	if err := lead.ReadBarrier(ctx); err != nil {
+		t.Errorf("read barrier on the leader: %v", err)
+	}
+}
+
+func TestRaftStore_Expire(t *testing.T) {
+	stores, _ := newRaftCluster(t, 3, memoryStorage)
+	lead := raftLeader(t, stores)
+
+	lead.Set("k", "v")
+	if ok, err := lead.Expire("k", time.Hour); err != nil || !ok {
+		t.Errorf("got %v, %v want true", ok, err)
+	}
+	if ok, err := lead.Expire("missing", time.Hour); err != nil || ok {
+		t.Errorf("got %v, %v want false for a missing key", ok, err)
+	}
+	if ttl, _ := lead.TTL("k"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("got TTL %v", ttl)
+	}
+
+	lead.SetWithTTL("short", "v", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	for _, s := range stores {
+		if _, ok := s.Get("short"); ok {
+			t.Error("expired key still readable")
+		}
+	}
+}
+
+func TestRaftStore_RestartReplaysTTLChanges(t *testing.T) {
+	storage := raft.NewMemoryStorage()
+	reopen := func(uint64) raft.Storage { return storage }
+
+	stores, stop := newRaftCluster(t, 1, reopen)
+	lead := raftLeader(t, stores)
+	lead.SetWithTTL("persisted", "1", 50*time.Millisecond)
+	lead.Persist("persisted")
+	lead.SetWithTTL("extended", "2", 50*time.Millisecond)
+	lead.Expire("extended", time.Hour)
+	stop()
+
+	// The log is applied again once the original TTLs have passed.
+	time.Sleep(150 * time.Millisecond)
+	stores, _ = newRaftCluster(t, 1, reopen)
+	lead = raftLeader(t, stores)
+	waitForKeys(t, lead, []string{"extended", "persisted"})
+}
+
+func TestRaftStore_RestartFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	var opened []*raft.FileStorage
+	open := func(id uint64) raft.Storage {
+		s, err := raft.OpenFileStorage(filepath.Join(dir, fmt.Sprint(id)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened = append(opened, s)
+		return s
+	}
+	closeAll := func() {
+		for _, s := range opened {
+			s.Close()
+		}
+		opened = nil
+	}
+	defer closeAll()
+
+	stores, stop := newRaftCluster(t, 1, open)
+	lead := raftLeader(t, stores)
+	for i := range 10 {
+		if err := lead.Set(fmt.Sprintf("key%d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lead.Delete("key3")
+	stop()
+	closeAll()
+
+	// The snapshot data is what PersistentStore writes to disk.
+	fs := open(1).(*raft.FileStorage)
+	_, snap, _, _ := fs.Load()
+	if snap.Index == 0 {
+		t.Fatal("no snapshot taken")
+	}
+	if _, _, err := decodeSnapshot(snap.Data); err != nil {
+		t.Errorf("snapshot is not in the snapshot file format: %v", err)
+	}
+	closeAll()
+
+	// A restart restores the snapshot and applies the log after it.
+	stores, _ = newRaftCluster(t, 1, open)
+	lead = raftLeader(t, stores)
+	if got := len(lead.Keys()); got != 9 {
+		t.Errorf("got %d keys after the restart want 9", got)
+	}
+	if _, ok := lead.Get("key3"); ok {
+		t.Error("deleted key came back")
+	}
+}
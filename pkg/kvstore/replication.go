@@ -0,0 +1,340 @@
+package kvstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+const (
+	// replicationHistory is how many recent entries a primary keeps so
+	// that followers can resume after a disconnect.
+	replicationHistory = 4096
+	// replicationBuffer is how many entries a follower's feed may fall
+	// behind by before it is dropped.
+	replicationBuffer = 1024
+)
+
+var (
+	// ErrReadOnly is returned by writes to a follower, which only changes
+	// through replication.
+	ErrReadOnly = errors.New("store is a read-only follower")
+	// ErrReplicationGap is returned when a follower's position is not in
+	// the primary's log: the entries after it are no longer kept, or it
+	// is from another log altogether. The follower must bootstrap again.
+	ErrReplicationGap = errors.New("replication log does not continue from this position")
+	// ErrFeedLagged is reported by ReplicationFeed.Err when the follower
+	// stopped reading and the feed was dropped.
+	ErrFeedLagged = errors.New("replication feed fell behind")
+)
+
+// Roles of a store in replication.
+const (
+	RolePrimary  = "primary"
+	RoleFollower = "follower"
+)
+
+// ReplicationPosition is a point in a replication log. Each primary starts
+// a log with a new ID, so a position only means something to the log it
+// came from.
+type ReplicationPosition struct {
+	LogID string `json:"log_id"`
+	Seq   uint64 `json:"seq"` // Of the last entry applied
+}
+
+// ReplicationEntry is one mutation in a replication log.
+type ReplicationEntry struct {
+	Seq uint64
+	rec record
+}
+
+type replicationEntryJSON struct {
+	Seq    uint64 `json:"seq"`
+	Record record `json:"record"`
+}
+
+func (e ReplicationEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(replicationEntryJSON{Seq: e.Seq, Record: e.rec})
+}
+
+func (e *ReplicationEntry) UnmarshalJSON(data []byte) error {
+	var v replicationEntryJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Seq, e.rec = v.Seq, v.Record
+	return nil
+}
+
+// ReplicationStatus describes the replication log of a store.
+type ReplicationStatus struct {
+	Role      string              `json:"role"`
+	Position  ReplicationPosition `json:"position"`
+	Followers int                 `json:"followers"` // Feeds open on a primary
+}
+
+// replication is the replication state of a PersistentStore, guarded by
+// its mu.
+type replication struct {
+	logID     string
+	seq       uint64 // Of the last entry
+	history   []ReplicationEntry
+	compacted uint64 // Seq of the newest entry dropped from history
+	feeds     map[*ReplicationFeed]struct{}
+	following bool
+}
+
+func newLogID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ReplicationFeed is a stream of the entries of a primary's log.
+type ReplicationFeed struct {
+	store   *PersistentStore
+	entries chan ReplicationEntry
+	err     error // Guarded by store.mu
+}
+
+// Entries returns the channel entries are delivered on, in order. It is
+// closed when the feed is closed or falls behind; see Err.
+func (f *ReplicationFeed) Entries() <-chan ReplicationEntry {
+	return f.entries
+}
+
+// Err returns ErrFeedLagged if the store dropped the feed because the
+// follower was not keeping up, ErrReadOnly if the store became a
+// follower itself, or ErrReplicationGap if a restore started a new log.
+func (f *ReplicationFeed) Err() error {
+	f.store.mu.RLock()
+	defer f.store.mu.RUnlock()
+
+	return f.err
+}
+
+// Close stops the feed and closes its channel.
+func (f *ReplicationFeed) Close() {
+	s := f.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.repl.feeds[f]; ok {
+		delete(s.repl.feeds, f)
+		close(f.entries)
+	}
+}
+
+// journalRecord is the journal of an initialized PersistentStore: it
+// refuses writes to a follower, then appends rec to the write-ahead log
+// and the replication log. The caller must hold s.mu.
+func (s *PersistentStore) journalRecord(rec record) error {
+	if s.repl.following {
+		return ErrReadOnly
+	}
+	if s.wal != nil {
+		if err := s.wal.Append(rec); err != nil {
+			return err
+		}
+	}
+
+	s.repl.seq++
+	s.publish(ReplicationEntry{Seq: s.repl.seq, rec: rec})
+	return nil
+}
+
+// publish records e in the history and delivers it to every feed,
+// dropping any that are too far behind to take it. The caller must hold
+// s.mu.
+func (s *PersistentStore) publish(e ReplicationEntry) {
+	s.repl.history = append(s.repl.history, e)
+	if len(s.repl.history) >= 2*replicationHistory {
+		s.repl.compacted = s.repl.history[replicationHistory-1].Seq
+		s.repl.history = append(s.repl.history[:0:0], s.repl.history[replicationHistory:]...)
+	}
+
+	for f := range s.repl.feeds {
+		select {
+		case f.entries <- e:
+		default:
+			f.err = ErrFeedLagged
+			delete(s.repl.feeds, f)
+			close(f.entries)
+		}
+	}
+}
+
+// ReplicationStatus returns the role of the store and the position of
+// its log.
+func (s *PersistentStore) ReplicationStatus() ReplicationStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := ReplicationStatus{
+		Role:      RolePrimary,
+		Position:  ReplicationPosition{LogID: s.repl.logID, Seq: s.repl.seq},
+		Followers: len(s.repl.feeds),
+	}
+	if s.repl.following {
+		st.Role = RoleFollower
+	}
+	return st
+}
+
+// ReplicationSnapshot encodes the contents of the store, in the snapshot
+// file format, together with the position of the log it is current to.
+// A follower loads it with LoadReplica and then follows the log from
+// there.
+func (s *PersistentStore) ReplicationSnapshot() ([]byte, ReplicationPosition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.repl.following {
+		return nil, ReplicationPosition{}, ErrReadOnly
+	}
+	data, err := encodeSnapshot(s.dict, 0)
+	return data, ReplicationPosition{LogID: s.repl.logID, Seq: s.repl.seq}, err
+}
+
+// Replicate opens a feed of the entries after from. Entries the follower
+// missed are replayed first, if they are still kept; otherwise it gets
+// ErrReplicationGap and must bootstrap again.
+func (s *PersistentStore) Replicate(from ReplicationPosition) (*ReplicationFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.repl.following {
+		return nil, ErrReadOnly
+	}
+	if from.LogID != s.repl.logID || from.Seq < s.repl.compacted || from.Seq > s.repl.seq {
+		return nil, ErrReplicationGap
+	}
+
+	var missed []ReplicationEntry
+	for _, e := range s.repl.history {
+		if e.Seq > from.Seq {
+			missed = append(missed, e)
+		}
+	}
+
+	f := &ReplicationFeed{
+		store:   s,
+		entries: make(chan ReplicationEntry, max(replicationBuffer, len(missed))),
+	}
+	for _, e := range missed {
+		f.entries <- e
+	}
+
+	if s.repl.feeds == nil {
+		s.repl.feeds = make(map[*ReplicationFeed]struct{})
+	}
+	s.repl.feeds[f] = struct{}{}
+	return f, nil
+}
+
+// Follow makes the store a read-only follower. Writes fail with
+// ErrReadOnly until Promote; the store only changes through LoadReplica
+// and ApplyReplicated. Feeds open on the store are closed.
+func (s *PersistentStore) Follow() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repl.following = true
+	for f := range s.repl.feeds {
+		f.err = ErrReadOnly
+		delete(s.repl.feeds, f)
+		close(f.entries)
+	}
+	s.repl.history = nil
+}
+
+// LoadReplica replaces the contents of a follower with a snapshot from
+// ReplicationSnapshot, current to pos.
+func (s *PersistentStore) LoadReplica(r io.Reader, pos ReplicationPosition) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dict, _, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.repl.following {
+		return errors.New("store is not a follower")
+	}
+	// The versions are the primary's, so ETags match across the nodes.
+	// That is safe on a follower, which takes no conditional writes, but
+	// the events of the load are out of revision order, so watches can
+	// only start from here.
+	s.replace(dict, true)
+	s.forgetHistory()
+	s.repl.logID, s.repl.seq = pos.LogID, pos.Seq
+
+	// Entries applied after the load go to the log the snapshot
+	// replaces, so it is written before they are taken.
+	if s.snapshotFile == "" {
+		return nil
+	}
+	return s.save()
+}
+
+// ApplyReplicated applies an entry of the primary's log to a follower.
+// Entries must be applied in order; if e does not follow the last one
+// the store is unchanged and the error is ErrReplicationGap.
+func (s *PersistentStore) ApplyReplicated(e ReplicationEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.repl.following {
+		return errors.New("store is not a follower")
+	}
+	if e.Seq != s.repl.seq+1 {
+		return ErrReplicationGap
+	}
+
+	if s.wal != nil {
+		if err := s.wal.Append(e.rec); err != nil {
+			return err
+		}
+	}
+	s.apply(e.rec)
+	s.repl.seq = e.Seq
+	return nil
+}
+
+// Promote makes a follower a primary that accepts writes. It starts a new
+// log, continuing the sequence numbers, so that the other followers of
+// the old primary bootstrap again rather than resume from entries that
+// may never have reached this store.
+func (s *PersistentStore) Promote() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.repl.following {
+		return
+	}
+	s.repl.following = false
+	s.restartLog()
+}
+
+// restartLog starts a new log, continuing the sequence numbers, and
+// closes the feeds of the old one: followers cannot resume from it and
+// must bootstrap again. The caller must hold s.mu.
+func (s *PersistentStore) restartLog() {
+	s.repl.logID = newLogID()
+	s.repl.history = nil
+	s.repl.compacted = s.repl.seq
+	for f := range s.repl.feeds {
+		f.err = ErrReplicationGap
+		delete(s.repl.feeds, f)
+		close(f.entries)
+	}
+}
@@ -0,0 +1,293 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newReplicationPair(t *testing.T) (primary, follower *PersistentStore) {
+	t.Helper()
+
+	primary, err := NewPersistentStore().Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(primary.Stop)
+
+	follower, err = NewPersistentStore().Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(follower.Stop)
+	follower.Follow()
+	return primary, follower
+}
+
+// bootstrap loads a snapshot of primary into follower and opens a feed
+// from the position it is current to.
+func bootstrap(t *testing.T, primary, follower *PersistentStore) *ReplicationFeed {
+	t.Helper()
+
+	data, pos, err := primary.ReplicationSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.LoadReplica(bytes.NewReader(data), pos); err != nil {
+		t.Fatal(err)
+	}
+	feed, err := primary.Replicate(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(feed.Close)
+	return feed
+}
+
+// drain applies the entries waiting on feed to follower, passing each
+// through JSON as it would be on the wire.
+func drain(t *testing.T, feed *ReplicationFeed, follower *PersistentStore) {
+	t.Helper()
+
+	for {
+		select {
+		case e := <-feed.Entries():
+			data, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded ReplicationEntry
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if err := follower.ApplyReplicated(decoded); err != nil {
+				t.Fatalf("apply entry %d: %v", e.Seq, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestReplication_BootstrapAndTail(t *testing.T) {
+	primary, follower := newReplicationPair(t)
+
+	primary.Set("before", "snapshot")
+	primary.SetContent("doc", `{"a":1}`, "application/json", 0)
+	feed := bootstrap(t, primary, follower)
+
+	primary.Set("after", "stream")
+	primary.SetWithTTL("ttl", "v", time.Hour)
+	primary.Delete("before")
+	primary.RPush("list", "a", "b")
+	primary.HSet("hash", map[string]string{"f": "v"})
+	primary.MSet([]Entry{{Key: "m1", Value: "1"}, {Key: "m2", Value: "2"}})
+	primary.Txn([]TxnOp{{Op: TxnSet, Key: "t", Value: "x"}})
+	drain(t, feed, follower)
+
+	for _, key := range []string{"doc", "after", "ttl", "m1", "m2", "t"} {
+		want, wantVersion, _ := primary.GetWithVersion(key)
+		got, gotVersion, ok := follower.GetWithVersion(key)
+		if !ok || got != want || gotVersion != wantVersion {
+			t.Errorf("%s: got %q version %d want %q version %d", key, got, gotVersion, want, wantVersion)
+		}
+	}
+	if _, ok := follower.Get("before"); ok {
+		t.Error("deleted key still on the follower")
+	}
+	if c, _ := follower.GetContent("doc"); c.ContentType != "application/json" {
+		t.Errorf("got content type %q", c.ContentType)
+	}
+	if ttl, ok := follower.TTL("ttl"); !ok || ttl <= 0 {
+		t.Errorf("got TTL %v, %v want one", ttl, ok)
+	}
+	if got, _ := follower.LRange("list", 0, -1); len(got) != 2 {
+		t.Errorf("got list %v", got)
+	}
+	if got, _, _ := follower.HGet("hash", "f"); got != "v" {
+		t.Errorf("got hash field %q", got)
+	}
+
+	if got, want := follower.ReplicationStatus().Position, primary.ReplicationStatus().Position; got != want {
+		t.Errorf("follower at %+v, primary at %+v", got, want)
+	}
+}
+
+func TestReplication_FollowerIsReadOnly(t *testing.T) {
+	_, follower := newReplicationPair(t)
+
+	if err := follower.Set("k", "v"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set: got %v want ErrReadOnly", err)
+	}
+	if _, err := follower.LPush("l", "v"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("LPush: got %v want ErrReadOnly", err)
+	}
+	if _, err := follower.Txn([]TxnOp{{Op: TxnSet, Key: "k", Value: "v"}}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Txn: got %v want ErrReadOnly", err)
+	}
+	if err := follower.RestoreSnapshot(bytes.NewReader([]byte(`{}`))); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RestoreSnapshot: got %v want ErrReadOnly", err)
+	}
+	if _, err := follower.Replicate(ReplicationPosition{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Replicate: got %v want ErrReadOnly", err)
+	}
+	if _, ok := follower.Get("k"); ok {
+		t.Error("write to a follower was applied")
+	}
+	if got := follower.ReplicationStatus().Role; got != RoleFollower {
+		t.Errorf("got role %q want %q", got, RoleFollower)
+	}
+}
+
+func TestReplication_Resume(t *testing.T) {
+	primary, follower := newReplicationPair(t)
+
+	feed := bootstrap(t, primary, follower)
+	primary.Set("a", "1")
+	drain(t, feed, follower)
+	feed.Close()
+
+	// Writes made while the follower is away are replayed when it comes back.
+	primary.Set("b", "2")
+	primary.Set("c", "3")
+	feed, err := primary.Replicate(follower.ReplicationStatus().Position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	drain(t, feed, follower)
+
+	if got, _ := follower.Get("c"); got != "3" {
+		t.Errorf("got %q want 3", got)
+	}
+}
+
+func TestReplication_Gap(t *testing.T) {
+	primary, follower := newReplicationPair(t)
+
+	pos := primary.ReplicationStatus().Position
+	tests := []struct {
+		name string
+		from ReplicationPosition
+	}{
+		{"OtherLog", ReplicationPosition{LogID: "elsewhere", Seq: pos.Seq}},
+		{"Ahead", ReplicationPosition{LogID: pos.LogID, Seq: pos.Seq + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := primary.Replicate(tt.from); !errors.Is(err, ErrReplicationGap) {
+				t.Errorf("got %v want ErrReplicationGap", err)
+			}
+		})
+	}
+
+	t.Run("Compacted", func(t *testing.T) {
+		for range 2 * replicationHistory {
+			primary.Set("k", "v")
+		}
+		if _, err := primary.Replicate(pos); !errors.Is(err, ErrReplicationGap) {
+			t.Errorf("got %v want ErrReplicationGap", err)
+		}
+	})
+
+	t.Run("OutOfOrder", func(t *testing.T) {
+		feed := bootstrap(t, primary, follower)
+		primary.Set("a", "1")
+		primary.Set("b", "2")
+
+		<-feed.Entries()
+		e := <-feed.Entries()
+		if err := follower.ApplyReplicated(e); !errors.Is(err, ErrReplicationGap) {
+			t.Errorf("got %v want ErrReplicationGap", err)
+		}
+		if _, ok := follower.Get("b"); ok {
+			t.Error("entry out of order was applied")
+		}
+	})
+}
+
+func TestReplication_FeedLagged(t *testing.T) {
+	primary, _ := newReplicationPair(t)
+
+	feed, err := primary.Replicate(primary.ReplicationStatus().Position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+
+	for range replicationBuffer + 1 {
+		primary.Set("k", "v")
+	}
+
+	n := 0
+	for range feed.Entries() {
+		n++
+	}
+	if n != replicationBuffer {
+		t.Errorf("got %d entries before the feed closed, want %d", n, replicationBuffer)
+	}
+	if !errors.Is(feed.Err(), ErrFeedLagged) {
+		t.Errorf("got %v want ErrFeedLagged", feed.Err())
+	}
+	if got := primary.ReplicationStatus().Followers; got != 0 {
+		t.Errorf("got %d followers want 0", got)
+	}
+}
+
+func TestReplication_RestoreStartsNewLog(t *testing.T) {
+	primary, follower := newReplicationPair(t)
+	primary.Set("old", "1")
+	feed := bootstrap(t, primary, follower)
+	pos := primary.ReplicationStatus().Position
+
+	donor := NewMemoryStore()
+	donor.Set("restored", "2")
+	data, _ := encodeSnapshot(donor.dict, 0)
+	if err := primary.RestoreSnapshot(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The feed ends, and the follower cannot resume past the restore.
+	for range feed.Entries() {
+	}
+	if !errors.Is(feed.Err(), ErrReplicationGap) {
+		t.Errorf("got %v want ErrReplicationGap", feed.Err())
+	}
+	if _, err := primary.Replicate(pos); !errors.Is(err, ErrReplicationGap) {
+		t.Errorf("got %v resuming across a restore want ErrReplicationGap", err)
+	}
+
+	bootstrap(t, primary, follower)
+	if _, ok := follower.Get("old"); ok {
+		t.Error("follower kept a key the restore removed")
+	}
+	if val, _ := follower.Get("restored"); val != "2" {
+		t.Errorf("got restored=%q on the follower", val)
+	}
+}
+
+func TestReplication_Promote(t *testing.T) {
+	primary, follower := newReplicationPair(t)
+
+	feed := bootstrap(t, primary, follower)
+	primary.Set("a", "1")
+	drain(t, feed, follower)
+	old := follower.ReplicationStatus().Position
+
+	follower.Promote()
+	if err := follower.Set("b", "2"); err != nil {
+		t.Fatalf("write to a promoted follower: %v", err)
+	}
+
+	st := follower.ReplicationStatus()
+	if st.Role != RolePrimary || st.Position.LogID == old.LogID || st.Position.Seq != old.Seq+1 {
+		t.Errorf("got status %+v after promoting from %+v", st, old)
+	}
+
+	// Followers of the old primary must bootstrap again.
+	if _, err := follower.Replicate(old); !errors.Is(err, ErrReplicationGap) {
+		t.Errorf("got %v want ErrReplicationGap", err)
+	}
+}
@@ -0,0 +1,60 @@
+package kvstore
+
+import (
+	"strings"
+	"time"
+)
+
+// ScanOptions selects a page of keys, in sorted order.
+type ScanOptions struct {
+	Prefix string // Only keys with this prefix
+	Match  string // Only keys matching this glob, see MatchPattern
+	Start  string // Only keys at or after Start
+	End    string // Only keys before End, if set
+	After  string // Only keys after After, to continue a previous scan
+	Limit  int    // At most this many keys; zero means no limit
+	Values bool   // Fill in KeyValue.Value
+}
+
+// KeyValue is a key returned by Scan, with its value if requested.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Scan returns the live keys selected by opts in sorted order, and whether
+// there are more after the last one returned. Pass the last key as After
+// to get the next page.
+func (s *MemoryStore) Scan(opts ScanOptions) ([]KeyValue, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	from := max(opts.Start, opts.Prefix)
+	if opts.After != "" && opts.After >= from {
+		from = opts.After + "\x00" // The smallest key after After
+	}
+
+	var page []KeyValue
+	now := time.Now().UnixNano()
+	for n := s.index.seek(from); n != nil; n = n.next[0] {
+		if !strings.HasPrefix(n.key, opts.Prefix) || (opts.End != "" && n.key >= opts.End) {
+			break
+		}
+
+		it := s.dict[n.key]
+		if it.expired(now) || (opts.Match != "" && !MatchPattern(opts.Match, n.key)) {
+			continue
+		}
+
+		if opts.Limit > 0 && len(page) == opts.Limit {
+			return page, true
+		}
+
+		kv := KeyValue{Key: n.key}
+		if opts.Values {
+			kv.Value = it.Value
+		}
+		page = append(page, kv)
+	}
+	return page, false
+}
@@ -0,0 +1,116 @@
+package kvstore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func scanKeys(page []KeyValue) []string {
+	keys := []string{}
+	for _, kv := range page {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestScan(t *testing.T) {
+	sharded := NewShardedStore(4)
+	defer sharded.Stop()
+
+	stores := map[string]interface {
+		Store
+		Scanner
+	}{
+		"MemoryStore":  NewMemoryStore(),
+		"ShardedStore": sharded,
+	}
+
+	for name, store := range stores {
+		for _, k := range []string{"user:3", "user:1", "session:1", "user:2", "user:10", "account"} {
+			store.Set(k, "v:"+k)
+		}
+		store.SetWithTTL("user:0", "gone", time.Nanosecond)
+		time.Sleep(time.Millisecond)
+
+		tests := []struct {
+			name     string
+			opts     ScanOptions
+			wantKeys []string
+			wantMore bool
+		}{
+			{
+				name:     "All keys sorted",
+				opts:     ScanOptions{},
+				wantKeys: []string{"account", "session:1", "user:1", "user:10", "user:2", "user:3"},
+			},
+			{
+				name:     "Prefix",
+				opts:     ScanOptions{Prefix: "user:"},
+				wantKeys: []string{"user:1", "user:10", "user:2", "user:3"},
+			},
+			{
+				name:     "Glob",
+				opts:     ScanOptions{Match: "user:?"},
+				wantKeys: []string{"user:1", "user:2", "user:3"},
+			},
+			{
+				name:     "Range",
+				opts:     ScanOptions{Start: "session", End: "user:2"},
+				wantKeys: []string{"session:1", "user:1", "user:10"},
+			},
+			{
+				name:     "First page",
+				opts:     ScanOptions{Prefix: "user:", Limit: 2},
+				wantKeys: []string{"user:1", "user:10"},
+				wantMore: true,
+			},
+			{
+				name:     "Last page",
+				opts:     ScanOptions{Prefix: "user:", Limit: 2, After: "user:10"},
+				wantKeys: []string{"user:2", "user:3"},
+			},
+			{
+				name:     "Prefix past start",
+				opts:     ScanOptions{Prefix: "account", Start: "b"},
+				wantKeys: []string{},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				page, more := store.Scan(tt.opts)
+				if got := scanKeys(page); !reflect.DeepEqual(got, tt.wantKeys) {
+					t.Errorf("got %q want %q", got, tt.wantKeys)
+				}
+				if more != tt.wantMore {
+					t.Errorf("got more %v want %v", more, tt.wantMore)
+				}
+			})
+		}
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("a", "1")
+
+	if page, _ := store.Scan(ScanOptions{}); page[0].Value != "" {
+		t.Errorf("expected no value unless asked for, got %q", page[0].Value)
+	}
+	if page, _ := store.Scan(ScanOptions{Values: true}); page[0].Value != "1" {
+		t.Errorf("got %q want %q", page[0].Value, "1")
+	}
+}
+
+func TestKeysSorted(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("b", "1")
+	store.Set("c", "1")
+	store.Set("a", "1")
+	store.Delete("c")
+
+	if got, want := store.Keys(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
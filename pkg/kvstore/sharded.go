@@ -0,0 +1,327 @@
+package kvstore
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultShardCount = 32
+
+// ShardedStore partitions keys across a fixed number of MemoryStores by
+// hash, so operations on different shards never contend for a lock.
+// Like TTLStore it runs a reaper; call Stop to release it.
+type ShardedStore struct {
+	shards          []*MemoryStore
+	cleanupInterval time.Duration
+	cleanupBudget   int
+	reaper          *reaperStats
+	stop            chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewShardedStore returns a store with n shards.
+// A non-positive n selects a default suited to most machines.
+func NewShardedStore(n int) *ShardedStore {
+	if n <= 0 {
+		n = defaultShardCount
+	}
+
+	store := &ShardedStore{
+		shards:          make([]*MemoryStore, n),
+		cleanupInterval: defaultCleanupInterval,
+		cleanupBudget:   defaultCleanupBudget,
+		reaper:          newReaperStats(),
+		stop:            make(chan struct{}),
+	}
+	for i := range store.shards {
+		store.shards[i] = NewMemoryStore()
+	}
+
+	store.wg.Add(1)
+	go store.cleanupExpired()
+	return store
+}
+
+// shardFor hashes key with 32-bit FNV-1a. It is inlined rather than using
+// hash/fnv to avoid allocating a hasher on every call.
+func (s *ShardedStore) shardFor(key string) *MemoryStore {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *ShardedStore) Set(key string, value string) error {
+	return s.shardFor(key).Set(key, value)
+}
+
+func (s *ShardedStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	return s.shardFor(key).SetWithTTL(key, value, ttl)
+}
+
+func (s *ShardedStore) Get(key string) (string, bool) {
+	return s.shardFor(key).Get(key)
+}
+
+func (s *ShardedStore) Delete(key string) error {
+	return s.shardFor(key).Delete(key)
+}
+
+// Keys returns a slice of all keys in the store.
+// The order of keys is not guaranteed. Shards are read one at a time,
+// so the result is not a point-in-time view of the whole store.
+func (s *ShardedStore) Keys() []string {
+	keys := []string{}
+	for _, sh := range s.shards {
+		keys = append(keys, sh.Keys()...)
+	}
+	return keys
+}
+
+func (s *ShardedStore) TTL(key string) (time.Duration, bool) {
+	return s.shardFor(key).TTL(key)
+}
+
+func (s *ShardedStore) Expire(key string, ttl time.Duration) (bool, error) {
+	return s.shardFor(key).Expire(key, ttl)
+}
+
+func (s *ShardedStore) Persist(key string) (bool, error) {
+	return s.shardFor(key).Persist(key)
+}
+
+// Scan merges a page from every shard. Like Keys, it is not a
+// point-in-time view of the whole store.
+func (s *ShardedStore) Scan(opts ScanOptions) ([]KeyValue, bool) {
+	var page []KeyValue
+	var more bool
+	for _, sh := range s.shards {
+		p, m := sh.Scan(opts)
+		page = append(page, p...)
+		more = more || m
+	}
+
+	slices.SortFunc(page, func(a, b KeyValue) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	if opts.Limit > 0 && len(page) > opts.Limit {
+		page, more = page[:opts.Limit], true
+	}
+	return page, more
+}
+
+func (s *ShardedStore) Type(key string) string {
+	return s.shardFor(key).Type(key)
+}
+
+func (s *ShardedStore) IncrBy(key string, delta int64) (int64, error) {
+	return s.shardFor(key).IncrBy(key, delta)
+}
+
+func (s *ShardedStore) LPush(key string, values ...string) (int, error) {
+	return s.shardFor(key).LPush(key, values...)
+}
+
+func (s *ShardedStore) RPush(key string, values ...string) (int, error) {
+	return s.shardFor(key).RPush(key, values...)
+}
+
+func (s *ShardedStore) LPop(key string, count int) ([]string, error) {
+	return s.shardFor(key).LPop(key, count)
+}
+
+func (s *ShardedStore) RPop(key string, count int) ([]string, error) {
+	return s.shardFor(key).RPop(key, count)
+}
+
+func (s *ShardedStore) LRange(key string, start, stop int) ([]string, error) {
+	return s.shardFor(key).LRange(key, start, stop)
+}
+
+func (s *ShardedStore) HSet(key string, fields map[string]string) (int, error) {
+	return s.shardFor(key).HSet(key, fields)
+}
+
+func (s *ShardedStore) HGet(key string, field string) (string, bool, error) {
+	return s.shardFor(key).HGet(key, field)
+}
+
+func (s *ShardedStore) HGetAll(key string) (map[string]string, error) {
+	return s.shardFor(key).HGetAll(key)
+}
+
+func (s *ShardedStore) HDel(key string, fields ...string) (int, error) {
+	return s.shardFor(key).HDel(key, fields...)
+}
+
+func (s *ShardedStore) SAdd(key string, members ...string) (int, error) {
+	return s.shardFor(key).SAdd(key, members...)
+}
+
+func (s *ShardedStore) SRem(key string, members ...string) (int, error) {
+	return s.shardFor(key).SRem(key, members...)
+}
+
+func (s *ShardedStore) SMembers(key string) ([]string, error) {
+	return s.shardFor(key).SMembers(key)
+}
+
+// group splits the indexes of keys by the shard each key lives in.
+func (s *ShardedStore) group(keys []string) map[*MemoryStore][]int {
+	groups := make(map[*MemoryStore][]int)
+	for i, key := range keys {
+		sh := s.shardFor(key)
+		groups[sh] = append(groups[sh], i)
+	}
+	return groups
+}
+
+// MGet takes each shard's lock once for all of its keys.
+func (s *ShardedStore) MGet(keys []string) map[string]string {
+	values := make(map[string]string, len(keys))
+	for sh, idx := range s.group(keys) {
+		batch := make([]string, len(idx))
+		for j, i := range idx {
+			batch[j] = keys[i]
+		}
+		for k, v := range sh.MGet(batch) {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// MSet sets each shard's entries as one batch. The batches of different
+// shards are independent, so if one fails others may have been applied.
+func (s *ShardedStore) MSet(entries []Entry) ([]uint64, error) {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+
+	versions := make([]uint64, len(entries))
+	for sh, idx := range s.group(keys) {
+		batch := make([]Entry, len(idx))
+		for j, i := range idx {
+			batch[j] = entries[i]
+		}
+
+		v, err := sh.MSet(batch)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range idx {
+			versions[i] = v[j]
+		}
+	}
+	return versions, nil
+}
+
+// MDelete deletes each shard's keys as one batch. Like MSet it is not
+// atomic across shards.
+func (s *ShardedStore) MDelete(keys []string) ([]bool, error) {
+	found := make([]bool, len(keys))
+	for sh, idx := range s.group(keys) {
+		batch := make([]string, len(idx))
+		for j, i := range idx {
+			batch[j] = keys[i]
+		}
+
+		f, err := sh.MDelete(batch)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range idx {
+			found[i] = f[j]
+		}
+	}
+	return found, nil
+}
+
+// Expirations merges the expirations of every shard.
+// Like Keys, it is not a point-in-time view of the whole store.
+func (s *ShardedStore) Expirations() map[string]time.Time {
+	expirations := make(map[string]time.Time)
+	for _, sh := range s.shards {
+		for k, exp := range sh.Expirations() {
+			expirations[k] = exp
+		}
+	}
+	return expirations
+}
+
+// Versions are per shard. A key always lives in the same shard, so they
+// still change on every write to it and are never reused for it.
+func (s *ShardedStore) GetWithVersion(key string) (string, uint64, bool) {
+	return s.shardFor(key).GetWithVersion(key)
+}
+
+func (s *ShardedStore) SetIfAbsent(key string, value string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).SetIfAbsent(key, value, ttl)
+}
+
+func (s *ShardedStore) SetIfPresent(key string, value string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).SetIfPresent(key, value, ttl)
+}
+
+func (s *ShardedStore) CompareAndSwap(key string, version uint64, value string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).CompareAndSwap(key, version, value, ttl)
+}
+
+func (s *ShardedStore) CompareAndDelete(key string, version uint64) error {
+	return s.shardFor(key).CompareAndDelete(key, version)
+}
+
+func (s *ShardedStore) SetContent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).SetContent(key, value, contentType, ttl)
+}
+
+func (s *ShardedStore) SetContentIfAbsent(key string, value string, contentType string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).SetContentIfAbsent(key, value, contentType, ttl)
+}
+
+func (s *ShardedStore) CompareAndSwapContent(key string, version uint64, value string, contentType string, ttl time.Duration) (uint64, error) {
+	return s.shardFor(key).CompareAndSwapContent(key, version, value, contentType, ttl)
+}
+
+func (s *ShardedStore) GetContent(key string) (Content, bool) {
+	return s.shardFor(key).GetContent(key)
+}
+
+func (s *ShardedStore) cleanupExpired() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Each shard is locked on its own, so the reaper only ever
+			// blocks the keys of one shard at a time.
+			start := time.Now()
+			n := 0
+			for _, sh := range s.shards {
+				n += sh.reapExpired(s.cleanupBudget)
+			}
+			s.reaper.observe(n, time.Since(start))
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop halts the reaper and waits for it to exit.
+func (s *ShardedStore) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
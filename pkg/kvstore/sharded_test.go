@@ -0,0 +1,172 @@
+package kvstore
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedSetGetDelete(t *testing.T) {
+	store := NewShardedStore(4)
+	defer store.Stop()
+
+	store.Set("key1", "value1")
+	store.Set("key2", "value2")
+	store.Set("key1", "value3")
+
+	if val, ok := store.Get("key1"); !ok || val != "value3" {
+		t.Errorf("got %q want %q", val, "value3")
+	}
+
+	store.Delete("key1")
+	if _, ok := store.Get("key1"); ok {
+		t.Errorf("key1 must not exist")
+	}
+
+	got := store.Keys()
+	sort.Strings(got)
+	if len(got) != 1 || got[0] != "key2" {
+		t.Errorf("got %q want %q", got, []string{"key2"})
+	}
+}
+
+func TestShardedSetWithTTL(t *testing.T) {
+	store := NewShardedStore(4)
+	defer store.Stop()
+
+	store.SetWithTTL("short", "value", 50*time.Millisecond)
+	store.SetWithTTL("long", "value", time.Minute)
+	store.Set("forever", "value")
+
+	time.Sleep(250 * time.Millisecond)
+
+	if _, exists := store.Get("short"); exists {
+		t.Errorf("expected short to expire")
+	}
+	if len(store.Keys()) != 2 {
+		t.Errorf("got %d keys, want 2", len(store.Keys()))
+	}
+
+	var items int
+	for _, sh := range store.shards {
+		sh.mu.RLock()
+		items += len(sh.dict)
+		sh.mu.RUnlock()
+	}
+	if items != 2 {
+		t.Errorf("expected reaper to remove expired item, got %d items", items)
+	}
+}
+
+func TestShardedDistributesKeys(t *testing.T) {
+	store := NewShardedStore(8)
+	defer store.Stop()
+
+	for i := 0; i < 1000; i++ {
+		store.Set("key"+strconv.Itoa(i), "value")
+	}
+
+	for i, sh := range store.shards {
+		sh.mu.RLock()
+		if len(sh.dict) == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+func TestShardedConcurrentAccess(t *testing.T) {
+	store := NewShardedStore(0)
+	defer store.Stop()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 1000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.Set("key"+strconv.Itoa(i), "val"+strconv.Itoa(i))
+			store.Get("key" + strconv.Itoa(i-1))
+		}(i)
+	}
+	wg.Wait()
+
+	if len(store.Keys()) != 1000 {
+		t.Errorf("got %d, expected 1000", len(store.Keys()))
+	}
+}
+
+// benchStore is the subset of the store API exercised by the parallel benchmarks.
+type benchStore interface {
+	Set(key string, value string) error
+	Get(key string) (string, bool)
+}
+
+// syncMapStore adapts sync.Map to benchStore as a lock-free baseline.
+type syncMapStore struct {
+	m sync.Map
+}
+
+func (s *syncMapStore) Set(key string, value string) error {
+	s.m.Store(key, value)
+	return nil
+}
+
+func (s *syncMapStore) Get(key string) (string, bool) {
+	v, ok := s.m.Load(key)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+const benchKeys = 10_000
+
+// benchmarkParallel runs a mix of reads and writes from every P, writing
+// once every writeEvery operations, against a store preloaded with benchKeys keys.
+func benchmarkParallel(b *testing.B, store benchStore, writeEvery int) {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		store.Set(keys[i], "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[(i*7919)%benchKeys]
+			if i%writeEvery == 0 {
+				store.Set(key, "value")
+			} else {
+				store.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func benchmarkStores(b *testing.B, writeEvery int) {
+	b.Run("MemoryStore", func(b *testing.B) {
+		benchmarkParallel(b, NewMemoryStore(), writeEvery)
+	})
+
+	b.Run("ShardedStore", func(b *testing.B) {
+		store := NewShardedStore(0)
+		defer store.Stop()
+		benchmarkParallel(b, store, writeEvery)
+	})
+
+	b.Run("SyncMap", func(b *testing.B) {
+		benchmarkParallel(b, &syncMapStore{}, writeEvery)
+	})
+}
+
+func BenchmarkParallelReadHeavy(b *testing.B) {
+	benchmarkStores(b, 10) // 90% reads
+}
+
+func BenchmarkParallelWriteHeavy(b *testing.B) {
+	benchmarkStores(b, 2) // 50% reads
+}
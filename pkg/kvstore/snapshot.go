@@ -0,0 +1,141 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// snapshotVersion is the current snapshot format version.
+// Version 0 is the legacy format: a bare JSON object with no header.
+// Version 1 only holds strings; version 2 adds lists, hashes and sets;
+// version 3 adds content types and base64 encoded binary values.
+const snapshotVersion = 3
+
+var (
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	ErrSnapshotVersion = errors.New("snapshot version is not supported")
+)
+
+// snapshotHeader is written as the first line of a snapshot file.
+// The JSON encoded store follows on the next line.
+type snapshotHeader struct {
+	Version  int    `json:"version"`
+	Entries  int    `json:"entries"`
+	Checksum uint32 `json:"checksum"`
+	Log      uint64 `json:"log,omitempty"` // Generation of the write-ahead log that follows
+}
+
+// encodeSnapshot returns the on-disk representation of dict, followed by
+// generation gen of the write-ahead log, or by none if gen is zero.
+func encodeSnapshot(dict map[string]*item, gen uint64) ([]byte, error) {
+	body, err := json.Marshal(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(snapshotHeader{
+		Version:  snapshotVersion,
+		Entries:  len(dict),
+		Checksum: crc32.ChecksumIEEE(body),
+		Log:      gen,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(header)+len(body)+1)
+	data = append(data, header...)
+	data = append(data, '\n')
+	data = append(data, body...)
+	return data, nil
+}
+
+// decodeSnapshot parses data produced by encodeSnapshot, or a legacy
+// headerless snapshot, and verifies its header. It returns the generation
+// of the write-ahead log that follows the snapshot.
+func decodeSnapshot(data []byte) (map[string]*item, uint64, error) {
+	dict := make(map[string]*item)
+
+	// Legacy snapshots are a JSON object without a header, which may be
+	// indented, so anything that does not start with a header is one.
+	i := bytes.IndexByte(data, '\n')
+	var header snapshotHeader
+	if i < 0 || json.Unmarshal(data[:i], &header) != nil || header.Version == 0 {
+		if err := json.Unmarshal(data, &dict); err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		return dict, 0, nil
+	}
+	if header.Version < 1 || header.Version > snapshotVersion {
+		return nil, 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+
+	body := data[i+1:]
+	if crc32.ChecksumIEEE(body) != header.Checksum {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	if err := json.Unmarshal(body, &dict); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if len(dict) != header.Entries {
+		return nil, 0, fmt.Errorf("%w: expected %d entries, got %d", ErrSnapshotCorrupt, header.Entries, len(dict))
+	}
+	return dict, header.Log, nil
+}
+
+// readSnapshot loads the snapshot in filename, as decodeSnapshot.
+// A missing file is not an error and yields an empty store.
+func readSnapshot(filename string) (map[string]*item, uint64, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]*item), 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return decodeSnapshot(data)
+}
+
+// writeSnapshot atomically replaces filename with data. The data is written
+// to a temporary file in the same directory, fsynced and renamed over
+// filename, so a crash leaves either the old or the new snapshot intact.
+func writeSnapshot(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once the rename has succeeded
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	// Persist the rename itself.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,174 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotEncodeDecode(t *testing.T) {
+	dict := map[string]*item{
+		"a": {Value: "1"},
+		"b": {Value: "2", Expiration: 42},
+		"c": {Value: "\xff\x00", ContentType: "application/octet-stream"},
+		"l": {Type: TypeList, List: []string{"x", "y"}},
+		"h": {Type: TypeHash, Hash: map[string]string{"f": "v"}},
+		"s": {Type: TypeSet, Set: map[string]struct{}{"m": {}}},
+	}
+
+	data, err := encodeSnapshot(dict, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, gen, err := decodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen != 7 {
+		t.Errorf("got log generation %d want 7", gen)
+	}
+
+	if len(got) != len(dict) {
+		t.Fatalf("got %d entries want %d", len(got), len(dict))
+	}
+	for k, v := range dict {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("got %+v want %+v for %q", got[k], v, k)
+		}
+	}
+}
+
+func TestSnapshotDecodeLegacy(t *testing.T) {
+	got, _, err := decodeSnapshot([]byte(`{"a":{"Value":"1","Expiration":0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got["a"] == nil || got["a"].Value != "1" {
+		t.Errorf("expected legacy snapshot to be loaded, got %v", got)
+	}
+}
+
+func TestSnapshotDecodeIndentedLegacy(t *testing.T) {
+	data := "{\n  \"a\": {\n    \"Value\": \"1\",\n    \"Expiration\": 0\n  },\n  \"version\": {\n    \"Value\": \"2\"\n  }\n}\n"
+
+	got, _, err := decodeSnapshot([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a"] == nil || got["a"].Value != "1" || got["version"] == nil {
+		t.Errorf("expected indented legacy snapshot to be loaded, got %v", got)
+	}
+}
+
+func TestSnapshotDecodeVersion1(t *testing.T) {
+	body := `{"a":{"Value":"1","Expiration":0}}`
+	header := fmt.Sprintf(`{"version":1,"entries":1,"checksum":%d}`, crc32.ChecksumIEEE([]byte(body)))
+
+	got, _, err := decodeSnapshot([]byte(header + "\n" + body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] == nil || got["a"].Value != "1" {
+		t.Errorf("expected version 1 snapshot to be loaded, got %v", got)
+	}
+}
+
+func TestSnapshotDecodeErrors(t *testing.T) {
+	valid, err := encodeSnapshot(map[string]*item{"a": {Value: "1"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "Truncated body",
+			data:    valid[:len(valid)-5],
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "Truncated legacy snapshot",
+			data:    []byte(`{"a":{"Value":"1","Expi`),
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "Bad header",
+			data:    []byte("not a header\n{}"),
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "Checksum mismatch",
+			data:    []byte(`{"version":1,"entries":0,"checksum":1}` + "\n{}"),
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "Entry count mismatch",
+			data:    []byte(`{"version":1,"entries":3,"checksum":2745614147}` + "\n{}"),
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "Unknown version",
+			data:    []byte(`{"version":99,"entries":0,"checksum":0}` + "\n{}"),
+			wantErr: ErrSnapshotVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeSnapshot(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteSnapshotLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "store.snapshot.json")
+
+	for _, data := range []string{"first", "second"} {
+		if err := writeSnapshot(filename, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "second" {
+		t.Errorf("got %q want %q", got, "second")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the snapshot in %s, got %d files", dir, len(entries))
+	}
+}
+
+func TestInitializeFailsOnCorruptSnapshot(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "store.snapshot.json")
+	if err := os.WriteFile(snapshotFile, []byte(`{"a":{"Val`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewPersistentStore()
+	defer store.Stop()
+
+	if _, err := store.WithSnapshotFile(snapshotFile).Initialize(); !errors.Is(err, ErrSnapshotCorrupt) {
+		t.Errorf("got error %v want %v", err, ErrSnapshotCorrupt)
+	}
+}
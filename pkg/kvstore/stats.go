@@ -0,0 +1,138 @@
+package kvstore
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang-learning/pkg/metrics"
+)
+
+// Stats counts the operations a store has served.
+type Stats struct {
+	Gets      uint64 // Reads of a string: Get, GetWithVersion, GetContent, MGet
+	Hits      uint64
+	Misses    uint64
+	Sets      uint64 // Writes of any key, including lists, hashes and sets
+	Deletes   uint64 // Including evictions
+	Expired   uint64 // Keys removed because their TTL ran out
+	Evictions uint64
+}
+
+// ReaperStats describes the work of a store's background reaper.
+type ReaperStats struct {
+	Runs     uint64
+	Reaped   uint64 // Expired keys deleted
+	Duration metrics.HistogramSnapshot
+}
+
+// storeStats holds the counters behind Stats. Reads are counted under
+// the read lock, so they are atomic; the rest are guarded by the store's
+// lock like the data they count.
+type storeStats struct {
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+	sets    uint64
+	deletes uint64
+	expired uint64
+}
+
+// read counts a read of a string key.
+func (s *MemoryStore) read(hit bool) {
+	if hit {
+		s.stats.hits.Add(1)
+	} else {
+		s.stats.misses.Add(1)
+	}
+}
+
+// count counts the change notify is about to publish.
+// The caller must hold s.mu.
+func (s *MemoryStore) count(typ string) {
+	switch typ {
+	case EventSet:
+		s.stats.sets++
+	case EventDelete:
+		s.stats.deletes++
+	case EventExpire:
+		s.stats.expired++
+	}
+}
+
+// resetStats zeroes the counters. It is used once a store has been loaded
+// from disk, so that the load does not count as writes.
+// The caller must hold s.mu.
+func (s *MemoryStore) resetStats() {
+	s.stats.hits.Store(0)
+	s.stats.misses.Store(0)
+	s.stats.sets, s.stats.deletes, s.stats.expired = 0, 0, 0
+	s.evictions, s.rejections = 0, 0
+}
+
+// Stats returns the operation counters of the store.
+func (s *MemoryStore) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits, misses := s.stats.hits.Load(), s.stats.misses.Load()
+	return Stats{
+		Gets:      hits + misses,
+		Hits:      hits,
+		Misses:    misses,
+		Sets:      s.stats.sets,
+		Deletes:   s.stats.deletes,
+		Expired:   s.stats.expired,
+		Evictions: s.evictions,
+	}
+}
+
+// Stats returns the operation counters of every shard added together.
+func (s *ShardedStore) Stats() Stats {
+	var total Stats
+	for _, sh := range s.shards {
+		st := sh.Stats()
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Misses += st.Misses
+		total.Sets += st.Sets
+		total.Deletes += st.Deletes
+		total.Expired += st.Expired
+		total.Evictions += st.Evictions
+	}
+	return total
+}
+
+// reaperStats holds the counters behind ReaperStats.
+type reaperStats struct {
+	runs     atomic.Uint64
+	reaped   atomic.Uint64
+	duration *metrics.Histogram
+}
+
+func newReaperStats() *reaperStats {
+	return &reaperStats{duration: metrics.NewHistogram()}
+}
+
+// observe records a run of the reaper that deleted n keys in d.
+func (r *reaperStats) observe(n int, d time.Duration) {
+	r.runs.Add(1)
+	r.reaped.Add(uint64(n))
+	r.duration.ObserveDuration(d)
+}
+
+func (r *reaperStats) snapshot() ReaperStats {
+	return ReaperStats{
+		Runs:     r.runs.Load(),
+		Reaped:   r.reaped.Load(),
+		Duration: r.duration.Snapshot(),
+	}
+}
+
+// ReaperStats returns what the reaper has done so far.
+func (s *TTLStore) ReaperStats() ReaperStats {
+	return s.reaper.snapshot()
+}
+
+// ReaperStats returns what the reaper has done so far, across all shards.
+func (s *ShardedStore) ReaperStats() ReaperStats {
+	return s.reaper.snapshot()
+}
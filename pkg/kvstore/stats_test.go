@@ -0,0 +1,105 @@
+package kvstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(2).WithEvictionPolicy(NewLRUPolicy())
+
+	store.Set("a", "1")
+	store.Get("a")
+	store.Get("missing")
+	store.MGet([]string{"a", "missing"})
+	store.SetWithTTL("b", "2", time.Millisecond)
+	store.Delete("a")
+	store.RPush("list", "x")
+
+	time.Sleep(5 * time.Millisecond)
+	store.reapExpired(10)
+
+	store.Set("c", "3")
+	store.Set("d", "4") // Evicts the least recently used key
+
+	want := Stats{
+		Gets:      4,
+		Hits:      2,
+		Misses:    2,
+		Sets:      5,
+		Deletes:   2,
+		Expired:   1,
+		Evictions: 1,
+	}
+	if got := store.Stats(); got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+}
+
+func TestShardedStoreStats(t *testing.T) {
+	store := NewShardedStore(4)
+	defer store.Stop()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		store.Set(k, "v")
+		store.Get(k)
+	}
+
+	if got := store.Stats(); got.Sets != 4 || got.Hits != 4 {
+		t.Errorf("got %+v, want 4 sets and 4 hits across shards", got)
+	}
+}
+
+func TestReaperStats(t *testing.T) {
+	store := NewTTLStore().WithCleanupInterval(time.Millisecond)
+	defer store.Stop()
+
+	store.SetWithTTL("a", "1", time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	got := store.ReaperStats()
+	if got.Runs == 0 || got.Reaped != 1 || got.Duration.Count != got.Runs {
+		t.Errorf("got %+v, want runs timed and the key reaped", got)
+	}
+	if got := store.Stats().Expired; got != 1 {
+		t.Errorf("got %d expired keys want 1", got)
+	}
+}
+
+func TestPersistentStore_Stats(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("a", "1")
+	store.Set("b", "2")
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.SaveStats(); got.Saves != 1 || got.Failures != 0 || got.Duration.Count != 1 {
+		t.Errorf("got %+v, want one timed save", got)
+	}
+	store.Stop()
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if got := reloaded.Stats(); got != (Stats{}) {
+		t.Errorf("got %+v, want loading not to count", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Package kvstore implements the key-value stores behind the KV servers in
+// this repository: a plain in-memory store, one that actively expires keys,
+// one persisted to disk, one sharded across several locks and one
+// replicated to a cluster with Raft. All of them satisfy Store, so callers
+// can embed whichever fits.
+package kvstore
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"golang-learning/pkg/raft"
+)
+
+// Store is the API shared by every store in this package.
+type Store interface {
+	Get(key string) (string, bool)
+	Set(key string, value string) error
+	SetWithTTL(key string, value string, ttl time.Duration) error
+	Delete(key string) error
+	Keys() []string
+}
+
+// Expirer is implemented by stores that can read and change the TTL of
+// keys that already exist.
+type Expirer interface {
+	// TTL returns the remaining lifetime of key.
+	// A zero duration means the key does not expire.
+	TTL(key string) (time.Duration, bool)
+	// Expire sets the remaining lifetime of an existing key.
+	Expire(key string, ttl time.Duration) (bool, error)
+	// Persist removes the TTL from an existing key.
+	Persist(key string) (bool, error)
+	// Expirations maps every key to the time it expires, or the zero time.
+	Expirations() map[string]time.Time
+}
+
+// Versioner is implemented by stores that version every key and can write
+// conditionally on what a key holds. A key's version changes on every write
+// to its value; versions are never reused, even after the key is deleted.
+type Versioner interface {
+	GetWithVersion(key string) (string, uint64, bool)
+	SetIfAbsent(key string, value string, ttl time.Duration) (uint64, error)
+	SetIfPresent(key string, value string, ttl time.Duration) (uint64, error)
+	// CompareAndSwap and CompareAndDelete fail with ErrVersionMismatch if
+	// the key is not at version. A zero version matches any.
+	CompareAndSwap(key string, version uint64, value string, ttl time.Duration) (uint64, error)
+	CompareAndDelete(key string, version uint64) error
+}
+
+// Scanner is implemented by stores that keep their keys in order and
+// can list them a page at a time.
+type Scanner interface {
+	Scan(opts ScanOptions) ([]KeyValue, bool)
+}
+
+// Batcher is implemented by stores that can read and write many keys
+// while taking their lock once per batch.
+type Batcher interface {
+	MGet(keys []string) map[string]string
+	MSet(entries []Entry) ([]uint64, error)
+	MDelete(keys []string) ([]bool, error)
+}
+
+// TypedStore is implemented by stores that hold counters, lists, hashes
+// and sets alongside strings. Operations on a key holding another type of
+// value fail with ErrWrongType.
+type TypedStore interface {
+	Type(key string) string
+	IncrBy(key string, delta int64) (int64, error)
+
+	LPush(key string, values ...string) (int, error)
+	RPush(key string, values ...string) (int, error)
+	LPop(key string, count int) ([]string, error)
+	RPop(key string, count int) ([]string, error)
+	LRange(key string, start, stop int) ([]string, error)
+
+	HSet(key string, fields map[string]string) (int, error)
+	HGet(key string, field string) (string, bool, error)
+	HGetAll(key string) (map[string]string, error)
+	HDel(key string, fields ...string) (int, error)
+
+	SAdd(key string, members ...string) (int, error)
+	SRem(key string, members ...string) (int, error)
+	SMembers(key string) ([]string, error)
+}
+
+// ContentStore is implemented by stores that keep a media type with each
+// string value, so arbitrary bodies can be stored and served verbatim.
+// The conditional writes fail with errors.ErrUnsupported on stores that
+// cannot make them, such as a RaftStore.
+type ContentStore interface {
+	SetContent(key string, value string, contentType string, ttl time.Duration) (uint64, error)
+	SetContentIfAbsent(key string, value string, contentType string, ttl time.Duration) (uint64, error)
+	CompareAndSwapContent(key string, version uint64, value string, contentType string, ttl time.Duration) (uint64, error)
+	GetContent(key string) (Content, bool)
+}
+
+// Transactor is implemented by stores that can apply a batch of
+// conditional ops atomically. See MemoryStore.Txn.
+type Transactor interface {
+	Txn(ops []TxnOp) ([]TxnResult, error)
+}
+
+// Watcher is implemented by stores that publish a feed of changes to
+// their keys. See MemoryStore.Watch.
+type Watcher interface {
+	Watch(opts WatchOptions) (*Subscription, error)
+}
+
+// StatsReporter is implemented by stores that count the operations they
+// serve.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// Reaper is implemented by stores that delete expired keys in the
+// background.
+type Reaper interface {
+	ReaperStats() ReaperStats
+}
+
+// Snapshotter is implemented by stores that can write and restore snapshots.
+type Snapshotter interface {
+	Snapshot() (SnapshotStats, error)
+	SnapshotStats() SnapshotStats
+	SaveStats() SaveStats
+	WriteSnapshot(w io.Writer) error
+	RestoreSnapshot(r io.Reader) error
+}
+
+// Replicator is implemented by stores that can replicate their writes to
+// read-only followers. See PersistentStore.Replicate.
+type Replicator interface {
+	ReplicationStatus() ReplicationStatus
+	ReplicationSnapshot() ([]byte, ReplicationPosition, error)
+	Replicate(from ReplicationPosition) (*ReplicationFeed, error)
+	Follow()
+	LoadReplica(r io.Reader, pos ReplicationPosition) error
+	ApplyReplicated(e ReplicationEntry) error
+	Promote()
+}
+
+// Consensus is implemented by stores replicated to a cluster with Raft,
+// where only the leader takes writes. See RaftStore.
+type Consensus interface {
+	// ReadBarrier returns once a linearizable read may be served, or
+	// ErrNotLeader on a node that is not the leader.
+	ReadBarrier(ctx context.Context) error
+	IsLeader() bool
+	Leader() string // Address of the leader, or "" if unknown
+	ClusterStatus() raft.Status
+	Step(m raft.Message) error
+	AddMember(ctx context.Context, id uint64, addr string) error
+	RemoveMember(ctx context.Context, id uint64) error
+}
+
+var (
+	_ Store         = (*MemoryStore)(nil)
+	_ Store         = (*TTLStore)(nil)
+	_ Store         = (*PersistentStore)(nil)
+	_ Store         = (*ShardedStore)(nil)
+	_ Store         = (*RaftStore)(nil)
+	_ Expirer       = (*MemoryStore)(nil)
+	_ Expirer       = (*ShardedStore)(nil)
+	_ Expirer       = (*RaftStore)(nil)
+	_ Versioner     = (*MemoryStore)(nil)
+	_ Versioner     = (*ShardedStore)(nil)
+	_ Scanner       = (*MemoryStore)(nil)
+	_ Scanner       = (*ShardedStore)(nil)
+	_ Batcher       = (*MemoryStore)(nil)
+	_ Batcher       = (*ShardedStore)(nil)
+	_ TypedStore    = (*MemoryStore)(nil)
+	_ TypedStore    = (*ShardedStore)(nil)
+	_ ContentStore  = (*MemoryStore)(nil)
+	_ ContentStore  = (*ShardedStore)(nil)
+	_ ContentStore  = (*RaftStore)(nil)
+	_ Transactor    = (*MemoryStore)(nil)
+	_ Watcher       = (*MemoryStore)(nil)
+	_ StatsReporter = (*MemoryStore)(nil)
+	_ StatsReporter = (*ShardedStore)(nil)
+	_ Reaper        = (*TTLStore)(nil)
+	_ Reaper        = (*ShardedStore)(nil)
+	_ Reaper        = (*RaftStore)(nil)
+	_ Snapshotter   = (*PersistentStore)(nil)
+	_ Replicator    = (*PersistentStore)(nil)
+	_ Consensus     = (*RaftStore)(nil)
+)
@@ -0,0 +1,110 @@
+package kvstore
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultCleanupInterval = 100 * time.Millisecond
+	defaultCleanupBudget   = 1000
+)
+
+// TTLStore is a MemoryStore with a background reaper that deletes expired
+// keys. Call Stop to release the reaper once the store is no longer needed.
+type TTLStore struct {
+	*MemoryStore
+
+	cleanupInterval time.Duration // Guarded by MemoryStore.mu
+	cleanupBudget   int           // Guarded by MemoryStore.mu
+	reaper          *reaperStats
+	stop            chan struct{}
+	wg              sync.WaitGroup
+}
+
+func NewTTLStore() *TTLStore {
+	store := &TTLStore{
+		MemoryStore:     NewMemoryStore(),
+		cleanupInterval: defaultCleanupInterval,
+		cleanupBudget:   defaultCleanupBudget,
+		reaper:          newReaperStats(),
+		stop:            make(chan struct{}),
+	}
+
+	store.wg.Add(1)
+	go store.cleanupExpired()
+	return store
+}
+
+// WithCleanupInterval sets how often the reaper looks for expired keys.
+// It takes effect from the next tick.
+func (s *TTLStore) WithCleanupInterval(interval time.Duration) *TTLStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupInterval = interval
+	return s
+}
+
+// WithCleanupBudget caps how many expired keys the reaper deletes per tick,
+// bounding how long it holds the write lock. Keys left over are deleted on
+// later ticks and are already invisible to readers.
+func (s *TTLStore) WithCleanupBudget(budget int) *TTLStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupBudget = budget
+	return s
+}
+
+// WithMaxEntries is MemoryStore.WithMaxEntries, returning s for chaining.
+func (s *TTLStore) WithMaxEntries(n int) *TTLStore {
+	s.MemoryStore.WithMaxEntries(n)
+	return s
+}
+
+// WithMaxBytes is MemoryStore.WithMaxBytes, returning s for chaining.
+func (s *TTLStore) WithMaxBytes(n int64) *TTLStore {
+	s.MemoryStore.WithMaxBytes(n)
+	return s
+}
+
+// WithEvictionPolicy is MemoryStore.WithEvictionPolicy, returning s for chaining.
+func (s *TTLStore) WithEvictionPolicy(policy EvictionPolicy) *TTLStore {
+	s.MemoryStore.WithEvictionPolicy(policy)
+	return s
+}
+
+func (s *TTLStore) cleanupExpired() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(defaultCleanupInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(s.tick())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// tick runs the reaper once and returns the delay until the next run.
+func (s *TTLStore) tick() time.Duration {
+	s.mu.RLock()
+	interval, budget := s.cleanupInterval, s.cleanupBudget
+	s.mu.RUnlock()
+
+	start := time.Now()
+	n := s.reapExpired(budget)
+	s.reaper.observe(n, time.Since(start))
+	return interval
+}
+
+// Stop halts the reaper and waits for it to exit.
+func (s *TTLStore) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
@@ -0,0 +1,155 @@
+package kvstore
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentSetWithTTL(t *testing.T) {
+	store := NewTTLStore()
+	defer store.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 1; i <= 100; i++ {
+		go func() {
+			defer wg.Done()
+			key := "key" + strconv.Itoa(i)
+			store.SetWithTTL(key, "value", 100*time.Millisecond)
+		}()
+	}
+
+	wg.Wait()
+
+	for i := 1; i <= 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, exists := store.Get(key); !exists {
+			t.Errorf("key %s should exist", key)
+		}
+	}
+
+	// Wait for expiration
+	time.Sleep(150 * time.Millisecond)
+
+	for i := 1; i <= 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, exists := store.Get(key); exists {
+			t.Errorf("key %s should have expired", key)
+		}
+	}
+
+}
+
+func TestCleanupExpired(t *testing.T) {
+	store := NewTTLStore()
+	defer store.Stop()
+
+	for i := 1; i <= 10; i++ {
+		key := "key" + strconv.Itoa(i)
+		val := "value" + strconv.Itoa(i)
+		store.SetWithTTL(key, val, 50*time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if len(store.dict) != 0 {
+		t.Errorf("store should be empty, got %d items", len(store.dict))
+	}
+}
+
+func TestCleanupBudget(t *testing.T) {
+	store := NewTTLStore().
+		WithCleanupInterval(time.Hour).
+		WithCleanupBudget(3)
+	defer store.Stop()
+
+	for i := 1; i <= 10; i++ {
+		store.SetWithTTL("key"+strconv.Itoa(i), "value", time.Nanosecond)
+	}
+	time.Sleep(time.Millisecond)
+
+	if next := store.tick(); next != time.Hour {
+		t.Errorf("got next run in %v want %v", next, time.Hour)
+	}
+
+	store.mu.RLock()
+	remaining := len(store.dict)
+	store.mu.RUnlock()
+
+	if remaining != 7 {
+		t.Errorf("got %d items after one tick, want 7", remaining)
+	}
+}
+
+// newBenchStore returns a MemoryStore holding n keys, of which withTTL
+// expire far in the future. The reaper is driven by hand in benchmarks.
+func newBenchStore(b *testing.B, n, withTTL int) *MemoryStore {
+	b.Helper()
+
+	store := NewMemoryStore()
+	for i := 0; i < n; i++ {
+		if i < withTTL {
+			store.SetWithTTL("key"+strconv.Itoa(i), "value", time.Hour)
+		} else {
+			store.Set("key"+strconv.Itoa(i), "value")
+		}
+	}
+	return store
+}
+
+// scanExpired is the full-map scan the reaper used before the expiry index,
+// kept as a baseline for the benchmarks.
+func scanExpired(s *MemoryStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for k, v := range s.dict {
+		if v.Expiration > 0 && now > v.Expiration {
+			delete(s.dict, k)
+		}
+	}
+}
+
+// Each op is one reaper tick, i.e. one write lock hold, on a store of
+// 1M keys of which 10k carry a TTL and none are due.
+func BenchmarkReaperLockHold_1M(b *testing.B) {
+	b.Run("FullScan", func(b *testing.B) {
+		store := newBenchStore(b, 1_000_000, 10_000)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			scanExpired(store)
+		}
+	})
+
+	b.Run("ExpiryIndex", func(b *testing.B) {
+		store := newBenchStore(b, 1_000_000, 10_000)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			store.reapExpired(defaultCleanupBudget)
+		}
+	})
+}
+
+// Each op is one reaper tick that deletes a full budget of due keys
+// from a store of 1M keys.
+func BenchmarkReaperLockHoldDue_1M(b *testing.B) {
+	store := newBenchStore(b, 1_000_000, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < defaultCleanupBudget; j++ {
+			store.SetWithTTL("due"+strconv.Itoa(j), "value", time.Nanosecond)
+		}
+		time.Sleep(time.Microsecond)
+		b.StartTimer()
+
+		store.reapExpired(defaultCleanupBudget)
+	}
+}
@@ -0,0 +1,203 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of TxnOp.
+const (
+	TxnGet    = "get"
+	TxnSet    = "set"
+	TxnDelete = "delete"
+)
+
+// ErrInvalidOp is returned for a transaction op of unknown kind or
+// without a key.
+var ErrInvalidOp = errors.New("invalid transaction op")
+
+// TxnOp is one step of a transaction.
+//
+// Its conditions are checked against the key as the ops before it left
+// it, so a transaction can, for example, create a key and then update it.
+type TxnOp struct {
+	Op    string // TxnGet, TxnSet or TxnDelete
+	Key   string
+	Value string        // Value to set
+	TTL   time.Duration // TTL to set, zero for none
+
+	IfExists  bool   // The key must be set
+	IfAbsent  bool   // The key must not be set
+	IfVersion uint64 // If non-zero, the key must be at this version
+}
+
+// TxnResult is the outcome of one TxnOp. For a get it holds the value
+// read, for a set the new version, and for a delete whether the key existed.
+type TxnResult struct {
+	Key     string
+	Value   string
+	Version uint64
+	Found   bool
+}
+
+// TxnError reports which op of a transaction failed, and why.
+type TxnError struct {
+	Index int
+	Err   error
+}
+
+func (e *TxnError) Error() string {
+	return fmt.Sprintf("txn op %d: %v", e.Index, e.Err)
+}
+
+func (e *TxnError) Unwrap() error {
+	return e.Err
+}
+
+// Txn runs ops in order under a single lock. Either every op is applied
+// or, if any condition fails, none is and the error is a *TxnError.
+// The whole transaction is journaled as one record, so replay after a
+// crash never applies part of it.
+func (s *MemoryStore) Txn(ops []TxnOp) ([]TxnResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired keys the transaction touches are dropped up front so that
+	// they are neither seen by it nor evicted from under it.
+	now := time.Now().UnixNano()
+	for _, op := range ops {
+		if it, exists := s.dict[op.Key]; exists && it.expired(now) {
+			s.expire(op.Key)
+		}
+	}
+
+	// Run the ops against an overlay of the keys they touch; nil marks
+	// a key deleted by the transaction.
+	overlay := make(map[string]*item)
+	results := make([]TxnResult, len(ops))
+	var writes []record
+	base := s.version
+	version := base
+
+	for i, op := range ops {
+		if op.Key == "" {
+			return nil, &TxnError{Index: i, Err: ErrInvalidOp}
+		}
+
+		it, exists := overlay[op.Key]
+		if !exists {
+			it = s.dict[op.Key]
+		}
+
+		switch {
+		case op.IfExists && it == nil:
+			return nil, &TxnError{Index: i, Err: ErrKeyNotFound}
+		case op.IfAbsent && it != nil:
+			return nil, &TxnError{Index: i, Err: ErrKeyExists}
+		case op.IfVersion != 0 && it == nil:
+			return nil, &TxnError{Index: i, Err: ErrKeyNotFound}
+		case op.IfVersion != 0 && it.Version != op.IfVersion:
+			return nil, &TxnError{Index: i, Err: ErrVersionMismatch}
+		}
+
+		results[i].Key = op.Key
+		switch op.Op {
+		case TxnGet:
+			if it != nil && it.Type != "" {
+				return nil, &TxnError{Index: i, Err: ErrWrongType}
+			}
+			if it != nil {
+				results[i].Value, results[i].Version, results[i].Found = it.Value, it.Version, true
+			}
+		case TxnSet:
+			var exp int64
+			if op.TTL > 0 {
+				exp = time.Now().Add(op.TTL).UnixNano()
+			}
+			version++
+			overlay[op.Key] = &item{Value: op.Value, Expiration: exp, Version: version, key: op.Key}
+			writes = append(writes, record{Op: opSet, Key: op.Key, Value: op.Value, Expiration: exp, Version: version})
+			results[i].Version, results[i].Found = version, it != nil
+		case TxnDelete:
+			if it != nil {
+				version++
+				overlay[op.Key] = nil
+				writes = append(writes, record{Op: opDelete, Key: op.Key, Version: version})
+			}
+			results[i].Found = it != nil
+		default:
+			return nil, &TxnError{Index: i, Err: ErrInvalidOp}
+		}
+	}
+
+	if len(writes) == 0 {
+		s.accessed(ops)
+		return results, nil
+	}
+
+	if err := s.makeRoomTxn(overlay); err != nil {
+		return nil, err
+	}
+
+	// Evictions take versions of their own; move the transaction's past them.
+	if shift := s.version - base; shift > 0 {
+		for i := range writes {
+			writes[i].Version += shift
+		}
+		for i, op := range ops {
+			if op.Op == TxnSet {
+				results[i].Version += shift
+			}
+		}
+	}
+
+	if err := s.log(record{Op: opTxn, Ops: writes}); err != nil {
+		return nil, err
+	}
+
+	for _, rec := range writes {
+		s.apply(rec)
+	}
+	s.accessed(ops)
+	return results, nil
+}
+
+// accessed tells the eviction policy about the keys a transaction read.
+// The caller must hold s.mu.
+func (s *MemoryStore) accessed(ops []TxnOp) {
+	if s.policy == nil {
+		return
+	}
+	for _, op := range ops {
+		if _, exists := s.dict[op.Key]; op.Op == TxnGet && exists {
+			s.policy.Accessed(op.Key)
+		}
+	}
+}
+
+// makeRoomTxn ensures the store stays within its bounds once the keys in
+// overlay are written, without evicting any of them. The caller must hold s.mu.
+func (s *MemoryStore) makeRoomTxn(overlay map[string]*item) error {
+	if s.maxEntries <= 0 && s.maxBytes <= 0 {
+		return nil
+	}
+
+	var entries int
+	var bytes int64
+	for key, it := range overlay {
+		if old, exists := s.dict[key]; exists {
+			entries--
+			bytes -= old.size()
+		}
+		if it != nil {
+			entries++
+			bytes += it.size()
+		}
+	}
+
+	return s.evict(func() bool {
+		return (s.maxEntries > 0 && len(s.dict)+entries > s.maxEntries) ||
+			(s.maxBytes > 0 && s.bytes+bytes > s.maxBytes)
+	}, overlay)
+}
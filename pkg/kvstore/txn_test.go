@@ -0,0 +1,176 @@
+package kvstore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTxn(t *testing.T) {
+	t.Run("moves a value between keys", func(t *testing.T) {
+		store := NewMemoryStore()
+		store.Set("from", "gopher")
+		_, version, _ := store.GetWithVersion("from")
+
+		results, err := store.Txn([]TxnOp{
+			{Op: TxnGet, Key: "from", IfVersion: version},
+			{Op: TxnDelete, Key: "from"},
+			{Op: TxnSet, Key: "to", Value: "gopher", IfAbsent: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if results[0].Value != "gopher" || !results[0].Found {
+			t.Errorf("got %+v, want the value read", results[0])
+		}
+		if _, exists := store.Get("from"); exists {
+			t.Errorf("expected from to be deleted")
+		}
+		if val, _ := store.Get("to"); val != "gopher" {
+			t.Errorf("got %q want %q", val, "gopher")
+		}
+		if _, v, _ := store.GetWithVersion("to"); v != results[2].Version {
+			t.Errorf("got version %d want %d", v, results[2].Version)
+		}
+	})
+
+	t.Run("applies nothing when a condition fails", func(t *testing.T) {
+		store := NewMemoryStore()
+		store.Set("a", "1")
+		store.Set("b", "1")
+
+		_, err := store.Txn([]TxnOp{
+			{Op: TxnSet, Key: "a", Value: "2"},
+			{Op: TxnDelete, Key: "c", IfExists: true},
+			{Op: TxnSet, Key: "b", Value: "2"},
+		})
+
+		var txnErr *TxnError
+		if !errors.As(err, &txnErr) || txnErr.Index != 1 {
+			t.Fatalf("got %v, want a TxnError for op 1", err)
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("got %v want %v", err, ErrKeyNotFound)
+		}
+
+		for _, k := range []string{"a", "b"} {
+			if val, _ := store.Get(k); val != "1" {
+				t.Errorf("got %s=%q want %q", k, val, "1")
+			}
+		}
+	})
+
+	t.Run("conditions see earlier ops", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		results, err := store.Txn([]TxnOp{
+			{Op: TxnSet, Key: "a", Value: "1", IfAbsent: true},
+			{Op: TxnSet, Key: "a", Value: "2", IfExists: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[1].Version <= results[0].Version {
+			t.Errorf("got versions %d then %d, want increasing", results[0].Version, results[1].Version)
+		}
+
+		_, err = store.Txn([]TxnOp{
+			{Op: TxnSet, Key: "a", Value: "3"},
+			{Op: TxnGet, Key: "a", IfVersion: results[1].Version},
+		})
+		if !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("got %v want %v", err, ErrVersionMismatch)
+		}
+	})
+
+	t.Run("rejects invalid ops", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		for _, op := range []TxnOp{{Op: "rename", Key: "a"}, {Op: TxnSet}} {
+			if _, err := store.Txn([]TxnOp{op}); !errors.Is(err, ErrInvalidOp) {
+				t.Errorf("%+v: got %v want %v", op, err, ErrInvalidOp)
+			}
+		}
+	})
+}
+
+func TestTxnBounded(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(2).WithEvictionPolicy(NewLRUPolicy())
+	store.Set("a", "1")
+	store.Set("b", "1")
+
+	// Making room for c would mean evicting a, which the transaction writes.
+	_, err := store.Txn([]TxnOp{
+		{Op: TxnSet, Key: "a", Value: "2"},
+		{Op: TxnSet, Key: "c", Value: "1"},
+	})
+	if !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("got %v want %v", err, ErrStoreFull)
+	}
+
+	if _, err := store.Txn([]TxnOp{{Op: TxnSet, Key: "c", Value: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := store.Get("a"); exists {
+		t.Errorf("expected a to be evicted")
+	}
+}
+
+func TestTxnJournaledOnce(t *testing.T) {
+	store := NewMemoryStore()
+
+	var records []record
+	store.journal = func(rec record) error {
+		records = append(records, rec)
+		return nil
+	}
+
+	store.Txn([]TxnOp{
+		{Op: TxnSet, Key: "a", Value: "1"},
+		{Op: TxnSet, Key: "b", Value: "2"},
+	})
+
+	if len(records) != 1 || records[0].Op != opTxn || len(records[0].Ops) != 2 {
+		t.Errorf("got %+v, want a single txn record with two ops", records)
+	}
+}
+
+func TestPersistentStore_ReplaysTxn(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		WithSaveInterval(time.Hour).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("a", "1")
+	store.Txn([]TxnOp{
+		{Op: TxnDelete, Key: "a"},
+		{Op: TxnSet, Key: "b", Value: "1"},
+	})
+	// No Stop: simulate a crash before the next snapshot.
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if _, exists := reloaded.Get("a"); exists {
+		t.Errorf("expected a to stay deleted")
+	}
+	if val, _ := reloaded.Get("b"); val != "1" {
+		t.Errorf("expected b to be replayed from wal")
+	}
+}
@@ -0,0 +1,471 @@
+package kvstore
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+)
+
+var (
+	// ErrWrongType is returned by operations on a key that holds a
+	// different type of value than the operation works on.
+	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+	// ErrNotInteger is returned by IncrBy when the key does not hold a
+	// 64-bit integer, or the result would not fit in one.
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+)
+
+// Type returns the type of value stored under key, or "" if it is not set.
+func (s *MemoryStore) Type(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	it, exists := s.lookup(key)
+	if !exists {
+		return ""
+	}
+	return it.typ()
+}
+
+// lookupType returns the live item stored under key, or nil if there is
+// none, and fails if it holds a type other than typ. The caller must hold s.mu.
+func (s *MemoryStore) lookupType(key string, typ string) (*item, error) {
+	it, exists := s.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	if it.typ() != typ {
+		return nil, ErrWrongType
+	}
+	return it, nil
+}
+
+// IncrBy adds delta to the integer stored under key and returns the result.
+// A missing key counts as zero. The key keeps its TTL.
+func (s *MemoryStore) IncrBy(key string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeString)
+	if err != nil {
+		return 0, err
+	}
+
+	var n, exp int64
+	if it != nil {
+		n, err = strconv.ParseInt(it.Value, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		exp = it.Expiration
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrNotInteger
+	}
+	n += delta
+
+	if _, err := s.setAt(key, strconv.FormatInt(n, 10), "", exp); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// LPush inserts values at the head of the list stored under key, creating
+// it if needed, and returns the new length. Like Redis, the values end up
+// in reverse order: LPush(k, "a", "b") leaves "b" first.
+func (s *MemoryStore) LPush(key string, values ...string) (int, error) {
+	return s.push(opLPush, key, values)
+}
+
+// RPush appends values to the list stored under key, creating it if
+// needed, and returns the new length.
+func (s *MemoryStore) RPush(key string, values ...string) (int, error) {
+	return s.push(opRPush, key, values)
+}
+
+func (s *MemoryStore) push(op string, key string, values []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeList)
+	if err != nil {
+		return 0, err
+	}
+
+	var grow int64
+	for _, v := range values {
+		grow += int64(len(v))
+	}
+	if err := s.commit(it, key, grow, record{Op: op, Key: key, Values: values}); err != nil {
+		return 0, err
+	}
+	return len(s.dict[key].List), nil
+}
+
+// LPop removes and returns up to count elements from the head of the
+// list stored under key. A missing key returns no elements.
+func (s *MemoryStore) LPop(key string, count int) ([]string, error) {
+	return s.pop(opLPop, key, count)
+}
+
+// RPop removes and returns up to count elements from the tail of the
+// list stored under key, last element first.
+func (s *MemoryStore) RPop(key string, count int) ([]string, error) {
+	return s.pop(opRPop, key, count)
+}
+
+func (s *MemoryStore) pop(op string, key string, count int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeList)
+	if err != nil || it == nil || count <= 0 {
+		return nil, err
+	}
+
+	count = min(count, len(it.List))
+	var popped []string
+	if op == opLPop {
+		popped = slices.Clone(it.List[:count])
+	} else {
+		popped = slices.Clone(it.List[len(it.List)-count:])
+		slices.Reverse(popped)
+	}
+
+	if err := s.commit(it, key, 0, record{Op: op, Key: key, Count: count}); err != nil {
+		return nil, err
+	}
+	return popped, nil
+}
+
+// LRange returns the elements of the list stored under key from start to
+// stop inclusive. Negative indexes count from the end, -1 being the last.
+func (s *MemoryStore) LRange(key string, start, stop int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	it, err := s.lookupType(key, TypeList)
+	if err != nil || it == nil {
+		return []string{}, err
+	}
+
+	n := len(it.List)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return []string{}, nil
+	}
+	return slices.Clone(it.List[start : stop+1]), nil
+}
+
+// HSet sets fields of the hash stored under key, creating it if needed,
+// and returns how many of the fields are new.
+func (s *MemoryStore) HSet(key string, fields map[string]string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeHash)
+	if err != nil || len(fields) == 0 {
+		return 0, err
+	}
+
+	var added int
+	var grow int64
+	pairs := make([]string, 0, 2*len(fields))
+	for f, v := range fields {
+		pairs = append(pairs, f, v)
+
+		old, exists := "", false
+		if it != nil {
+			old, exists = it.Hash[f]
+		}
+		if exists {
+			grow += int64(len(v) - len(old))
+		} else {
+			grow += int64(len(f) + len(v))
+			added++
+		}
+	}
+
+	if err := s.commit(it, key, grow, record{Op: opHSet, Key: key, Values: pairs}); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// HGet returns a field of the hash stored under key.
+func (s *MemoryStore) HGet(key string, field string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	it, err := s.lookupType(key, TypeHash)
+	if err != nil || it == nil {
+		return "", false, err
+	}
+
+	v, exists := it.Hash[field]
+	return v, exists, nil
+}
+
+// HGetAll returns every field of the hash stored under key.
+func (s *MemoryStore) HGetAll(key string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	it, err := s.lookupType(key, TypeHash)
+	if err != nil || it == nil {
+		return map[string]string{}, err
+	}
+
+	fields := make(map[string]string, len(it.Hash))
+	for f, v := range it.Hash {
+		fields[f] = v
+	}
+	return fields, nil
+}
+
+// HDel removes fields from the hash stored under key and returns how many
+// it held. The key is deleted along with its last field.
+func (s *MemoryStore) HDel(key string, fields ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeHash)
+	if err != nil || it == nil {
+		return 0, err
+	}
+
+	var removed []string
+	for _, f := range fields {
+		if _, exists := it.Hash[f]; exists && !slices.Contains(removed, f) {
+			removed = append(removed, f)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	if err := s.commit(it, key, 0, record{Op: opHDel, Key: key, Values: removed}); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// SAdd adds members to the set stored under key, creating it if needed,
+// and returns how many of them are new.
+func (s *MemoryStore) SAdd(key string, members ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeSet)
+	if err != nil {
+		return 0, err
+	}
+
+	var added []string
+	var grow int64
+	for _, m := range members {
+		if it != nil {
+			if _, exists := it.Set[m]; exists {
+				continue
+			}
+		}
+		if !slices.Contains(added, m) {
+			added = append(added, m)
+			grow += int64(len(m))
+		}
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	if err := s.commit(it, key, grow, record{Op: opSAdd, Key: key, Values: added}); err != nil {
+		return 0, err
+	}
+	return len(added), nil
+}
+
+// SRem removes members from the set stored under key and returns how many
+// it held. The key is deleted along with its last member.
+func (s *MemoryStore) SRem(key string, members ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, err := s.lookupType(key, TypeSet)
+	if err != nil || it == nil {
+		return 0, err
+	}
+
+	var removed []string
+	for _, m := range members {
+		if _, exists := it.Set[m]; exists && !slices.Contains(removed, m) {
+			removed = append(removed, m)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	if err := s.commit(it, key, 0, record{Op: opSRem, Key: key, Values: removed}); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// SMembers returns the members of the set stored under key, sorted.
+func (s *MemoryStore) SMembers(key string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	it, err := s.lookupType(key, TypeSet)
+	if err != nil || it == nil {
+		return []string{}, err
+	}
+
+	members := make([]string, 0, len(it.Set))
+	for m := range it.Set {
+		members = append(members, m)
+	}
+	slices.Sort(members)
+	return members, nil
+}
+
+// commit makes room for a collection write that grows the item under key
+// by grow bytes, journals rec and applies it. it is the live item, or nil
+// if the key is not set. The caller must hold s.mu.
+func (s *MemoryStore) commit(it *item, key string, grow int64, rec record) error {
+	size := int64(len(key)) + grow
+	if it != nil {
+		size += it.size()
+	}
+	if grow > 0 {
+		if err := s.makeRoom(key, size); err != nil {
+			return err
+		}
+	}
+
+	rec.Version = s.version + 1
+	rec.New = it == nil
+	if err := s.log(rec); err != nil {
+		return err
+	}
+
+	s.applyCollection(rec)
+	return nil
+}
+
+// applyCollection applies a change to a list, hash or set, creating the
+// key if the change adds to it and deleting it if the change empties it.
+// A change made to a key that was not set replaces what replay finds under
+// it, which had expired. The caller must hold s.mu.
+func (s *MemoryStore) applyCollection(rec record) {
+	it, exists := s.dict[rec.Key]
+	if exists && rec.New {
+		s.expire(rec.Key)
+		it, exists = nil, false
+	}
+
+	if !exists {
+		it = &item{Version: rec.Version}
+		switch rec.Op {
+		case opLPush, opRPush:
+			it.Type = TypeList
+		case opHSet:
+			it.Type, it.Hash = TypeHash, make(map[string]string)
+		case opSAdd:
+			it.Type, it.Set = TypeSet, make(map[string]struct{})
+		default:
+			return // Nothing to remove from
+		}
+		s.put(rec.Key, it)
+	}
+
+	var grow int64
+	switch rec.Op {
+	case opLPush:
+		list := make([]string, 0, len(rec.Values)+len(it.List))
+		for _, v := range slices.Backward(rec.Values) {
+			list = append(list, v)
+			grow += int64(len(v))
+		}
+		it.List = append(list, it.List...)
+	case opRPush:
+		for _, v := range rec.Values {
+			grow += int64(len(v))
+		}
+		it.List = append(it.List, rec.Values...)
+	case opLPop, opRPop:
+		n := min(rec.Count, len(it.List))
+		popped := it.List[:n]
+		if rec.Op == opRPop {
+			popped = it.List[len(it.List)-n:]
+		}
+		for _, v := range popped {
+			grow -= int64(len(v))
+		}
+		clear(popped)
+		if rec.Op == opLPop {
+			it.List = it.List[n:]
+		} else {
+			it.List = it.List[:len(it.List)-n]
+		}
+	case opHSet:
+		for i := 0; i+1 < len(rec.Values); i += 2 {
+			f, v := rec.Values[i], rec.Values[i+1]
+			if old, exists := it.Hash[f]; exists {
+				grow -= int64(len(f) + len(old))
+			}
+			it.Hash[f] = v
+			grow += int64(len(f) + len(v))
+		}
+	case opHDel:
+		for _, f := range rec.Values {
+			if old, exists := it.Hash[f]; exists {
+				delete(it.Hash, f)
+				grow -= int64(len(f) + len(old))
+			}
+		}
+	case opSAdd:
+		for _, m := range rec.Values {
+			if _, exists := it.Set[m]; !exists {
+				it.Set[m] = struct{}{}
+				grow += int64(len(m))
+			}
+		}
+	case opSRem:
+		for _, m := range rec.Values {
+			if _, exists := it.Set[m]; exists {
+				delete(it.Set, m)
+				grow -= int64(len(m))
+			}
+		}
+	}
+	it.extra += grow
+	s.bytes += grow
+
+	version := rec.Version
+	if version > s.version {
+		s.version = version
+	} else {
+		version = s.nextVersion()
+	}
+	it.Version = version
+
+	if it.empty() {
+		s.remove(rec.Key)
+		s.notify(EventDelete, rec.Key, "", version)
+		return
+	}
+
+	if s.policy != nil {
+		s.policy.Accessed(rec.Key)
+	}
+	s.notify(EventSet, rec.Key, "", version)
+}
@@ -0,0 +1,242 @@
+package kvstore
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	store := NewMemoryStore()
+
+	if n, _ := store.IncrBy("counter", 5); n != 5 {
+		t.Errorf("got %d want 5", n)
+	}
+	if n, _ := store.IncrBy("counter", -7); n != -2 {
+		t.Errorf("got %d want -2", n)
+	}
+	if val, _ := store.Get("counter"); val != "-2" {
+		t.Errorf("got %q want %q", val, "-2")
+	}
+
+	store.Set("name", "gopher")
+	if _, err := store.IncrBy("name", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("got %v want %v", err, ErrNotInteger)
+	}
+
+	store.Set("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := store.IncrBy("max", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("got %v on overflow, want %v", err, ErrNotInteger)
+	}
+
+	store.SetWithTTL("limited", "1", time.Minute)
+	store.IncrBy("limited", 1)
+	if ttl, _ := store.TTL("limited"); ttl <= 0 {
+		t.Errorf("expected the counter to keep its ttl")
+	}
+}
+
+func TestLists(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.RPush("queue", "b", "c")
+	if n, _ := store.LPush("queue", "a", "z"); n != 4 {
+		t.Errorf("got length %d want 4", n)
+	}
+
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"z", "a", "b", "c"}},
+		{1, 2, []string{"a", "b"}},
+		{-2, -1, []string{"b", "c"}},
+		{2, 100, []string{"b", "c"}},
+		{3, 1, []string{}},
+	}
+	for _, tt := range tests {
+		if got, _ := store.LRange("queue", tt.start, tt.stop); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LRange(%d, %d): got %q want %q", tt.start, tt.stop, got, tt.want)
+		}
+	}
+
+	if got, _ := store.LPop("queue", 1); !reflect.DeepEqual(got, []string{"z"}) {
+		t.Errorf("got %q want %q", got, []string{"z"})
+	}
+	if got, _ := store.RPop("queue", 2); !reflect.DeepEqual(got, []string{"c", "b"}) {
+		t.Errorf("got %q want %q", got, []string{"c", "b"})
+	}
+	store.LPop("queue", 10)
+
+	if typ := store.Type("queue"); typ != "" {
+		t.Errorf("expected the emptied list to be deleted, got type %q", typ)
+	}
+	if got, err := store.LPop("queue", 1); got != nil || err != nil {
+		t.Errorf("got %q, %v from a missing list", got, err)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	store := NewMemoryStore()
+
+	if n, _ := store.HSet("user", map[string]string{"name": "gopher", "lang": "go"}); n != 2 {
+		t.Errorf("got %d new fields want 2", n)
+	}
+	if n, _ := store.HSet("user", map[string]string{"name": "ferris", "age": "9"}); n != 1 {
+		t.Errorf("got %d new fields want 1", n)
+	}
+
+	if v, ok, _ := store.HGet("user", "name"); !ok || v != "ferris" {
+		t.Errorf("got %q, %v want %q", v, ok, "ferris")
+	}
+	if _, ok, _ := store.HGet("user", "missing"); ok {
+		t.Errorf("expected missing field not to be found")
+	}
+
+	if n, _ := store.HDel("user", "lang", "lang", "missing"); n != 1 {
+		t.Errorf("got %d removed want 1", n)
+	}
+	want := map[string]string{"name": "ferris", "age": "9"}
+	if got, _ := store.HGetAll("user"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestSets(t *testing.T) {
+	store := NewMemoryStore()
+
+	if n, _ := store.SAdd("tags", "go", "kv", "go"); n != 2 {
+		t.Errorf("got %d added want 2", n)
+	}
+	if n, _ := store.SAdd("tags", "kv", "db"); n != 1 {
+		t.Errorf("got %d added want 1", n)
+	}
+	if n, _ := store.SRem("tags", "kv", "missing"); n != 1 {
+		t.Errorf("got %d removed want 1", n)
+	}
+
+	if got, _ := store.SMembers("tags"); !reflect.DeepEqual(got, []string{"db", "go"}) {
+		t.Errorf("got %q want %q", got, []string{"db", "go"})
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("string", "1")
+	store.RPush("list", "a")
+
+	errs := map[string]error{}
+	_, errs["IncrBy"] = store.IncrBy("list", 1)
+	_, errs["RPush"] = store.RPush("string", "a")
+	_, errs["LPop"] = store.LPop("string", 1)
+	_, errs["HSet"] = store.HSet("list", map[string]string{"f": "v"})
+	_, _, errs["HGet"] = store.HGet("list", "f")
+	_, errs["SAdd"] = store.SAdd("list", "m")
+	_, errs["SMembers"] = store.SMembers("string")
+
+	for op, err := range errs {
+		if !errors.Is(err, ErrWrongType) {
+			t.Errorf("%s: got %v want %v", op, err, ErrWrongType)
+		}
+	}
+
+	if _, ok := store.Get("list"); ok {
+		t.Errorf("expected Get of a list to report no string")
+	}
+	if typ := store.Type("list"); typ != TypeList {
+		t.Errorf("got %q want %q", typ, TypeList)
+	}
+
+	// Set replaces a value of any type, like Redis.
+	store.Set("list", "now a string")
+	if typ := store.Type("list"); typ != TypeString {
+		t.Errorf("got %q want %q", typ, TypeString)
+	}
+}
+
+func TestTypedValuesCountBytes(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.RPush("l", "abc", "de")
+	store.HSet("h", map[string]string{"f": "vv"})
+	store.SAdd("s", "xyz")
+	if got, want := store.Usage().Bytes, int64(1+5+1+3+1+3); got != want {
+		t.Errorf("got %d bytes want %d", got, want)
+	}
+
+	store.LPop("l", 1)
+	store.HSet("h", map[string]string{"f": "v"})
+	store.SRem("s", "xyz")
+	if got, want := store.Usage().Bytes, int64(1+2+1+2); got != want {
+		t.Errorf("got %d bytes want %d", got, want)
+	}
+}
+
+func TestPushRespectsMaxBytes(t *testing.T) {
+	store := NewMemoryStore().WithMaxBytes(10)
+
+	store.RPush("l", "12345")
+	if _, err := store.RPush("l", "123456"); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("got %v want %v", err, ErrStoreFull)
+	}
+}
+
+func TestPersistentStore_TypedValues(t *testing.T) {
+	dir := t.TempDir()
+	snapshotFile := filepath.Join(dir, "store.snapshot.json")
+	walFile := filepath.Join(dir, "store.wal")
+
+	store, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		WithSaveInterval(time.Hour).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Some of it goes into the snapshot, the rest only into the wal.
+	store.RPush("queue", "a", "b", "c")
+	store.HSet("user", map[string]string{"name": "gopher"})
+	store.IncrBy("hits", 3)
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.LPop("queue", 1)
+	store.SAdd("tags", "go")
+	store.Expire("tags", time.Hour)
+	store.IncrBy("hits", 1)
+	// No Stop: simulate a crash before the next snapshot.
+
+	reloaded, err := NewPersistentStore().
+		WithSnapshotFile(snapshotFile).
+		WithWALFile(walFile).
+		Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Stop()
+
+	if got, _ := reloaded.LRange("queue", 0, -1); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("got queue %q want %q", got, []string{"b", "c"})
+	}
+	if v, _, _ := reloaded.HGet("user", "name"); v != "gopher" {
+		t.Errorf("got %q want %q", v, "gopher")
+	}
+	if got, _ := reloaded.SMembers("tags"); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("got tags %q want %q", got, []string{"go"})
+	}
+	if ttl, _ := reloaded.TTL("tags"); ttl <= 0 {
+		t.Errorf("expected tags to keep its ttl")
+	}
+	if val, _ := reloaded.Get("hits"); val != "4" {
+		t.Errorf("got hits %q want %q", val, "4")
+	}
+	if got, want := reloaded.Usage().Bytes, store.Usage().Bytes; got != want {
+		t.Errorf("got %d bytes after reload want %d", got, want)
+	}
+}
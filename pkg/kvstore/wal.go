@@ -0,0 +1,196 @@
+package kvstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+	opExpire = "expire" // Change the TTL of an existing key
+	opTxn    = "txn"    // Ops applied together
+	opLog    = "log"    // First record of a log, with its generation as Version
+
+	// Changes to lists, hashes and sets.
+	opLPush = "lpush"
+	opRPush = "rpush"
+	opLPop  = "lpop"
+	opRPop  = "rpop"
+	opHSet  = "hset"
+	opHDel  = "hdel"
+	opSAdd  = "sadd"
+	opSRem  = "srem"
+)
+
+// walHeaderSize is the size of the frame header preceding every record:
+// a 4-byte payload length followed by a 4-byte CRC32 of the payload.
+const walHeaderSize = 8
+
+// record is a single store mutation, as passed to the journal and
+// appended to the write-ahead log.
+type record struct {
+	Op          string   `json:"op"`
+	Key         string   `json:"key"`
+	Value       string   `json:"value,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Expiration  int64    `json:"expiration,omitempty"`
+	Version     uint64   `json:"version,omitempty"`
+	Ops         []record `json:"ops,omitempty"`
+	Values      []string `json:"values,omitempty"` // Elements, fields or members
+	Count       int      `json:"count,omitempty"`  // Elements to pop
+	New         bool     `json:"new,omitempty"`    // Key was not set, or had expired
+}
+
+// recordJSON is how a record is encoded. Like items, values that are not
+// valid UTF-8 are written base64 encoded to Binary.
+type recordJSON struct {
+	plainRecord
+	Binary []byte `json:"binary,omitempty"`
+}
+
+type plainRecord record
+
+func (r record) MarshalJSON() ([]byte, error) {
+	if utf8.ValidString(r.Value) {
+		return json.Marshal(plainRecord(r))
+	}
+
+	v := recordJSON{plainRecord: plainRecord(r), Binary: []byte(r.Value)}
+	v.Value = ""
+	return json.Marshal(v)
+}
+
+func (r *record) UnmarshalJSON(data []byte) error {
+	var v recordJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*r = record(v.plainRecord)
+	if v.Binary != nil {
+		r.Value = string(v.Binary)
+	}
+	return nil
+}
+
+// wal is an append-only, checksummed log of store mutations.
+// Every Append is fsynced before it returns, so a record that was
+// appended survives a crash of the process.
+//
+// Each Reset starts a new generation of the log. A snapshot names the
+// generation that continues from it, so a log that a crash left behind
+// before it could be reset is known to be covered by the snapshot.
+type wal struct {
+	file *os.File
+	gen  uint64 // Zero for a log that has never been reset
+}
+
+func openWAL(filename string) (*wal, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{file: f}, nil
+}
+
+// Replay calls fn for every record in the log, in order, and sets the
+// generation of the log from its first record.
+// A torn final record (short write or bad checksum at the end of the file)
+// is truncated away; corruption anywhere before the end is reported as an error.
+func (w *wal) Replay(fn func(record)) error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(w.file)
+
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for offset < size {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return w.truncate(offset)
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		end := offset + walHeaderSize + int64(length)
+		if end > size {
+			return w.truncate(offset)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return w.truncate(offset)
+		}
+
+		var rec record
+		if crc32.ChecksumIEEE(payload) != sum || json.Unmarshal(payload, &rec) != nil {
+			if end == size {
+				return w.truncate(offset)
+			}
+			return fmt.Errorf("wal: corrupt record at offset %d", offset)
+		}
+
+		if offset == 0 && rec.Op == opLog {
+			w.gen = rec.Version
+		} else {
+			fn(rec)
+		}
+		offset = end
+	}
+	return nil
+}
+
+// Append writes rec to the end of the log and fsyncs it.
+func (w *wal) Append(rec record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Reset discards every record in the log and starts generation gen. It
+// is called once the records are covered by a snapshot.
+func (w *wal) Reset(gen uint64) error {
+	if err := w.truncate(0); err != nil {
+		return err
+	}
+	if err := w.Append(record{Op: opLog, Version: gen}); err != nil {
+		return err
+	}
+	w.gen = gen
+	return nil
+}
+
+func (w *wal) truncate(offset int64) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *wal) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,209 @@
+package kvstore
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kinds of Event.
+const (
+	EventSet    = "set"
+	EventDelete = "delete"
+	EventExpire = "expire"
+)
+
+const (
+	// watchHistory is how many recent events a store keeps so that
+	// watches can resume from an earlier revision.
+	watchHistory = 1024
+	// watchHistoryShare bounds the bytes of those events in a store
+	// bounded by WithMaxBytes to this fraction of the bound.
+	watchHistoryShare = 4
+	// watchBuffer is how many events a subscriber may fall behind by
+	// before it is dropped.
+	watchBuffer = 256
+)
+
+var (
+	// ErrCompacted is returned by Watch when the events since the requested
+	// revision are no longer kept. The caller should re-read what it needs
+	// and watch again from the current revision.
+	ErrCompacted = errors.New("revision compacted")
+	// ErrWatchLagged is reported by Subscription.Err when the subscriber
+	// stopped reading and its events were dropped.
+	ErrWatchLagged = errors.New("watch fell behind")
+)
+
+// Event describes a change to a key. Revisions increase with every change
+// to the store, so the revision of the last event seen is enough to
+// resume a watch.
+type Event struct {
+	Type     string // EventSet, EventDelete or EventExpire
+	Key      string
+	Value    string // New value of a set
+	Revision uint64
+}
+
+// WatchOptions selects the events a subscription receives.
+type WatchOptions struct {
+	// Key is the key to watch, or the prefix of the keys to watch if
+	// Prefix is set. An empty Key watches every key.
+	Key    string
+	Prefix bool
+	// Since resumes the watch after this revision, replaying the events
+	// the subscriber missed. Zero watches from the current revision.
+	Since uint64
+}
+
+func (o WatchOptions) matches(key string) bool {
+	if o.Prefix || o.Key == "" {
+		return strings.HasPrefix(key, o.Key)
+	}
+	return key == o.Key
+}
+
+// Subscription is a stream of events from a store.
+type Subscription struct {
+	store    *MemoryStore
+	opts     WatchOptions
+	events   chan Event
+	revision uint64
+	err      error // Guarded by store.mu
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the subscription is closed or falls behind; see Err.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+// Revision is the revision of the store when the subscription started.
+// Every later event is delivered.
+func (sub *Subscription) Revision() uint64 {
+	return sub.revision
+}
+
+// Err returns ErrWatchLagged if the store closed the subscription
+// because the subscriber was not keeping up.
+func (sub *Subscription) Err() error {
+	sub.store.mu.RLock()
+	defer sub.store.mu.RUnlock()
+
+	return sub.err
+}
+
+// Close stops the subscription and closes its channel.
+func (sub *Subscription) Close() {
+	s := sub.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.watchers[sub]; ok {
+		delete(s.watchers, sub)
+		close(sub.events)
+	}
+}
+
+// Watch subscribes to changes to the keys selected by opts.
+//
+// Expire events are only generated when expired keys are removed, which
+// a plain MemoryStore only does to make room; use a TTLStore to have
+// them removed, and reported, as they expire.
+func (s *MemoryStore) Watch(opts WatchOptions) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missed []Event
+	if opts.Since != 0 {
+		if opts.Since < s.compacted || opts.Since > s.version {
+			return nil, ErrCompacted
+		}
+		for _, ev := range s.history {
+			if ev.Revision > opts.Since && opts.matches(ev.Key) {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		store:    s,
+		opts:     opts,
+		events:   make(chan Event, max(watchBuffer, len(missed))),
+		revision: s.version,
+	}
+	for _, ev := range missed {
+		sub.events <- ev
+	}
+
+	if s.watchers == nil {
+		s.watchers = make(map[*Subscription]struct{})
+	}
+	s.watchers[sub] = struct{}{}
+	return sub, nil
+}
+
+// notify records an event and delivers it to matching subscribers,
+// dropping any that are too far behind to take it. The caller must
+// hold s.mu.
+func (s *MemoryStore) notify(typ string, key string, value string, revision uint64) {
+	s.count(typ)
+	ev := Event{Type: typ, Key: key, Value: value, Revision: revision}
+
+	s.history = append(s.history, ev)
+	s.historyBytes += ev.size()
+	if len(s.history) >= 2*watchHistory {
+		s.compactHistory(len(s.history) - watchHistory)
+	}
+	if budget := s.maxBytes / watchHistoryShare; s.maxBytes > 0 && s.historyBytes > budget {
+		// Drop the oldest events until half the budget is left, so that
+		// the copy is not made on every write.
+		n, kept := 0, s.historyBytes
+		for n < len(s.history) && kept > budget/2 {
+			kept -= s.history[n].size()
+			n++
+		}
+		s.compactHistory(n)
+	}
+
+	for sub := range s.watchers {
+		if !sub.opts.matches(key) {
+			continue
+		}
+
+		select {
+		case sub.events <- ev:
+		default:
+			sub.err = ErrWatchLagged
+			delete(s.watchers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// compactHistory drops the n oldest events of the history. The caller
+// must hold s.mu.
+func (s *MemoryStore) compactHistory(n int) {
+	if n == 0 {
+		return
+	}
+	for _, ev := range s.history[:n] {
+		s.historyBytes -= ev.size()
+	}
+	s.compacted = s.history[n-1].Revision
+	s.history = append(s.history[:0:0], s.history[n:]...)
+}
+
+// size is the number of bytes an event holds in the history.
+func (ev Event) size() int64 {
+	return int64(len(ev.Key) + len(ev.Value))
+}
+
+// forgetHistory drops the events recorded so far, so that watches can
+// only resume from the current revision. It is used once a store has
+// been loaded from disk, since the events that built it up are not all
+// known. The caller must hold s.mu.
+func (s *MemoryStore) forgetHistory() {
+	s.history = nil
+	s.historyBytes = 0
+	s.compacted = s.version
+}
@@ -0,0 +1,183 @@
+package kvstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent waits briefly for an event on sub.
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("subscription closed: %v", sub.Err())
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("delivers sets and deletes in revision order", func(t *testing.T) {
+		store := NewMemoryStore()
+		sub, err := store.Watch(WatchOptions{Key: "key"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		store.Set("key", "1")
+		store.Set("other", "1")
+		store.Delete("key")
+
+		set, del := nextEvent(t, sub), nextEvent(t, sub)
+		if set.Type != EventSet || set.Key != "key" || set.Value != "1" {
+			t.Errorf("got %+v, want a set of key", set)
+		}
+		if del.Type != EventDelete || del.Key != "key" {
+			t.Errorf("got %+v, want a delete of key", del)
+		}
+		if del.Revision <= set.Revision {
+			t.Errorf("got revisions %d then %d, want increasing", set.Revision, del.Revision)
+		}
+	})
+
+	t.Run("filters by prefix", func(t *testing.T) {
+		store := NewMemoryStore()
+		sub, _ := store.Watch(WatchOptions{Key: "user:", Prefix: true})
+		defer sub.Close()
+
+		store.Set("session:1", "x")
+		store.Set("user:1", "x")
+
+		if ev := nextEvent(t, sub); ev.Key != "user:1" {
+			t.Errorf("got %q want %q", ev.Key, "user:1")
+		}
+	})
+
+	t.Run("reports expirations", func(t *testing.T) {
+		store := NewTTLStore().WithCleanupInterval(10 * time.Millisecond)
+		defer store.Stop()
+		sub, _ := store.Watch(WatchOptions{})
+		defer sub.Close()
+
+		store.SetWithTTL("key", "1", 20*time.Millisecond)
+
+		nextEvent(t, sub)
+		if ev := nextEvent(t, sub); ev.Type != EventExpire || ev.Key != "key" {
+			t.Errorf("got %+v, want an expiry of key", ev)
+		}
+	})
+
+	t.Run("reports transactions", func(t *testing.T) {
+		store := NewMemoryStore()
+		store.Set("a", "1")
+		sub, _ := store.Watch(WatchOptions{})
+		defer sub.Close()
+
+		results, _ := store.Txn([]TxnOp{
+			{Op: TxnDelete, Key: "a"},
+			{Op: TxnSet, Key: "b", Value: "1"},
+		})
+
+		if ev := nextEvent(t, sub); ev.Type != EventDelete || ev.Key != "a" {
+			t.Errorf("got %+v, want a delete of a", ev)
+		}
+		if ev := nextEvent(t, sub); ev.Revision != results[1].Version {
+			t.Errorf("got revision %d want %d", ev.Revision, results[1].Version)
+		}
+	})
+}
+
+func TestWatchResume(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("a", "1")
+	_, since, _ := store.GetWithVersion("a")
+	store.Set("b", "1")
+	store.Delete("a")
+
+	sub, err := store.Watch(WatchOptions{Since: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if ev := nextEvent(t, sub); ev.Key != "b" || ev.Type != EventSet {
+		t.Errorf("got %+v, want the set of b", ev)
+	}
+	if ev := nextEvent(t, sub); ev.Key != "a" || ev.Type != EventDelete {
+		t.Errorf("got %+v, want the delete of a", ev)
+	}
+}
+
+func TestWatchCompacted(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("key", "0")
+	_, since, _ := store.GetWithVersion("key")
+
+	for i := range 2 * watchHistory {
+		store.Set("key", strconv.Itoa(i))
+	}
+
+	if _, err := store.Watch(WatchOptions{Since: since}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got %v want %v", err, ErrCompacted)
+	}
+	if _, err := store.Watch(WatchOptions{Since: store.version + 1}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got %v for a future revision, want %v", err, ErrCompacted)
+	}
+}
+
+func TestWatchHistoryBoundedByMaxBytes(t *testing.T) {
+	store := NewMemoryStore().WithMaxBytes(1000)
+	value := strings.Repeat("v", 100)
+
+	store.Set("key", value)
+	first := store.version
+	for range 100 {
+		store.Set("key", value)
+	}
+
+	if got := store.Usage().HistoryBytes; got <= 0 || got > 1000/watchHistoryShare {
+		t.Errorf("got %d bytes of history want at most %d", got, 1000/watchHistoryShare)
+	}
+	if _, err := store.Watch(WatchOptions{Since: first}); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got %v for a dropped revision, want %v", err, ErrCompacted)
+	}
+	sub, err := store.Watch(WatchOptions{Since: store.version - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if ev := <-sub.Events(); ev.Value != value {
+		t.Errorf("got value %q from the history", ev.Value)
+	}
+}
+
+func TestWatchLagged(t *testing.T) {
+	store := NewMemoryStore()
+	sub, _ := store.Watch(WatchOptions{})
+
+	for i := range watchBuffer + 1 {
+		store.Set("key", strconv.Itoa(i))
+	}
+
+	n := 0
+	for range sub.Events() {
+		n++
+	}
+	if n != watchBuffer {
+		t.Errorf("got %d events want %d", n, watchBuffer)
+	}
+	if !errors.Is(sub.Err(), ErrWatchLagged) {
+		t.Errorf("got %v want %v", sub.Err(), ErrWatchLagged)
+	}
+
+	sub.Close() // Closing again is a no-op
+}
@@ -0,0 +1,197 @@
+// Package metrics writes the Prometheus text exposition format and keeps
+// the histograms behind it, without depending on the Prometheus client.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are upper bounds in seconds suited to the latency of
+// operations that take from well under a millisecond to a few seconds.
+var DefaultBuckets = []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// Histogram counts observations into buckets. It is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // Per bucket, the last one unbounded
+	sum    float64
+}
+
+// NewHistogram returns a histogram with the given upper bounds, which must
+// be sorted, or DefaultBuckets if there are none.
+func NewHistogram(bounds ...float64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[i]++
+	h.sum += v
+}
+
+// ObserveDuration observes d in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snap := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    h.sum,
+	}
+	for i, n := range h.counts {
+		snap.Count += n
+		snap.Counts[i] = snap.Count
+	}
+	return snap
+}
+
+// HistogramSnapshot is the state of a histogram at one point in time.
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64 // Cumulative, with one more entry than Bounds for +Inf
+	Sum    float64
+	Count  uint64
+}
+
+// Label is a label name and value of a sample.
+type Label struct {
+	Name, Value string
+}
+
+// Sample is one value of a counter or gauge.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// HistogramSample is one histogram of a histogram family.
+type HistogramSample struct {
+	Labels    []Label
+	Histogram HistogramSnapshot
+}
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Writer writes metric families in the text exposition format. The first
+// write error is kept and returned by Err; later writes do nothing.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first error writing to the underlying writer.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Counter writes a counter family.
+func (w *Writer) Counter(name, help string, samples ...Sample) {
+	w.family(name, help, "counter", samples)
+}
+
+// Gauge writes a gauge family.
+func (w *Writer) Gauge(name, help string, samples ...Sample) {
+	w.family(name, help, "gauge", samples)
+}
+
+// Histogram writes a histogram family.
+func (w *Writer) Histogram(name, help string, samples ...HistogramSample) {
+	w.header(name, help, "histogram")
+	for _, s := range samples {
+		h := s.Histogram
+		for i, n := range h.Counts {
+			le := "+Inf"
+			if i < len(h.Bounds) {
+				le = formatFloat(h.Bounds[i])
+			}
+			w.sample(name+"_bucket", append(s.Labels[:len(s.Labels):len(s.Labels)], Label{"le", le}), float64(n))
+		}
+		w.sample(name+"_sum", s.Labels, h.Sum)
+		w.sample(name+"_count", s.Labels, float64(h.Count))
+	}
+}
+
+func (w *Writer) family(name, help, typ string, samples []Sample) {
+	w.header(name, help, typ)
+	for _, s := range samples {
+		w.sample(name, s.Labels, s.Value)
+	}
+}
+
+func (w *Writer) header(name, help, typ string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+func (w *Writer) sample(name string, labels []Label, v float64) {
+	if len(labels) == 0 {
+		w.printf("%s %s\n", name, formatFloat(v))
+		return
+	}
+
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l.Name + `="` + escapeLabel(l.Value) + `"`
+	}
+	w.printf("%s{%s} %s\n", name, strings.Join(parts, ","), formatFloat(v))
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
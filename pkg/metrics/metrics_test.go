@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(1, 5)
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		h.Observe(v)
+	}
+
+	snap := h.Snapshot()
+	if want := []uint64{2, 3, 4}; !slices.Equal(snap.Counts, want) {
+		t.Errorf("got counts %v want %v", snap.Counts, want)
+	}
+	if snap.Sum != 14.5 || snap.Count != 4 {
+		t.Errorf("got sum %v and count %d want 14.5 and 4", snap.Sum, snap.Count)
+	}
+
+	h.ObserveDuration(2 * time.Second)
+	if got := h.Snapshot().Counts[1]; got != 4 {
+		t.Errorf("got %d observations up to 5s want 4", got)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+
+	w.Counter("kv_gets_total", "Reads of a key.", Sample{Value: 3})
+	w.Gauge("kv_keys", "Keys in the store.\nIncluding expired ones.", Sample{Labels: []Label{{"shard", `a"b`}}, Value: 1.5})
+
+	h := NewHistogram(0.1)
+	h.Observe(0.05)
+	h.Observe(1)
+	w.Histogram("kv_save_seconds", "Time to save.", HistogramSample{Labels: []Label{{"store", "disk"}}, Histogram: h.Snapshot()})
+
+	want := `# HELP kv_gets_total Reads of a key.
+# TYPE kv_gets_total counter
+kv_gets_total 3
+# HELP kv_keys Keys in the store.\nIncluding expired ones.
+# TYPE kv_keys gauge
+kv_keys{shard="a\"b"} 1.5
+# HELP kv_save_seconds Time to save.
+# TYPE kv_save_seconds histogram
+kv_save_seconds_bucket{store="disk",le="0.1"} 1
+kv_save_seconds_bucket{store="disk",le="+Inf"} 2
+kv_save_seconds_sum{store="disk"} 1.05
+kv_save_seconds_count{store="disk"} 2
+`
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package raft
+
+// raftLog is the log of a node: a snapshot of everything up to some index,
+// then the entries after it.
+type raftLog struct {
+	snapshot Snapshot // Data may be nil once it has been persisted
+	entries  []Entry  // From snapshot.Index+1
+	stable   uint64   // Last index persisted
+	// committed and applied are the highest indexes known to be committed
+	// and handed out to be applied.
+	committed uint64
+	applied   uint64
+}
+
+func (l *raftLog) firstIndex() uint64 {
+	return l.snapshot.Index + 1
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return l.snapshot.Index + uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	t, _ := l.term(l.lastIndex())
+	return t
+}
+
+// term returns the term of the entry at i, if the log still knows it.
+func (l *raftLog) term(i uint64) (uint64, bool) {
+	switch {
+	case i == l.snapshot.Index:
+		return l.snapshot.Term, true
+	case i < l.snapshot.Index || i > l.lastIndex():
+		return 0, false
+	}
+	return l.entries[i-l.firstIndex()].Term, true
+}
+
+func (l *raftLog) matchTerm(i, term uint64) bool {
+	t, ok := l.term(i)
+	return ok && t == term
+}
+
+// isUpToDate reports whether a log ending at lastIndex in lastTerm is at
+// least as up to date as this one, which is when a vote may be granted.
+func (l *raftLog) isUpToDate(lastIndex, lastTerm uint64) bool {
+	return lastTerm > l.lastTerm() || (lastTerm == l.lastTerm() && lastIndex >= l.lastIndex())
+}
+
+// slice returns the entries from lo up to but not including hi, at most
+// max of them. lo must be after the snapshot.
+func (l *raftLog) slice(lo, hi uint64, max int) []Entry {
+	if hi > lo+uint64(max) {
+		hi = lo + uint64(max)
+	}
+	if lo >= hi {
+		return nil
+	}
+	return append([]Entry(nil), l.entries[lo-l.firstIndex():hi-l.firstIndex()]...)
+}
+
+// append adds entries after prevIndex, which must match, dropping any
+// entries from the first one that conflicts. It returns the index of the
+// last new entry.
+func (l *raftLog) append(prevIndex uint64, ents []Entry) uint64 {
+	for i, e := range ents {
+		if e.Index <= l.snapshot.Index {
+			continue
+		}
+		if l.matchTerm(e.Index, e.Term) {
+			continue
+		}
+		// A conflicting entry and everything after it are replaced;
+		// committed entries never conflict.
+		l.entries = append(l.entries[:e.Index-l.firstIndex()], ents[i:]...)
+		l.stable = min(l.stable, e.Index-1)
+		break
+	}
+	return prevIndex + uint64(len(ents))
+}
+
+// commitTo raises the commit index, never past the end of the log.
+func (l *raftLog) commitTo(i uint64) bool {
+	i = min(i, l.lastIndex())
+	if i <= l.committed {
+		return false
+	}
+	l.committed = i
+	return true
+}
+
+// unstable returns the entries not yet persisted.
+func (l *raftLog) unstable() []Entry {
+	if l.stable >= l.lastIndex() {
+		return nil
+	}
+	lo := max(l.stable+1, l.firstIndex())
+	return l.slice(lo, l.lastIndex()+1, len(l.entries))
+}
+
+// nextCommitted returns the committed entries not yet handed out to be
+// applied, which must already be persisted.
+func (l *raftLog) nextCommitted() []Entry {
+	hi := min(l.committed, l.stable)
+	lo := max(l.applied+1, l.firstIndex())
+	if lo > hi {
+		return nil
+	}
+	return l.slice(lo, hi+1, len(l.entries))
+}
+
+// restore resets the log to snap, dropping every entry.
+func (l *raftLog) restore(snap Snapshot) {
+	l.snapshot = snap
+	l.entries = nil
+	l.committed = snap.Index
+	l.stable = snap.Index
+}
+
+// compact replaces the entries up to snap.Index with snap.
+func (l *raftLog) compact(snap Snapshot) {
+	l.entries = append([]Entry(nil), l.entries[snap.Index-l.snapshot.Index:]...)
+	l.snapshot = snap
+}
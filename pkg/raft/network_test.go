@@ -0,0 +1,267 @@
+package raft
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// network is a deterministic in-memory cluster. Messages are queued and
+// delivered in order, unless the link they travel is cut or the node they
+// go to is down, and nodes only move on when the test ticks them.
+type network struct {
+	t     *testing.T
+	nodes map[uint64]*testNode
+	queue []Message
+	cut   map[[2]uint64]bool // Links that drop messages, by from and to
+	// dropRate is the chance that any message is lost, decided by rand
+	// so that runs repeat exactly.
+	dropRate float64
+	rand     *rand.Rand
+	trace    []string // Every message delivered
+}
+
+type testNode struct {
+	*Node
+	storage *MemoryStorage
+	applied []string    // Commands applied, in order
+	reads   []ReadState // ReadStates handed out
+	down    bool
+}
+
+func newNetwork(t *testing.T, ids ...uint64) *network {
+	t.Helper()
+
+	nw := &network{
+		t:     t,
+		nodes: make(map[uint64]*testNode),
+		cut:   make(map[[2]uint64]bool),
+		rand:  rand.New(rand.NewSource(1)),
+	}
+	peers := make([]Peer, len(ids))
+	for i, id := range ids {
+		peers[i] = Peer{ID: id, Addr: fmt.Sprintf("node-%d", id)}
+	}
+	for _, id := range ids {
+		nw.start(id, peers, NewMemoryStorage())
+	}
+	return nw
+}
+
+// start runs node id on storage, restoring what it applied from the
+// snapshot there.
+func (nw *network) start(id uint64, peers []Peer, storage *MemoryStorage) *testNode {
+	nw.t.Helper()
+
+	n, err := NewNode(Config{
+		ID:             id,
+		Peers:          peers,
+		ElectionTicks:  10,
+		HeartbeatTicks: 1,
+		Storage:        storage,
+		Rand:           rand.New(rand.NewSource(int64(id))),
+	})
+	if err != nil {
+		nw.t.Fatal(err)
+	}
+
+	tn := &testNode{Node: n, storage: storage}
+	_, snap, _, _ := storage.Load()
+	if snap.Data != nil {
+		tn.restore(snap.Data)
+	}
+	nw.nodes[id] = tn
+	return tn
+}
+
+// add starts a node that joins the cluster once a leader adds it.
+func (nw *network) add(id uint64) *testNode {
+	return nw.start(id, nil, NewMemoryStorage())
+}
+
+func (tn *testNode) restore(data []byte) {
+	tn.applied = nil
+	if err := json.Unmarshal(data, &tn.applied); err != nil {
+		panic(err)
+	}
+}
+
+func (tn *testNode) snapshot() []byte {
+	data, _ := json.Marshal(tn.applied)
+	return data
+}
+
+func (nw *network) ids() []uint64 {
+	ids := make([]uint64, 0, len(nw.nodes))
+	for id := range nw.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// process does what node id has ready, as a Runner would.
+func (nw *network) process(id uint64) {
+	tn := nw.nodes[id]
+	for tn.HasReady() {
+		rd := tn.Ready()
+		if rd.Snapshot != nil {
+			tn.storage.ApplySnapshot(*rd.Snapshot)
+			tn.restore(rd.Snapshot.Data)
+		}
+		tn.storage.Save(rd.HardState, rd.Entries)
+		nw.queue = append(nw.queue, rd.Messages...)
+		for _, e := range rd.CommittedEntries {
+			if e.Type == EntryNormal && len(e.Data) > 0 {
+				tn.applied = append(tn.applied, string(e.Data))
+			}
+		}
+		tn.reads = append(tn.reads, rd.ReadStates...)
+		tn.Advance(rd)
+	}
+}
+
+// deliver delivers messages until none are left.
+func (nw *network) deliver() {
+	for delivered := 0; len(nw.queue) > 0; delivered++ {
+		if delivered > 100000 {
+			nw.t.Fatal("messages are not settling")
+		}
+		m := nw.queue[0]
+		nw.queue = nw.queue[1:]
+
+		to := nw.nodes[m.To]
+		if to == nil || to.down || nw.nodes[m.From].down || nw.cut[[2]uint64{m.From, m.To}] {
+			continue
+		}
+		if nw.dropRate > 0 && nw.rand.Float64() < nw.dropRate {
+			continue
+		}
+		nw.trace = append(nw.trace, fmt.Sprintf("%d->%d %v t%d i%d", m.From, m.To, m.Type, m.Term, m.Index))
+		if err := to.Step(m); err != nil {
+			nw.t.Fatal(err)
+		}
+		nw.process(m.To)
+	}
+}
+
+// tick advances every node that is up by n ticks, delivering the
+// messages of each.
+func (nw *network) tick(n int) {
+	for range n {
+		for _, id := range nw.ids() {
+			if tn := nw.nodes[id]; !tn.down {
+				tn.Tick()
+				nw.process(id)
+			}
+		}
+		nw.deliver()
+	}
+}
+
+// partition cuts every link between nodes in different groups. Nodes in
+// no group can reach everyone.
+func (nw *network) partition(groups ...[]uint64) {
+	group := make(map[uint64]int)
+	for i, g := range groups {
+		for _, id := range g {
+			group[id] = i + 1
+		}
+	}
+	for _, a := range nw.ids() {
+		for _, b := range nw.ids() {
+			if group[a] != 0 && group[b] != 0 && group[a] != group[b] {
+				nw.cut[[2]uint64{a, b}] = true
+			}
+		}
+	}
+}
+
+// isolate cuts id off from every other node.
+func (nw *network) isolate(id uint64) {
+	for _, other := range nw.ids() {
+		if other != id {
+			nw.cut[[2]uint64{id, other}] = true
+			nw.cut[[2]uint64{other, id}] = true
+		}
+	}
+}
+
+func (nw *network) heal() {
+	nw.cut = make(map[[2]uint64]bool)
+}
+
+// crash stops id, keeping its storage, and restart brings it back.
+func (nw *network) crash(id uint64) {
+	nw.nodes[id].down = true
+}
+
+func (nw *network) restart(id uint64) *testNode {
+	return nw.start(id, nil, nw.nodes[id].storage)
+}
+
+// leader ticks until the nodes in ids, or all of them, agree on a leader
+// among them, and returns it.
+func (nw *network) leader(ids ...uint64) *testNode {
+	nw.t.Helper()
+
+	if len(ids) == 0 {
+		ids = nw.ids()
+	}
+	for range 1000 {
+		var lead uint64
+		agree := true
+		for _, id := range ids {
+			st := nw.nodes[id].Status()
+			if nw.nodes[id].down || !slices.ContainsFunc(st.Members, func(p Peer) bool { return p.ID == id }) {
+				continue
+			}
+			if lead == 0 {
+				lead = st.Lead
+			}
+			agree = agree && st.Lead != 0 && st.Lead == lead
+		}
+		if agree && lead != 0 && slices.Contains(ids, lead) && nw.nodes[lead].Status().Role == Leader {
+			return nw.nodes[lead]
+		}
+		nw.tick(1)
+	}
+	nw.t.Fatalf("no leader among %v", ids)
+	return nil
+}
+
+// propose proposes cmd on node id and delivers the messages that follow.
+func (nw *network) propose(id uint64, cmd string) error {
+	_, _, err := nw.nodes[id].Propose([]byte(cmd))
+	nw.process(id)
+	nw.deliver()
+	return err
+}
+
+func (nw *network) confChange(id uint64, cc ConfChange) error {
+	_, _, err := nw.nodes[id].ProposeConfChange(cc)
+	nw.process(id)
+	nw.deliver()
+	return err
+}
+
+// checkApplied fails unless every node in ids, or every node that is up,
+// applied exactly want.
+func (nw *network) checkApplied(want []string, ids ...uint64) {
+	nw.t.Helper()
+
+	if len(ids) == 0 {
+		for _, id := range nw.ids() {
+			if !nw.nodes[id].down {
+				ids = append(ids, id)
+			}
+		}
+	}
+	for _, id := range ids {
+		if got := nw.nodes[id].applied; !slices.Equal(got, want) {
+			nw.t.Errorf("node %d applied %v want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,1035 @@
+// Package raft implements the Raft consensus algorithm: leader election,
+// log replication, snapshots, single-server membership changes and
+// linearizable reads through the read index.
+//
+// A Node keeps no time and sends no messages of its own, so it is
+// deterministic: it is driven by Tick and Step, and its callers persist,
+// send and apply what Ready returns before calling Advance. Runner does
+// that over a Transport for a node in a real cluster.
+package raft
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+)
+
+var (
+	// ErrNotLeader is returned by proposals and reads sent to a node that
+	// is not the leader. Status().Lead names the leader, if known.
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrConfChangePending is returned by ProposeConfChange while an
+	// earlier membership change is not yet committed.
+	ErrConfChangePending = errors.New("raft: membership change in progress")
+	// ErrCompacted is returned by Compact for an index already in a
+	// snapshot or not yet applied.
+	ErrCompacted = errors.New("raft: index not compactable")
+)
+
+// maxMsgEntries is how many entries a leader sends in one append.
+const maxMsgEntries = 256
+
+// Role is what a node currently does in the cluster.
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	for _, role := range []Role{Follower, Candidate, Leader} {
+		if string(text) == role.String() {
+			*r = role
+			return nil
+		}
+	}
+	return fmt.Errorf("raft: unknown role %q", text)
+}
+
+// EntryType tells what the data of an entry is.
+type EntryType int
+
+const (
+	EntryNormal     EntryType = iota // Data is a command for the state machine, or empty
+	EntryConfChange                  // Data is a JSON ConfChange
+)
+
+// Entry is an entry of the replicated log.
+type Entry struct {
+	Term  uint64    `json:"term"`
+	Index uint64    `json:"index"`
+	Type  EntryType `json:"type,omitempty"`
+	Data  []byte    `json:"data,omitempty"`
+}
+
+// ConfChangeType is the kind of a membership change.
+type ConfChangeType int
+
+const (
+	AddNode ConfChangeType = iota
+	RemoveNode
+)
+
+// ConfChange adds a node to the cluster or removes one. Changes take
+// effect once committed, one at a time.
+type ConfChange struct {
+	Type   ConfChangeType `json:"type"`
+	NodeID uint64         `json:"node_id"`
+	Addr   string         `json:"addr,omitempty"` // Of an added node, for the Transport
+}
+
+// Peer is a member of the cluster.
+type Peer struct {
+	ID   uint64 `json:"id"`
+	Addr string `json:"addr,omitempty"`
+}
+
+// Snapshot is the state machine as of an entry of the log, replacing the
+// entries up to it.
+type Snapshot struct {
+	Index   uint64 `json:"index"`
+	Term    uint64 `json:"term"`
+	Members []Peer `json:"members"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+// HardState is what a node must persist before it sends messages, so that
+// it never votes twice in a term after a restart.
+type HardState struct {
+	Term   uint64 `json:"term"`
+	Vote   uint64 `json:"vote"`
+	Commit uint64 `json:"commit"`
+}
+
+// MessageType is the kind of a message between nodes.
+type MessageType int
+
+const (
+	MsgPreVote MessageType = iota
+	MsgPreVoteResp
+	MsgVote
+	MsgVoteResp
+	MsgApp
+	MsgAppResp
+	MsgHeartbeat
+	MsgHeartbeatResp
+	MsgSnap
+)
+
+func (t MessageType) String() string {
+	names := [...]string{"MsgPreVote", "MsgPreVoteResp", "MsgVote", "MsgVoteResp", "MsgApp", "MsgAppResp", "MsgHeartbeat", "MsgHeartbeatResp", "MsgSnap"}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	return fmt.Sprintf("MessageType(%d)", int(t))
+}
+
+// Message is sent from one node to another.
+type Message struct {
+	Type MessageType `json:"type"`
+	From uint64      `json:"from"`
+	To   uint64      `json:"to"`
+	Term uint64      `json:"term"`
+	// Index and LogTerm are the entry before Entries in MsgApp and the
+	// last entry of the candidate in MsgVote and MsgPreVote. In
+	// MsgAppResp, Index is the last entry the follower now matches, or
+	// the one it rejected.
+	Index      uint64    `json:"index,omitempty"`
+	LogTerm    uint64    `json:"log_term,omitempty"`
+	Entries    []Entry   `json:"entries,omitempty"`
+	Commit     uint64    `json:"commit,omitempty"`
+	Reject     bool      `json:"reject,omitempty"`
+	RejectHint uint64    `json:"reject_hint,omitempty"` // Last index of a rejecting follower
+	Context    uint64    `json:"context,omitempty"`     // Read index round of a heartbeat
+	Snapshot   *Snapshot `json:"snapshot,omitempty"`
+}
+
+// ReadState says that a read requested with ReadIndex is linearizable
+// once the state machine has applied Index.
+type ReadState struct {
+	ID    uint64
+	Index uint64
+}
+
+// Ready is what a node needs done before it can go on: persist HardState,
+// Entries and Snapshot, then send Messages, restore Snapshot, apply
+// CommittedEntries and serve ReadStates, in that order.
+type Ready struct {
+	HardState        HardState
+	Entries          []Entry   // Replace the persisted entries from Entries[0].Index on
+	Snapshot         *Snapshot // Received from the leader
+	CommittedEntries []Entry
+	Messages         []Message
+	ReadStates       []ReadState
+}
+
+// Config configures a Node.
+type Config struct {
+	ID uint64
+	// Peers are the nodes that start a new cluster, this one among
+	// them. It is ignored if Storage holds any state. A node joining an
+	// existing cluster is added to it with ProposeConfChange; see Join.
+	Peers []Peer
+	// Join makes a node with no state wait to be added to the existing
+	// cluster of Peers rather than start a new one. A Runner sends to
+	// Peers until the node has learned the members from the leader.
+	Join bool
+	// ElectionTicks is how many ticks a follower waits to hear from a
+	// leader before it campaigns, randomized up to twice as many.
+	// HeartbeatTicks is how often a leader sends heartbeats.
+	ElectionTicks  int
+	HeartbeatTicks int
+	Storage        Storage
+	Rand           *rand.Rand // For the election timeouts; seeded from ID if nil
+}
+
+// progress is what a leader knows of a follower's log.
+type progress struct {
+	match, next uint64
+	active      bool // Heard from since the last quorum check
+}
+
+type readRequest struct {
+	id    uint64
+	index uint64
+	round uint64 // Heartbeat round that confirms it, or 0 if waiting to commit in the term
+	acks  map[uint64]bool
+}
+
+// Node is a member of a Raft cluster. Its methods are not safe for
+// concurrent use.
+type Node struct {
+	id      uint64
+	term    uint64
+	vote    uint64
+	role    Role
+	lead    uint64
+	log     *raftLog
+	members map[uint64]string // Addresses by ID
+
+	progress map[uint64]*progress // Leader only
+	votes    map[uint64]bool      // Candidate only
+	preVote  bool                 // The candidate is polling before it campaigns
+	reads    []*readRequest       // Leader only
+	round    uint64               // Last read index heartbeat round
+	confIdx  uint64               // Index of the last membership change in the log
+
+	electionTicks, heartbeatTicks int
+	electionElapsed               int
+	heartbeatElapsed              int
+	timeout                       int // Randomized election timeout
+	rand                          *rand.Rand
+
+	storage     Storage
+	msgs        []Message
+	readStates  []ReadState
+	prevHard    HardState
+	snapPending bool // log.snapshot arrived from a leader and is not persisted
+}
+
+// NewNode restores a node from cfg.Storage, or starts a new cluster of
+// cfg.Peers if it is empty.
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.ID == 0 {
+		return nil, errors.New("raft: node ID must not be zero")
+	}
+	if cfg.ElectionTicks <= 0 {
+		cfg.ElectionTicks = 10
+	}
+	if cfg.HeartbeatTicks <= 0 {
+		cfg.HeartbeatTicks = 1
+	}
+	if cfg.HeartbeatTicks >= cfg.ElectionTicks {
+		return nil, errors.New("raft: heartbeat ticks must be fewer than election ticks")
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+	if cfg.Rand == nil {
+		cfg.Rand = rand.New(rand.NewSource(int64(cfg.ID)))
+	}
+
+	n := &Node{
+		id:             cfg.ID,
+		log:            &raftLog{},
+		members:        make(map[uint64]string),
+		electionTicks:  cfg.ElectionTicks,
+		heartbeatTicks: cfg.HeartbeatTicks,
+		rand:           cfg.Rand,
+		storage:        cfg.Storage,
+	}
+
+	hs, snap, ents, err := cfg.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	if hs == (HardState{}) && snap.Index == 0 && len(ents) == 0 {
+		if !cfg.Join {
+			n.bootstrap(cfg.Peers)
+		}
+	} else {
+		n.term, n.vote = hs.Term, hs.Vote
+		n.log.restore(snap)
+		n.log.entries = ents
+		n.log.stable = n.log.lastIndex()
+		n.log.committed = max(snap.Index, min(hs.Commit, n.log.lastIndex()))
+		n.log.applied = snap.Index
+		for _, p := range snap.Members {
+			n.members[p.ID] = p.Addr
+		}
+		// The entries up to the commit index are applied to the
+		// state machine again, which brings the membership with them.
+		n.applyConfChanges(snap.Index+1, n.log.committed)
+		for _, e := range ents {
+			if e.Type == EntryConfChange {
+				n.confIdx = e.Index
+			}
+		}
+		n.prevHard = hs
+	}
+
+	n.becomeFollower(n.term, 0)
+	return n, nil
+}
+
+// bootstrap starts the log of a new cluster with an entry adding each
+// peer, committed, so that every node of the cluster starts with the same
+// log and a node that joins later learns the membership from it.
+func (n *Node) bootstrap(peers []Peer) {
+	if len(peers) == 0 {
+		return
+	}
+	peers = slices.Clone(peers)
+	slices.SortFunc(peers, func(a, b Peer) int { return cmp.Compare(a.ID, b.ID) })
+
+	n.term = 1
+	for i, p := range peers {
+		data, _ := json.Marshal(ConfChange{Type: AddNode, NodeID: p.ID, Addr: p.Addr})
+		n.log.entries = append(n.log.entries, Entry{Term: 1, Index: uint64(i + 1), Type: EntryConfChange, Data: data})
+	}
+	n.log.commitTo(uint64(len(peers)))
+	n.applyConfChanges(1, n.log.committed)
+}
+
+// Status describes a node.
+type Status struct {
+	ID      uint64 `json:"id"`
+	Term    uint64 `json:"term"`
+	Role    Role   `json:"role"`
+	Lead    uint64 `json:"lead"` // Zero if unknown
+	Commit  uint64 `json:"commit"`
+	Applied uint64 `json:"applied"`
+	Members []Peer `json:"members"`
+}
+
+func (n *Node) Status() Status {
+	return Status{
+		ID:      n.id,
+		Term:    n.term,
+		Role:    n.role,
+		Lead:    n.lead,
+		Commit:  n.log.committed,
+		Applied: n.log.applied,
+		Members: n.Members(),
+	}
+}
+
+// Members returns the members of the cluster, in order of ID.
+func (n *Node) Members() []Peer {
+	peers := make([]Peer, 0, len(n.members))
+	for _, id := range n.memberIDs() {
+		peers = append(peers, Peer{ID: id, Addr: n.members[id]})
+	}
+	return peers
+}
+
+func (n *Node) isMember(id uint64) bool {
+	_, ok := n.members[id]
+	return ok
+}
+
+// memberIDs returns the members in order, so that messages to them are
+// too.
+func (n *Node) memberIDs() []uint64 {
+	ids := make([]uint64, 0, len(n.members))
+	for id := range n.members {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (n *Node) quorum() int {
+	return len(n.members)/2 + 1
+}
+
+func (n *Node) send(m Message) {
+	m.From = n.id
+	if m.Term == 0 {
+		m.Term = n.term
+	}
+	n.msgs = append(n.msgs, m)
+}
+
+func (n *Node) resetTimers() {
+	n.electionElapsed = 0
+	n.heartbeatElapsed = 0
+	n.timeout = n.electionTicks + n.rand.Intn(n.electionTicks)
+}
+
+func (n *Node) becomeFollower(term, lead uint64) {
+	if term > n.term {
+		n.term = term
+		n.vote = 0
+	}
+	n.role = Follower
+	n.lead = lead
+	n.progress = nil
+	n.votes = nil
+	n.preVote = false
+	n.failReads()
+	n.resetTimers()
+}
+
+// becomePreCandidate polls the others on whether they would vote for
+// the node, without raising its term, so that a node that was cut off
+// does not depose a working leader when it comes back.
+func (n *Node) becomePreCandidate() {
+	n.role = Candidate
+	n.preVote = true
+	n.lead = 0
+	n.votes = map[uint64]bool{n.id: true}
+	n.resetTimers()
+}
+
+func (n *Node) becomeCandidate() {
+	n.term++
+	n.vote = n.id
+	n.role = Candidate
+	n.preVote = false
+	n.lead = 0
+	n.votes = map[uint64]bool{n.id: true}
+	n.resetTimers()
+}
+
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.lead = n.id
+	n.votes = nil
+	n.preVote = false
+	n.progress = make(map[uint64]*progress)
+	for id := range n.members {
+		n.progress[id] = &progress{next: n.log.lastIndex() + 1}
+	}
+	n.resetTimers()
+
+	// An entry of its own term lets the leader commit the entries of
+	// earlier terms, and tells it when it may serve reads.
+	n.appendEntries(Entry{})
+	n.broadcastAppend()
+}
+
+// failReads drops the reads a leader was confirming. Their callers time
+// out and retry with the new leader.
+func (n *Node) failReads() {
+	n.reads = nil
+}
+
+// Tick advances the logical clock of the node by one tick.
+func (n *Node) Tick() {
+	n.electionElapsed++
+
+	if n.role != Leader {
+		if n.electionElapsed >= n.timeout && n.isMember(n.id) {
+			n.Campaign()
+		}
+		return
+	}
+
+	n.heartbeatElapsed++
+	if n.heartbeatElapsed >= n.heartbeatTicks {
+		n.heartbeatElapsed = 0
+		n.broadcastHeartbeat(0)
+	}
+
+	// A leader that has not heard from a quorum in an election timeout
+	// may have been partitioned away, and steps down so that clients
+	// look for the leader elsewhere.
+	if n.electionElapsed >= n.electionTicks {
+		n.electionElapsed = 0
+		active := 0
+		for id, pr := range n.progress {
+			if id == n.id || pr.active {
+				active++
+			}
+			pr.active = false
+		}
+		if active < n.quorum() {
+			n.becomeFollower(n.term, 0)
+		}
+	}
+}
+
+// Campaign starts an election, as a follower does when its election
+// timeout passes without word from a leader. The election only goes
+// ahead if a quorum answers the pre-vote.
+func (n *Node) Campaign() {
+	if n.role == Leader || !n.isMember(n.id) {
+		return
+	}
+	n.becomePreCandidate()
+	n.poll(MsgPreVote, n.term+1)
+}
+
+// poll asks the other members for their vote in term, and wins at once
+// if there are none.
+func (n *Node) poll(t MessageType, term uint64) {
+	if len(n.votes) >= n.quorum() {
+		n.won()
+		return
+	}
+	for _, id := range n.memberIDs() {
+		if id != n.id {
+			n.send(Message{Type: t, To: id, Term: term, Index: n.log.lastIndex(), LogTerm: n.log.lastTerm()})
+		}
+	}
+}
+
+// won moves a candidate that got a quorum on from the pre-vote to the
+// election, and from the election to leading.
+func (n *Node) won() {
+	if !n.preVote {
+		n.becomeLeader()
+		return
+	}
+	n.becomeCandidate()
+	n.poll(MsgVote, n.term)
+}
+
+// Propose appends data to the log, if the node is the leader, returning
+// the index and term of its entry. The command is committed when the
+// entry comes out of Ready.CommittedEntries with that term.
+func (n *Node) Propose(data []byte) (index, term uint64, err error) {
+	if n.role != Leader {
+		return 0, 0, ErrNotLeader
+	}
+	e := n.appendEntries(Entry{Data: data})
+	n.broadcastAppend()
+	return e.Index, e.Term, nil
+}
+
+// ProposeConfChange proposes a membership change, like Propose.
+func (n *Node) ProposeConfChange(cc ConfChange) (index, term uint64, err error) {
+	if n.role != Leader {
+		return 0, 0, ErrNotLeader
+	}
+	if n.confIdx > n.log.committed {
+		return 0, 0, ErrConfChangePending
+	}
+	data, err := json.Marshal(cc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	e := n.appendEntries(Entry{Type: EntryConfChange, Data: data})
+	n.broadcastAppend()
+	return e.Index, e.Term, nil
+}
+
+// ReadIndex asks for a linearizable read, identified by id. Once the
+// leader has confirmed it still leads, a ReadState with the same id says
+// which entry the state machine must have applied before the read.
+func (n *Node) ReadIndex(id uint64) error {
+	if n.role != Leader {
+		return ErrNotLeader
+	}
+
+	req := &readRequest{id: id, acks: map[uint64]bool{n.id: true}}
+	n.reads = append(n.reads, req)
+	if t, _ := n.log.term(n.log.committed); t == n.term {
+		n.confirmRead(req)
+	}
+	// Otherwise the commit index may be behind entries of earlier
+	// leaders, and the read waits for the first entry of this term.
+	return nil
+}
+
+// confirmRead starts a round of heartbeats to check that the node still
+// leads as of the commit index.
+func (n *Node) confirmRead(req *readRequest) {
+	req.index = n.log.committed
+	n.round++
+	req.round = n.round
+	if len(req.acks) >= n.quorum() {
+		n.releaseReads()
+		return
+	}
+	n.broadcastHeartbeat(req.round)
+}
+
+// releaseReads hands out the reads, in order, that a quorum confirmed.
+func (n *Node) releaseReads() {
+	for len(n.reads) > 0 {
+		req := n.reads[0]
+		if req.round == 0 || len(req.acks) < n.quorum() {
+			return
+		}
+		n.readStates = append(n.readStates, ReadState{ID: req.id, Index: req.index})
+		n.reads = n.reads[1:]
+	}
+}
+
+// appendEntries adds e to the log of the leader and returns it with its
+// index and term.
+func (n *Node) appendEntries(e Entry) Entry {
+	e.Term = n.term
+	e.Index = n.log.lastIndex() + 1
+	if e.Type == EntryConfChange {
+		n.confIdx = e.Index
+	}
+	n.log.entries = append(n.log.entries, e)
+
+	if pr := n.progress[n.id]; pr != nil {
+		pr.match = e.Index
+		pr.next = e.Index + 1
+	}
+	n.maybeCommit()
+	return e
+}
+
+func (n *Node) broadcastAppend() {
+	for _, id := range n.memberIDs() {
+		if id != n.id {
+			n.sendAppend(id)
+		}
+	}
+}
+
+func (n *Node) broadcastHeartbeat(round uint64) {
+	for _, id := range n.memberIDs() {
+		if id == n.id {
+			continue
+		}
+		pr := n.progress[id]
+		n.send(Message{Type: MsgHeartbeat, To: id, Commit: min(pr.match, n.log.committed), Context: round})
+	}
+}
+
+// sendAppend sends a follower the entries from its next index, or the
+// snapshot if they have been compacted away. The next index is moved
+// past what was sent, so that appends can be pipelined.
+func (n *Node) sendAppend(to uint64) {
+	pr := n.progress[to]
+	if pr == nil {
+		return
+	}
+
+	prev := pr.next - 1
+	prevTerm, ok := n.log.term(prev)
+	if !ok {
+		if n.log.snapshot.Data == nil {
+			// The data has not been kept; it cannot be sent until
+			// the next compaction.
+			return
+		}
+		snap := n.log.snapshot
+		n.send(Message{Type: MsgSnap, To: to, Snapshot: &snap})
+		pr.next = snap.Index + 1
+		return
+	}
+
+	ents := n.log.slice(pr.next, n.log.lastIndex()+1, maxMsgEntries)
+	n.send(Message{Type: MsgApp, To: to, Index: prev, LogTerm: prevTerm, Entries: ents, Commit: n.log.committed})
+	if len(ents) > 0 {
+		pr.next = ents[len(ents)-1].Index + 1
+	}
+}
+
+// maybeCommit commits the highest entry of the current term that a
+// quorum has.
+func (n *Node) maybeCommit() {
+	if n.role != Leader {
+		return
+	}
+
+	matches := make([]uint64, 0, len(n.members))
+	for id := range n.members {
+		if pr := n.progress[id]; pr != nil {
+			matches = append(matches, pr.match)
+		}
+	}
+	if len(matches) < n.quorum() {
+		return
+	}
+	slices.Sort(matches)
+	slices.Reverse(matches)
+	index := matches[n.quorum()-1]
+
+	if t, _ := n.log.term(index); t != n.term || !n.commitTo(index) {
+		return
+	}
+
+	// The first commit of the term lets waiting reads go ahead.
+	for _, req := range n.reads {
+		if req.round == 0 {
+			n.confirmRead(req)
+		}
+	}
+	n.broadcastAppend()
+}
+
+// commitTo raises the commit index, applying the membership changes it
+// commits.
+func (n *Node) commitTo(index uint64) bool {
+	prev := n.log.committed
+	if !n.log.commitTo(index) {
+		return false
+	}
+	n.applyConfChanges(prev+1, n.log.committed)
+	return true
+}
+
+// applyConfChanges applies the membership changes in the entries from lo
+// to hi, which have been committed.
+func (n *Node) applyConfChanges(lo, hi uint64) {
+	for i := max(lo, n.log.firstIndex()); i <= hi; i++ {
+		e := n.log.entries[i-n.log.firstIndex()]
+		if e.Type != EntryConfChange {
+			continue
+		}
+		var cc ConfChange
+		if err := json.Unmarshal(e.Data, &cc); err != nil {
+			continue
+		}
+		n.applyConfChange(cc)
+	}
+}
+
+func (n *Node) applyConfChange(cc ConfChange) {
+	switch cc.Type {
+	case AddNode:
+		n.members[cc.NodeID] = cc.Addr
+		if n.role == Leader && n.progress[cc.NodeID] == nil {
+			n.progress[cc.NodeID] = &progress{next: n.log.lastIndex() + 1, active: true}
+		}
+	case RemoveNode:
+		delete(n.members, cc.NodeID)
+		if n.role != Leader {
+			return
+		}
+		delete(n.progress, cc.NodeID)
+		if cc.NodeID == n.id {
+			// Tell the others of the commit before going.
+			n.broadcastAppend()
+			n.becomeFollower(n.term, 0)
+			return
+		}
+		// A smaller quorum may commit more.
+		n.maybeCommit()
+	}
+}
+
+// Step handles a message from another node.
+func (n *Node) Step(m Message) error {
+	fromLeader := m.Type == MsgApp || m.Type == MsgHeartbeat || m.Type == MsgSnap
+
+	switch {
+	case m.Term > n.term:
+		if (m.Type == MsgVote || m.Type == MsgPreVote) && n.lead != 0 && n.electionElapsed < n.electionTicks {
+			// A leader was heard from within the election timeout,
+			// so the candidate is the one that lost touch.
+			return nil
+		}
+		if m.Type == MsgPreVote || (m.Type == MsgPreVoteResp && !m.Reject) {
+			// The term of a pre-vote is the one the candidate would
+			// campaign in, which nobody is in yet.
+			break
+		}
+		lead := uint64(0)
+		if fromLeader {
+			lead = m.From
+		}
+		n.becomeFollower(m.Term, lead)
+	case m.Term < n.term:
+		// A stale leader or candidate learns of the new term from
+		// the response.
+		if fromLeader {
+			n.send(Message{Type: MsgAppResp, To: m.From})
+		} else if m.Type == MsgPreVote {
+			n.send(Message{Type: MsgPreVoteResp, To: m.From, Reject: true})
+		}
+		return nil
+	}
+
+	switch m.Type {
+	case MsgPreVote, MsgVote:
+		n.handleVote(m)
+	case MsgPreVoteResp, MsgVoteResp:
+		n.handleVoteResp(m)
+	case MsgApp:
+		n.handleFromLeader(m)
+		n.handleAppend(m)
+	case MsgHeartbeat:
+		n.handleFromLeader(m)
+		n.commitTo(m.Commit)
+		n.send(Message{Type: MsgHeartbeatResp, To: m.From, Context: m.Context})
+	case MsgSnap:
+		n.handleFromLeader(m)
+		n.handleSnapshot(m)
+	case MsgAppResp:
+		n.handleAppendResp(m)
+	case MsgHeartbeatResp:
+		n.handleHeartbeatResp(m)
+	default:
+		return fmt.Errorf("raft: unknown message type %v", m.Type)
+	}
+	return nil
+}
+
+func (n *Node) handleVote(m Message) {
+	resp := MsgVoteResp
+	if m.Type == MsgPreVote {
+		resp = MsgPreVoteResp
+	}
+
+	canVote := n.vote == m.From || (n.vote == 0 && n.lead == 0) ||
+		(m.Type == MsgPreVote && m.Term > n.term)
+	if !canVote || !n.log.isUpToDate(m.Index, m.LogTerm) {
+		n.send(Message{Type: resp, To: m.From, Reject: true})
+		return
+	}
+
+	if m.Type == MsgVote {
+		n.vote = m.From
+		n.resetTimers()
+	}
+	n.send(Message{Type: resp, To: m.From, Term: m.Term})
+}
+
+func (n *Node) handleVoteResp(m Message) {
+	if n.role != Candidate || m.Reject || n.preVote != (m.Type == MsgPreVoteResp) {
+		return
+	}
+	n.votes[m.From] = true
+
+	granted := 0
+	for id := range n.votes {
+		if n.isMember(id) {
+			granted++
+		}
+	}
+	if granted >= n.quorum() {
+		n.won()
+	}
+}
+
+// handleFromLeader notes that m came from the leader of the current term.
+func (n *Node) handleFromLeader(m Message) {
+	if n.role != Follower {
+		n.becomeFollower(m.Term, m.From)
+	}
+	n.lead = m.From
+	n.electionElapsed = 0
+}
+
+func (n *Node) handleAppend(m Message) {
+	if m.Index < n.log.committed {
+		// Already committed here; say so, and the leader moves on.
+		n.send(Message{Type: MsgAppResp, To: m.From, Index: n.log.committed})
+		return
+	}
+	if !n.log.matchTerm(m.Index, m.LogTerm) {
+		n.send(Message{Type: MsgAppResp, To: m.From, Index: m.Index, Reject: true, RejectHint: n.log.lastIndex()})
+		return
+	}
+
+	last := n.log.append(m.Index, m.Entries)
+	for _, e := range m.Entries {
+		if e.Type == EntryConfChange {
+			n.confIdx = max(n.confIdx, e.Index)
+		}
+	}
+	n.commitTo(min(m.Commit, last))
+	n.send(Message{Type: MsgAppResp, To: m.From, Index: last})
+}
+
+func (n *Node) handleSnapshot(m Message) {
+	snap := *m.Snapshot
+	if snap.Index <= n.log.committed {
+		n.send(Message{Type: MsgAppResp, To: m.From, Index: n.log.committed})
+		return
+	}
+
+	n.log.restore(snap)
+	n.members = make(map[uint64]string)
+	for _, p := range snap.Members {
+		n.members[p.ID] = p.Addr
+	}
+	n.snapPending = true
+	n.send(Message{Type: MsgAppResp, To: m.From, Index: snap.Index})
+}
+
+func (n *Node) handleAppendResp(m Message) {
+	pr := n.progress[m.From]
+	if n.role != Leader || pr == nil {
+		return
+	}
+	pr.active = true
+
+	if m.Reject {
+		if m.Index < pr.match {
+			return // Stale
+		}
+		pr.next = max(pr.match+1, min(m.Index, m.RejectHint+1))
+		n.sendAppend(m.From)
+		return
+	}
+
+	if m.Index > pr.match {
+		pr.match = m.Index
+		pr.next = max(pr.next, m.Index+1)
+		n.maybeCommit()
+	}
+	if pr.next <= n.log.lastIndex() {
+		n.sendAppend(m.From)
+	}
+}
+
+func (n *Node) handleHeartbeatResp(m Message) {
+	pr := n.progress[m.From]
+	if n.role != Leader || pr == nil {
+		return
+	}
+	pr.active = true
+
+	if pr.match < n.log.lastIndex() {
+		// The follower may have missed appends; resend from what it
+		// is known to have.
+		pr.next = pr.match + 1
+		n.sendAppend(m.From)
+	}
+
+	if m.Context == 0 {
+		return
+	}
+	for _, req := range n.reads {
+		if req.round != 0 && req.round <= m.Context {
+			req.acks[m.From] = true
+		}
+	}
+	n.releaseReads()
+}
+
+// HasReady reports whether Ready has anything to do.
+func (n *Node) HasReady() bool {
+	return n.hardState() != n.prevHard || n.snapPending || len(n.msgs) > 0 ||
+		len(n.log.unstable()) > 0 || len(n.log.nextCommitted()) > 0 || len(n.readStates) > 0
+}
+
+func (n *Node) hardState() HardState {
+	return HardState{Term: n.term, Vote: n.vote, Commit: n.log.committed}
+}
+
+// Ready returns what needs doing, which must be done before Advance.
+func (n *Node) Ready() Ready {
+	rd := Ready{
+		HardState:        n.hardState(),
+		Entries:          n.log.unstable(),
+		CommittedEntries: n.log.nextCommitted(),
+		Messages:         n.msgs,
+		ReadStates:       n.readStates,
+	}
+	if n.snapPending {
+		snap := n.log.snapshot
+		rd.Snapshot = &snap
+		// The entries are only handed out once persisted, after the
+		// snapshot they follow.
+		rd.CommittedEntries = nil
+	}
+	return rd
+}
+
+// Advance records that rd has been done.
+func (n *Node) Advance(rd Ready) {
+	n.prevHard = rd.HardState
+	if rd.Snapshot != nil {
+		n.snapPending = false
+		n.log.applied = max(n.log.applied, rd.Snapshot.Index)
+		n.log.stable = max(n.log.stable, rd.Snapshot.Index)
+	}
+	if len(rd.Entries) > 0 {
+		last := rd.Entries[len(rd.Entries)-1]
+		if n.log.matchTerm(last.Index, last.Term) {
+			n.log.stable = max(n.log.stable, last.Index)
+		}
+	}
+	if len(rd.CommittedEntries) > 0 {
+		n.log.applied = rd.CommittedEntries[len(rd.CommittedEntries)-1].Index
+	}
+	n.msgs = n.msgs[len(rd.Messages):]
+	n.readStates = n.readStates[len(rd.ReadStates):]
+}
+
+// Compact replaces the log up to the applied entry index with a snapshot
+// of the state machine as of it, and persists the snapshot.
+func (n *Node) Compact(index uint64, data []byte) error {
+	if index <= n.log.snapshot.Index || index > n.log.applied {
+		return ErrCompacted
+	}
+	term, _ := n.log.term(index)
+
+	snap := Snapshot{Index: index, Term: term, Members: n.membersAt(index), Data: data}
+	if err := n.storage.Compact(snap); err != nil {
+		return err
+	}
+	n.log.compact(snap)
+	return nil
+}
+
+// membersAt returns the membership as of the entry at index, which must
+// be in the log.
+func (n *Node) membersAt(index uint64) []Peer {
+	members := make(map[uint64]string)
+	for _, p := range n.log.snapshot.Members {
+		members[p.ID] = p.Addr
+	}
+	for _, e := range n.log.slice(n.log.firstIndex(), index+1, len(n.log.entries)) {
+		var cc ConfChange
+		if e.Type != EntryConfChange || json.Unmarshal(e.Data, &cc) != nil {
+			continue
+		}
+		if cc.Type == AddNode {
+			members[cc.NodeID] = cc.Addr
+		} else {
+			delete(members, cc.NodeID)
+		}
+	}
+
+	peers := make([]Peer, 0, len(members))
+	for id, addr := range members {
+		peers = append(peers, Peer{ID: id, Addr: addr})
+	}
+	slices.SortFunc(peers, func(a, b Peer) int { return cmp.Compare(a.ID, b.ID) })
+	return peers
+}
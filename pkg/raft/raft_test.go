@@ -0,0 +1,401 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestElection(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	leaders := 0
+	for _, id := range nw.ids() {
+		st := nw.nodes[id].Status()
+		if st.Role == Leader {
+			leaders++
+		}
+		if st.Term != lead.Status().Term {
+			t.Errorf("node %d in term %d, leader in %d", id, st.Term, lead.Status().Term)
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("got %d leaders want 1", leaders)
+	}
+}
+
+func TestSingleNodeCluster(t *testing.T) {
+	nw := newNetwork(t, 1)
+	lead := nw.leader()
+
+	if err := nw.propose(lead.id, "a"); err != nil {
+		t.Fatal(err)
+	}
+	nw.checkApplied([]string{"a"})
+}
+
+func TestLogReplication(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3, 4, 5)
+	lead := nw.leader()
+
+	var want []string
+	for i := range 10 {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		if err := nw.propose(lead.id, cmd); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, cmd)
+	}
+	nw.tick(1) // Heartbeats carry the last commit index
+	nw.checkApplied(want)
+}
+
+func TestProposeToFollower(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	for _, id := range nw.ids() {
+		if id == lead.id {
+			continue
+		}
+		if err := nw.propose(id, "x"); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("got %v want ErrNotLeader", err)
+		}
+		if got := nw.nodes[id].Status().Lead; got != lead.id {
+			t.Errorf("node %d thinks %d leads, want %d", id, got, lead.id)
+		}
+	}
+}
+
+func TestCommitNeedsQuorum(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3, 4, 5)
+	old := nw.leader()
+	nw.propose(old.id, "before")
+
+	// The old leader keeps one follower, which is not a quorum of five.
+	minority := []uint64{old.id}
+	var majority []uint64
+	for _, id := range nw.ids() {
+		if id == old.id {
+			continue
+		}
+		if len(minority) < 2 {
+			minority = append(minority, id)
+		} else {
+			majority = append(majority, id)
+		}
+	}
+	nw.partition(minority, majority)
+
+	if err := nw.propose(old.id, "lost"); err != nil {
+		t.Fatal(err)
+	}
+	nw.tick(2)
+	if got := old.Status().Commit; slices.Contains(old.applied, "lost") {
+		t.Fatalf("entry committed at %d without a quorum", got)
+	}
+
+	lead := nw.leader(majority...)
+	if err := nw.propose(lead.id, "after"); err != nil {
+		t.Fatal(err)
+	}
+	nw.tick(1)
+	nw.checkApplied([]string{"before", "after"}, majority...)
+
+	// The old leader gives up its uncommitted entry when it rejoins.
+	nw.heal()
+	nw.leader()
+	nw.tick(5)
+	nw.checkApplied([]string{"before", "after"})
+}
+
+func TestLeaderStepsDownWithoutQuorum(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	nw.isolate(lead.id)
+	nw.tick(2 * lead.electionTicks)
+	if lead.Status().Role == Leader {
+		t.Error("isolated leader still leads")
+	}
+	if err := nw.propose(lead.id, "x"); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("got %v want ErrNotLeader", err)
+	}
+}
+
+func TestRejoiningNodeDoesNotDisrupt(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+	term := lead.Status().Term
+
+	var follower uint64
+	for _, id := range nw.ids() {
+		if id != lead.id {
+			follower = id
+			break
+		}
+	}
+
+	// Cut off, the follower campaigns over and over, but the pre-vote
+	// keeps it from raising its term.
+	nw.isolate(follower)
+	nw.tick(100)
+	if got := nw.nodes[follower].Status().Term; got != term {
+		t.Errorf("isolated follower moved from term %d to %d", term, got)
+	}
+
+	nw.heal()
+	nw.tick(5)
+	if st := lead.Status(); st.Role != Leader || st.Term != term {
+		t.Errorf("leader deposed by a rejoining node: %+v", st)
+	}
+}
+
+func TestLeaderCrashAndRestart(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	old := nw.leader()
+	nw.propose(old.id, "a")
+	nw.tick(1)
+
+	nw.crash(old.id)
+	var others []uint64
+	for _, id := range nw.ids() {
+		if id != old.id {
+			others = append(others, id)
+		}
+	}
+	lead := nw.leader(others...)
+	nw.propose(lead.id, "b")
+
+	// The restarted node replays its log and catches up.
+	restarted := nw.restart(old.id)
+	if restarted.Status().Term < old.Status().Term {
+		t.Errorf("restarted in term %d, before the crash it was %d", restarted.Status().Term, old.Status().Term)
+	}
+	nw.tick(5)
+	nw.checkApplied([]string{"a", "b"})
+}
+
+func TestReadIndex(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+	nw.propose(lead.id, "a")
+
+	if err := lead.ReadIndex(7); err != nil {
+		t.Fatal(err)
+	}
+	nw.process(lead.id)
+	nw.deliver()
+
+	if len(lead.reads) != 1 {
+		t.Fatalf("got reads %v want one", lead.reads)
+	}
+	if rs := lead.reads[0]; rs.ID != 7 || rs.Index != lead.Status().Commit {
+		t.Errorf("got %+v want ID 7 at the commit index %d", rs, lead.Status().Commit)
+	}
+
+	for _, id := range nw.ids() {
+		if id != lead.id {
+			if err := nw.nodes[id].ReadIndex(8); !errors.Is(err, ErrNotLeader) {
+				t.Errorf("got %v want ErrNotLeader", err)
+			}
+		}
+	}
+}
+
+func TestReadIndexNeedsQuorum(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	// A leader that lost its followers may not know it has been
+	// replaced, so it must not answer reads.
+	nw.isolate(lead.id)
+	if err := lead.ReadIndex(1); err != nil {
+		t.Fatal(err)
+	}
+	nw.process(lead.id)
+	nw.deliver()
+	nw.tick(2 * lead.electionTicks)
+
+	if len(lead.reads) != 0 {
+		t.Errorf("isolated leader confirmed reads %v", lead.reads)
+	}
+}
+
+func TestSnapshotCatchesUpFollower(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	var lagging uint64
+	for _, id := range nw.ids() {
+		if id != lead.id {
+			lagging = id
+			break
+		}
+	}
+	nw.isolate(lagging)
+
+	var want []string
+	for i := range 20 {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		nw.propose(lead.id, cmd)
+		want = append(want, cmd)
+	}
+	nw.tick(1)
+
+	// Compacting away what the lagging follower is missing leaves a
+	// snapshot as the only way to catch it up.
+	for _, id := range nw.ids() {
+		if id == lagging {
+			continue
+		}
+		tn := nw.nodes[id]
+		if err := tn.Compact(tn.Status().Applied, tn.snapshot()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lead.Compact(lead.Status().Applied, lead.snapshot()); !errors.Is(err, ErrCompacted) {
+		t.Errorf("compacting twice: got %v want ErrCompacted", err)
+	}
+
+	nw.heal()
+	nw.tick(5)
+	nw.checkApplied(want)
+
+	_, snap, _, _ := nw.nodes[lagging].storage.Load()
+	if snap.Index == 0 || len(snap.Members) != 3 {
+		t.Errorf("lagging follower persisted snapshot %+v", snap)
+	}
+}
+
+func TestAddNode(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+	nw.propose(lead.id, "a")
+
+	nw.add(4)
+	if err := nw.confChange(lead.id, ConfChange{Type: AddNode, NodeID: 4, Addr: "node-4"}); err != nil {
+		t.Fatal(err)
+	}
+	nw.propose(lead.id, "b")
+	nw.tick(5)
+
+	nw.checkApplied([]string{"a", "b"})
+	members := nw.nodes[4].Status().Members
+	if len(members) != 4 || members[3] != (Peer{ID: 4, Addr: "node-4"}) {
+		t.Errorf("new node sees members %v", members)
+	}
+
+	// With four members a quorum is three, so losing two stalls writes.
+	nw.crash(lead.id)
+	var others []uint64
+	for _, id := range nw.ids() {
+		if id != lead.id {
+			others = append(others, id)
+		}
+	}
+	next := nw.leader(others...)
+	for _, id := range others {
+		if id != next.id {
+			nw.crash(id)
+			break
+		}
+	}
+	nw.propose(next.id, "stalled")
+	nw.tick(1)
+	if slices.Contains(next.applied, "stalled") {
+		t.Error("committed without a quorum of the new membership")
+	}
+}
+
+func TestRemoveLeader(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	if err := nw.confChange(lead.id, ConfChange{Type: RemoveNode, NodeID: lead.id}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.confChange(lead.id, ConfChange{Type: AddNode, NodeID: 9}); err == nil {
+		t.Error("removed leader accepted another change")
+	}
+
+	var others []uint64
+	for _, id := range nw.ids() {
+		if id != lead.id {
+			others = append(others, id)
+		}
+	}
+	next := nw.leader(others...)
+	if len(next.Status().Members) != 2 {
+		t.Errorf("got members %v want two", next.Status().Members)
+	}
+
+	// The removed node no longer campaigns, and the rest commit alone.
+	nw.propose(next.id, "a")
+	nw.tick(3 * lead.electionTicks)
+	if lead.Status().Role != Follower {
+		t.Errorf("removed node is %v", lead.Status().Role)
+	}
+	nw.checkApplied([]string{"a"}, others...)
+}
+
+func TestOneConfChangeAtATime(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3)
+	lead := nw.leader()
+
+	nw.isolate(lead.id) // So the first change cannot commit
+	if err := nw.confChange(lead.id, ConfChange{Type: AddNode, NodeID: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.confChange(lead.id, ConfChange{Type: AddNode, NodeID: 5}); !errors.Is(err, ErrConfChangePending) {
+		t.Errorf("got %v want ErrConfChangePending", err)
+	}
+}
+
+func TestLossyNetworkConverges(t *testing.T) {
+	nw := newNetwork(t, 1, 2, 3, 4, 5)
+	nw.dropRate = 0.2
+
+	var want []string
+	for i := 0; len(want) < 10; i++ {
+		lead := nw.leader()
+		cmd := fmt.Sprintf("cmd-%d", i)
+		if nw.propose(lead.id, cmd) == nil {
+			want = append(want, cmd)
+		}
+		nw.tick(1)
+	}
+
+	nw.dropRate = 0
+	nw.tick(20)
+
+	// Entries proposed to a leader that was then replaced may be lost,
+	// but every node applies the same ones in the same order.
+	first := nw.nodes[1].applied
+	for _, cmd := range first {
+		if !slices.Contains(want, cmd) {
+			t.Errorf("applied %q which was never proposed", cmd)
+		}
+	}
+	nw.checkApplied(first)
+}
+
+func TestNetworkIsDeterministic(t *testing.T) {
+	run := func() []string {
+		nw := newNetwork(t, 1, 2, 3)
+		nw.dropRate = 0.1
+		lead := nw.leader()
+		nw.propose(lead.id, "a")
+		nw.partition([]uint64{lead.id})
+		nw.tick(30)
+		nw.heal()
+		nw.tick(10)
+		return nw.trace
+	}
+
+	if a, b := run(), run(); !slices.Equal(a, b) {
+		t.Errorf("two runs delivered different messages: %d and %d", len(a), len(b))
+	}
+}
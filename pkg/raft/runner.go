@@ -0,0 +1,444 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTickInterval    = 100 * time.Millisecond
+	defaultSnapshotEntries = 10000
+)
+
+var (
+	// ErrProposalDropped is returned by Runner.Propose when a new leader
+	// overwrote the entry of the proposal before it was committed. The
+	// command was not applied, and may be proposed again.
+	ErrProposalDropped = errors.New("raft: proposal dropped by a new leader")
+	// ErrStopped is returned by a Runner once Run has returned.
+	ErrStopped = errors.New("raft: node stopped")
+)
+
+// StateMachine is what a Runner replicates. Apply is called with every
+// committed command, in the same order on every node.
+type StateMachine interface {
+	// Apply applies a command. Its result is returned by the
+	// Runner.Propose that proposed it, on the node that did.
+	Apply(data []byte) any
+	// Snapshot returns the state as of the last command applied.
+	Snapshot() ([]byte, error)
+	// Restore replaces the state with a snapshot.
+	Restore(data []byte) error
+}
+
+// Transport carries messages between the nodes of a cluster. Send must
+// not block; a message that cannot be delivered is dropped, and Raft
+// sends it again.
+type Transport interface {
+	Send(msgs []Message)
+	// AddPeer and RemovePeer tell the transport where the other members
+	// are, as the membership changes.
+	AddPeer(id uint64, addr string)
+	RemovePeer(id uint64)
+}
+
+// Runner drives a Node in a real cluster: it ticks it on a clock,
+// persists and sends what it has ready, applies committed commands to a
+// StateMachine and snapshots it every so often. Its methods are safe for
+// concurrent use.
+type Runner struct {
+	mu        sync.Mutex
+	node      *Node
+	storage   Storage
+	sm        StateMachine
+	transport Transport
+	peers     map[uint64]string // Known to the transport
+	seeds     []Peer            // Config.Peers, until the node learns the members
+
+	tickInterval    time.Duration
+	snapshotEntries uint64
+	snapIndex       uint64 // Of the last snapshot
+
+	proposals map[uint64]*proposal // By index
+	reads     map[uint64]*read     // By ID
+	nextRead  uint64
+	applied   uint64
+	err       error // Why the node stopped, once it has
+	wake      chan struct{}
+}
+
+type proposal struct {
+	term uint64
+	done chan proposalResult
+}
+
+type proposalResult struct {
+	result any
+	err    error
+}
+
+type read struct {
+	index     uint64 // Known once the leader confirmed it
+	confirmed bool
+	done      chan error
+}
+
+// NewRunner restores the node in cfg from its storage and sm from the
+// snapshot there. The commands after the snapshot are applied again once
+// Run starts.
+func NewRunner(cfg Config, sm StateMachine, transport Transport) (*Runner, error) {
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+	_, snap, _, err := cfg.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	if snap.Data != nil {
+		if err := sm.Restore(snap.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	node, err := NewNode(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{
+		node:            node,
+		storage:         cfg.Storage,
+		sm:              sm,
+		transport:       transport,
+		peers:           make(map[uint64]string),
+		seeds:           cfg.Peers,
+		tickInterval:    defaultTickInterval,
+		snapshotEntries: defaultSnapshotEntries,
+		snapIndex:       snap.Index,
+		proposals:       make(map[uint64]*proposal),
+		reads:           make(map[uint64]*read),
+		applied:         snap.Index,
+		wake:            make(chan struct{}, 1),
+	}
+	r.syncPeers()
+	return r, nil
+}
+
+// WithTickInterval sets how long a tick of the node lasts, and so the
+// election timeout and heartbeat interval of Config.
+func (r *Runner) WithTickInterval(d time.Duration) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tickInterval = d
+	return r
+}
+
+// WithSnapshotEntries sets how many commands are applied between
+// snapshots, after which the log before them is discarded.
+func (r *Runner) WithSnapshotEntries(n uint64) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.snapshotEntries = n
+	return r
+}
+
+// Run ticks the node and does what it has ready until ctx is done, or
+// until persisting its state fails, which is returned.
+func (r *Runner) Run(ctx context.Context) error {
+	r.mu.Lock()
+	ticker := time.NewTicker(r.tickInterval)
+	r.mu.Unlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.stop(ErrStopped)
+			return nil
+		case <-ticker.C:
+			r.mu.Lock()
+			r.node.Tick()
+			r.mu.Unlock()
+		case <-r.wake:
+		}
+
+		if err := r.process(); err != nil {
+			r.stop(err)
+			return err
+		}
+	}
+}
+
+// signal tells Run that the node may have something ready.
+func (r *Runner) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop fails everything still waiting on the node with err.
+func (r *Runner) stop(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+	for index, p := range r.proposals {
+		p.done <- proposalResult{err: err}
+		delete(r.proposals, index)
+	}
+	r.failReads(err)
+}
+
+// Step hands the node a message from another node.
+func (r *Runner) Step(m Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.node.Step(m); err != nil {
+		return err
+	}
+	r.signal()
+	return nil
+}
+
+// Propose proposes a command and waits until it is applied, returning
+// the result of StateMachine.Apply. If ctx is done first the command may
+// still be applied later.
+func (r *Runner) Propose(ctx context.Context, data []byte) (any, error) {
+	return r.propose(ctx, func() (uint64, uint64, error) {
+		return r.node.Propose(data)
+	})
+}
+
+// ProposeConfChange proposes a membership change and waits until it is
+// applied, like Propose.
+func (r *Runner) ProposeConfChange(ctx context.Context, cc ConfChange) error {
+	_, err := r.propose(ctx, func() (uint64, uint64, error) {
+		return r.node.ProposeConfChange(cc)
+	})
+	return err
+}
+
+func (r *Runner) propose(ctx context.Context, propose func() (uint64, uint64, error)) (any, error) {
+	r.mu.Lock()
+	if r.err != nil {
+		r.mu.Unlock()
+		return nil, r.err
+	}
+	index, term, err := propose()
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	p := &proposal{term: term, done: make(chan proposalResult, 1)}
+	if old := r.proposals[index]; old != nil {
+		// A new leader is reusing the index of an entry it overwrote.
+		old.done <- proposalResult{err: ErrProposalDropped}
+	}
+	r.proposals[index] = p
+	r.mu.Unlock()
+	r.signal()
+
+	select {
+	case res := <-p.done:
+		return res.result, res.err
+	case <-ctx.Done():
+		r.mu.Lock()
+		if r.proposals[index] == p {
+			delete(r.proposals, index)
+		}
+		r.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// ReadBarrier waits until the state machine is current enough for a
+// linearizable read: the leader has confirmed with a quorum that it
+// still leads, and has applied everything committed before the call. It
+// fails with ErrNotLeader on any other node, or if the node stops
+// leading before the read is confirmed.
+func (r *Runner) ReadBarrier(ctx context.Context) error {
+	r.mu.Lock()
+	if r.err != nil {
+		r.mu.Unlock()
+		return r.err
+	}
+	r.nextRead++
+	id := r.nextRead
+	if err := r.node.ReadIndex(id); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	rd := &read{done: make(chan error, 1)}
+	r.reads[id] = rd
+	r.mu.Unlock()
+	r.signal()
+
+	select {
+	case err := <-rd.done:
+		return err
+	case <-ctx.Done():
+		r.mu.Lock()
+		delete(r.reads, id)
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Status describes the node.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.node.Status()
+}
+
+// process does what the node has ready: persist, send, restore, apply and
+// release reads, in the order Ready asks for. The lock is held
+// throughout, so nothing reaches the node between Ready and Advance.
+func (r *Runner) process() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.node.HasReady() {
+		rd := r.node.Ready()
+
+		if rd.Snapshot != nil {
+			if err := r.storage.ApplySnapshot(*rd.Snapshot); err != nil {
+				return err
+			}
+		}
+		if err := r.storage.Save(rd.HardState, rd.Entries); err != nil {
+			return err
+		}
+		r.syncPeers()
+		r.transport.Send(rd.Messages)
+
+		if rd.Snapshot != nil {
+			if err := r.sm.Restore(rd.Snapshot.Data); err != nil {
+				return err
+			}
+			r.applied = rd.Snapshot.Index
+			r.snapIndex = rd.Snapshot.Index
+			// Whether the proposals the snapshot covers were
+			// committed is not known; their callers time out.
+			for index := range r.proposals {
+				if index <= rd.Snapshot.Index {
+					delete(r.proposals, index)
+				}
+			}
+		}
+		for _, e := range rd.CommittedEntries {
+			r.apply(e)
+		}
+		for _, rs := range rd.ReadStates {
+			if rd := r.reads[rs.ID]; rd != nil {
+				rd.index, rd.confirmed = rs.Index, true
+			}
+		}
+		r.releaseReads()
+		r.node.Advance(rd)
+	}
+
+	if r.node.role != Leader {
+		r.failReads(ErrNotLeader)
+	}
+	return r.maybeCompact()
+}
+
+// apply applies a committed entry and answers its proposal, if it was
+// made here. The caller must hold r.mu.
+func (r *Runner) apply(e Entry) {
+	var result any
+	if e.Type == EntryNormal && len(e.Data) > 0 {
+		result = r.sm.Apply(e.Data)
+	}
+	r.applied = e.Index
+
+	p := r.proposals[e.Index]
+	if p == nil {
+		return
+	}
+	delete(r.proposals, e.Index)
+	if p.term != e.Term {
+		p.done <- proposalResult{err: ErrProposalDropped}
+		return
+	}
+	p.done <- proposalResult{result: result}
+}
+
+// releaseReads lets go the confirmed reads whose index has been applied.
+// The caller must hold r.mu.
+func (r *Runner) releaseReads() {
+	for id, rd := range r.reads {
+		if rd.confirmed && rd.index <= r.applied {
+			rd.done <- nil
+			delete(r.reads, id)
+		}
+	}
+}
+
+// failReads fails the reads not yet confirmed, which the node has
+// forgotten. The caller must hold r.mu.
+func (r *Runner) failReads(err error) {
+	for id, rd := range r.reads {
+		if !rd.confirmed || r.err != nil {
+			rd.done <- err
+			delete(r.reads, id)
+		}
+	}
+}
+
+// maybeCompact snapshots the state machine once enough commands have
+// been applied since the last snapshot. The caller must hold r.mu.
+func (r *Runner) maybeCompact() error {
+	if r.snapshotEntries == 0 || r.applied < r.snapIndex+r.snapshotEntries {
+		return nil
+	}
+	data, err := r.sm.Snapshot()
+	if err != nil {
+		return err
+	}
+	if err := r.node.Compact(r.applied, data); err != nil {
+		return err
+	}
+	r.snapIndex = r.applied
+	return nil
+}
+
+// syncPeers tells the transport of changes to the membership. A node
+// joining a cluster knows no members until the leader's log reaches it,
+// so until then it talks to the peers it was configured with. The caller
+// must hold r.mu.
+func (r *Runner) syncPeers() {
+	peers := r.node.Members()
+	if len(peers) == 0 {
+		peers = r.seeds
+	}
+	members := make(map[uint64]string)
+	for _, p := range peers {
+		if p.ID != r.node.id {
+			members[p.ID] = p.Addr
+		}
+	}
+	for id, addr := range members {
+		if known, ok := r.peers[id]; !ok || known != addr {
+			r.transport.AddPeer(id, addr)
+			r.peers[id] = addr
+		}
+	}
+	for id := range r.peers {
+		if _, ok := members[id]; !ok {
+			r.transport.RemovePeer(id)
+			delete(r.peers, id)
+		}
+	}
+}
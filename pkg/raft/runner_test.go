@@ -0,0 +1,267 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hub is a Transport between Runners in one process. Each node has a
+// queue delivered in order by its own goroutine, so that Send never
+// blocks on a busy node.
+type hub struct {
+	mu     sync.Mutex
+	queues map[uint64]chan Message
+}
+
+type hubTransport struct {
+	hub   *hub
+	peers sync.Map // IDs known to the node
+}
+
+func (h *hub) transport() *hubTransport {
+	return &hubTransport{hub: h}
+}
+
+func (t *hubTransport) Send(msgs []Message) {
+	t.hub.mu.Lock()
+	defer t.hub.mu.Unlock()
+
+	for _, m := range msgs {
+		if _, ok := t.peers.Load(m.To); !ok {
+			continue
+		}
+		select {
+		case t.hub.queues[m.To] <- m:
+		default:
+		}
+	}
+}
+
+func (t *hubTransport) AddPeer(id uint64, addr string) { t.peers.Store(id, addr) }
+func (t *hubTransport) RemovePeer(id uint64)           { t.peers.Delete(id) }
+
+// listMachine is a StateMachine of the commands applied, in order.
+type listMachine struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (m *listMachine) Apply(data []byte) any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cmds = append(m.cmds, string(data))
+	return len(m.cmds)
+}
+
+func (m *listMachine) Snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return json.Marshal(m.cmds)
+}
+
+func (m *listMachine) Restore(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cmds = nil
+	return json.Unmarshal(data, &m.cmds)
+}
+
+func (m *listMachine) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.cmds)
+}
+
+type runnerCluster struct {
+	t        *testing.T
+	hub      *hub
+	peers    []Peer
+	runners  map[uint64]*Runner
+	machines map[uint64]*listMachine
+	cancel   context.CancelFunc
+	ctx      context.Context
+	wg       sync.WaitGroup
+}
+
+func newRunnerCluster(t *testing.T, ids ...uint64) *runnerCluster {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &runnerCluster{
+		t:        t,
+		hub:      &hub{queues: make(map[uint64]chan Message)},
+		runners:  make(map[uint64]*Runner),
+		machines: make(map[uint64]*listMachine),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	t.Cleanup(func() {
+		c.cancel()
+		c.wg.Wait()
+	})
+
+	for _, id := range ids {
+		c.peers = append(c.peers, Peer{ID: id, Addr: fmt.Sprint(id)})
+	}
+	for _, id := range ids {
+		c.start(Config{ID: id, Peers: c.peers})
+	}
+	return c
+}
+
+func (c *runnerCluster) start(cfg Config) *Runner {
+	c.t.Helper()
+
+	sm := &listMachine{}
+	r, err := NewRunner(cfg, sm, c.hub.transport())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	r.WithTickInterval(2 * time.Millisecond).WithSnapshotEntries(5)
+
+	queue := make(chan Message, 1024)
+	c.hub.mu.Lock()
+	c.hub.queues[cfg.ID] = queue
+	c.hub.mu.Unlock()
+	c.runners[cfg.ID] = r
+	c.machines[cfg.ID] = sm
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		r.Run(c.ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case m := <-queue:
+				r.Step(m)
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (c *runnerCluster) leader() *Runner {
+	c.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, r := range c.runners {
+			if r.Status().Role == Leader {
+				return r
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+// waitApplied waits until every node applied want.
+func (c *runnerCluster) waitApplied(want []string) {
+	c.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for id, sm := range c.machines {
+		for !slices.Equal(sm.list(), want) {
+			if time.Now().After(deadline) {
+				c.t.Fatalf("node %d applied %v want %v", id, sm.list(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestRunnerProposeAndRead(t *testing.T) {
+	c := newRunnerCluster(t, 1, 2, 3)
+	lead := c.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var want []string
+	for i := range 12 { // Past two snapshots
+		cmd := fmt.Sprintf("cmd-%d", i)
+		res, err := lead.Propose(ctx, []byte(cmd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, cmd)
+		if res != len(want) {
+			t.Errorf("got result %v want %d", res, len(want))
+		}
+	}
+	if err := lead.ReadBarrier(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.machines[lead.Status().ID].list(); !slices.Equal(got, want) {
+		t.Errorf("read after the barrier saw %v", got)
+	}
+	c.waitApplied(want)
+
+	for id, r := range c.runners {
+		if r == lead {
+			continue
+		}
+		if _, err := r.Propose(ctx, []byte("x")); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("propose to node %d: got %v want ErrNotLeader", id, err)
+		}
+		if err := r.ReadBarrier(ctx); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("read from node %d: got %v want ErrNotLeader", id, err)
+		}
+	}
+}
+
+func TestRunnerJoin(t *testing.T) {
+	c := newRunnerCluster(t, 1, 2, 3)
+	lead := c.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var want []string
+	for i := range 8 {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		if _, err := lead.Propose(ctx, []byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, cmd)
+	}
+
+	// The log has been compacted, so the new node starts from a snapshot.
+	c.start(Config{ID: 4, Peers: c.peers, Join: true})
+	if err := lead.ProposeConfChange(ctx, ConfChange{Type: AddNode, NodeID: 4, Addr: "4"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lead.Propose(ctx, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	c.waitApplied(append(want, "after"))
+
+	if got := c.runners[4].Status().Members; len(got) != 4 {
+		t.Errorf("new node sees members %v", got)
+	}
+}
+
+func TestRunnerStop(t *testing.T) {
+	c := newRunnerCluster(t, 1)
+	r := c.leader()
+	c.cancel()
+	c.wg.Wait()
+
+	if _, err := r.Propose(context.Background(), []byte("x")); !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v want ErrStopped", err)
+	}
+}
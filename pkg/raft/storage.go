@@ -0,0 +1,349 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Storage persists the state of a node, so that it can restart without
+// forgetting its votes or the entries it acknowledged.
+type Storage interface {
+	// Load returns what has been persisted, for NewNode.
+	Load() (HardState, Snapshot, []Entry, error)
+	// Save persists st and entries, replacing the persisted entries from
+	// entries[0].Index on.
+	Save(st HardState, entries []Entry) error
+	// ApplySnapshot replaces everything persisted with a snapshot
+	// received from the leader.
+	ApplySnapshot(snap Snapshot) error
+	// Compact replaces the entries up to snap.Index with snap.
+	Compact(snap Snapshot) error
+}
+
+// MemoryStorage keeps the state of a node in memory, which is enough for
+// tests and for nodes that rejoin as new members after a restart.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	state    HardState
+	snapshot Snapshot
+	entries  []Entry // From snapshot.Index+1
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Load() (HardState, Snapshot, []Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state, s.snapshot, slices.Clone(s.entries), nil
+}
+
+func (s *MemoryStorage) Save(st HardState, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.save(st, entries)
+	return nil
+}
+
+// save is Save. The caller must hold s.mu.
+func (s *MemoryStorage) save(st HardState, entries []Entry) {
+	s.state = st
+	for _, e := range entries {
+		if e.Index <= s.snapshot.Index {
+			continue
+		}
+		// Entries are contiguous, so an entry replaces the one at its
+		// index and everything after it.
+		s.entries = append(s.entries[:min(uint64(len(s.entries)), e.Index-s.snapshot.Index-1)], e)
+	}
+}
+
+func (s *MemoryStorage) ApplySnapshot(snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = snap
+	s.entries = nil
+	s.state.Commit = max(s.state.Commit, snap.Index)
+	return nil
+}
+
+func (s *MemoryStorage) Compact(snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compact(snap)
+	return nil
+}
+
+// compact is Compact. The caller must hold s.mu.
+func (s *MemoryStorage) compact(snap Snapshot) {
+	drop := min(uint64(len(s.entries)), snap.Index-s.snapshot.Index)
+	s.entries = slices.Clone(s.entries[drop:])
+	s.snapshot = snap
+}
+
+// FileStorage persists the state of a node in a directory: a log of
+// checksummed records, each fsynced before Save returns, and the latest
+// snapshot. The log is rewritten with the entries after the snapshot
+// whenever the snapshot changes.
+type FileStorage struct {
+	mem  *MemoryStorage
+	dir  string
+	file *os.File // The log
+}
+
+// logRecord is a record of the log: the hard state, and entries replacing
+// those from the first one's index on.
+type logRecord struct {
+	State   HardState `json:"state"`
+	Entries []Entry   `json:"entries,omitempty"`
+}
+
+const (
+	logFile      = "raft.log"
+	snapshotFile = "raft.snapshot"
+	// recordHeaderSize is the size of the header of every record of the
+	// log: its length, then its CRC32, both 4 bytes.
+	recordHeaderSize = 8
+)
+
+// OpenFileStorage opens the storage in dir, creating it if needed, and
+// reads what it holds.
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStorage{mem: NewMemoryStorage(), dir: dir}
+
+	snap, err := readSnapshotFile(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	s.mem.snapshot = snap
+	s.mem.state.Commit = snap.Index
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	if err := s.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay reads the log into memory. A torn final record is truncated
+// away; corruption before the end is an error.
+func (s *FileStorage) replay() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	r := bufio.NewReader(io.NewSectionReader(s.file, 0, size))
+
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for offset < size {
+		end := int64(-1)
+		var rec logRecord
+		if _, err := io.ReadFull(r, header); err == nil {
+			end = offset + recordHeaderSize + int64(binary.BigEndian.Uint32(header[0:4]))
+		}
+		if end < 0 || end > size {
+			return s.file.Truncate(offset)
+		}
+
+		payload := make([]byte, end-offset-recordHeaderSize)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return s.file.Truncate(offset)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) || json.Unmarshal(payload, &rec) != nil {
+			if end == size {
+				return s.file.Truncate(offset)
+			}
+			return fmt.Errorf("raft: corrupt log record at offset %d", offset)
+		}
+
+		s.mem.save(rec.State, rec.Entries)
+		offset = end
+	}
+	return nil
+}
+
+func (s *FileStorage) Load() (HardState, Snapshot, []Entry, error) {
+	return s.mem.Load()
+}
+
+func (s *FileStorage) Save(st HardState, entries []Entry) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+
+	if st == s.mem.state && len(entries) == 0 {
+		return nil
+	}
+	if err := appendRecord(s.file, logRecord{State: st, Entries: entries}); err != nil {
+		return err
+	}
+	s.mem.save(st, entries)
+	return nil
+}
+
+func (s *FileStorage) ApplySnapshot(snap Snapshot) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+
+	if err := writeSnapshotFile(filepath.Join(s.dir, snapshotFile), snap); err != nil {
+		return err
+	}
+	s.mem.snapshot = snap
+	s.mem.entries = nil
+	s.mem.state.Commit = max(s.mem.state.Commit, snap.Index)
+	return s.rewrite()
+}
+
+func (s *FileStorage) Compact(snap Snapshot) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+
+	if err := writeSnapshotFile(filepath.Join(s.dir, snapshotFile), snap); err != nil {
+		return err
+	}
+	s.mem.compact(snap)
+	return s.rewrite()
+}
+
+// rewrite replaces the log with a single record of what is in memory.
+// Until the rename, the old log still replays to the same state, since
+// it skips the entries the new snapshot covers. The caller must hold
+// s.mem.mu.
+func (s *FileStorage) rewrite() error {
+	tmp := filepath.Join(s.dir, logFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := appendRecord(f, logRecord{State: s.mem.state, Entries: s.mem.entries}); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, logFile)); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file.Close()
+	s.file = f
+	return nil
+}
+
+// Close closes the log.
+func (s *FileStorage) Close() error {
+	return s.file.Close()
+}
+
+// appendRecord writes rec to the end of f and fsyncs it.
+func appendRecord(f *os.File, rec logRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	if _, err := f.Write(buf); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// snapshotMeta is the first line of a snapshot file. The data of the
+// snapshot follows it as is.
+type snapshotMeta struct {
+	Index   uint64 `json:"index"`
+	Term    uint64 `json:"term"`
+	Members []Peer `json:"members"`
+}
+
+func readSnapshotFile(filename string) (Snapshot, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, nil
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	line, body, ok := bytes.Cut(data, []byte("\n"))
+	var meta snapshotMeta
+	if !ok || json.Unmarshal(line, &meta) != nil {
+		return Snapshot{}, fmt.Errorf("raft: corrupt snapshot %s", filename)
+	}
+	return Snapshot{Index: meta.Index, Term: meta.Term, Members: meta.Members, Data: body}, nil
+}
+
+// writeSnapshotFile atomically replaces filename with snap.
+func writeSnapshotFile(filename string, snap Snapshot) error {
+	line, err := json.Marshal(snapshotMeta{Index: snap.Index, Term: snap.Term, Members: snap.Members})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once the rename has succeeded
+
+	data := append(append(line, '\n'), snap.Data...)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// syncDir persists renames in dir.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
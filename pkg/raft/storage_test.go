@@ -0,0 +1,113 @@
+package raft
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ents := []Entry{{Term: 1, Index: 1}, {Term: 1, Index: 2, Data: []byte("a")}, {Term: 1, Index: 3, Data: []byte("b")}}
+	s.Save(HardState{Term: 1, Vote: 2, Commit: 1}, ents)
+	// A new leader replaces the entries from index 3 on.
+	s.Save(HardState{Term: 2, Vote: 3, Commit: 2}, []Entry{{Term: 2, Index: 3, Data: []byte("c")}})
+	s.Close()
+
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	st, _, got, _ := s.Load()
+	if st != (HardState{Term: 2, Vote: 3, Commit: 2}) {
+		t.Errorf("got state %+v", st)
+	}
+	want := []Entry{ents[0], ents[1], {Term: 2, Index: 3, Data: []byte("c")}}
+	if !slices.EqualFunc(got, want, equalEntry) {
+		t.Errorf("got entries %+v want %+v", got, want)
+	}
+}
+
+func TestFileStorageCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ents []Entry
+	for i := uint64(1); i <= 5; i++ {
+		ents = append(ents, Entry{Term: 1, Index: i})
+	}
+	s.Save(HardState{Term: 1, Commit: 5}, ents)
+	snap := Snapshot{Index: 3, Term: 1, Members: []Peer{{ID: 1, Addr: "a"}}, Data: []byte("state\nwith lines")}
+	if err := s.Compact(snap); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, gotSnap, got, _ := s.Load()
+	if gotSnap.Index != 3 || gotSnap.Term != 1 || string(gotSnap.Data) != string(snap.Data) || len(gotSnap.Members) != 1 {
+		t.Errorf("got snapshot %+v", gotSnap)
+	}
+	if !slices.EqualFunc(got, ents[3:], equalEntry) {
+		t.Errorf("got entries %+v want %+v", got, ents[3:])
+	}
+}
+
+func TestFileStorageTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Save(HardState{Term: 1}, []Entry{{Term: 1, Index: 1}})
+	s.Save(HardState{Term: 1}, []Entry{{Term: 1, Index: 2}})
+	s.Close()
+
+	// A crash in the middle of the last write leaves part of it.
+	filename := filepath.Join(dir, logFile)
+	info, _ := os.Stat(filename)
+	if err := os.Truncate(filename, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, got, _ := s.Load()
+	if len(got) != 1 {
+		t.Fatalf("got entries %+v want the first", got)
+	}
+
+	// The torn record is gone, so writes after it replay too.
+	s.Save(HardState{Term: 2}, []Entry{{Term: 2, Index: 2}})
+	s.Close()
+	s, err = OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if st, _, got, _ := s.Load(); st.Term != 2 || len(got) != 2 {
+		t.Errorf("got state %+v and entries %+v", st, got)
+	}
+}
+
+func equalEntry(a, b Entry) bool {
+	return a.Term == b.Term && a.Index == b.Index && a.Type == b.Type && string(a.Data) == string(b.Data)
+}
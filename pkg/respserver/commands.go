@@ -0,0 +1,386 @@
+package respserver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// command is a RESP command handler. args includes the command name.
+type command struct {
+	handler func(s *Server, w *writer, args []string)
+	// arity is the exact number of arguments, including the command
+	// name, or the negated minimum for variadic commands.
+	arity int
+}
+
+var commands = map[string]command{
+	"PING":    {(*Server).ping, -1},
+	"GET":     {(*Server).get, 2},
+	"SET":     {(*Server).set, -3},
+	"DEL":     {(*Server).del, -2},
+	"EXISTS":  {(*Server).exists, -2},
+	"KEYS":    {(*Server).keys, 2},
+	"TTL":     {(*Server).ttl, 2},
+	"PTTL":    {(*Server).pttl, 2},
+	"EXPIRE":  {(*Server).expire, 3},
+	"PERSIST": {(*Server).persist, 2},
+	"DBSIZE":  {(*Server).dbsize, 1},
+	"HELLO":   {(*Server).hello, -1},
+	"COMMAND": {(*Server).command, -1},
+	"SELECT":  {(*Server).selectDB, 2},
+	"CLIENT":  {(*Server).client, -2},
+	"QUIT":    {(*Server).quit, 1},
+
+	"TYPE":     {(*Server).typeOf, 2},
+	"INCR":     {(*Server).incr, 2},
+	"DECR":     {(*Server).decr, 2},
+	"INCRBY":   {(*Server).incrby, 3},
+	"DECRBY":   {(*Server).decrby, 3},
+	"LPUSH":    {(*Server).lpush, -3},
+	"RPUSH":    {(*Server).rpush, -3},
+	"LPOP":     {(*Server).lpop, -2},
+	"RPOP":     {(*Server).rpop, -2},
+	"LRANGE":   {(*Server).lrange, 4},
+	"HSET":     {(*Server).hset, -4},
+	"HGET":     {(*Server).hget, 3},
+	"HGETALL":  {(*Server).hgetall, 2},
+	"HDEL":     {(*Server).hdel, -3},
+	"SADD":     {(*Server).sadd, -3},
+	"SREM":     {(*Server).srem, -3},
+	"SMEMBERS": {(*Server).smembers, 2},
+}
+
+// dispatch runs the command in args for client, the address it is sent
+// from.
+func (s *Server) dispatch(w *writer, client string, args []string) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		w.err("ERR unknown command '" + args[0] + "'")
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.err("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return
+	}
+	if !s.allow(w, client, name, args) {
+		return
+	}
+
+	cmd.handler(s, w, args)
+}
+
+// storeError writes the reply for an error returned by the store.
+func storeError(w *writer, err error) {
+	if errors.Is(err, kvstore.ErrStoreFull) {
+		w.err("OOM command not allowed when the store is full")
+		return
+	}
+	w.err("ERR " + err.Error())
+}
+
+// expirer returns the store as a kvstore.Expirer, replying with an error
+// if it is not one.
+func (s *Server) expirer(w *writer) (kvstore.Expirer, bool) {
+	expirer, ok := s.store.(kvstore.Expirer)
+	if !ok {
+		w.err("ERR TTLs are not supported by this store")
+	}
+	return expirer, ok
+}
+
+// has reports whether key holds a value of any type: Get sees only
+// strings, not the lists, hashes and sets of a kvstore.TypedStore.
+func (s *Server) has(key string) bool {
+	if typed, ok := s.store.(kvstore.TypedStore); ok {
+		return typed.Type(key) != ""
+	}
+	_, exists := s.store.Get(key)
+	return exists
+}
+
+func (s *Server) ping(w *writer, args []string) {
+	switch len(args) {
+	case 1:
+		w.simple("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		w.err("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) get(w *writer, args []string) {
+	val, exists := s.store.Get(args[1])
+	if !exists {
+		if typed, ok := s.store.(kvstore.TypedStore); ok && typed.Type(args[1]) != "" {
+			typedError(w, kvstore.ErrWrongType)
+			return
+		}
+		w.null()
+		return
+	}
+	w.bulk(val)
+}
+
+// set implements SET key value [EX seconds | PX milliseconds] [NX | XX].
+func (s *Server) set(w *writer, args []string) {
+	key, value := args[1], args[2]
+
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if ttl != 0 || i+1 >= len(args) {
+				w.err("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				w.err("ERR invalid expire time in 'set' command")
+				return
+			}
+			if opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+		default:
+			w.err("ERR syntax error")
+			return
+		}
+	}
+	if nx && xx {
+		w.err("ERR syntax error")
+		return
+	}
+
+	var err error
+	versioner, atomic := s.store.(kvstore.Versioner)
+	switch {
+	case nx && atomic:
+		_, err = versioner.SetIfAbsent(key, value, ttl)
+	case xx && atomic:
+		_, err = versioner.SetIfPresent(key, value, ttl)
+	case nx || xx:
+		// Without a Versioner, NX and XX are checked before the write rather
+		// than atomically with it, so two racing clients can both succeed.
+		if nx == s.has(key) {
+			w.null()
+			return
+		}
+		fallthrough
+	default:
+		err = s.store.SetWithTTL(key, value, ttl)
+	}
+
+	if errors.Is(err, kvstore.ErrKeyExists) || errors.Is(err, kvstore.ErrKeyNotFound) {
+		w.null()
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	w.simple("OK")
+}
+
+func (s *Server) del(w *writer, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if !s.has(key) {
+			continue
+		}
+		if err := s.store.Delete(key); err != nil {
+			storeError(w, err)
+			return
+		}
+		n++
+	}
+	w.integer(n)
+}
+
+func (s *Server) exists(w *writer, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.has(key) {
+			n++
+		}
+	}
+	w.integer(n)
+}
+
+func (s *Server) keys(w *writer, args []string) {
+	matched := []string{}
+	for _, key := range s.store.Keys() {
+		if kvstore.MatchPattern(args[1], key) {
+			matched = append(matched, key)
+		}
+	}
+	w.bulkArray(matched)
+}
+
+// remaining writes the TTL of key in units of unit: -2 if the key does not
+// exist and -1 if it has no TTL.
+func (s *Server) remaining(w *writer, key string, unit time.Duration) {
+	expirer, ok := s.expirer(w)
+	if !ok {
+		return
+	}
+
+	ttl, exists := expirer.TTL(key)
+	switch {
+	case !exists:
+		w.integer(-2)
+	case ttl == 0:
+		w.integer(-1)
+	default:
+		w.integer(int64((ttl + unit/2) / unit))
+	}
+}
+
+func (s *Server) ttl(w *writer, args []string) {
+	s.remaining(w, args[1], time.Second)
+}
+
+func (s *Server) pttl(w *writer, args []string) {
+	s.remaining(w, args[1], time.Millisecond)
+}
+
+func (s *Server) expire(w *writer, args []string) {
+	seconds, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		w.err("ERR value is not an integer or out of range")
+		return
+	}
+
+	expirer, ok := s.expirer(w)
+	if !ok {
+		return
+	}
+
+	// Like Redis, a non-positive TTL deletes the key straight away.
+	if seconds <= 0 {
+		if !s.has(args[1]) {
+			w.integer(0)
+			return
+		}
+		if err := s.store.Delete(args[1]); err != nil {
+			storeError(w, err)
+			return
+		}
+		w.integer(1)
+		return
+	}
+
+	found, err := expirer.Expire(args[1], time.Duration(seconds)*time.Second)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if !found {
+		w.integer(0)
+		return
+	}
+	w.integer(1)
+}
+
+func (s *Server) persist(w *writer, args []string) {
+	expirer, ok := s.expirer(w)
+	if !ok {
+		return
+	}
+
+	// PERSIST replies 0 for keys that exist but have no TTL to remove.
+	if ttl, exists := expirer.TTL(args[1]); !exists || ttl == 0 {
+		w.integer(0)
+		return
+	}
+
+	found, err := expirer.Persist(args[1])
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if !found {
+		w.integer(0)
+		return
+	}
+	w.integer(1)
+}
+
+func (s *Server) dbsize(w *writer, args []string) {
+	w.integer(int64(len(s.store.Keys())))
+}
+
+// hello implements HELLO [protover], switching the connection to RESP3
+// when asked to.
+func (s *Server) hello(w *writer, args []string) {
+	proto := 2
+	if w.resp3 {
+		proto = 3
+	}
+
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.err("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			w.err("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+	}
+	w.resp3 = proto == 3
+
+	w.mapHeader(6)
+	w.bulk("server")
+	w.bulk("kvstore")
+	w.bulk("version")
+	w.bulk("1.0.0")
+	w.bulk("proto")
+	w.integer(int64(proto))
+	w.bulk("mode")
+	w.bulk("standalone")
+	w.bulk("role")
+	w.bulk("master")
+	w.bulk("modules")
+	w.arrayHeader(0)
+}
+
+// command replies to COMMAND and its subcommands with an empty list,
+// which is enough for redis-cli and client libraries to carry on.
+func (s *Server) command(w *writer, args []string) {
+	w.arrayHeader(0)
+}
+
+func (s *Server) selectDB(w *writer, args []string) {
+	if args[1] != "0" {
+		w.err("ERR DB index is out of range")
+		return
+	}
+	w.simple("OK")
+}
+
+// client accepts CLIENT SETNAME, SETINFO and friends, which client
+// libraries send on connect, without acting on them.
+func (s *Server) client(w *writer, args []string) {
+	w.simple("OK")
+}
+
+func (s *Server) quit(w *writer, args []string) {
+	w.simple("OK")
+}
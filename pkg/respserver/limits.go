@@ -0,0 +1,105 @@
+package respserver
+
+import (
+	"math"
+	"strconv"
+
+	"golang-learning/pkg/kvserver"
+)
+
+// WithLimits applies l to every command, as kvserver.Server.WithLimits
+// does to every request, so that a client cannot get around the limits of
+// the HTTP API by speaking RESP instead. MaxBodyBytes bounds the total
+// size of the arguments of a command. Clients are told apart by their IP
+// address.
+func (s *Server) WithLimits(l kvserver.Limits) *Server {
+	s.limits = l
+	s.limiter = nil
+	if l.Rate > 0 {
+		s.limiter = kvserver.NewRateLimiter(l.Rate, l.Burst)
+	}
+	return s
+}
+
+// keyless lists the commands whose arguments are not keys.
+var keyless = map[string]bool{
+	"PING":    true,
+	"DBSIZE":  true,
+	"HELLO":   true,
+	"COMMAND": true,
+	"SELECT":  true,
+	"CLIENT":  true,
+	"QUIT":    true,
+}
+
+// commandValues returns the values that each command stores, by name, to
+// check against MaxValueBytes.
+var commandValues = map[string]func(args []string) []string{
+	"SET":   func(args []string) []string { return args[2:3] },
+	"LPUSH": func(args []string) []string { return args[2:] },
+	"RPUSH": func(args []string) []string { return args[2:] },
+	"SADD":  func(args []string) []string { return args[2:] },
+	"HSET":  hsetValues,
+}
+
+func hsetValues(args []string) []string {
+	var values []string
+	for i := 3; i < len(args); i += 2 {
+		values = append(values, args[i])
+	}
+	return values
+}
+
+// commandKeys returns the keys that the command name is sent for.
+func commandKeys(name string, args []string) []string {
+	switch {
+	case keyless[name]:
+		return nil
+	case name == "DEL" || name == "EXISTS":
+		return args[1:]
+	default:
+		return args[1:2]
+	}
+}
+
+// allow reports whether client may send the command name with args, and
+// otherwise writes the error refusing it.
+func (s *Server) allow(w *writer, client string, name string, args []string) bool {
+	if s.limiter != nil {
+		if ok, wait := s.limiter.Allow(client); !ok {
+			retry := max(1, int(math.Ceil(wait.Seconds())))
+			w.err("ERR too many requests, retry in " + strconv.Itoa(retry) + "s")
+			return false
+		}
+	}
+
+	if s.limits.MaxBodyBytes > 0 {
+		var size int64
+		for _, arg := range args {
+			size += int64(len(arg))
+		}
+		if size > s.limits.MaxBodyBytes {
+			w.err("ERR command too large")
+			return false
+		}
+	}
+
+	if s.limits.MaxKeyBytes > 0 {
+		for _, key := range commandKeys(name, args) {
+			if len(key) > s.limits.MaxKeyBytes {
+				w.err("ERR key too large")
+				return false
+			}
+		}
+	}
+
+	if values := commandValues[name]; s.limits.MaxValueBytes > 0 && values != nil {
+		for _, v := range values(args) {
+			if len(v) > s.limits.MaxValueBytes {
+				w.err("ERR value too large")
+				return false
+			}
+		}
+	}
+	return true
+}
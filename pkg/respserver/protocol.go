@@ -0,0 +1,144 @@
+package respserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxBulkLen caps the size of a single bulk string in a request,
+// matching Redis's default proto-max-bulk-len.
+const maxBulkLen = 512 << 20
+
+// maxLineLen caps the length of an inline command or a length line,
+// matching Redis's limit on inline requests.
+const maxLineLen = 64 << 10
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand reads one request from r: either a RESP array of bulk
+// strings, as sent by client libraries, or an inline command, as typed
+// into telnet.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		// The buffer grows as the data arrives rather than to the
+		// length the client claims, which it may never send.
+		var b bytes.Buffer
+		if _, err := io.CopyN(&b, r, int64(size)+2); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		buf := b.Bytes()
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line terminated by "\r\n" (or a bare "\n") and
+// returns it without the terminator. Lines longer than maxLineLen are a
+// protocol error, so a client cannot make the server buffer without end.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineLen+2 {
+			return "", fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return "", err
+		}
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+}
+
+// writer encodes replies in RESP2, or RESP3 once the client has
+// negotiated it with HELLO.
+type writer struct {
+	*bufio.Writer
+	resp3 bool
+}
+
+func (w *writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) err(msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	if w.resp3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) arrayHeader(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *writer) mapHeader(n int) {
+	if w.resp3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+	w.arrayHeader(n * 2)
+}
+
+func (w *writer) bulkArray(items []string) {
+	w.arrayHeader(len(items))
+	for _, s := range items {
+		w.bulk(s)
+	}
+}
@@ -0,0 +1,122 @@
+package respserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "Multibulk",
+			input: "*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+			want:  []string{"SET", "foo", "bar"},
+		},
+		{
+			name:  "Binary safe bulk",
+			input: "*2\r\n$3\r\nGET\r\n$5\r\na\r\nb\x00\r\n",
+			want:  []string{"GET", "a\r\nb\x00"},
+		},
+		{
+			name:  "Inline",
+			input: "PING hello\r\n",
+			want:  []string{"PING", "hello"},
+		},
+		{
+			name:  "Inline with bare newline",
+			input: "DBSIZE\n",
+			want:  []string{"DBSIZE"},
+		},
+		{
+			name:    "Bad multibulk length",
+			input:   "*x\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "Missing bulk marker",
+			input:   "*1\r\n:1\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "Bulk not terminated",
+			input:   "*1\r\n$3\r\nfooXX",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "Inline too long",
+			input:   strings.Repeat("x", maxLineLen+1) + "\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "Length line too long",
+			input:   "*1\r\n$" + strings.Repeat("0", maxLineLen) + "\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:  "Inline at the limit",
+			input: "PING " + strings.Repeat("x", maxLineLen-5) + "\r\n",
+			want:  []string{"PING", strings.Repeat("x", maxLineLen-5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCommand(bufio.NewReader(strings.NewReader(tt.input)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCommandAllocatesAsBulkArrives(t *testing.T) {
+	input := "*1\r\n$" + strconv.Itoa(maxBulkLen) + "\r\nabc"
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readCommand(bufio.NewReader(strings.NewReader(input)))
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v want %v", err, io.ErrUnexpectedEOF)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for a bulk string of 3", n)
+	}
+}
+
+func TestWriterNull(t *testing.T) {
+	tests := []struct {
+		resp3 bool
+		want  string
+	}{
+		{resp3: false, want: "$-1\r\n"},
+		{resp3: true, want: "_\r\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := &writer{Writer: bufio.NewWriter(&buf), resp3: tt.resp3}
+		w.null()
+		w.Flush()
+
+		if buf.String() != tt.want {
+			t.Errorf("resp3=%v: got %q want %q", tt.resp3, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package respserver exposes a kvstore.Store over the Redis serialization
+// protocol (RESP2 and RESP3), so redis-cli and Redis client libraries can
+// talk to it.
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"golang-learning/pkg/kvserver"
+	"golang-learning/pkg/kvstore"
+)
+
+var ErrServerClosed = errors.New("respserver: Server closed")
+
+type Server struct {
+	store   kvstore.Store
+	limits  kvserver.Limits
+	limiter *kvserver.RateLimiter // Nil without a rate limit
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(store kvstore.Store) *Server {
+	return &Server{
+		store: store,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called,
+// and then returns ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		// Close may have run since Accept returned, in which case it
+		// neither closed conn nor waits for it.
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener, closes every open connection and waits for
+// their handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := &writer{Writer: bufio.NewWriter(conn)}
+	client := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	for {
+		args, err := readCommand(r)
+		if errors.Is(err, errProtocol) {
+			w.err("ERR " + err.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Println("resp: read:", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.EqualFold(args[0], "QUIT")
+		s.dispatch(w, client, args)
+
+		// Replies to pipelined commands are batched into one write.
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-learning/pkg/kvserver"
+	"golang-learning/pkg/kvstore"
+)
+
+// respError is a RESP error reply as decoded by readReply.
+type respError string
+
+// readReply decodes one RESP2 or RESP3 reply into Go values:
+// string, respError, int64, nil, []any or map[string]any.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := r.Read(buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case '%':
+		n, _ := strconv.Atoi(line[1:])
+		m := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			k, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[k.(string)], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown reply %q", line)
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) do(args ...string) any {
+	c.t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+
+	reply, err := readReply(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return reply
+}
+
+// newTestServer serves store on a loopback port and returns a connected client.
+func newTestServer(t *testing.T, store kvstore.Store) *client {
+	t.Helper()
+	return serve(t, NewServer(store))
+}
+
+// serve runs server on a loopback port and returns a connected client.
+func serve(t *testing.T, server *Server) *client {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestCommands(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"ping", "hello"}, "hello"},
+		{[]string{"GET", "foo"}, nil},
+		{[]string{"SET", "foo", "bar"}, "OK"},
+		{[]string{"GET", "foo"}, "bar"},
+		{[]string{"SET", "foo", "baz", "NX"}, nil},
+		{[]string{"SET", "new", "value", "XX"}, nil},
+		{[]string{"SET", "foo", "baz", "XX"}, "OK"},
+		{[]string{"GET", "foo"}, "baz"},
+		{[]string{"SET", "foo", "bar", "NX", "XX"}, respError("ERR syntax error")},
+		{[]string{"SET", "foo", "bar", "EX", "0"}, respError("ERR invalid expire time in 'set' command")},
+		{[]string{"EXISTS", "foo", "new", "foo"}, int64(2)},
+		{[]string{"TTL", "foo"}, int64(-1)},
+		{[]string{"TTL", "missing"}, int64(-2)},
+		{[]string{"EXPIRE", "foo", "100"}, int64(1)},
+		{[]string{"TTL", "foo"}, int64(100)},
+		{[]string{"PERSIST", "foo"}, int64(1)},
+		{[]string{"PERSIST", "foo"}, int64(0)},
+		{[]string{"SET", "session", "x", "PX", "60000"}, "OK"},
+		{[]string{"DBSIZE"}, int64(2)},
+		{[]string{"DEL", "foo", "missing"}, int64(1)},
+		{[]string{"DBSIZE"}, int64(1)},
+		{[]string{"GET"}, respError("ERR wrong number of arguments for 'get' command")},
+		{[]string{"NOPE"}, respError("ERR unknown command 'NOPE'")},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v want %#v", tt.args, got, tt.want)
+		}
+	}
+
+	pttl, ok := c.do("PTTL", "session").(int64)
+	if !ok || pttl <= 0 || pttl > 60000 {
+		t.Errorf("got PTTL %v, want within (0, 60000]", pttl)
+	}
+}
+
+func TestTypedCommands(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"INCR", "hits"}, int64(1)},
+		{[]string{"INCRBY", "hits", "10"}, int64(11)},
+		{[]string{"DECRBY", "hits", "3"}, int64(8)},
+		{[]string{"DECR", "hits"}, int64(7)},
+		{[]string{"GET", "hits"}, "7"},
+		{[]string{"INCRBY", "hits", "x"}, respError("ERR value is not an integer or out of range")},
+		{[]string{"RPUSH", "queue", "a", "b", "c"}, int64(3)},
+		{[]string{"LPUSH", "queue", "z"}, int64(4)},
+		{[]string{"LRANGE", "queue", "0", "-1"}, []any{"z", "a", "b", "c"}},
+		{[]string{"LPOP", "queue"}, "z"},
+		{[]string{"RPOP", "queue", "2"}, []any{"c", "b"}},
+		{[]string{"LPOP", "missing"}, nil},
+		{[]string{"HSET", "user", "name", "gopher", "lang", "go"}, int64(2)},
+		{[]string{"HGET", "user", "name"}, "gopher"},
+		{[]string{"HGET", "user", "missing"}, nil},
+		{[]string{"HGETALL", "user"}, []any{"lang", "go", "name", "gopher"}},
+		{[]string{"HDEL", "user", "lang", "missing"}, int64(1)},
+		{[]string{"HSET", "user", "name"}, respError("ERR wrong number of arguments for 'hset' command")},
+		{[]string{"SADD", "tags", "go", "kv", "go"}, int64(2)},
+		{[]string{"SREM", "tags", "kv"}, int64(1)},
+		{[]string{"SMEMBERS", "tags"}, []any{"go"}},
+		{[]string{"TYPE", "queue"}, "list"},
+		{[]string{"TYPE", "user"}, "hash"},
+		{[]string{"TYPE", "tags"}, "set"},
+		{[]string{"TYPE", "hits"}, "string"},
+		{[]string{"TYPE", "missing"}, "none"},
+		{[]string{"GET", "queue"}, respError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"SADD", "queue", "x"}, respError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]string{"INCR", "user"}, respError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v want %#v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestKeyCommandsOnTypedKeys(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	c := newTestServer(t, store)
+
+	store.RPush("queue", "a")
+	store.HSet("user", map[string]string{"name": "gopher"})
+	store.SAdd("tags", "go")
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"EXISTS", "queue", "user", "tags", "missing"}, int64(3)},
+		{[]string{"DEL", "queue", "missing"}, int64(1)},
+		{[]string{"EXPIRE", "user", "0"}, int64(1)},
+		{[]string{"EXISTS", "queue", "user"}, int64(0)},
+		{[]string{"TYPE", "tags"}, "set"},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v want %#v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSetWithExpiry(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	c.do("SET", "foo", "bar", "PX", "50")
+	time.Sleep(100 * time.Millisecond)
+
+	if got := c.do("GET", "foo"); got != nil {
+		t.Errorf("expected foo to expire, got %v", got)
+	}
+}
+
+func TestKeysPattern(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	c.do("SET", "user:1", "a")
+	c.do("SET", "user:2", "b")
+	c.do("SET", "session:1", "c")
+
+	reply := c.do("KEYS", "user:*").([]any)
+	var got []string
+	for _, k := range reply {
+		got = append(got, k.(string))
+	}
+	sort.Strings(got)
+
+	if want := []string{"user:1", "user:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestHelloNegotiatesRESP3(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	if got := c.do("GET", "missing"); got != nil {
+		t.Fatalf("got %v want nil", got)
+	}
+
+	reply, ok := c.do("HELLO", "3").(map[string]any)
+	if !ok {
+		t.Fatalf("expected a RESP3 map reply")
+	}
+	if reply["proto"] != int64(3) {
+		t.Errorf("got proto %v want 3", reply["proto"])
+	}
+
+	// Nulls are now sent as RESP3 nulls.
+	c.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n"))
+	line, err := readLine(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "_" {
+		t.Errorf("got %q want RESP3 null", line)
+	}
+
+	if got := c.do("HELLO", "4"); got != respError("NOPROTO unsupported protocol version") {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestInlineAndPipelinedCommands(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore())
+
+	c.conn.Write([]byte("SET foo bar\r\nGET foo\r\nPING\r\n"))
+
+	for _, want := range []any{"OK", "bar", "PONG"} {
+		got, err := readReply(c.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %v want %v", got, want)
+		}
+	}
+}
+
+func TestStoreFull(t *testing.T) {
+	c := newTestServer(t, kvstore.NewMemoryStore().WithMaxEntries(1))
+
+	c.do("SET", "a", "1")
+	got, ok := c.do("SET", "b", "2").(respError)
+	if !ok || !strings.HasPrefix(string(got), "OOM") {
+		t.Errorf("got %v, want an OOM error", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	c := serve(t, NewServer(store).WithLimits(kvserver.Limits{MaxBodyBytes: 64, MaxKeyBytes: 8, MaxValueBytes: 16}))
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"Key", []string{"GET", "a-very-long-key"}, "ERR key too large"},
+		{"Second key", []string{"DEL", "k", "a-very-long-key"}, "ERR key too large"},
+		{"Value", []string{"SET", "k", strings.Repeat("v", 17)}, "ERR value too large"},
+		{"Pushed value", []string{"RPUSH", "l", "v", strings.Repeat("v", 17)}, "ERR value too large"},
+		{"Hash value", []string{"HSET", "h", "f", "v", "g", strings.Repeat("v", 17)}, "ERR value too large"},
+		{"Command", []string{"SADD", "s", strings.Repeat("a", 16), strings.Repeat("b", 16), strings.Repeat("c", 16), strings.Repeat("d", 16)}, "ERR command too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.do(tt.args...); got != respError(tt.want) {
+				t.Errorf("got %v want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := c.do("SET", "k", strings.Repeat("v", 16)); got != "OK" {
+		t.Errorf("got %v for a value at the limit", got)
+	}
+	if got := store.Keys(); !reflect.DeepEqual(got, []string{"k"}) {
+		t.Errorf("got keys %v, want only the command within the limits applied", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := serve(t, NewServer(kvstore.NewMemoryStore()).WithLimits(kvserver.Limits{Rate: 0.001, Burst: 2}))
+
+	c.do("PING")
+	c.do("PING")
+	got, ok := c.do("PING").(respError)
+	if !ok || !strings.HasPrefix(string(got), "ERR too many requests") {
+		t.Errorf("got %v, want a rate limit error", got)
+	}
+}
+
+func TestCloseStopsServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(kvstore.NewMemoryStore())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	server.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrServerClosed) {
+			t.Errorf("got %v want %v", err, ErrServerClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
+
+// lateListener hands Serve a connection only after Close has returned,
+// as the kernel may when a client connects while the server shuts down.
+type lateListener struct {
+	accepting chan struct{}
+	conns     chan net.Conn
+}
+
+func (l *lateListener) Accept() (net.Conn, error) {
+	l.accepting <- struct{}{}
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *lateListener) Close() error   { return nil }
+func (l *lateListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestCloseRefusesLateConnection(t *testing.T) {
+	l := &lateListener{accepting: make(chan struct{}, 1), conns: make(chan net.Conn, 1)}
+	server := NewServer(kvstore.NewMemoryStore())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+
+	<-l.accepting
+	server.Close()
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	l.conns <- conn
+	close(l.conns)
+
+	if err := <-done; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("got %v want %v", err, ErrServerClosed)
+	}
+	client.SetDeadline(time.Now().Add(time.Second))
+	if _, err := client.Write([]byte("PING\r\n")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("got %v writing to a connection accepted after Close, want it closed", err)
+	}
+}
+
+func TestSetConditionsWithoutVersioner(t *testing.T) {
+	// Embedding only the Store interface hides the Versioner methods.
+	c := newTestServer(t, struct{ kvstore.Store }{kvstore.NewMemoryStore()})
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"SET", "foo", "1", "XX"}, nil},
+		{[]string{"SET", "foo", "1", "NX"}, "OK"},
+		{[]string{"SET", "foo", "2", "NX"}, nil},
+		{[]string{"SET", "foo", "2", "XX"}, "OK"},
+		{[]string{"GET", "foo"}, "2"},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v want %#v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSetNXOnTypedKeyWithoutVersioner(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	store.SAdd("tags", "go")
+	c := newTestServer(t, struct {
+		kvstore.Store
+		kvstore.TypedStore
+	}{store, store})
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"SET", "tags", "x", "NX"}, nil},
+		{[]string{"TYPE", "tags"}, "set"},
+		{[]string{"SET", "tags", "x", "XX"}, "OK"},
+		{[]string{"GET", "tags"}, "x"},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v want %#v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package respserver
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"golang-learning/pkg/kvstore"
+)
+
+// typed returns the store as a kvstore.TypedStore, replying with an error
+// if it is not one.
+func (s *Server) typed(w *writer) (kvstore.TypedStore, bool) {
+	typed, ok := s.store.(kvstore.TypedStore)
+	if !ok {
+		w.err("ERR typed values are not supported by this store")
+	}
+	return typed, ok
+}
+
+// typedError writes the reply for an error returned by a TypedStore.
+func typedError(w *writer, err error) {
+	switch {
+	case errors.Is(err, kvstore.ErrWrongType):
+		w.err("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case errors.Is(err, kvstore.ErrNotInteger):
+		w.err("ERR value is not an integer or out of range")
+	default:
+		storeError(w, err)
+	}
+}
+
+// typeOf implements TYPE key.
+func (s *Server) typeOf(w *writer, args []string) {
+	typed, ok := s.store.(kvstore.TypedStore)
+	if !ok {
+		if _, exists := s.store.Get(args[1]); exists {
+			w.simple(kvstore.TypeString)
+			return
+		}
+		w.simple("none")
+		return
+	}
+
+	typ := typed.Type(args[1])
+	if typ == "" {
+		typ = "none"
+	}
+	w.simple(typ)
+}
+
+func (s *Server) incr(w *writer, args []string) {
+	s.incrBy(w, args[1], 1)
+}
+
+func (s *Server) decr(w *writer, args []string) {
+	s.incrBy(w, args[1], -1)
+}
+
+func (s *Server) incrby(w *writer, args []string) {
+	if delta, ok := parseDelta(w, args[2]); ok {
+		s.incrBy(w, args[1], delta)
+	}
+}
+
+func (s *Server) decrby(w *writer, args []string) {
+	if delta, ok := parseDelta(w, args[2]); ok {
+		s.incrBy(w, args[1], -delta)
+	}
+}
+
+func parseDelta(w *writer, arg string) (int64, bool) {
+	delta, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		w.err("ERR value is not an integer or out of range")
+		return 0, false
+	}
+	return delta, true
+}
+
+func (s *Server) incrBy(w *writer, key string, delta int64) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	n, err := typed.IncrBy(key, delta)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(n)
+}
+
+func (s *Server) lpush(w *writer, args []string) {
+	s.push(w, args, true)
+}
+
+func (s *Server) rpush(w *writer, args []string) {
+	s.push(w, args, false)
+}
+
+func (s *Server) push(w *writer, args []string, head bool) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	push := typed.RPush
+	if head {
+		push = typed.LPush
+	}
+	n, err := push(args[1], args[2:]...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(int64(n))
+}
+
+func (s *Server) lpop(w *writer, args []string) {
+	s.pop(w, args, true)
+}
+
+func (s *Server) rpop(w *writer, args []string) {
+	s.pop(w, args, false)
+}
+
+// pop implements LPOP and RPOP key [count]. Without a count it replies
+// with a single element, with one it replies with an array.
+func (s *Server) pop(w *writer, args []string, head bool) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+	if len(args) > 3 {
+		w.err("ERR syntax error")
+		return
+	}
+
+	count := 1
+	if len(args) == 3 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 {
+			w.err("ERR value is out of range, must be positive")
+			return
+		}
+		count = n
+	}
+
+	pop := typed.RPop
+	if head {
+		pop = typed.LPop
+	}
+
+	var values []string
+	var err error
+	if count > 0 {
+		values, err = pop(args[1], count)
+	}
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	switch {
+	case len(args) == 3 && len(values) == 0:
+		w.null()
+	case len(args) == 3:
+		w.bulkArray(values)
+	case len(values) == 0:
+		w.null()
+	default:
+		w.bulk(values[0])
+	}
+}
+
+// lrange implements LRANGE key start stop.
+func (s *Server) lrange(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		w.err("ERR value is not an integer or out of range")
+		return
+	}
+
+	values, err := typed.LRange(args[1], start, stop)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.bulkArray(values)
+}
+
+// hset implements HSET key field value [field value ...].
+func (s *Server) hset(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+	if len(args)%2 != 0 {
+		w.err("ERR wrong number of arguments for 'hset' command")
+		return
+	}
+
+	fields := make(map[string]string, (len(args)-2)/2)
+	for i := 2; i < len(args); i += 2 {
+		fields[args[i]] = args[i+1]
+	}
+
+	n, err := typed.HSet(args[1], fields)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(int64(n))
+}
+
+func (s *Server) hget(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	v, exists, err := typed.HGet(args[1], args[2])
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	if !exists {
+		w.null()
+		return
+	}
+	w.bulk(v)
+}
+
+// hgetall replies with the fields of a hash sorted by name.
+func (s *Server) hgetall(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	fields, err := typed.HGetAll(args[1])
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+
+	w.mapHeader(len(names))
+	for _, f := range names {
+		w.bulk(f)
+		w.bulk(fields[f])
+	}
+}
+
+func (s *Server) hdel(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	n, err := typed.HDel(args[1], args[2:]...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(int64(n))
+}
+
+func (s *Server) sadd(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	n, err := typed.SAdd(args[1], args[2:]...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(int64(n))
+}
+
+func (s *Server) srem(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	n, err := typed.SRem(args[1], args[2:]...)
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.integer(int64(n))
+}
+
+func (s *Server) smembers(w *writer, args []string) {
+	typed, ok := s.typed(w)
+	if !ok {
+		return
+	}
+
+	members, err := typed.SMembers(args[1])
+	if err != nil {
+		typedError(w, err)
+		return
+	}
+	w.bulkArray(members)
+}